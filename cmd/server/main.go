@@ -2,22 +2,34 @@ package main
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	airecipes "github.com/mounis-bhat/starter/internal/ai/recipes"
 	"github.com/mounis-bhat/starter/internal/api"
 	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
 	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/logging"
 	"github.com/mounis-bhat/starter/internal/service"
 	"github.com/mounis-bhat/starter/internal/storage"
 	"github.com/mounis-bhat/starter/internal/storage/blob"
+	storerecipes "github.com/mounis-bhat/starter/internal/storage/recipes"
 
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/firebase/genkit/go/plugins/googlegenai"
-	"github.com/firebase/genkit/go/plugins/server"
 	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // @title           API
@@ -27,37 +39,71 @@ import (
 // @BasePath  /api
 
 func main() {
-	ctx := context.Background()
 	cfg := config.Load()
+	logger := logging.New(cfg.Env, cfg.LogLevel)
+	slog.SetDefault(logger)
+	if err := cfg.Validate(); err != nil {
+		logger.Error("invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+	domain.SetArgon2Params(domain.Argon2Params{
+		Memory:      uint32(cfg.Auth.Argon2MemoryKiB),
+		Iterations:  uint32(cfg.Auth.Argon2Iterations),
+		Parallelism: uint8(cfg.Auth.Argon2Parallelism),
+	})
 
-	// Initialize Genkit with the Google AI plugin
-	g := genkit.Init(ctx,
-		genkit.WithPlugins(&googlegenai.GoogleAI{}),
-		genkit.WithDefaultModel("googleai/gemini-2.5-flash"),
-	)
+	if err := run(cfg, logger); err != nil {
+		logger.Error("server stopped", logging.Err(err))
+		os.Exit(1)
+	}
+}
 
-	recipeGenerator := airecipes.NewGenkitGenerator(g)
-	recipeService := apprecipes.NewService(recipeGenerator)
+func run(cfg *config.Config, logger *slog.Logger) error {
+	ctx := context.Background()
 
-	store, err := storage.New(ctx, cfg.Database)
+	store, err := storage.New(ctx, cfg.Database, logger)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("storage init failed: %w", err)
 	}
 	defer store.Close()
 
-	blobClient, err := blob.New(ctx, blob.Config{
-		Endpoint:           cfg.Storage.Endpoint,
-		Region:             cfg.Storage.Region,
-		Bucket:             cfg.Storage.Bucket,
-		AccessKeyID:        cfg.Storage.AccessKeyID,
-		SecretAccessKey:    cfg.Storage.SecretAccessKey,
-		ForcePathStyle:     cfg.Storage.ForcePathStyle,
-		PresignUploadTTL:   cfg.Storage.PresignUploadTTL,
-		PresignDownloadTTL: cfg.Storage.PresignDownloadTTL,
-	})
+	// One pool for every Valkey user; nothing is dialed until the first command.
+	valkey := storage.NewValkeyClient(cfg.Valkey)
+	defer valkey.Close()
+
+	// A nil service disables the recipe routes.
+	var recipeService *apprecipes.Service
+	if cfg.Recipes.Enabled {
+		var recipeOptions []apprecipes.Option
+		if cfg.Recipes.CacheEnabled {
+			recipeOptions = append(recipeOptions, apprecipes.WithCache(storerecipes.NewValkeyCache(valkey), cfg.Recipes.CacheTTL))
+		}
+
+		ingredientFilter, err := newIngredientFilter(cfg.Recipes)
+		if err != nil {
+			return fmt.Errorf("ingredient filter init failed: %w", err)
+		}
+		recipeOptions = append(recipeOptions, apprecipes.WithIngredientFilter(ingredientFilter))
+
+		recipeGenerator, err := newRecipeGenerator(ctx, cfg.AI, logger)
+		if err != nil {
+			return fmt.Errorf("recipe generator init failed: %w", err)
+		}
+		recipeService = apprecipes.NewService(recipeGenerator, storerecipes.NewRepository(store.Queries), apprecipes.Limits{
+			MaxCount:              cfg.Recipes.MaxCount,
+			MaxTitleLength:        cfg.Recipes.MaxTitleLength,
+			MaxInstructions:       cfg.Recipes.MaxInstructions,
+			MaxIngredients:        cfg.Recipes.MaxIngredients,
+			MaxIngredientLength:   cfg.Recipes.MaxIngredientLength,
+			MaxRestrictionsLength: cfg.Recipes.MaxRestrictionsLength,
+		}, recipeOptions...)
+	} else {
+		logger.Info("recipe feature disabled", slog.String("ai_backend", cfg.AI.Backend))
+	}
+
+	blobStore, err := newBlobStore(ctx, cfg.Storage, logger)
 	if err != nil {
-		log.Printf("blob storage disabled: %v", err)
-		blobClient = nil
+		logger.Warn("blob storage disabled", logging.Err(err))
 	}
 
 	auditCleanup := service.NewAuditCleanupService(store.Queries)
@@ -70,27 +116,340 @@ func main() {
 			cutoff := time.Now().AddDate(0, 0, -cfg.Audit.RetentionDays)
 			deleted, err := auditCleanup.PurgeBefore(jobCtx, cutoff)
 			if err != nil {
-				log.Printf("audit cleanup failed: %v", err)
+				logger.Error("audit cleanup failed", logging.Err(err))
 				return
 			}
 
-			log.Printf("audit cleanup complete: deleted=%d cutoff=%s", deleted, cutoff.Format(time.RFC3339))
+			logger.Info("audit cleanup complete", slog.Int64("deleted", deleted), slog.Time("cutoff", cutoff))
 		})
 		if err != nil {
-			log.Printf("invalid audit cleanup cron schedule: %s error=%v", cfg.Audit.CleanupCron, err)
-		} else {
-			cronScheduler.Start()
-			defer cronScheduler.Stop()
+			logger.Error("invalid audit cleanup cron schedule", slog.String("cron", cfg.Audit.CleanupCron), logging.Err(err))
 		}
 	} else {
-		log.Printf("audit cleanup job disabled (cron=%q retention_days=%d)", cfg.Audit.CleanupCron, cfg.Audit.RetentionDays)
+		logger.Info("audit cleanup job disabled", slog.String("cron", cfg.Audit.CleanupCron), slog.Int("retention_days", cfg.Audit.RetentionDays))
+	}
+
+	tokenCleanup := service.NewTokenCleanupService(store.Queries)
+	if cfg.Auth.TokenCleanupCron != "" {
+		_, err = cronScheduler.AddFunc(cfg.Auth.TokenCleanupCron, func() {
+			jobCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			defer cancel()
+
+			cleared, err := tokenCleanup.ClearExpiredTokens(jobCtx, time.Now())
+			if err != nil {
+				logger.Error("token cleanup failed", logging.Err(err))
+				return
+			}
+
+			logger.Info("token cleanup complete", slog.Int64("cleared", cleared))
+		})
+		if err != nil {
+			logger.Error("invalid token cleanup cron schedule", slog.String("cron", cfg.Auth.TokenCleanupCron), logging.Err(err))
+		}
+	} else {
+		logger.Info("token cleanup job disabled")
+	}
+
+	// Validation gives idle sessions LastActiveInterval of slack, since
+	// last_active_at is only written that often; cleanup must not undercut it.
+	idleCutoff := cfg.Auth.IdleTimeout
+	if idleCutoff > 0 {
+		idleCutoff += cfg.Auth.LastActiveInterval
+	}
+	sessionCleanup := service.NewSessionCleanupService(store.Queries, idleCutoff)
+	if cfg.Auth.SessionCleanupCron != "" {
+		_, err = cronScheduler.AddFunc(cfg.Auth.SessionCleanupCron, func() {
+			jobCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			defer cancel()
+
+			deleted, err := sessionCleanup.DeleteExpired(jobCtx, time.Now())
+			if err != nil {
+				logger.Error("session cleanup failed", slog.Int64("deleted", deleted), logging.Err(err))
+				return
+			}
+
+			logger.Info("session cleanup complete", slog.Int64("deleted", deleted))
+		})
+		if err != nil {
+			logger.Error("invalid session cleanup cron schedule", slog.String("cron", cfg.Auth.SessionCleanupCron), logging.Err(err))
+		}
+	} else {
+		logger.Info("session cleanup job disabled")
+	}
+
+	if len(cronScheduler.Entries()) > 0 {
+		cronScheduler.Start()
 	}
 
 	// Setup router
-	mux := api.NewRouter(cfg, store, recipeService, blobClient)
+	auditBatcher := api.NewAuditBatcher(store.Queries, cfg.Audit, logger)
+	// background collects the work handlers leave running, such as new device
+	// emails, so shutdown can let it finish before the store closes.
+	var background sync.WaitGroup
+	mux := api.NewRouter(cfg, store, valkey, recipeService, blobStore, auditBatcher, &background, logger)
 	root := http.NewServeMux()
-	root.Handle("/", api.WithSecurityHeaders(cfg, mux))
+	root.Handle("/", api.WithRequestLogging(cfg, logger, api.WithCompression(cfg, api.WithSecurityHeaders(cfg, api.WithIPFilter(cfg, api.WithFetchMetadata(cfg, logger, mux))))))
+
+	srv := newServer(cfg.ListenAddr(), root, cfg.ServerTimeouts)
+	servers := []*http.Server{srv}
+	if cfg.TLS.Enabled() {
+		redirectSrv, err := configureTLS(srv, cfg, logger)
+		if err != nil {
+			return fmt.Errorf("tls init failed: %w", err)
+		}
+		if redirectSrv != nil {
+			servers = append(servers, redirectSrv)
+		}
+	}
+
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, len(servers))
+	go func() {
+		if srv.TLSConfig != nil {
+			logger.Info("starting server", slog.String("addr", srv.Addr), slog.String("scheme", "https"), slog.Any("autocert_domains", cfg.TLS.AutocertDomains))
+			serverErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		logger.Info("starting server", slog.String("addr", srv.Addr), slog.String("scheme", "http"))
+		serverErr <- srv.ListenAndServe()
+	}()
+	for _, redirectSrv := range servers[1:] {
+		go func() {
+			logger.Info("starting https redirect", slog.String("addr", redirectSrv.Addr))
+			serverErr <- redirectSrv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		cronScheduler.Stop()
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := waitBackground(flushCtx, &background); err != nil {
+			logger.Error("background work did not finish", logging.Err(err))
+		}
+		if err := auditBatcher.Close(flushCtx); err != nil {
+			logger.Error("audit log flush failed", logging.Err(err))
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-signalCtx.Done():
+	}
+
+	stop()
+	logger.Info("shutting down", slog.Duration("drain_timeout", cfg.ShutdownTimeout))
+	return shutdown(servers, cronScheduler, &background, auditBatcher, cfg.ShutdownTimeout, logger)
+}
+
+// newServer returns an HTTP server on addr with the connection timeouts from
+// timeouts, so slow clients cannot hold connections open.
+func newServer(addr string, handler http.Handler, timeouts config.ServerTimeoutConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: timeouts.ReadHeader,
+		ReadTimeout:       timeouts.Read,
+		IdleTimeout:       timeouts.Idle,
+	}
+}
+
+// configureTLS sets srv up to serve HTTPS, over HTTP/2 when the client supports
+// it, with the certificate files or a Let's Encrypt manager from cfg.TLS. The
+// certificate files are reloaded when they change. It returns the plain HTTP
+// server on BIND_ADDRESS that redirects to PORT and answers ACME challenges, or
+// nil when TLS_REDIRECT_PORT is empty.
+func configureTLS(srv *http.Server, cfg *config.Config, logger *slog.Logger) (*http.Server, error) {
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true)
+
+	redirect := httpsRedirect(cfg.Port)
+	if cfg.TLS.Autocert() {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLS.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLS.AutocertCacheDir),
+			Email:      cfg.TLS.AutocertEmail,
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		redirect = manager.HTTPHandler(redirect)
+	} else {
+		certs, err := newCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if cfg.TLS.RedirectPort == "" {
+		return nil, nil
+	}
+	return newServer(net.JoinHostPort(cfg.BindAddress, cfg.TLS.RedirectPort), redirect, cfg.ServerTimeouts), nil
+}
+
+// httpsRedirect sends every request to the same host and path on httpsPort.
+func httpsRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			http.Error(w, "missing host", http.StatusBadRequest)
+			return
+		}
+		target := net.JoinHostPort(host, httpsPort)
+		if httpsPort == "443" {
+			target = strings.TrimSuffix(target, ":443")
+		}
+		http.Redirect(w, r, "https://"+target+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
 
-	log.Printf("Starting server on http://localhost:%s", cfg.Port)
-	log.Fatal(server.Start(ctx, "127.0.0.1:"+cfg.Port, root))
+// newIngredientFilter builds the filter selected by RECIPE_INGREDIENT_FILTER from the
+// inline terms and the terms file.
+func newIngredientFilter(cfg config.RecipesConfig) (apprecipes.IngredientFilter, error) {
+	terms := cfg.IngredientTerms
+	if cfg.IngredientTermsFile != "" {
+		data, err := os.ReadFile(cfg.IngredientTermsFile)
+		if err != nil {
+			return apprecipes.IngredientFilter{}, fmt.Errorf("read ingredient terms: %w", err)
+		}
+		terms = append(terms, apprecipes.ParseIngredientTerms(data)...)
+	}
+	return apprecipes.NewIngredientFilter(cfg.IngredientFilter, terms)
+}
+
+// newRecipeGenerator builds the generator selected by AI_BACKEND. Genkit is only
+// initialized for the genkit backend, so the stub runs without Google AI credentials.
+func newRecipeGenerator(ctx context.Context, cfg config.AIConfig, logger *slog.Logger) (apprecipes.Generator, error) {
+	switch cfg.Backend {
+	case "stub":
+		var fixtures map[string]apprecipes.Recipe
+		if cfg.StubFixturesFile != "" {
+			data, err := os.ReadFile(cfg.StubFixturesFile)
+			if err != nil {
+				return nil, fmt.Errorf("read stub fixtures: %w", err)
+			}
+			if fixtures, err = apprecipes.LoadStubFixtures(data); err != nil {
+				return nil, err
+			}
+		}
+		logger.Warn("using stub recipe generator", slog.Int("fixtures", len(fixtures)))
+		return apprecipes.NewStubGenerator(fixtures), nil
+	case "genkit":
+		// Initialize Genkit with the Google AI plugin. The key is passed in
+		// because it may have come from GEMINI_API_KEY_FILE.
+		g := genkit.Init(ctx,
+			genkit.WithPlugins(&googlegenai.GoogleAI{APIKey: cfg.APIKey}),
+			genkit.WithDefaultModel("googleai/gemini-2.5-flash"),
+		)
+		return airecipes.NewGenkitGenerator(g, airecipes.ModelConfig{
+			Temperature:     cfg.Temperature,
+			TopP:            cfg.TopP,
+			MaxOutputTokens: cfg.MaxOutputTokens,
+		})
+	default:
+		return nil, fmt.Errorf("unknown AI_BACKEND %q", cfg.Backend)
+	}
+}
+
+// newBlobStore builds the configured blob backend. It returns a nil Store on error so
+// handlers can report storage as unavailable.
+func newBlobStore(ctx context.Context, cfg config.StorageConfig, logger *slog.Logger) (blob.Store, error) {
+	switch cfg.Backend {
+	case "local":
+		localStore, err := blob.NewLocalStore(blob.LocalConfig{
+			Dir:                cfg.LocalDir,
+			BaseURL:            cfg.LocalBaseURL,
+			Secret:             []byte(cfg.LocalSecret),
+			PresignUploadTTL:   cfg.PresignUploadTTL,
+			PresignDownloadTTL: cfg.PresignDownloadTTL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("using local blob storage", slog.String("dir", localStore.Dir()))
+		return localStore, nil
+	case "s3":
+		client, err := blob.New(ctx, blob.Config{
+			Endpoint:           cfg.Endpoint,
+			Region:             cfg.Region,
+			Bucket:             cfg.Bucket,
+			AccessKeyID:        cfg.AccessKeyID,
+			SecretAccessKey:    cfg.SecretAccessKey,
+			ForcePathStyle:     cfg.ForcePathStyle,
+			PresignUploadTTL:   cfg.PresignUploadTTL,
+			PresignDownloadTTL: cfg.PresignDownloadTTL,
+			MaxConcurrentOps:   cfg.MaxConcurrentOps,
+			QueueTimeout:       cfg.QueueTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// shutdown stops accepting connections, waits for in-flight requests, running
+// cron jobs and the background work they started to finish, and gives up once
+// the drain timeout elapses.
+func shutdown(servers []*http.Server, scheduler *cron.Cron, background *sync.WaitGroup, auditBatcher *api.AuditBatcher, timeout time.Duration, logger *slog.Logger) error {
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(drainCtx); err != nil {
+			return fmt.Errorf("failed to drain http server %s: %w", srv.Addr, err)
+		}
+	}
+	logger.Info("http server drained")
+
+	select {
+	case <-scheduler.Stop().Done():
+		logger.Info("cron scheduler stopped")
+	case <-drainCtx.Done():
+		return errors.New("timed out waiting for cron jobs to finish")
+	}
+
+	// Handlers have returned; let the new device checks they started send
+	// their emails and audit events.
+	if err := waitBackground(drainCtx, background); err != nil {
+		return err
+	}
+	logger.Info("background work finished")
+
+	// Handlers and jobs have stopped logging; write out what they queued.
+	if err := auditBatcher.Close(drainCtx); err != nil {
+		return fmt.Errorf("failed to flush audit logs: %w", err)
+	}
+	if auditBatcher != nil {
+		logger.Info("audit logs flushed")
+	}
+
+	return nil
+}
+
+// waitBackground waits for the work tracked by background, giving up when ctx
+// is done.
+func waitBackground(ctx context.Context, background *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("timed out waiting for background work to finish")
+	}
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/logging"
+)
+
+// certReloader serves the certificate in certFile and keyFile, loading it
+// again on the first handshake after either file changes, so a renewed
+// certificate is picked up without a restart. A pair that fails to load, such
+// as one caught halfway through being replaced, is logged and the previous
+// certificate stays in use.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is the tls.Config hook.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		r.logger.Warn("tls certificate check failed, serving the loaded one", logging.Err(err))
+		return r.cert, nil
+	}
+	if !modTime.Equal(r.modTime) {
+		if err := r.load(modTime); err != nil {
+			r.logger.Warn("tls certificate reload failed, serving the loaded one", logging.Err(err))
+		} else {
+			r.logger.Info("tls certificate reloaded", slog.String("cert_file", r.certFile))
+		}
+	}
+	return r.cert, nil
+}
+
+// load reads the pair and records modTime as the version it came from. A
+// failed load records it too, so a broken pair is retried only once it changes
+// again.
+func (r *certReloader) load(modTime time.Time) error {
+	r.modTime = modTime
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	return nil
+}
+
+// latestModTime returns the later modification time of the two files.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,85 @@
+// Command service-session creates a long-lived service session for an existing user and
+// prints its token once. Service sessions skip the idle timeout but keep an absolute expiry.
+// Access to this command (and therefore the database) is the admin gate.
+//
+// Usage:
+//
+//	go run ./cmd/service-session -email integration@example.com -ttl 720h -description "billing sync"
+//
+// Send the token as the session cookie on API requests.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mounis-bhat/starter/internal/api"
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/storage"
+)
+
+func main() {
+	cfg := config.Load()
+
+	email := flag.String("email", "", "email of the user the session acts as (required)")
+	ttl := flag.Duration("ttl", cfg.Auth.ServiceSessionMaxAge, "absolute lifetime of the session")
+	description := flag.String("description", "", "label stored with the session, e.g. the integration name")
+	flag.Parse()
+
+	if err := run(cfg, *email, *ttl, *description); err != nil {
+		fmt.Fprintln(os.Stderr, "service-session:", err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg *config.Config, email string, ttl time.Duration, description string) error {
+	if email == "" {
+		return errors.New("-email is required")
+	}
+	email, err := domain.NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, cfg.Database, slog.Default())
+	if err != nil {
+		return fmt.Errorf("storage init failed: %w", err)
+	}
+	defer store.Close()
+
+	user, err := store.Queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("no user with email %q", email)
+		}
+		return err
+	}
+
+	sessions := domain.NewSessionService(store.Queries, cfg.Auth.SessionMaxAge, cfg.Auth.ShortSessionMaxAge, cfg.Auth.IdleTimeout, cfg.Auth.LastActiveInterval, domain.SessionTokens{
+		Bytes:  cfg.Auth.SessionTokenBytes,
+		Hasher: domain.NewTokenHasher(cfg.Auth.TokenPepper, cfg.Auth.TokenPepperPrevious, cfg.Auth.AcceptUnpeppered),
+	})
+	token, session, err := sessions.CreateServiceSession(ctx, user.ID, ttl, description)
+	if err != nil {
+		return fmt.Errorf("create service session: %w", err)
+	}
+
+	api.NewAuditLogger(store.Queries, cfg.Audit).Log(ctx, "service_session_created", user.ID, nil, "", map[string]any{
+		"expires_at":  session.ExpiresAt.Time,
+		"description": description,
+	})
+
+	fmt.Fprintf(os.Stderr, "Service session for %s expires %s. The token is shown only once.\n", email, session.ExpiresAt.Time.Format(time.RFC3339))
+	fmt.Println(token)
+	return nil
+}
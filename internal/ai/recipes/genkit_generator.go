@@ -2,21 +2,70 @@ package recipes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/core"
 	"github.com/firebase/genkit/go/genkit"
 	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
+	"google.golang.org/genai"
 )
 
-// GenkitGenerator wraps a Genkit flow for recipe generation.
+// ModelConfig tunes generation cost and determinism. Nil or zero fields keep the
+// model's own defaults.
+type ModelConfig struct {
+	// Temperature is between 0 and 2; lower is more deterministic.
+	Temperature *float64
+	// TopP is the nucleus sampling cutoff, between 0 and 1.
+	TopP *float64
+	// MaxOutputTokens caps the response length, and with it the cost per call.
+	MaxOutputTokens int
+}
+
+// Validate checks the ranges the Gemini API accepts.
+func (c ModelConfig) Validate() error {
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > 2) {
+		return fmt.Errorf("temperature %v is outside [0, 2]", *c.Temperature)
+	}
+	if c.TopP != nil && (*c.TopP < 0 || *c.TopP > 1) {
+		return fmt.Errorf("top-p %v is outside [0, 1]", *c.TopP)
+	}
+	if c.MaxOutputTokens < 0 {
+		return fmt.Errorf("max output tokens %d is negative", c.MaxOutputTokens)
+	}
+	return nil
+}
+
+// generateOption returns the Genkit config option for c, or nil when every field
+// is unset.
+func (c ModelConfig) generateOption() ai.GenerateOption {
+	if c.Temperature == nil && c.TopP == nil && c.MaxOutputTokens == 0 {
+		return nil
+	}
+	config := &genai.GenerateContentConfig{MaxOutputTokens: int32(c.MaxOutputTokens)}
+	if c.Temperature != nil {
+		config.Temperature = genai.Ptr(float32(*c.Temperature))
+	}
+	if c.TopP != nil {
+		config.TopP = genai.Ptr(float32(*c.TopP))
+	}
+	return ai.WithConfig(config)
+}
+
+// GenkitGenerator wraps a Genkit flow for recipe generation. The flow streams the
+// model's raw text as it is produced.
 type GenkitGenerator struct {
-	flow *core.Flow[*apprecipes.RecipeRequest, *apprecipes.Recipe, struct{}]
+	flow *core.Flow[*apprecipes.RecipeRequest, *apprecipes.Recipe, string]
 }
 
-func NewGenkitGenerator(g *genkit.Genkit) *GenkitGenerator {
-	flow := genkit.DefineFlow(g, "recipeGeneratorFlow", func(ctx context.Context, input *apprecipes.RecipeRequest) (*apprecipes.Recipe, error) {
+func NewGenkitGenerator(g *genkit.Genkit, modelConfig ModelConfig) (*GenkitGenerator, error) {
+	if err := modelConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid model config: %w", err)
+	}
+	configOption := modelConfig.generateOption()
+
+	flow := genkit.DefineStreamingFlow(g, "recipeGeneratorFlow", func(ctx context.Context, input *apprecipes.RecipeRequest, sendChunk core.StreamCallback[string]) (*apprecipes.Recipe, error) {
 		dietaryRestrictions := input.DietaryRestrictions
 		if dietaryRestrictions == "" {
 			dietaryRestrictions = "none"
@@ -26,7 +75,22 @@ func NewGenkitGenerator(g *genkit.Genkit) *GenkitGenerator {
 			Main ingredient: %s
 			Dietary restrictions: %s`, input.Ingredient, dietaryRestrictions)
 
-		recipe, _, err := genkit.GenerateData[apprecipes.Recipe](ctx, g, ai.WithPrompt(prompt))
+		opts := []ai.GenerateOption{ai.WithPrompt(prompt)}
+		if configOption != nil {
+			opts = append(opts, configOption)
+		}
+		if sendChunk != nil {
+			opts = append(opts, ai.WithStreaming(func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+				// Stop reading the model as soon as the caller gives up, so a timeout
+				// does not keep consuming output nobody will see.
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				return sendChunk(ctx, chunk.Text())
+			}))
+		}
+
+		recipe, _, err := genkit.GenerateData[apprecipes.Recipe](ctx, g, opts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate recipe: %w", err)
 		}
@@ -34,9 +98,30 @@ func NewGenkitGenerator(g *genkit.Genkit) *GenkitGenerator {
 		return recipe, nil
 	})
 
-	return &GenkitGenerator{flow: flow}
+	return &GenkitGenerator{flow: flow}, nil
 }
 
 func (g *GenkitGenerator) Generate(ctx context.Context, req apprecipes.RecipeRequest) (*apprecipes.Recipe, error) {
 	return g.flow.Run(ctx, &req)
 }
+
+func (g *GenkitGenerator) GenerateStream(ctx context.Context, req apprecipes.RecipeRequest, onChunk func(chunk string) error) (*apprecipes.Recipe, error) {
+	for value, err := range g.flow.Stream(ctx, &req) {
+		if err != nil {
+			return nil, err
+		}
+		if value.Done {
+			return value.Output, nil
+		}
+		if value.Stream == "" {
+			continue
+		}
+		if err := onChunk(value.Stream); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("recipe stream ended without a result")
+}
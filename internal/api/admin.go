@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// RequireRole restricts a handler to users holding role and refuses others per
+// AUTH_DENY_POLICY. It must be wrapped by RequireAuth or RequireAuthOrAPIKey.
+func (h *AuthHandler) RequireRole(role string, next http.Handler) http.Handler {
+	return h.requireRole(role, h.userDenyPolicy, next)
+}
+
+func (h *AuthHandler) requireRole(role, denyPolicy string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ctxkeys.User(r.Context())
+		if !ok {
+			writeDenied(w, denyPolicy, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		if h.roleOf(user) != role {
+			h.auditLogger.Log(r.Context(), "role_access_denied", uuidFromString(user.ID), h.ipFromRequest(r), r.UserAgent(), map[string]any{
+				"role": role,
+				"path": r.URL.Path,
+			})
+			writeDenied(w, denyPolicy, http.StatusForbidden, CodeForbidden, "forbidden")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin is session auth and RequireRole(admin) plus a per-admin rate limit
+// shared by all admin endpoints. Refusals follow AUTH_ADMIN_DENY_POLICY, which
+// defaults to 404 so the admin surface is not disclosed.
+func (h *AuthHandler) RequireAdmin(next http.Handler) http.Handler {
+	return h.requireSession(h.adminDenyPolicy, h.requireRole(domain.RoleAdmin, h.adminDenyPolicy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := ctxkeys.User(r.Context())
+		if !h.allow(r.Context(), "admin:"+user.ID, h.rateLimits.Admin) {
+			writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})))
+}
+
+// handleAdminNotFound answers unknown admin paths and methods the same way as a
+// refused admin request under the not_found policy.
+func handleAdminNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, CodeNotFound, "not found")
+}
+
+// roleOf returns the user's effective role: the stored role, raised to admin for
+// verified emails listed in AUTH_ADMIN_EMAILS.
+func (h *AuthHandler) roleOf(user domain.SessionUser) string {
+	if _, ok := h.adminEmails[strings.ToLower(user.Email)]; ok && user.EmailVerified {
+		return domain.RoleAdmin
+	}
+	if user.Role == "" {
+		return domain.RoleUser
+	}
+	return user.Role
+}
+
+// promoteBootstrapAdmin stores the admin role for the AUTH_BOOTSTRAP_ADMIN_EMAIL
+// account on its first login with a verified email. Failures are logged and do
+// not block the login.
+func (h *AuthHandler) promoteBootstrapAdmin(ctx context.Context, user db.User, ip *netip.Addr, userAgent string) {
+	if h.bootstrapAdminEmail == "" || user.Role == domain.RoleAdmin || !user.EmailVerified {
+		return
+	}
+	if strings.ToLower(user.Email) != h.bootstrapAdminEmail {
+		return
+	}
+
+	if _, err := h.queries.UpdateUserRole(ctx, db.UpdateUserRoleParams{ID: user.ID, Role: domain.RoleAdmin}); err != nil {
+		h.logger.Error("bootstrap admin promotion failed", slog.String("user_id", uuid.UUID(user.ID.Bytes).String()), logging.Err(err))
+		return
+	}
+	h.sessions.EvictUserSessions(ctx, user.ID)
+	h.auditLogger.Log(ctx, "role_changed", user.ID, ip, userAgent, map[string]any{
+		"role":   domain.RoleAdmin,
+		"reason": "bootstrap",
+	})
+}
+
+const (
+	adminUserListDefaultLimit = 50
+	adminUserListMaxLimit     = 100
+)
+
+// AdminUser is the operator view of an account. It never includes password
+// hashes or tokens. An indefinite admin lock is locked without a locked_until.
+type AdminUser struct {
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	Provider      string     `json:"provider" example:"credentials"`
+	Role          string     `json:"role" example:"user"`
+	EmailVerified bool       `json:"email_verified"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	Locked        bool       `json:"locked"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type AdminUserListResponse struct {
+	Users      []AdminUser `json:"users"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// HandleAdminListUsers lists users, newest first
+// @Summary      List users (admin)
+// @Description  Lists users newest first with keyset pagination. Pass next_cursor from the previous page as cursor; it is omitted on the last page.
+// @Tags         admin
+// @Produce      json
+// @Param        limit     query     int     false  "Page size (default 50, max 100)"
+// @Param        cursor    query     string  false  "Cursor from the previous page"
+// @Param        provider  query     string  false  "Filter by provider"  Enums(credentials, google)
+// @Param        verified  query     bool    false  "Filter by email verification"
+// @Success      200  {object}  AdminUserListResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /admin/users [get]
+func (h *AuthHandler) HandleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := queryInt(r, "limit", adminUserListDefaultLimit)
+	if err != nil || limit <= 0 || limit > adminUserListMaxLimit {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and 100")
+		return
+	}
+
+	// Fetch one extra row to learn whether another page exists.
+	params := db.ListUsersParams{Limit: int32(limit + 1)}
+
+	if provider := query.Get("provider"); provider != "" {
+		if provider != "credentials" && provider != "google" && provider != "apple" && provider != "oidc" {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "provider must be credentials, google, apple or oidc")
+			return
+		}
+		params.Provider = pgtype.Text{String: provider, Valid: true}
+	}
+
+	if verified := query.Get("verified"); verified != "" {
+		value, err := strconv.ParseBool(verified)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "verified must be true or false")
+			return
+		}
+		params.EmailVerified = pgtype.Bool{Bool: value, Valid: true}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		createdAt, id, ok := decodeUserCursor(cursor)
+		if !ok {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid cursor")
+			return
+		}
+		params.BeforeCreatedAt = pgtype.Timestamptz{Time: createdAt, Valid: true}
+		params.BeforeID = id
+	}
+
+	rows, err := h.queries.ListUsers(r.Context(), params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	response := AdminUserListResponse{Users: make([]AdminUser, 0, min(len(rows), limit))}
+	for _, row := range rows[:min(len(rows), limit)] {
+		response.Users = append(response.Users, toAdminUserResponse(row))
+	}
+	if len(rows) > limit {
+		last := rows[limit-1]
+		response.NextCursor = encodeUserCursor(last.CreatedAt.Time, last.ID)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func toAdminUserResponse(row db.ListUsersRow) AdminUser {
+	user := AdminUser{
+		ID:            uuid.UUID(row.ID.Bytes).String(),
+		Email:         row.Email,
+		Name:          row.Name,
+		Provider:      row.Provider,
+		Role:          row.Role,
+		EmailVerified: row.EmailVerified,
+		CreatedAt:     row.CreatedAt.Time,
+	}
+	user.Locked = domain.AccountLocked(row.LockedUntil, time.Now())
+	if row.LockedUntil.Valid && row.LockedUntil.InfinityModifier == pgtype.Finite {
+		user.LockedUntil = &row.LockedUntil.Time
+	}
+	return user
+}
+
+// encodeUserCursor packs the sort key of the last row on a page into an opaque
+// cursor: base64url("<created_at unix micros>.<id>").
+func encodeUserCursor(createdAt time.Time, id pgtype.UUID) string {
+	raw := strconv.FormatInt(createdAt.UnixMicro(), 10) + "." + uuid.UUID(id.Bytes).String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeUserCursor(cursor string) (time.Time, pgtype.UUID, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, pgtype.UUID{}, false
+	}
+	micros, idValue, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return time.Time{}, pgtype.UUID{}, false
+	}
+	unixMicro, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return time.Time{}, pgtype.UUID{}, false
+	}
+	id := uuidFromString(idValue)
+	if !id.Valid {
+		return time.Time{}, pgtype.UUID{}, false
+	}
+	return time.UnixMicro(unixMicro), id, true
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// AuditExporter streams audit logs created in [from, to) to fn, oldest first.
+// *storage.Store implements it.
+type AuditExporter interface {
+	ExportAuditLogs(ctx context.Context, from, to time.Time, fn func(db.AuditLog) error) error
+}
+
+// auditCSVHeader is the fixed column order of CSV exports.
+var auditCSVHeader = []string{"id", "created_at", "event_type", "user_id", "ip_address", "user_agent", "metadata"}
+
+// AuditExportRecord is one NDJSON line of an audit export.
+type AuditExportRecord struct {
+	ID        string          `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	EventType string          `json:"event_type"`
+	UserID    *string         `json:"user_id"`
+	IPAddress *string         `json:"ip_address"`
+	UserAgent *string         `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// HandleAdminAuditExport streams audit logs as CSV or NDJSON
+// @Summary      Export audit logs (admin)
+// @Description  Streams the audit logs created in [from, to), oldest first. from and to are RFC 3339 timestamps or YYYY-MM-DD dates (UTC midnight); the range may not exceed AUDIT_EXPORT_MAX_DAYS. CSV has the columns id, created_at, event_type, user_id, ip_address, user_agent, metadata; NDJSON has one object per line. The export itself is audited as audit_exported.
+// @Tags         admin
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Param        from    query     string  true   "Start of the range (inclusive)"
+// @Param        to      query     string  true   "End of the range (exclusive)"
+// @Param        format  query     string  false  "Output format (default csv)"  Enums(csv, ndjson)
+// @Success      200
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /admin/audit/export [get]
+func (h *AuthHandler) HandleAdminAuditExport(w http.ResponseWriter, r *http.Request) {
+	if h.auditExports == nil {
+		writeError(w, http.StatusInternalServerError, CodeFeatureDisabled, "audit export not available")
+		return
+	}
+
+	query := r.URL.Query()
+	from, okFrom := parseExportTime(query.Get("from"))
+	to, okTo := parseExportTime(query.Get("to"))
+	if !okFrom || !okTo {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "from and to must be RFC 3339 timestamps or YYYY-MM-DD dates")
+		return
+	}
+	if !to.After(from) {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "to must be after from")
+		return
+	}
+	if to.Sub(from) > h.auditExportMaxRange {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "range exceeds the export limit of "+formatDays(h.auditExportMaxRange))
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	var write func(db.AuditLog) error
+	var finish func() error
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		write = func(row db.AuditLog) error {
+			return cw.Write(auditCSVRecord(row))
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := cw.Write(auditCSVHeader); err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+			return
+		}
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		write = func(row db.AuditLog) error {
+			return encoder.Encode(auditExportRecord(row))
+		}
+		finish = func() error { return nil }
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "format must be csv or ndjson")
+		return
+	}
+
+	filename := "audit-" + from.Format("20060102T150405Z") + "-" + to.Format("20060102T150405Z") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Rows go straight to the response; once the first one is out the status
+	// is sent, so a later failure can only cut the export short.
+	var count int64
+	err := h.auditExports.ExportAuditLogs(r.Context(), from, to, func(row db.AuditLog) error {
+		count++
+		return write(row)
+	})
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		h.logger.Warn("audit export interrupted", slog.Int64("rows", count), logging.Err(err))
+	}
+
+	admin, _ := ctxkeys.User(r.Context())
+	h.auditLogger.Log(context.WithoutCancel(r.Context()), "audit_exported", uuidFromString(admin.ID), h.ipFromRequest(r), r.UserAgent(), map[string]any{
+		"from":     from,
+		"to":       to,
+		"format":   format,
+		"rows":     count,
+		"complete": err == nil,
+	})
+}
+
+// parseExportTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date, taken as
+// midnight UTC.
+func parseExportTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), true
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func formatDays(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	if days == 1 {
+		return "1 day"
+	}
+	return strconv.Itoa(days) + " days"
+}
+
+func auditExportRecord(row db.AuditLog) AuditExportRecord {
+	record := AuditExportRecord{
+		ID:        uuid.UUID(row.ID.Bytes).String(),
+		CreatedAt: row.CreatedAt.Time.UTC(),
+		EventType: row.EventType,
+		Metadata:  row.Metadata,
+	}
+	if row.UserID.Valid {
+		id := uuid.UUID(row.UserID.Bytes).String()
+		record.UserID = &id
+	}
+	if row.IpAddress != nil {
+		ip := row.IpAddress.String()
+		record.IPAddress = &ip
+	}
+	if row.UserAgent.Valid {
+		record.UserAgent = &row.UserAgent.String
+	}
+	if len(record.Metadata) == 0 {
+		record.Metadata = json.RawMessage("null")
+	}
+	return record
+}
+
+func auditCSVRecord(row db.AuditLog) []string {
+	record := auditExportRecord(row)
+	optional := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}
+	metadata := ""
+	if row.Metadata != nil {
+		metadata = string(row.Metadata)
+	}
+	return []string{
+		record.ID,
+		record.CreatedAt.Format(time.RFC3339Nano),
+		csvSafe(record.EventType),
+		optional(record.UserID),
+		optional(record.IPAddress),
+		csvSafe(optional(record.UserAgent)),
+		csvSafe(metadata),
+	}
+}
+
+// csvSafe prefixes values a spreadsheet would run as a formula with a quote.
+// User agents and metadata come from clients, and exports are opened in
+// spreadsheets.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
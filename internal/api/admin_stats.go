@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+const (
+	adminStatsDefaultDays = 30
+	adminStatsMaxDays     = 365
+)
+
+// loginFailureEvents are the audit events counted as failed logins.
+var loginFailureEvents = []string{"login_failure", "oauth_login_failure"}
+
+// AdminStatsDay holds the counts for one UTC day.
+type AdminStatsDay struct {
+	Date           string `json:"date" example:"2026-01-31"`
+	ActiveSessions int64  `json:"active_sessions"`
+	Registrations  int64  `json:"registrations"`
+	LoginFailures  int64  `json:"login_failures"`
+}
+
+// AdminRecipeCacheStats counts recipe cache lookups since the server started.
+// Failed lookups count as misses.
+type AdminRecipeCacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+type AdminStatsResponse struct {
+	Since       time.Time              `json:"since"`
+	Until       time.Time              `json:"until"`
+	Days        []AdminStatsDay        `json:"days"`
+	RecipeCache *AdminRecipeCacheStats `json:"recipe_cache,omitempty"`
+}
+
+// HandleAdminStats returns daily usage counts
+// @Summary      Usage stats (admin)
+// @Description  Daily counts for the last `days` UTC days including today, oldest first: sessions in use, new accounts and failed logins (password and OAuth). Active sessions only include sessions that still exist, so logouts and cleanup lower past days. recipe_cache holds the recipe cache hits and misses since startup when the cache is on.
+// @Tags         admin
+// @Produce      json
+// @Param        days  query     int  false  "Window in days (default 30, max 365)"
+// @Success      200  {object}  AdminStatsResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /admin/stats [get]
+func (h *AuthHandler) HandleAdminStats(w http.ResponseWriter, r *http.Request) {
+	days, err := queryInt(r, "days", adminStatsDefaultDays)
+	if err != nil || days <= 0 || days > adminStatsMaxDays {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "days must be between 1 and 365")
+		return
+	}
+
+	until := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	since := until.AddDate(0, 0, -days)
+	sinceParam := pgtype.Timestamptz{Time: since, Valid: true}
+	untilParam := pgtype.Timestamptz{Time: until, Valid: true}
+
+	response := AdminStatsResponse{Since: since, Until: until, Days: make([]AdminStatsDay, days)}
+	index := make(map[string]*AdminStatsDay, days)
+	for i := range response.Days {
+		day := &response.Days[i]
+		day.Date = since.AddDate(0, 0, i).Format(time.DateOnly)
+		index[day.Date] = day
+	}
+	add := func(date pgtype.Date, apply func(*AdminStatsDay)) {
+		if day, ok := index[date.Time.Format(time.DateOnly)]; ok && date.Valid {
+			apply(day)
+		}
+	}
+
+	sessions, err := h.queries.CountActiveSessionsByDay(r.Context(), db.CountActiveSessionsByDayParams{Since: sinceParam, Until: untilParam})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	for _, row := range sessions {
+		add(row.Day, func(day *AdminStatsDay) { day.ActiveSessions = row.Count })
+	}
+
+	registrations, err := h.queries.CountUsersCreatedByDay(r.Context(), db.CountUsersCreatedByDayParams{Since: sinceParam, Until: untilParam})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	for _, row := range registrations {
+		add(row.Day, func(day *AdminStatsDay) { day.Registrations = row.Count })
+	}
+
+	failures, err := h.queries.CountAuditEventsByDay(r.Context(), db.CountAuditEventsByDayParams{
+		EventTypes: loginFailureEvents,
+		Since:      sinceParam,
+		Until:      untilParam,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	for _, row := range failures {
+		add(row.Day, func(day *AdminStatsDay) { day.LoginFailures = row.Count })
+	}
+
+	if h.recipeCacheStats != nil {
+		stats := h.recipeCacheStats()
+		response.RecipeCache = &AdminRecipeCacheStats{Hits: stats.Hits, Misses: stats.Misses}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
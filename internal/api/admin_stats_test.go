@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// statsQuerier answers the admin stats queries with no activity.
+type statsQuerier struct {
+	db.Querier
+}
+
+func (statsQuerier) CountActiveSessionsByDay(context.Context, db.CountActiveSessionsByDayParams) ([]db.CountActiveSessionsByDayRow, error) {
+	return nil, nil
+}
+
+func (statsQuerier) CountUsersCreatedByDay(context.Context, db.CountUsersCreatedByDayParams) ([]db.CountUsersCreatedByDayRow, error) {
+	return nil, nil
+}
+
+func (statsQuerier) CountAuditEventsByDay(context.Context, db.CountAuditEventsByDayParams) ([]db.CountAuditEventsByDayRow, error) {
+	return nil, nil
+}
+
+func TestAdminStatsRecipeCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats func() apprecipes.CacheStats
+		want  *AdminRecipeCacheStats
+	}{
+		{"cache on", func() apprecipes.CacheStats { return apprecipes.CacheStats{Hits: 7, Misses: 3} }, &AdminRecipeCacheStats{Hits: 7, Misses: 3}},
+		{"cache off", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, _ := newTestAuthHandler(t, testAuthConfig())
+			h.queries = statsQuerier{}
+			h.recipeCacheStats = tt.stats
+
+			rec := httptest.NewRecorder()
+			h.HandleAdminStats(rec, httptest.NewRequest(http.MethodGet, "/api/admin/stats?days=1", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			var response AdminStatsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.want == nil && response.RecipeCache != nil:
+				t.Errorf("recipe_cache = %+v, want it left out", response.RecipeCache)
+			case tt.want != nil && (response.RecipeCache == nil || *response.RecipeCache != *tt.want):
+				t.Errorf("recipe_cache = %+v, want %+v", response.RecipeCache, tt.want)
+			}
+		})
+	}
+}
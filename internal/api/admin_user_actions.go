@@ -0,0 +1,189 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+type AdminRevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked" example:"3"`
+}
+
+// HandleAdminRevokeSessions signs a user out everywhere
+// @Summary      Revoke a user's sessions (admin)
+// @Description  Deletes every session of the user, service sessions included, for example when the account is suspected compromised. The user's next request gets 401 with the session cookie cleared. API keys are not affected.
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  AdminRevokeSessionsResponse
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /admin/users/{id}/revoke-sessions [post]
+func (h *AuthHandler) HandleAdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	admin, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.sessions.RevokeUserSessions(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	h.auditLogger.Log(r.Context(), "admin_sessions_revoked", uuidFromString(admin.ID), h.ipFromRequest(r), r.UserAgent(), map[string]any{
+		"target_user_id": r.PathValue("id"),
+		"revoked":        revoked,
+	})
+	writeJSON(w, http.StatusOK, AdminRevokeSessionsResponse{Revoked: revoked})
+}
+
+type AdminLockRequest struct {
+	DurationMinutes int `json:"duration_minutes,omitempty" example:"1440" validate:"min=0,max=525600"`
+}
+
+// AdminAccountLockResponse reports a user's lock after an admin lock or
+// unlock. locked_until is omitted for an indefinite lock.
+type AdminAccountLockResponse struct {
+	Locked      bool       `json:"locked"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	Revoked     int64      `json:"revoked,omitempty" example:"3"`
+}
+
+// HandleAdminLockAccount locks a user's account
+// @Summary      Lock an account (admin)
+// @Description  Locks the account until duration_minutes have passed, or until unlocked when no duration is given. While locked, password login, OAuth sign-in and the user's API keys are refused. The user's sessions are revoked. The body is optional.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string            true   "User ID"
+// @Param        request  body      AdminLockRequest  false  "Lock duration"
+// @Success      200  {object}  AdminAccountLockResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /admin/users/{id}/lock [post]
+func (h *AuthHandler) HandleAdminLockAccount(w http.ResponseWriter, r *http.Request) {
+	admin, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	var req AdminLockRequest
+	if r.ContentLength != 0 {
+		if req, ok = decodeAndValidate[AdminLockRequest](w, r); !ok {
+			return
+		}
+	}
+
+	userID, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if userID == uuidFromString(admin.ID) {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "cannot lock your own account")
+		return
+	}
+
+	// Without a duration the lock is stored as infinity, which only an unlock
+	// clears.
+	lockedUntil := pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+	response := AdminAccountLockResponse{Locked: true}
+	if req.DurationMinutes > 0 {
+		until := time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+		lockedUntil = pgtype.Timestamptz{Time: until, Valid: true}
+		response.LockedUntil = &until
+	}
+	if err := h.queries.LockUser(r.Context(), db.LockUserParams{ID: userID, LockedUntil: lockedUntil}); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	revoked, err := h.sessions.RevokeUserSessions(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	response.Revoked = revoked
+
+	h.auditLogger.Log(r.Context(), "admin_account_lock", uuidFromString(admin.ID), h.ipFromRequest(r), r.UserAgent(), map[string]any{
+		"target_user_id":   r.PathValue("id"),
+		"duration_minutes": req.DurationMinutes,
+		"revoked":          revoked,
+	})
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleAdminUnlockAccount clears a user's lock
+// @Summary      Unlock an account (admin)
+// @Description  Clears a lock set by an admin or by repeated failed logins, and resets the failed login counter. Unlocking an account that is not locked succeeds.
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  AdminAccountLockResponse
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /admin/users/{id}/unlock [post]
+func (h *AuthHandler) HandleAdminUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	admin, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := h.queries.UnlockUser(r.Context(), userID); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	h.auditLogger.Log(r.Context(), "admin_account_unlock", uuidFromString(admin.ID), h.ipFromRequest(r), r.UserAgent(), map[string]any{
+		"target_user_id": r.PathValue("id"),
+	})
+	writeJSON(w, http.StatusOK, AdminAccountLockResponse{Locked: false})
+}
+
+// adminTargetUser resolves the {id} path value to an existing user. It writes
+// a 404 for unknown or malformed ids.
+func (h *AuthHandler) adminTargetUser(w http.ResponseWriter, r *http.Request) (pgtype.UUID, bool) {
+	userID := uuidFromString(r.PathValue("id"))
+	if !userID.Valid {
+		writeError(w, http.StatusNotFound, CodeNotFound, "user not found")
+		return pgtype.UUID{}, false
+	}
+	if _, err := h.queries.GetUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, CodeNotFound, "user not found")
+			return pgtype.UUID{}, false
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return pgtype.UUID{}, false
+	}
+	return userID, true
+}
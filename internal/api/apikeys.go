@@ -0,0 +1,275 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// apiKeyUsageAuditInterval throttles "api_key_used" audit events to one per key per interval.
+	apiKeyUsageAuditInterval = time.Hour
+)
+
+type APIKeyCreateRequest struct {
+	Name          string   `json:"name" validate:"notblank,max=100"`
+	Scopes        []string `json:"scopes" example:"recipes:generate" validate:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" validate:"min=0,max=365"`
+}
+
+// APIKeyCreateResponse includes the raw key, which is only ever returned here
+type APIKeyCreateResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type APIKeyListResponse struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// RequireAuthOrAPIKey authenticates with an API key from "Authorization: Bearer" or
+// "X-API-Key" and falls back to the session cookie when neither header is present.
+// API-key requests carry the user in context but no session.
+func (h *AuthHandler) RequireAuthOrAPIKey(next http.Handler) http.Handler {
+	next = h.RequireVerifiedEmail(next)
+	sessionAuth := h.requireSession(h.userDenyPolicy, h.limitUser(next))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawKey, ok := apiKeyFromRequest(r)
+		if !ok {
+			sessionAuth.ServeHTTP(w, r)
+			return
+		}
+
+		info, err := h.apiKeys.Validate(r.Context(), rawKey)
+		if err != nil {
+			if errors.Is(err, domain.ErrAPIKeyNotFound) || errors.Is(err, domain.ErrAPIKeyExpired) || errors.Is(err, domain.ErrAPIKeyOwnerLocked) {
+				reason := "invalid"
+				switch {
+				case errors.Is(err, domain.ErrAPIKeyExpired):
+					reason = "expired"
+				case errors.Is(err, domain.ErrAPIKeyOwnerLocked):
+					reason = "locked"
+				}
+				h.auditLogger.Log(r.Context(), "api_key_auth_failure", pgtype.UUID{}, h.ipFromRequest(r), r.UserAgent(), map[string]any{
+					"reason": reason,
+				})
+				writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+			return
+		}
+
+		keyID := uuid.UUID(info.ID.Bytes).String()
+		if !h.allow(r.Context(), "api_key:"+keyID, h.rateLimits.APIKey) {
+			writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+			return
+		}
+
+		if info.LastUsedAt == nil || time.Since(*info.LastUsedAt) >= apiKeyUsageAuditInterval {
+			h.auditLogger.Log(r.Context(), "api_key_used", uuidFromString(info.User.ID), h.ipFromRequest(r), r.UserAgent(), map[string]any{
+				"api_key_id": keyID,
+				"path":       r.URL.Path,
+			})
+		}
+
+		ctx := ctxkeys.WithUser(r.Context(), info.User)
+		ctx = ctxkeys.WithAPIKey(ctx, info)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireScope rejects API-key requests whose key was not granted scope with a 403
+// "insufficient_scope". Session-authenticated requests pass through unchanged, so it
+// must run after RequireAuthOrAPIKey.
+func (h *AuthHandler) RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := ctxkeys.APIKey(r.Context())
+		if ok && !info.HasScope(scope) {
+			h.auditLogger.Log(r.Context(), "api_key_scope_denied", uuidFromString(info.User.ID), h.ipFromRequest(r), r.UserAgent(), map[string]any{
+				"api_key_id": uuid.UUID(info.ID.Bytes).String(),
+				"scope":      scope,
+				"path":       r.URL.Path,
+			})
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			writeError(w, http.StatusForbidden, CodeInsufficientScope, "api key is missing the required scope")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleAPIKeyCreate creates an API key for the current user
+// @Summary      Create API key
+// @Description  Creates an API key for server-to-server access. The key is returned once and only its hash is stored. Scopes limit what the key can reach: recipes:generate, recipes:read, profile:read.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body APIKeyCreateRequest true "API key request"
+// @Success      201  {object}  APIKeyCreateResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      409  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/api-keys [post]
+func (h *AuthHandler) HandleAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	user, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	req, ok := decodeAndValidate[APIKeyCreateRequest](w, r)
+	if !ok {
+		return
+	}
+
+	userID := uuidFromString(user.ID)
+	rawKey, key, err := h.apiKeys.Create(r.Context(), userID, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidAPIKeyName), errors.Is(err, domain.ErrInvalidAPIKeyScope):
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		case errors.Is(err, domain.ErrAPIKeyLimitReached):
+			writeError(w, http.StatusConflict, CodeLimitReached, "api key limit reached")
+		default:
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		}
+		return
+	}
+
+	h.auditLogger.Log(r.Context(), "api_key_created", userID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
+		"api_key_id": uuid.UUID(key.ID.Bytes).String(),
+		"name":       key.Name,
+		"scopes":     key.Scopes,
+	})
+
+	writeJSON(w, http.StatusCreated, APIKeyCreateResponse{
+		APIKey: toAPIKeyResponse(key),
+		Key:    rawKey,
+	})
+}
+
+// HandleAPIKeyList lists the current user's API keys
+// @Summary      List API keys
+// @Description  Lists the current user's API keys, including revoked and expired ones. Raw keys are never returned.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  APIKeyListResponse
+// @Failure      401  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/api-keys [get]
+func (h *AuthHandler) HandleAPIKeyList(w http.ResponseWriter, r *http.Request) {
+	user, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	keys, err := h.apiKeys.List(r.Context(), uuidFromString(user.ID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	response := APIKeyListResponse{Keys: make([]APIKey, 0, len(keys))}
+	for _, key := range keys {
+		response.Keys = append(response.Keys, toAPIKeyResponse(key))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleAPIKeyRevoke revokes one of the current user's API keys
+// @Summary      Revoke API key
+// @Description  Revokes an API key. Requests using it are rejected immediately.
+// @Tags         auth
+// @Produce      json
+// @Param        id   path      string  true  "API key ID"
+// @Success      200  {object}  AuthStatusResponse
+// @Failure      401  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/api-keys/{id} [delete]
+func (h *AuthHandler) HandleAPIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	user, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	keyID := uuidFromString(r.PathValue("id"))
+	if !keyID.Valid {
+		writeError(w, http.StatusNotFound, CodeNotFound, "api key not found")
+		return
+	}
+
+	userID := uuidFromString(user.ID)
+	if err := h.apiKeys.Revoke(r.Context(), userID, keyID); err != nil {
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			writeError(w, http.StatusNotFound, CodeNotFound, "api key not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	h.auditLogger.Log(r.Context(), "api_key_revoked", userID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
+		"api_key_id": r.PathValue("id"),
+	})
+	writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
+}
+
+// apiKeyFromRequest returns the key from X-API-Key or an Authorization bearer token.
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	if value := strings.TrimSpace(r.Header.Get(apiKeyHeader)); value != "" {
+		return value, true
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		if token = strings.TrimSpace(token); token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+func toAPIKeyResponse(key db.ApiKey) APIKey {
+	response := APIKey{
+		ID:        uuid.UUID(key.ID.Bytes).String(),
+		Name:      key.Name,
+		Prefix:    key.KeyPrefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Time,
+	}
+	if key.ExpiresAt.Valid {
+		response.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		response.LastUsedAt = &key.LastUsedAt.Time
+	}
+	if key.RevokedAt.Valid {
+		response.RevokedAt = &key.RevokedAt.Time
+	}
+	return response
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/oidc"
+	"github.com/mounis-bhat/starter/internal/storage/oauthstate"
+	"golang.org/x/oauth2"
+)
+
+const (
+	appleIssuer   = "https://appleid.apple.com"
+	appleKeysURL  = "https://appleid.apple.com/auth/keys"
+	appleAuthURL  = "https://appleid.apple.com/auth/authorize"
+	appleTokenURL = "https://appleid.apple.com/auth/token"
+	// appleClientSecretTTL is the lifetime of the client secret JWT minted for
+	// each code exchange. Apple allows up to six months; nothing reuses it.
+	appleClientSecretTTL = 5 * time.Minute
+	// appleRelayDomain hosts the forwarding addresses Hide My Email creates.
+	appleRelayDomain = "privaterelay.appleid.com"
+	// maxAppleCallbackBytes bounds the form Apple posts to the callback.
+	maxAppleCallbackBytes = 64 << 10
+)
+
+// appleSignIn holds what the Sign in with Apple flow needs at runtime.
+type appleSignIn struct {
+	oauth    oauth2.Config
+	teamID   string
+	keyID    string
+	key      *ecdsa.PrivateKey
+	verifier *oidc.Verifier
+	cookies  OAuthCookieSettings
+}
+
+// newAppleSignIn returns nil when Sign in with Apple is not configured.
+func newAppleSignIn(cfg config.AppleOAuthConfig) (*appleSignIn, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	key, err := cfg.ParsePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &appleSignIn{
+		oauth: oauth2.Config{
+			ClientID:    cfg.ClientID,
+			RedirectURL: cfg.RedirectURI,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   appleAuthURL,
+				TokenURL:  appleTokenURL,
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+			Scopes: []string{"name", "email"},
+		},
+		teamID: cfg.TeamID,
+		keyID:  cfg.KeyID,
+		key:    key,
+		verifier: &oidc.Verifier{
+			Issuer:   appleIssuer,
+			ClientID: cfg.ClientID,
+			Keys:     oidc.NewKeySet(appleKeysURL, nil),
+		},
+		// Apple posts the callback cross-site; only SameSite=None cookies are sent.
+		cookies: OAuthCookieSettings{Path: cfg.CookiePath, SameSite: http.SameSiteNoneMode},
+	}, nil
+}
+
+// clientSecret signs the JWT Apple accepts in place of a static client secret.
+func (a *appleSignIn) clientSecret(now time.Time) (string, error) {
+	return oidc.SignES256(a.key, a.keyID, map[string]any{
+		"iss": a.teamID,
+		"sub": a.oauth.ClientID,
+		"aud": appleIssuer,
+		"iat": now.Unix(),
+		"exp": now.Add(appleClientSecretTTL).Unix(),
+	})
+}
+
+// appleUserForm is the user field of the first callback for an Apple ID. Apple
+// sends the name only then, and only in this unsigned field.
+type appleUserForm struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+}
+
+// HandleAppleLogin initiates Sign in with Apple
+// @Summary      Login with Apple
+// @Description  Redirects to the Sign in with Apple authorization URL. Apple posts the result back to /auth/apple/callback. An optional redirect path under AUTH_POST_LOGIN_REDIRECT_PREFIXES is where the callback sends the user afterwards; other values are ignored.
+// @Tags         auth
+// @Produce      json
+// @Param        redirect  query  string  false  "Path to return to after login"
+// @Success      302
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/apple [get]
+func (h *AuthHandler) HandleAppleLogin(w http.ResponseWriter, r *http.Request) {
+	if !h.allowRequest(r.Context(), "apple", r, h.rateLimits.Google) {
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+		return
+	}
+
+	if h.apple == nil {
+		writeError(w, http.StatusInternalServerError, CodeFeatureDisabled, "apple sign in not configured")
+		return
+	}
+
+	state, err := generateRandomToken(32)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	// Apple has no PKCE, so the verifier only seeds the ID token nonce.
+	verifier, err := generateRandomToken(64)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	entry := oauthstate.Entry{State: state, Verifier: verifier}
+	if raw := r.URL.Query().Get("redirect"); raw != "" {
+		if target, ok := h.returnURLs.resolve(raw); ok {
+			entry.Redirect = target
+		} else {
+			h.logger.Debug("ignoring disallowed oauth redirect", slog.String("redirect", raw))
+		}
+	}
+	h.saveOAuthState(r.Context(), w, h.apple.cookies, entry)
+
+	authURL := h.apple.oauth.AuthCodeURL(
+		state,
+		oauth2.SetAuthURLParam("response_mode", "form_post"),
+		oauth2.SetAuthURLParam("nonce", oauthNonce(verifier)),
+	)
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]string{"url": authURL})
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleAppleCallback handles the Sign in with Apple callback
+// @Summary      Apple callback
+// @Description  Receives Apple's form post, verifies the ID token and creates a session. Apple shares the user's name only on the first authorization; relay addresses from Hide My Email are stored like any other address.
+// @Tags         auth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Success      303
+// @Failure      400  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/apple/callback [post]
+func (h *AuthHandler) HandleAppleCallback(w http.ResponseWriter, r *http.Request) {
+	if h.apple == nil {
+		writeError(w, http.StatusInternalServerError, CodeFeatureDisabled, "apple sign in not configured")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAppleCallbackBytes)
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	state := r.PostForm.Get("state")
+	code := r.PostForm.Get("code")
+	if state == "" || code == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+		return
+	}
+
+	saved, ok := h.takeOAuthState(w, r, h.apple.cookies)
+	if !ok || subtle.ConstantTimeCompare([]byte(state), []byte(saved.State)) != 1 {
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid state")
+		return
+	}
+
+	exchange := h.apple.oauth
+	secret, err := h.apple.clientSecret(time.Now())
+	if err != nil {
+		h.logger.Error("apple client secret failed", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	exchange.ClientSecret = secret
+	token, err := exchange.Exchange(r.Context(), code)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth code")
+		return
+	}
+
+	// The ID token from the token endpoint is used rather than the one in the
+	// form, since it came over a direct TLS connection to Apple.
+	rawIDToken, _ := token.Extra("id_token").(string)
+	claims, err := h.apple.verifier.Verify(r.Context(), rawIDToken, oauthNonce(saved.Verifier))
+	if err != nil {
+		h.logger.Warn("apple id token rejected", logging.Err(err))
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response")
+		return
+	}
+
+	profile := claimsProfile(claims)
+	profile.Name = appleName(r.PostForm.Get("user"))
+	profile.PrivateEmail = isAppleRelayEmail(claims)
+	user, err := h.identityUser(r, domain.AuthMethodApple, profile, true)
+	if err != nil {
+		h.writeOAuthLoginError(w, err)
+		return
+	}
+
+	h.finishOAuthLogin(w, r, user, domain.AuthMethodApple, saved.Redirect, map[string]any{
+		"private_email": profile.PrivateEmail,
+	})
+}
+
+// appleName reads the display name from the callback's user field, or "".
+func appleName(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	var form appleUserForm
+	if err := json.Unmarshal([]byte(raw), &form); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimSpace(form.Name.FirstName) + " " + strings.TrimSpace(form.Name.LastName))
+}
+
+// isAppleRelayEmail reports whether the user chose Hide My Email. Mail to these
+// addresses is only delivered from senders registered with Apple.
+func isAppleRelayEmail(claims *oidc.Claims) bool {
+	return bool(claims.IsPrivateEmail) || strings.HasSuffix(strings.ToLower(claims.Email), "@"+appleRelayDomain)
+}
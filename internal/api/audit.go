@@ -1,23 +1,64 @@
 package api
 
 import (
+	"cmp"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
 	"github.com/mounis-bhat/starter/internal/storage/db"
 )
 
+// auditTruncatedKey marks metadata cut down to AUDIT_METADATA_MAX_BYTES; its
+// value is the size of the full JSON.
+const auditTruncatedKey = "_truncated"
+
+// AuditRecorder records audit events. *AuditLogger is the implementation;
+// handler tests substitute a fake to see what was logged.
+type AuditRecorder interface {
+	Log(ctx context.Context, event string, userID pgtype.UUID, ip *netip.Addr, userAgent string, metadata map[string]any)
+}
+
+// AuditLogger stores audit events. Metadata passes through the configured
+// redaction first: AUDIT_DROP_KEYS are removed and AUDIT_REDACT_KEYS replaced
+// with a fingerprint, at any depth, and the result is capped at
+// AUDIT_METADATA_MAX_BYTES. With a batcher, events are queued for it and only
+// written synchronously when it cannot take them.
 type AuditLogger struct {
-	queries *db.Queries
+	queries  db.Querier
+	batcher  *AuditBatcher
+	redact   map[string]struct{}
+	drop     map[string]struct{}
+	maxBytes int
+}
+
+func NewAuditLogger(queries db.Querier, cfg config.AuditConfig) *AuditLogger {
+	return &AuditLogger{
+		queries:  queries,
+		redact:   auditKeySet(cfg.RedactKeys),
+		drop:     auditKeySet(cfg.DropKeys),
+		maxBytes: cfg.MetadataMaxBytes,
+	}
 }
 
-func NewAuditLogger(queries *db.Queries) *AuditLogger {
-	return &AuditLogger{queries: queries}
+func auditKeySet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			set[key] = struct{}{}
+		}
+	}
+	return set
 }
 
 func (l *AuditLogger) Log(ctx context.Context, event string, userID pgtype.UUID, ip *netip.Addr, userAgent string, metadata map[string]any) {
@@ -25,21 +66,112 @@ func (l *AuditLogger) Log(ctx context.Context, event string, userID pgtype.UUID,
 		return
 	}
 
+	if requestID := ctxkeys.RequestID(ctx); requestID != "" {
+		withRequestID := make(map[string]any, len(metadata)+1)
+		for key, value := range metadata {
+			withRequestID[key] = value
+		}
+		withRequestID["request_id"] = requestID
+		metadata = withRequestID
+	}
+
 	var meta []byte
 	if metadata != nil {
-		if raw, err := json.Marshal(metadata); err == nil {
-			meta = raw
-		}
+		meta = l.encodeMetadata(l.sanitize(metadata))
 	}
 
-	ua := pgtype.Text{String: userAgent, Valid: userAgent != ""}
-	_ = l.queries.CreateAuditLog(ctx, db.CreateAuditLogParams{
+	params := db.CreateAuditLogParams{
 		UserID:    userID,
 		EventType: event,
 		IpAddress: ip,
-		UserAgent: ua,
+		UserAgent: pgtype.Text{String: userAgent, Valid: userAgent != ""},
 		Metadata:  meta,
+	}
+	if l.batcher.enqueue(auditEntry{params: params, loggedAt: time.Now()}) {
+		return
+	}
+	_ = l.queries.CreateAuditLog(ctx, params)
+}
+
+// sanitize returns a copy of metadata without dropped keys and with redacted
+// values replaced by "sha256:" and the first 16 hex digits of their hash.
+// Nested maps are handled the same way; keys match case-insensitively.
+func (l *AuditLogger) sanitize(metadata map[string]any) map[string]any {
+	clean := make(map[string]any, len(metadata))
+	for key, value := range metadata {
+		name := strings.ToLower(key)
+		if _, ok := l.drop[name]; ok {
+			continue
+		}
+		if _, ok := l.redact[name]; ok {
+			clean[key] = fingerprint(value)
+			continue
+		}
+		if nested, ok := value.(map[string]any); ok {
+			value = l.sanitize(nested)
+		}
+		clean[key] = value
+	}
+	return clean
+}
+
+func fingerprint(value any) string {
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+	sum := sha256.Sum256([]byte(text))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// encodeMetadata marshals metadata, or nil if it cannot be. Past the size cap
+// it keeps request_id and then the smallest fields that fit, and records the
+// full size under auditTruncatedKey, so the stored value stays valid JSON.
+func (l *AuditLogger) encodeMetadata(metadata map[string]any) []byte {
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil
+	}
+	if l.maxBytes <= 0 || len(raw) <= l.maxBytes {
+		return raw
+	}
+
+	type field struct {
+		key  string
+		size int
+	}
+	fields := make([]field, 0, len(metadata))
+	for key, value := range metadata {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		fields = append(fields, field{key, len(key) + len(encoded) + 4})
+	}
+	slices.SortFunc(fields, func(a, b field) int {
+		if (a.key == "request_id") != (b.key == "request_id") {
+			if a.key == "request_id" {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(a.size, b.size), strings.Compare(a.key, b.key))
 	})
+
+	kept := map[string]any{auditTruncatedKey: len(raw)}
+	budget := l.maxBytes - len(auditTruncatedKey) - 16
+	for _, f := range fields {
+		if f.size > budget {
+			continue
+		}
+		kept[f.key] = metadata[f.key]
+		budget -= f.size
+	}
+	raw, err = json.Marshal(kept)
+	if err != nil {
+		return nil
+	}
+	return raw
 }
 
 func hashEmail(email string) string {
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// auditFlushTimeout bounds one batch insert, so a stuck database cannot hold
+// up the events queued behind it forever.
+const auditFlushTimeout = 10 * time.Second
+
+// AuditBatcher queues audit events and inserts them in batches from a single
+// goroutine, so the request that logged them does not wait on the database.
+// Events keep the order and time they were logged in. Close flushes what is
+// left.
+type AuditBatcher struct {
+	queries  db.Querier
+	size     int
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu      sync.RWMutex
+	closed  bool
+	entries chan auditEntry
+	done    chan struct{}
+}
+
+type auditEntry struct {
+	params   db.CreateAuditLogParams
+	loggedAt time.Time
+}
+
+// NewAuditBatcher starts a batcher for cfg, or returns nil when AUDIT_BATCH_SIZE
+// is zero and events are written as they are logged.
+func NewAuditBatcher(queries db.Querier, cfg config.AuditConfig, logger *slog.Logger) *AuditBatcher {
+	if cfg.BatchSize <= 0 {
+		return nil
+	}
+	b := &AuditBatcher{
+		queries:  queries,
+		size:     cfg.BatchSize,
+		interval: cfg.BatchFlushInterval,
+		logger:   logger,
+		entries:  make(chan auditEntry, cfg.BatchBuffer),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// enqueue queues an event and reports whether it was taken. It is not once the
+// batcher is closed or its buffer is full; the caller then writes the event
+// itself.
+func (b *AuditBatcher) enqueue(entry auditEntry) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return false
+	}
+	select {
+	case b.entries <- entry:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops taking events and waits until the queued ones are written, or
+// until ctx is done.
+func (b *AuditBatcher) Close(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.entries)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *AuditBatcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]auditEntry, 0, b.size)
+	for {
+		select {
+		case entry, ok := <-b.entries:
+			if !ok {
+				b.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= b.size {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			b.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush inserts batch in one statement. If that fails, each event is retried
+// on its own, so one bad row does not lose the others.
+func (b *AuditBatcher) flush(batch []auditEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	err := b.insert(batch)
+	if err == nil || len(batch) == 1 {
+		if err != nil {
+			b.logger.Error("audit log write failed", slog.String("event", batch[0].params.EventType), logging.Err(err))
+		}
+		return
+	}
+
+	b.logger.Warn("audit batch insert failed, writing events one by one", slog.Int("events", len(batch)), logging.Err(err))
+	for i := range batch {
+		if err := b.insert(batch[i : i+1]); err != nil {
+			b.logger.Error("audit log write failed", slog.String("event", batch[i].params.EventType), logging.Err(err))
+		}
+	}
+}
+
+func (b *AuditBatcher) insert(batch []auditEntry) error {
+	arg := db.CreateAuditLogBatchParams{
+		UserIds:     make([]pgtype.UUID, len(batch)),
+		EventTypes:  make([]string, len(batch)),
+		IpAddresses: make([]string, len(batch)),
+		UserAgents:  make([]string, len(batch)),
+		Metadata:    make([]string, len(batch)),
+		CreatedAts:  make([]pgtype.Timestamptz, len(batch)),
+	}
+	for i, entry := range batch {
+		arg.UserIds[i] = entry.params.UserID
+		arg.EventTypes[i] = entry.params.EventType
+		if entry.params.IpAddress != nil {
+			arg.IpAddresses[i] = entry.params.IpAddress.String()
+		}
+		arg.UserAgents[i] = entry.params.UserAgent.String
+		arg.Metadata[i] = string(entry.params.Metadata)
+		arg.CreatedAts[i] = pgtype.Timestamptz{Time: entry.loggedAt, Valid: true}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditFlushTimeout)
+	defer cancel()
+	return b.queries.CreateAuditLogBatch(ctx, arg)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// auditRoundTrip stands in for the network and commit time of one INSERT,
+// which dominates an audit write whether it carries one row or a batch.
+const auditRoundTrip = 500 * time.Microsecond
+
+// auditQuerier counts audit rows and statements, taking auditRoundTrip per
+// statement.
+type auditQuerier struct {
+	db.Querier
+	rows       atomic.Int64
+	statements atomic.Int64
+}
+
+func (q *auditQuerier) CreateAuditLog(context.Context, db.CreateAuditLogParams) error {
+	time.Sleep(auditRoundTrip)
+	q.statements.Add(1)
+	q.rows.Add(1)
+	return nil
+}
+
+func (q *auditQuerier) CreateAuditLogBatch(_ context.Context, arg db.CreateAuditLogBatchParams) error {
+	time.Sleep(auditRoundTrip)
+	q.statements.Add(1)
+	q.rows.Add(int64(len(arg.EventTypes)))
+	return nil
+}
+
+// BenchmarkAuditLogConcurrentLogins logs a login_success event from many
+// goroutines at once, as concurrent logins do, with events written one by one
+// and with the batcher. ns/op is the time the request spends in Log;
+// statements/op is how many INSERTs each event costs the database.
+func BenchmarkAuditLogConcurrentLogins(b *testing.B) {
+	ip := netip.MustParseAddr("203.0.113.7")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, bc := range []struct {
+		name  string
+		batch config.AuditConfig
+	}{
+		{"unbatched", config.AuditConfig{}},
+		{"batched", config.AuditConfig{BatchSize: 100, BatchFlushInterval: 50 * time.Millisecond, BatchBuffer: 4096}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			queries := &auditQuerier{}
+			audit := NewAuditLogger(queries, config.AuditConfig{MetadataMaxBytes: 4096})
+			audit.batcher = NewAuditBatcher(queries, bc.batch, logger)
+			userID := newUUID()
+
+			b.SetParallelism(16)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					audit.Log(context.Background(), "login_success", userID, &ip, "Mozilla/5.0", map[string]any{
+						"method": "password",
+					})
+				}
+			})
+			b.StopTimer()
+
+			if err := audit.batcher.Close(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+			if rows := queries.rows.Load(); rows != int64(b.N) {
+				b.Fatalf("%d rows written for %d events", rows, b.N)
+			}
+			b.ReportMetric(float64(queries.statements.Load())/float64(b.N), "statements/op")
+		})
+	}
+}
@@ -11,70 +11,153 @@ import (
 	"fmt"
 	"html"
 	"io"
-	"net"
+	"log/slog"
 	"net/http"
 	"net/netip"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
 	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
 	"github.com/mounis-bhat/starter/internal/domain"
 	"github.com/mounis-bhat/starter/internal/email"
-	"github.com/mounis-bhat/starter/internal/storage"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/oidc"
 	"github.com/mounis-bhat/starter/internal/storage/db"
+	"github.com/mounis-bhat/starter/internal/storage/oauthstate"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
-type contextKey string
-
-const (
-	contextKeyUser    contextKey = "authUser"
-	contextKeySession contextKey = "authSession"
-)
-
 const (
 	oauthStateCookieName    = "oauth_state"
 	oauthVerifierCookieName = "oauth_verifier"
+	oauthStateIDCookieName  = "oauth_state_id"
+	oauthRedirectCookieName = "oauth_redirect"
 	oauthCookieMaxAge       = 5 * time.Minute
 )
 
+const (
+	googleIssuer  = "https://accounts.google.com"
+	googleKeysURL = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
 const (
 	emailVerificationTokenSize = 32
 	emailVerificationTTL       = 24 * time.Hour
 )
 
+// AuthStore is the persistence AuthHandler needs. *storage.Store implements it;
+// handler tests can supply a fake db.Querier and run transactions inline.
+type AuthStore interface {
+	Querier() db.Querier
+	WithTx(ctx context.Context, fn func(q db.Querier) error) error
+}
+
 type AuthHandler struct {
-	queries              *db.Queries
-	sessions             *domain.SessionService
-	cookies              CookieManager
-	oauthConfig          *oauth2.Config
-	rateLimiter          RateLimiter
-	rateLimits           config.RateLimitConfig
-	auditLogger          *AuditLogger
-	postLoginRedirectURL string
-	mailer               email.Mailer
-	appBaseURL           string
-	trustedProxyHeader   string
+	store                 AuthStore
+	queries               db.Querier
+	sessions              domain.SessionManager
+	apiKeys               *domain.APIKeyService
+	cookies               CookieManager
+	oauthConfig           *oauth2.Config
+	googleRequireVerified bool
+	googleCookies         OAuthCookieSettings
+	googleIDTokens        *oidc.Verifier
+	rateLimiters          RateLimiters
+	rateLimits            config.RateLimitConfig
+	auditLogger           AuditRecorder
+	auditExports          AuditExporter
+	auditExportMaxRange   time.Duration
+	postLoginRedirectURL  string
+	postVerifyRedirect    string
+	returnURLs            returnURLs
+	oauthStateKeys        domain.KeyRing
+	mailer                email.Mailer
+	appBaseURL            string
+	resendPolicy          string
+	resendBackoff         domain.ResendBackoff
+	resendCooldown        time.Duration
+	verifyTokenGrace      time.Duration
+	proxies               trustedProxies
+	adminEmails           map[string]struct{}
+	bootstrapAdminEmail   string
+	passwordPolicy        domain.PasswordPolicy
+	passwordHistory       int
+	userDenyPolicy        string
+	adminDenyPolicy       string
+	existingSession       string
+	newDeviceLookback     time.Duration
+	// background tracks work a request leaves running, such as the new device
+	// check; NewRouter points it at the group shutdown waits on.
+	background           *sync.WaitGroup
+	verifiedEmailPaths   []string
+	requireVerifiedEmail bool
+	// capabilities is set by NewRouter once every optional component is known.
+	capabilities Capabilities
+	// apple is set by NewRouter when Sign in with Apple is configured.
+	apple *appleSignIn
+	// oidcProvider is set by NewRouter when OIDC_ISSUER is configured.
+	oidcProvider *genericOIDC
+	// oauthStates is set by NewRouter when GOOGLE_OAUTH_STATE_STORE=valkey and
+	// Valkey answers; nil keeps the state and verifier in cookies.
+	oauthStates OAuthStateStore
+	// recipeCacheStats is set by NewRouter when recipes are served with the
+	// cache on; nil leaves recipe_cache out of the admin stats.
+	recipeCacheStats func() apprecipes.CacheStats
+	// dbSessions is the Postgres session service. sessions is the same unless
+	// NewRouter switches to stateless sessions, which still use it for opaque
+	// tokens.
+	dbSessions *domain.SessionService
+	logger     *slog.Logger
 }
 
 type RateLimiter interface {
 	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error)
 }
 
+// RateLimiters holds a limiter for each algorithm a rule may name
+// (config.RateLimitSliding, RateLimitFixed and RateLimitTokenBucket).
+type RateLimiters map[string]RateLimiter
+
+// OAuthStateStore keeps the OAuth state and PKCE verifier server-side between
+// login and callback.
+type OAuthStateStore interface {
+	Save(ctx context.Context, id string, entry oauthstate.Entry, ttl time.Duration) error
+	// Take returns and deletes the entry; found is false once it expired or was used.
+	Take(ctx context.Context, id string) (entry oauthstate.Entry, found bool, err error)
+}
+
 // AuthMeResponse represents the authenticated user
 // @Description Authenticated user response
 type AuthMeResponse struct {
-	ID            string  `json:"id"`
-	Email         string  `json:"email"`
-	EmailVerified bool    `json:"email_verified"`
-	Name          string  `json:"name"`
-	Picture       *string `json:"picture,omitempty"`
-	Provider      string  `json:"provider"`
+	ID            string   `json:"id"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       *string  `json:"picture,omitempty"`
+	Provider      string   `json:"provider"`
+	Role          string   `json:"role" example:"user"`
+	AuthMethods   []string `json:"auth_methods" example:"password,google"`
+	// Capabilities reports the deployment's optional features, not the user's.
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// SessionStatusResponse reports when the current session ends
+// @Description Session status response
+type SessionStatusResponse struct {
+	Type      string    `json:"type" example:"interactive"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// IdleExpiresAt is omitted for service sessions and when the idle timeout is
+	// off. For stateless sessions it is when the current token expires.
+	IdleExpiresAt *time.Time `json:"idle_expires_at,omitempty"`
 }
 
 // LogoutResponse represents a successful logout
@@ -86,23 +169,29 @@ type LogoutResponse struct {
 // RegisterRequest represents registration input
 // @Description Registration request
 type RegisterRequest struct {
-	Email    string `json:"email" example:"user@example.com" validate:"required"`
-	Password string `json:"password" example:"verysecurepassword" validate:"required"`
-	Name     string `json:"name" example:"Jane Doe" validate:"required"`
+	Email    string `json:"email" example:"user@example.com" validate:"required,max=255"`
+	Password string `json:"password" example:"verysecurepassword" validate:"required,max=1000"`
+	Name     string `json:"name" example:"Jane Doe" validate:"notblank,max=255"`
+	// Remember keeps the session across browser restarts for the full session
+	// lifetime; otherwise it is a browser-session cookie with a short expiry.
+	Remember bool `json:"remember,omitempty"`
 }
 
 // LoginRequest represents login input
 // @Description Login request
 type LoginRequest struct {
-	Email    string `json:"email" example:"user@example.com" validate:"required"`
-	Password string `json:"password" example:"verysecurepassword" validate:"required"`
+	Email    string `json:"email" example:"user@example.com" validate:"required,max=255"`
+	Password string `json:"password" example:"verysecurepassword" validate:"required,max=1000"`
+	// Remember keeps the session across browser restarts for the full session
+	// lifetime; otherwise it is a browser-session cookie with a short expiry.
+	Remember bool `json:"remember,omitempty"`
 }
 
 // ChangePasswordRequest represents password change input
 // @Description Password change request
 type ChangePasswordRequest struct {
-	CurrentPassword string `json:"current_password" validate:"required"`
-	NewPassword     string `json:"new_password" validate:"required"`
+	CurrentPassword string `json:"current_password" validate:"required,max=1000"`
+	NewPassword     string `json:"new_password" validate:"required,max=1000"`
 }
 
 // AuthStatusResponse represents a generic auth response
@@ -111,6 +200,34 @@ type AuthStatusResponse struct {
 	Status string `json:"status" example:"ok"`
 }
 
+// RegisterResponse represents a registration result. The verification fields
+// are only set when a new account was created and a session started; a
+// duplicate email gets the bare status. Under AUTH_REQUIRE_VERIFIED_EMAIL no
+// session is started and every request gets the bare "verification_required"
+// status, so the body does not confirm whether the account exists.
+// @Description Registration response
+type RegisterResponse struct {
+	Status                string `json:"status" example:"ok" enums:"ok,verification_required"`
+	EmailVerified         *bool  `json:"email_verified,omitempty" example:"false"`
+	VerificationEmailSent *bool  `json:"verification_email_sent,omitempty" example:"true"`
+}
+
+// VerifyEmailResponse represents a successful email verification
+// @Description Verify email response
+type VerifyEmailResponse struct {
+	Status string `json:"status" example:"ok"`
+	// Redirect is set when EMAIL_POST_VERIFICATION_REDIRECT_URL is configured.
+	Redirect string `json:"redirect,omitempty" example:"/welcome"`
+}
+
+// ResendVerificationResponse represents a verification email resend
+// @Description Resend verification response
+type ResendVerificationResponse struct {
+	Status string `json:"status" example:"ok"`
+	// NextResendAt is set under the backoff resend policy.
+	NextResendAt *time.Time `json:"next_resend_at,omitempty"`
+}
+
 type googleUserInfo struct {
 	Sub           string `json:"sub"`
 	Email         string `json:"email"`
@@ -119,8 +236,9 @@ type googleUserInfo struct {
 	Picture       string `json:"picture"`
 }
 
-func NewAuthHandler(store *storage.Store, cfg config.AuthConfig, googleCfg config.GoogleOAuthConfig, emailCfg config.EmailConfig, rateLimitCfg config.RateLimitConfig, limiter RateLimiter, mailer email.Mailer) *AuthHandler {
+func NewAuthHandler(store AuthStore, cfg config.AuthConfig, googleCfg config.GoogleOAuthConfig, emailCfg config.EmailConfig, rateLimitCfg config.RateLimitConfig, auditCfg config.AuditConfig, limiters RateLimiters, mailer email.Mailer, logger *slog.Logger) *AuthHandler {
 	var oauthConfig *oauth2.Config
+	var googleIDTokens *oidc.Verifier
 	if googleCfg.ClientID != "" && googleCfg.ClientSecret != "" && googleCfg.RedirectURI != "" {
 		oauthConfig = &oauth2.Config{
 			ClientID:     googleCfg.ClientID,
@@ -129,6 +247,12 @@ func NewAuthHandler(store *storage.Store, cfg config.AuthConfig, googleCfg confi
 			Endpoint:     google.Endpoint,
 			Scopes:       []string{"openid", "email", "profile"},
 		}
+		googleIDTokens = &oidc.Verifier{
+			Issuer:       googleIssuer,
+			OtherIssuers: []string{"accounts.google.com"},
+			ClientID:     googleCfg.ClientID,
+			Keys:         oidc.NewKeySet(googleKeysURL, nil),
+		}
 	}
 
 	postLoginRedirect := cfg.PostLoginRedirectURL
@@ -144,27 +268,80 @@ func NewAuthHandler(store *storage.Store, cfg config.AuthConfig, googleCfg confi
 		}
 	}
 
+	returnURLs := newReturnURLs(cfg.ReturnPathPrefixes, postLoginRedirect, emailCfg.AppBaseURL)
+	postVerifyRedirect := ""
+	if raw := emailCfg.PostVerificationRedirectURL; raw != "" {
+		target, ok := returnURLs.resolve(raw)
+		if ok {
+			postVerifyRedirect = target
+		} else {
+			logger.Warn("post-verification redirect not allowed, using default",
+				slog.String("url", raw))
+		}
+	}
+
+	adminEmails := make(map[string]struct{}, len(cfg.AdminEmails))
+	for _, email := range cfg.AdminEmails {
+		adminEmails[email] = struct{}{}
+	}
+
+	sessions := domain.NewSessionService(store.Querier(), cfg.SessionMaxAge, cfg.ShortSessionMaxAge, cfg.IdleTimeout, cfg.LastActiveInterval, newSessionTokens(cfg))
 	return &AuthHandler{
-		queries:              store.Queries,
-		sessions:             domain.NewSessionService(store.Queries, cfg.SessionMaxAge, cfg.IdleTimeout),
-		cookies:              NewCookieManager(cfg),
-		oauthConfig:          oauthConfig,
-		rateLimiter:          limiter,
-		rateLimits:           rateLimitCfg,
-		auditLogger:          NewAuditLogger(store.Queries),
-		postLoginRedirectURL: postLoginRedirect,
-		mailer:               mailer,
-		appBaseURL:           strings.TrimRight(emailCfg.AppBaseURL, "/"),
-		trustedProxyHeader:   cfg.TrustedProxyHeader,
+		store:                 store,
+		queries:               store.Querier(),
+		sessions:              sessions,
+		dbSessions:            sessions,
+		apiKeys:               domain.NewAPIKeyService(store.Querier(), cfg.APIKeyMaxPerUser),
+		cookies:               NewCookieManager(cfg),
+		oauthConfig:           oauthConfig,
+		googleRequireVerified: googleCfg.RequireVerifiedEmail,
+		googleCookies:         OAuthCookieSettings{Path: googleCfg.CookiePath, SameSite: googleCfg.CookieSameSite},
+		googleIDTokens:        googleIDTokens,
+		rateLimiters:          limiters,
+		rateLimits:            rateLimitCfg,
+		auditLogger:           NewAuditLogger(store.Querier(), auditCfg),
+		auditExportMaxRange:   auditCfg.ExportMaxRange,
+		postLoginRedirectURL:  postLoginRedirect,
+		returnURLs:            returnURLs,
+		postVerifyRedirect:    postVerifyRedirect,
+		oauthStateKeys:        domain.NewKeyRing(googleCfg.StateKey, googleCfg.StateKeyPrevious),
+		mailer:                mailer,
+		appBaseURL:            strings.TrimRight(emailCfg.AppBaseURL, "/"),
+		resendPolicy:          emailCfg.VerificationResendPolicy,
+		resendBackoff: domain.ResendBackoff{
+			Schedule: emailCfg.VerificationResendBackoff,
+			Reset:    emailCfg.VerificationResendBackoffReset,
+		},
+		resendCooldown:       emailCfg.VerificationResendCooldown,
+		verifyTokenGrace:     emailCfg.VerificationTokenGrace,
+		proxies:              newTrustedProxies(cfg.TrustedProxy),
+		adminEmails:          adminEmails,
+		bootstrapAdminEmail:  cfg.BootstrapAdminEmail,
+		passwordPolicy:       newPasswordPolicy(cfg),
+		passwordHistory:      cfg.PasswordHistory,
+		userDenyPolicy:       cfg.UserDenyPolicy,
+		adminDenyPolicy:      cfg.AdminDenyPolicy,
+		existingSession:      cfg.ExistingSession,
+		newDeviceLookback:    cfg.NewDeviceLookback,
+		background:           &sync.WaitGroup{},
+		verifiedEmailPaths:   cfg.VerifiedEmailPaths,
+		requireVerifiedEmail: cfg.RequireVerifiedEmail,
+		logger:               logger,
 	}
 }
 
+// RequireAuth requires a valid session cookie and refuses other requests per
+// AUTH_DENY_POLICY. The user's request budget applies (limitUser).
 func (h *AuthHandler) RequireAuth(next http.Handler) http.Handler {
+	return h.requireSession(h.userDenyPolicy, h.limitUser(h.RequireVerifiedEmail(next)))
+}
+
+func (h *AuthHandler) requireSession(denyPolicy string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(h.cookies.name)
+		cookie, err := r.Cookie(h.cookies.SessionCookieName())
 		if err != nil || cookie.Value == "" {
 			h.cookies.ClearSessionCookie(w)
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			writeDenied(w, denyPolicy, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 			return
 		}
 
@@ -172,32 +349,53 @@ func (h *AuthHandler) RequireAuth(next http.Handler) http.Handler {
 		if err != nil {
 			if errors.Is(err, domain.ErrSessionNotFound) || errors.Is(err, domain.ErrSessionExpired) {
 				h.cookies.ClearSessionCookie(w)
-				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				writeDenied(w, denyPolicy, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 				return
 			}
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), contextKeySession, session)
-		ctx = context.WithValue(ctx, contextKeyUser, session.User)
+		if session.RenewedToken != "" {
+			h.cookies.SetSessionCookie(w, session.RenewedToken, session.Persistent)
+		}
+
+		ctx := ctxkeys.WithSession(r.Context(), session)
+		ctx = ctxkeys.WithUser(ctx, session.User)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// writeDenied refuses a request to a protected route: with status, or with a
+// plain 404 when the route class's deny policy hides that the route exists.
+func writeDenied(w http.ResponseWriter, denyPolicy string, status int, code, message string) {
+	if denyPolicy == config.DenyPolicyNotFound {
+		writeError(w, http.StatusNotFound, CodeNotFound, "not found")
+		return
+	}
+	writeError(w, status, code, message)
+}
+
 // HandleMe returns the authenticated user
 // @Summary      Get current user
 // @Description  Returns the authenticated user from the session cookie
 // @Tags         auth
 // @Produce      json
 // @Success      200  {object}  AuthMeResponse
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/me [get]
 func (h *AuthHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
-	user, ok := userFromContext(r.Context())
+	user, ok := ctxkeys.User(r.Context())
 	if !ok {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	stored, err := h.queries.GetUserByID(r.Context(), uuidFromString(user.ID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
@@ -208,28 +406,56 @@ func (h *AuthHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
 		Name:          user.Name,
 		Picture:       user.Picture,
 		Provider:      user.Provider,
+		Role:          h.roleOf(user),
+		AuthMethods:   domain.AuthMethods(stored),
+		Capabilities:  h.capabilities,
 	})
 }
 
+// HandleSession reports the current session's expiry times
+// @Summary      Get session status
+// @Description  Returns the absolute expiry and, for interactive sessions, the idle expiry. The session ends at whichever comes first. Calling this counts as activity, so idle_expires_at is always idle-timeout from now; clients should count down locally and call it only to keep the session alive.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  SessionStatusResponse
+// @Failure      401  {object}  APIError
+// @Router       /auth/session [get]
+func (h *AuthHandler) HandleSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := ctxkeys.Session(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	response := SessionStatusResponse{
+		Type:      session.Type,
+		ExpiresAt: session.ExpiresAt,
+	}
+	if !session.IdleExpiresAt.IsZero() {
+		response.IdleExpiresAt = &session.IdleExpiresAt
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
 // HandleLogout clears the session cookie and revokes the session
 // @Summary      Logout
 // @Description  Revokes the current session and clears the session cookie
 // @Tags         auth
 // @Produce      json
 // @Success      200  {object}  LogoutResponse
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/logout [post]
 func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
-	session, ok := sessionFromContext(r.Context())
+	session, ok := ctxkeys.Session(r.Context())
 	if ok {
 		if !h.allowRequest(r.Context(), "logout:"+session.TokenHash, r, h.rateLimits.Logout) {
-			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many requests"})
+			writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
 			return
 		}
 	}
 	if ok {
-		_ = h.sessions.RevokeByTokenHash(r.Context(), session.TokenHash)
+		_ = h.sessions.RevokeSession(r.Context(), session)
 	}
 
 	h.cookies.ClearSessionCookie(w)
@@ -247,59 +473,63 @@ func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 
 // HandleRegister registers a new user with email/password
 // @Summary      Register with credentials
-// @Description  Creates a user account with email and password, then starts a session
+// @Description  Creates a user account with email and password, then starts a session. Under AUTH_REQUIRE_VERIFIED_EMAIL no session is started and status is verification_required: the user signs in after following the emailed link.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        request body RegisterRequest true "Registration request"
-// @Success      200  {object}  AuthStatusResponse
-// @Failure      400  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Success      200  {object}  RegisterResponse
+// @Failure      400  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/register [post]
 func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	if !h.allowRequest(r.Context(), "register", r, h.rateLimits.Register) {
-		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many requests"})
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
 		return
 	}
 
-	var req RegisterRequest
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	req, ok := decodeAndValidate[RegisterRequest](w, r)
+	if !ok {
 		return
 	}
 
 	email, err := domain.NormalizeEmail(req.Email)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid email"})
+		writeError(w, http.StatusBadRequest, CodeInvalidEmail, "invalid email")
 		return
 	}
 
 	name := strings.TrimSpace(req.Name)
-	if name == "" || len(name) > 255 {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid name"})
+
+	if err := h.passwordPolicy.Validate(req.Password, email, name); err != nil {
+		writePasswordError(w, err)
 		return
 	}
 
-	if err := domain.ValidatePassword(req.Password); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
-		return
+	// Duplicates get the same status as new accounts, so it does not reveal
+	// which emails are registered. They also pay for a hash, so the response
+	// time does not tell them apart either.
+	status := "ok"
+	if h.requireVerifiedEmail {
+		status = "verification_required"
 	}
 
 	if _, err := h.queries.GetUserByEmail(r.Context(), email); err == nil {
+		domain.FakePasswordHash(req.Password)
 		h.auditLogger.Log(r.Context(), "register_duplicate", pgtype.UUID{}, h.ipFromRequest(r), r.UserAgent(), map[string]any{
 			"email_hash": hashEmail(email),
 		})
-		writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
+		writeJSON(w, http.StatusOK, RegisterResponse{Status: status})
 		return
 	} else if !errors.Is(err, pgx.ErrNoRows) {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
 	hash, err := domain.HashPassword(req.Password)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
@@ -317,67 +547,73 @@ func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 			h.auditLogger.Log(r.Context(), "register_duplicate", pgtype.UUID{}, h.ipFromRequest(r), r.UserAgent(), map[string]any{
 				"email_hash": hashEmail(email),
 			})
-			writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
+			writeJSON(w, http.StatusOK, RegisterResponse{Status: status})
 			return
 		}
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
 	userAgent := r.UserAgent()
 	ipAddress := h.ipFromRequest(r)
-	if revoked := h.revokeExistingSession(r); revoked {
-		h.auditLogger.Log(r.Context(), "session_revoked", user.ID, ipAddress, userAgent, map[string]any{
-			"reason": "rotation",
-		})
+	if h.requireVerifiedEmail {
+		h.auditLogger.Log(r.Context(), "register_success", user.ID, ipAddress, userAgent, nil)
+		// No verification fields: a duplicate gets none either. A failed
+		// send is recovered at login, which mails a new link.
+		h.sendVerificationEmail(r.Context(), user, ipAddress, userAgent)
+		writeJSON(w, http.StatusOK, RegisterResponse{Status: status})
+		return
 	}
-	token, _, err := h.sessions.CreateSession(r.Context(), user.ID, ipAddress, userAgent)
+
+	h.rotateExistingSession(r, config.ExistingSessionRotate, user.ID, ipAddress, userAgent)
+	lifetime := h.sessions.Lifetime(req.Remember)
+	token, _, err := h.sessions.CreateSession(r.Context(), user.ID, ipAddress, userAgent, lifetime)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	h.cookies.SetSessionCookie(w, token)
+	h.cookies.SetSessionCookie(w, token, lifetime.Persistent)
 	h.auditLogger.Log(r.Context(), "register_success", user.ID, ipAddress, userAgent, nil)
+	sent := false
 	if user.Provider == "credentials" && !user.EmailVerified {
-		h.sendVerificationEmail(r.Context(), user, ipAddress, userAgent)
+		sent = h.sendVerificationEmail(r.Context(), user, ipAddress, userAgent)
 	}
-	writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
+	writeJSON(w, http.StatusOK, RegisterResponse{
+		Status:                "ok",
+		EmailVerified:         &user.EmailVerified,
+		VerificationEmailSent: &sent,
+	})
 }
 
 // HandleLogin logs in a user with email/password
 // @Summary      Login with credentials
-// @Description  Verifies credentials, creates a session, and sets a cookie
+// @Description  Verifies credentials, creates a session, and sets a cookie. Under AUTH_REQUIRE_VERIFIED_EMAIL an unverified user gets 403 email_not_verified instead, with details.verification_email_sent telling whether a new link was sent.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        request body LoginRequest true "Login request"
 // @Success      200  {object}  AuthStatusResponse
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/login [post]
 func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	req, ok := decodeAndValidate[LoginRequest](w, r)
+	if !ok {
 		return
 	}
 
 	email, err := domain.NormalizeEmail(req.Email)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid email"})
+		writeError(w, http.StatusBadRequest, CodeInvalidEmail, "invalid email")
 		return
 	}
 
 	if !h.allowRequest(r.Context(), "login:"+email, r, h.rateLimits.Login) {
-		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many requests"})
-		return
-	}
-
-	if len(req.Password) > 1000 {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid password"})
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
 		return
 	}
 
@@ -389,25 +625,25 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 				"email_hash": hashEmail(email),
 				"reason":     "not_found",
 			})
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid email or password"})
+			writeError(w, http.StatusUnauthorized, CodeInvalidCredentials, "invalid email or password")
 			return
 		}
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
 	now := time.Now()
-	if user.LockedUntil.Valid && user.LockedUntil.Time.After(now) {
+	if domain.AccountLocked(user.LockedUntil, now) {
 		h.auditLogger.Log(r.Context(), "login_failure", user.ID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
 			"email_hash": hashEmail(email),
 			"reason":     "locked",
 		})
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid email or password"})
+		writeError(w, http.StatusUnauthorized, CodeInvalidCredentials, "invalid email or password")
 		return
 	}
-	if user.LockedUntil.Valid && user.LockedUntil.Time.Before(now) {
+	if user.LockedUntil.Valid {
 		if err := h.queries.UnlockUser(r.Context(), user.ID); err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 			return
 		}
 	}
@@ -418,19 +654,19 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			"email_hash": hashEmail(email),
 			"reason":     "invalid_provider",
 		})
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid email or password"})
+		writeError(w, http.StatusUnauthorized, CodeInvalidCredentials, "invalid email or password")
 		return
 	}
 
 	valid, err := domain.VerifyPassword(req.Password, user.PasswordHash.String)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 	if !valid {
 		updated, err := h.queries.IncrementFailedLoginAttempts(r.Context(), user.ID)
 		if err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 			return
 		}
 		if updated.FailedLoginAttempts >= 10 {
@@ -439,7 +675,7 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 				ID:          user.ID,
 				LockedUntil: pgtype.Timestamptz{Time: lockUntil, Valid: true},
 			}); err != nil {
-				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+				writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 				return
 			}
 			h.auditLogger.Log(r.Context(), "account_lockout", user.ID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
@@ -451,25 +687,37 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			"email_hash": hashEmail(email),
 			"reason":     "invalid_password",
 		})
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid email or password"})
+		writeError(w, http.StatusUnauthorized, CodeInvalidCredentials, "invalid email or password")
 		return
 	}
 
 	if err := h.queries.ResetFailedLoginAttempts(r.Context(), user.ID); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	if h.requireVerifiedEmail && !user.EmailVerified {
+		h.refuseUnverifiedLogin(w, r, user, email)
 		return
 	}
 
 	userAgent := r.UserAgent()
 	ipAddress := h.ipFromRequest(r)
-	token, _, err := h.sessions.CreateSession(r.Context(), user.ID, ipAddress, userAgent)
+	if domain.NeedsRehash(user.PasswordHash.String) {
+		h.rehashPassword(r.Context(), user, req.Password, ipAddress, userAgent)
+	}
+	h.rotateExistingSession(r, config.ExistingSessionAdd, user.ID, ipAddress, userAgent)
+	lifetime := h.sessions.Lifetime(req.Remember)
+	token, _, err := h.sessions.CreateSession(r.Context(), user.ID, ipAddress, userAgent, lifetime)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	h.cookies.SetSessionCookie(w, token)
+	h.cookies.SetSessionCookie(w, token, lifetime.Persistent)
+	h.checkNewDevice(r.Context(), user, "password", ipAddress, userAgent)
 	h.auditLogger.Log(r.Context(), "login_success", user.ID, ipAddress, userAgent, nil)
+	h.promoteBootstrapAdmin(r.Context(), user, ipAddress, userAgent)
 	writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
 }
 
@@ -481,44 +729,38 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        request body ChangePasswordRequest true "Change password request"
 // @Success      200  {object}  AuthStatusResponse
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      429  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/password [post]
 func (h *AuthHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
-	user, ok := userFromContext(r.Context())
+	user, ok := ctxkeys.User(r.Context())
 	if !ok {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	if !h.allowRequest(r.Context(), "password:"+user.ID, r, h.rateLimits.Password) {
-		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many requests"})
-		return
-	}
-
-	var req ChangePasswordRequest
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
 		return
 	}
 
-	if len(req.NewPassword) > 1000 {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid password"})
+	req, ok := decodeAndValidate[ChangePasswordRequest](w, r)
+	if !ok {
 		return
 	}
 
 	userID := uuidFromString(user.ID)
 	if !userID.Valid {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	stored, err := h.queries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
@@ -526,47 +768,65 @@ func (h *AuthHandler) HandleChangePassword(w http.ResponseWriter, r *http.Reques
 		h.auditLogger.Log(r.Context(), "password_change_failure", stored.ID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
 			"reason": "invalid_provider",
 		})
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid credentials"})
+		writeError(w, http.StatusBadRequest, CodeInvalidCredentials, "invalid credentials")
 		return
 	}
 
 	valid, err := domain.VerifyPassword(req.CurrentPassword, stored.PasswordHash.String)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 	if !valid {
 		h.auditLogger.Log(r.Context(), "password_change_failure", stored.ID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
 			"reason": "invalid_current_password",
 		})
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid credentials"})
+		writeError(w, http.StatusBadRequest, CodeInvalidCredentials, "invalid credentials")
 		return
 	}
 
-	if err := domain.ValidatePassword(req.NewPassword); err != nil {
+	if err := h.passwordPolicy.Validate(req.NewPassword, stored.Email, stored.Name); err != nil {
 		h.auditLogger.Log(r.Context(), "password_change_failure", stored.ID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
 			"reason": "invalid_new_password",
 		})
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		writePasswordError(w, err)
+		return
+	}
+
+	reused, err := h.passwordReused(r.Context(), stored, req.NewPassword)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	if reused {
+		h.auditLogger.Log(r.Context(), "password_reuse_rejected", stored.ID, h.ipFromRequest(r), r.UserAgent(), map[string]any{
+			"flow": "change_password",
+		})
+		writePasswordReused(w, h.passwordHistory)
 		return
 	}
 
 	hash, err := domain.HashPassword(req.NewPassword)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	if err := h.queries.UpdateUserPassword(r.Context(), db.UpdateUserPasswordParams{
-		ID:           stored.ID,
-		PasswordHash: pgtype.Text{String: hash, Valid: true},
+	if err := h.store.WithTx(r.Context(), func(q db.Querier) error {
+		if err := q.UpdateUserPassword(r.Context(), db.UpdateUserPasswordParams{
+			ID:           stored.ID,
+			PasswordHash: pgtype.Text{String: hash, Valid: true},
+		}); err != nil {
+			return err
+		}
+		return h.recordPasswordHistory(r.Context(), q, stored)
 	}); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	if err := h.sessions.RevokeUserSessions(r.Context(), stored.ID); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	if _, err := h.sessions.RevokeUserSessions(r.Context(), stored.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
@@ -577,13 +837,19 @@ func (h *AuthHandler) HandleChangePassword(w http.ResponseWriter, r *http.Reques
 
 	userAgent := r.UserAgent()
 	ipAddress := h.ipFromRequest(r)
-	token, _, err := h.sessions.CreateSession(r.Context(), stored.ID, ipAddress, userAgent)
+	// Keep the replacement session on the same terms as the one that changed the
+	// password, so this cannot turn a short browser session into a remembered one.
+	lifetime := h.sessions.Lifetime(true)
+	if session, ok := ctxkeys.Session(r.Context()); ok {
+		lifetime = domain.SessionLifetime{MaxAge: time.Until(session.ExpiresAt), Persistent: session.Persistent}
+	}
+	token, _, err := h.sessions.CreateSession(r.Context(), stored.ID, ipAddress, userAgent, lifetime)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	h.cookies.SetSessionCookie(w, token)
+	h.cookies.SetSessionCookie(w, token, lifetime.Persistent)
 	h.auditLogger.Log(r.Context(), "password_change", stored.ID, ipAddress, userAgent, nil)
 	writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
 }
@@ -594,128 +860,215 @@ func (h *AuthHandler) HandleChangePassword(w http.ResponseWriter, r *http.Reques
 // @Tags         auth
 // @Produce      json
 // @Param        token  query  string  true  "Verification token"
-// @Success      200  {object}  AuthStatusResponse
-// @Failure      400  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Success      200  {object}  VerifyEmailResponse
+// @Failure      400  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/verify-email [get]
 func (h *AuthHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
 	token := strings.TrimSpace(r.URL.Query().Get("token"))
 	if token == "" {
-		h.writeVerificationResponse(w, r, http.StatusBadRequest, "Invalid verification link", "The verification token is missing or invalid.")
+		h.writeVerificationResponse(w, r, http.StatusBadRequest, CodeVerificationInvalid, "Invalid verification link", "The verification token is missing or invalid.")
 		return
 	}
 
-	user, err := h.queries.GetUserByEmailVerificationTokenHash(r.Context(), domain.HashToken(token))
+	user, expiresAt, err := h.userByVerificationToken(r.Context(), domain.HashToken(token))
 	if err != nil {
-		h.writeVerificationResponse(w, r, http.StatusBadRequest, "Invalid verification link", "The verification token is missing or invalid.")
+		h.writeVerificationResponse(w, r, http.StatusBadRequest, CodeVerificationInvalid, "Invalid verification link", "The verification token is missing or invalid.")
 		return
 	}
 
-	if user.EmailVerificationExpiresAt.Valid && user.EmailVerificationExpiresAt.Time.Before(time.Now()) {
-		h.writeVerificationResponse(w, r, http.StatusBadRequest, "Verification link expired", "Your verification link has expired. Please request a new one.")
+	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		h.writeVerificationResponse(w, r, http.StatusBadRequest, CodeVerificationExpired, "Verification link expired", "Your verification link has expired. Please request a new one.")
 		return
 	}
 
 	if !user.EmailVerified {
 		if _, err := h.queries.VerifyUserEmail(r.Context(), user.ID); err != nil {
-			h.writeVerificationResponse(w, r, http.StatusInternalServerError, "Verification failed", "We could not verify your email right now. Please try again.")
+			h.writeVerificationResponse(w, r, http.StatusInternalServerError, CodeInternal, "Verification failed", "We could not verify your email right now. Please try again.")
 			return
 		}
+		h.sessions.EvictUserSessions(r.Context(), user.ID)
 		h.auditLogger.Log(r.Context(), "email_verified", user.ID, h.ipFromRequest(r), r.UserAgent(), nil)
+		if err := h.queries.DeletePreviousVerificationToken(r.Context(), user.ID); err != nil {
+			h.logger.Warn("delete previous verification token failed", logging.Err(err))
+		}
+	}
+
+	h.writeVerificationResponse(w, r, http.StatusOK, "", "Email verified", "Your email has been verified successfully.")
+}
+
+// userByVerificationToken finds the user a verification link belongs to and
+// when the link expires. A link superseded by a resend is still honoured until
+// its grace window ends; see keepPreviousVerificationToken.
+func (h *AuthHandler) userByVerificationToken(ctx context.Context, tokenHash string) (db.User, pgtype.Timestamptz, error) {
+	user, err := h.queries.GetUserByEmailVerificationTokenHash(ctx, tokenHash)
+	if err == nil {
+		return user, user.EmailVerificationExpiresAt, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return db.User{}, pgtype.Timestamptz{}, err
 	}
 
-	h.writeVerificationResponse(w, r, http.StatusOK, "Email verified", "Your email has been verified successfully.")
+	previous, err := h.queries.GetPreviousVerificationToken(ctx, tokenHash)
+	if err != nil {
+		return db.User{}, pgtype.Timestamptz{}, err
+	}
+	user, err = h.queries.GetUserByID(ctx, previous.UserID)
+	if err != nil {
+		return db.User{}, pgtype.Timestamptz{}, err
+	}
+	return user, previous.ExpiresAt, nil
 }
 
 // HandleResendVerification resends the verification email
 // @Summary      Resend verification email
-// @Description  Resends the verification email for the authenticated user
+// @Description  Resends the verification email for the authenticated user. Sends are at least EMAIL_VERIFICATION_RESEND_COOLDOWN_SECONDS apart, and under the backoff policy the wait grows with each resend; next_resend_at reports when the next one is allowed and 429 responses carry Retry-After.
 // @Tags         auth
 // @Produce      json
-// @Success      200  {object}  AuthStatusResponse
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      429  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Success      200  {object}  ResendVerificationResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/verify-email/resend [post]
 func (h *AuthHandler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
-	user, ok := userFromContext(r.Context())
+	user, ok := ctxkeys.User(r.Context())
 	if !ok {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
-	if !h.allowRequest(r.Context(), "verify-email-resend:"+user.ID, r, h.rateLimits.VerifyEmailResend) {
-		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many requests"})
+	useBackoff := h.resendPolicy == config.VerificationResendBackoff
+	if !useBackoff && !h.allowRequest(r.Context(), "verify-email-resend:"+user.ID, r, h.rateLimits.VerifyEmailResend) {
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
 		return
 	}
 
 	userID := uuidFromString(user.ID)
 	if !userID.Valid {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	stored, err := h.queries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
 	if stored.Provider != "credentials" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid credentials"})
+		writeError(w, http.StatusBadRequest, CodeInvalidCredentials, "invalid credentials")
 		return
 	}
 
-	if !stored.EmailVerified {
-		h.sendVerificationEmail(r.Context(), stored, h.ipFromRequest(r), r.UserAgent())
+	if stored.EmailVerified {
+		writeJSON(w, http.StatusOK, ResendVerificationResponse{Status: "ok"})
+		return
 	}
 
-	writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
+	// The cooldown is checked per user in the database, so unlike the rate limit
+	// it holds when Valkey is down and across every app instance.
+	nextAt, err := h.nextVerificationSend(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	if wait := time.Until(nextAt); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		writeErrorDetails(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests", map[string]any{
+			"next_resend_at": nextAt.UTC().Format(time.RFC3339),
+		})
+		return
+	}
+
+	h.sendVerificationEmail(r.Context(), stored, h.ipFromRequest(r), r.UserAgent())
+
+	response := ResendVerificationResponse{Status: "ok"}
+	if nextAt, err := h.nextVerificationSend(r.Context(), userID); err == nil && !nextAt.IsZero() {
+		response.NextResendAt = &nextAt
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// nextVerificationSend returns when the next verification email is allowed: the
+// later of the cooldown after the last send and, under the backoff policy, the
+// backoff delay. The zero time means now.
+func (h *AuthHandler) nextVerificationSend(ctx context.Context, userID pgtype.UUID) (time.Time, error) {
+	useBackoff := h.resendPolicy == config.VerificationResendBackoff
+	if !useBackoff && h.resendCooldown <= 0 {
+		return time.Time{}, nil
+	}
+
+	sent, err := h.queries.GetEmailVerificationSend(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	if h.resendCooldown > 0 && sent.LastSentAt.Valid {
+		next = sent.LastSentAt.Time.Add(h.resendCooldown)
+	}
+	if useBackoff {
+		if backoff := h.resendBackoff.NextAllowed(int(sent.Attempts), sent.LastSentAt.Time); backoff.After(next) {
+			next = backoff
+		}
+	}
+	return next, nil
 }
 
 // HandleGoogleLogin redirects to Google OAuth
 // @Summary      Login with Google
-// @Description  Redirects to Google OAuth authorization URL
+// @Description  Redirects to Google OAuth authorization URL. An optional redirect path under AUTH_POST_LOGIN_REDIRECT_PREFIXES is where the callback sends the user afterwards; other values are ignored.
 // @Tags         auth
 // @Produce      json
+// @Param        redirect  query  string  false  "Path to return to after login"
 // @Success      302
-// @Failure      429  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/google [get]
 func (h *AuthHandler) HandleGoogleLogin(w http.ResponseWriter, r *http.Request) {
 	if !h.allowRequest(r.Context(), "google", r, h.rateLimits.Google) {
-		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many requests"})
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
 		return
 	}
 
 	if h.oauthConfig == nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "google oauth not configured"})
+		writeError(w, http.StatusInternalServerError, CodeFeatureDisabled, "google oauth not configured")
 		return
 	}
 
 	state, err := generateRandomToken(32)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
 	verifier, err := generateRandomToken(64)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
 	challenge := codeChallenge(verifier)
-
-	setOAuthCookie(w, h.cookies, oauthStateCookieName, state)
-	setOAuthCookie(w, h.cookies, oauthVerifierCookieName, verifier)
+	entry := oauthstate.Entry{State: state, Verifier: verifier}
+	if raw := r.URL.Query().Get("redirect"); raw != "" {
+		if target, ok := h.returnURLs.resolve(raw); ok {
+			entry.Redirect = target
+		} else {
+			h.logger.Debug("ignoring disallowed oauth redirect", slog.String("redirect", raw))
+		}
+	}
+	h.saveOAuthState(r.Context(), w, h.googleCookies, entry)
 
 	authURL := h.oauthConfig.AuthCodeURL(
 		state,
 		oauth2.AccessTypeOnline,
 		oauth2.SetAuthURLParam("code_challenge", challenge),
 		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oauth2.SetAuthURLParam("nonce", oauthNonce(verifier)),
 	)
 
 	if wantsJSON(r) {
@@ -732,81 +1085,91 @@ func (h *AuthHandler) HandleGoogleLogin(w http.ResponseWriter, r *http.Request)
 // @Tags         auth
 // @Produce      json
 // @Success      302
-// @Failure      400  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/google/callback [get]
 func (h *AuthHandler) HandleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 	if h.oauthConfig == nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "google oauth not configured"})
+		writeError(w, http.StatusInternalServerError, CodeFeatureDisabled, "google oauth not configured")
 		return
 	}
 
 	state := r.URL.Query().Get("state")
 	code := r.URL.Query().Get("code")
 	if state == "" || code == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
-		return
-	}
-
-	stateCookie, err := r.Cookie(oauthStateCookieName)
-	if err != nil || stateCookie.Value == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid state"})
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
 		return
 	}
 
-	verifierCookie, err := r.Cookie(oauthVerifierCookieName)
-	if err != nil || verifierCookie.Value == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid state"})
+	saved, ok := h.takeOAuthState(w, r, h.googleCookies)
+	if !ok || subtle.ConstantTimeCompare([]byte(state), []byte(saved.State)) != 1 {
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid state")
 		return
 	}
 
-	clearOAuthCookie(w, h.cookies, oauthStateCookieName)
-	clearOAuthCookie(w, h.cookies, oauthVerifierCookieName)
-
-	if subtle.ConstantTimeCompare([]byte(state), []byte(stateCookie.Value)) != 1 {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid state"})
+	token, err := h.oauthConfig.Exchange(r.Context(), code, oauth2.SetAuthURLParam("code_verifier", saved.Verifier))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth code")
 		return
 	}
 
-	token, err := h.oauthConfig.Exchange(r.Context(), code, oauth2.SetAuthURLParam("code_verifier", verifierCookie.Value))
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid oauth code"})
-		return
+	// With the openid scope Google also returns an ID token. When present it must
+	// carry this login's nonce and name the same account as userinfo.
+	var idTokenSubject string
+	if rawIDToken, _ := token.Extra("id_token").(string); rawIDToken != "" {
+		claims, err := h.googleIDTokens.Verify(r.Context(), rawIDToken, oauthNonce(saved.Verifier))
+		if err != nil {
+			h.logger.Warn("google id token rejected", logging.Err(err))
+			writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response")
+			return
+		}
+		idTokenSubject = claims.Subject
 	}
 
 	client := h.oauthConfig.Client(r.Context(), token)
 	resp, err := client.Get("https://openidconnect.googleapis.com/v1/userinfo")
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid oauth response"})
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response")
 		return
 	}
 
 	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
 	var info googleUserInfo
 	if err := json.Unmarshal(body, &info); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	if info.Sub == "" || info.Email == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid oauth response"})
+	if info.Sub == "" || info.Email == "" || (idTokenSubject != "" && idTokenSubject != info.Sub) {
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response")
 		return
 	}
 
 	email, err := domain.NormalizeEmail(info.Email)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid oauth response"})
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response")
+		return
+	}
+
+	if h.googleRequireVerified && !info.EmailVerified {
+		h.auditLogger.Log(r.Context(), "oauth_login_failure", pgtype.UUID{}, h.ipFromRequest(r), r.UserAgent(), map[string]any{
+			"email_hash": hashEmail(email),
+			"provider":   "google",
+			"reason":     "email_unverified",
+		})
+		writeError(w, http.StatusForbidden, CodeEmailNotVerified, "email address is not verified with google")
 		return
 	}
 
@@ -816,11 +1179,11 @@ func (h *AuthHandler) HandleGoogleCallback(w http.ResponseWriter, r *http.Reques
 				"email_hash": hashEmail(email),
 				"reason":     "email_conflict",
 			})
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unable to authenticate"})
+			writeError(w, http.StatusBadRequest, CodeOAuthFailed, "unable to authenticate")
 			return
 		}
 	} else if !errors.Is(err, pgx.ErrNoRows) {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
@@ -842,60 +1205,76 @@ func (h *AuthHandler) HandleGoogleCallback(w http.ResponseWriter, r *http.Reques
 				"email_hash": hashEmail(email),
 				"reason":     "email_conflict",
 			})
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unable to authenticate"})
+			writeError(w, http.StatusBadRequest, CodeOAuthFailed, "unable to authenticate")
 			return
 		}
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
+	h.finishOAuthLogin(w, r, user, "google", saved.Redirect, nil)
+}
+
+// finishOAuthLogin creates a session for user after a provider callback and
+// redirects to redirect, or the default post-login target. metadata is added
+// to the oauth_login audit event. A locked account is refused with the same
+// error as a locked password login, whichever provider vouched for it.
+func (h *AuthHandler) finishOAuthLogin(w http.ResponseWriter, r *http.Request, user db.User, provider, redirect string, metadata map[string]any) {
 	userAgent := r.UserAgent()
 	ipAddress := h.ipFromRequest(r)
-	if revoked := h.revokeExistingSession(r); revoked {
-		h.auditLogger.Log(r.Context(), "session_revoked", user.ID, ipAddress, userAgent, map[string]any{
-			"reason": "rotation",
+	if domain.AccountLocked(user.LockedUntil, time.Now()) {
+		h.auditLogger.Log(r.Context(), "oauth_login_failure", user.ID, ipAddress, userAgent, map[string]any{
+			"email_hash": hashEmail(user.Email),
+			"provider":   provider,
+			"reason":     "locked",
 		})
+		writeError(w, http.StatusUnauthorized, CodeInvalidCredentials, "invalid email or password")
+		return
 	}
-	rawToken, _, err := h.sessions.CreateSession(r.Context(), user.ID, ipAddress, userAgent)
+	h.rotateExistingSession(r, config.ExistingSessionRotate, user.ID, ipAddress, userAgent)
+	lifetime := h.sessions.Lifetime(true)
+	rawToken, _, err := h.sessions.CreateSession(r.Context(), user.ID, ipAddress, userAgent, lifetime)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	h.cookies.SetSessionCookie(w, rawToken)
-	h.auditLogger.Log(r.Context(), "oauth_login", user.ID, ipAddress, userAgent, map[string]any{
-		"provider": "google",
-	})
+	h.cookies.SetSessionCookie(w, rawToken, lifetime.Persistent)
+	h.checkNewDevice(r.Context(), user, provider, ipAddress, userAgent)
+	event := map[string]any{"provider": provider}
+	for key, value := range metadata {
+		event[key] = value
+	}
+	h.auditLogger.Log(r.Context(), "oauth_login", user.ID, ipAddress, userAgent, event)
+	h.promoteBootstrapAdmin(r.Context(), user, ipAddress, userAgent)
 	redirectTarget := h.postLoginRedirectURL
+	if redirect != "" {
+		redirectTarget = redirect
+	}
 	if redirectTarget == "" {
 		redirectTarget = "/"
 	}
-	http.Redirect(w, r, redirectTarget, http.StatusFound)
+	// A form_post callback must become a GET on the target.
+	status := http.StatusFound
+	if r.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+	http.Redirect(w, r, redirectTarget, status)
 }
 
-func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user db.User, ip *netip.Addr, userAgent string) {
+// sendVerificationEmail issues a fresh verification token and mails it. It
+// reports whether the mailer accepted the message.
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user db.User, ip *netip.Addr, userAgent string) bool {
 	if h.mailer == nil {
-		return
+		return false
 	}
 
-	token, err := generateRandomToken(emailVerificationTokenSize)
+	token, _, err := h.issueVerificationToken(ctx, user)
 	if err != nil {
 		h.auditLogger.Log(ctx, "email_verification_token_failed", user.ID, ip, userAgent, map[string]any{
 			"error": err.Error(),
 		})
-		return
-	}
-
-	expiresAt := pgtype.Timestamptz{Time: time.Now().Add(emailVerificationTTL), Valid: true}
-	if err := h.queries.SetEmailVerificationToken(ctx, db.SetEmailVerificationTokenParams{
-		ID:                         user.ID,
-		EmailVerificationTokenHash: domain.HashToken(token),
-		EmailVerificationExpiresAt: expiresAt,
-	}); err != nil {
-		h.auditLogger.Log(ctx, "email_verification_token_failed", user.ID, ip, userAgent, map[string]any{
-			"error": err.Error(),
-		})
-		return
+		return false
 	}
 
 	verificationURL := h.verificationURL(token)
@@ -904,26 +1283,131 @@ func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user db.User, i
 		name = user.Email
 	}
 
-	subject := "Verify your email"
-	params := email.EmailParams{
-		Greeting:   fmt.Sprintf("Hi %s,", name),
-		BodyLines:  []string{"Please verify your email address to get started."},
-		ButtonText: "Verify Email",
-		ButtonURL:  verificationURL,
-		FooterText: "If you did not create an account, you can safely ignore this email.",
-	}
+	subject, params := verificationEmail(name, verificationURL)
 	textBody := email.RenderText(params)
 	htmlBody := email.RenderHTML(params)
 
 	if err := h.mailer.Send(ctx, user.Email, subject, textBody, htmlBody); err != nil {
+		h.logger.Error("email send failed", slog.String("type", "verification"), logging.Err(err))
 		h.auditLogger.Log(ctx, "email_send_failed", user.ID, ip, userAgent, map[string]any{
 			"type":  "verification",
 			"error": err.Error(),
 		})
-		return
+		return false
+	}
+
+	resetBefore := pgtype.Timestamptz{}
+	if h.resendBackoff.Reset > 0 {
+		resetBefore = pgtype.Timestamptz{Time: time.Now().Add(-h.resendBackoff.Reset), Valid: true}
+	}
+	if _, err := h.queries.RecordEmailVerificationSend(ctx, db.RecordEmailVerificationSendParams{
+		UserID:      user.ID,
+		ResetBefore: resetBefore,
+	}); err != nil {
+		h.logger.Error("record verification send failed", logging.Err(err))
 	}
 
 	h.auditLogger.Log(ctx, "email_verification_sent", user.ID, ip, userAgent, nil)
+	return true
+}
+
+// issueVerificationToken replaces the user's verification token with a fresh
+// one and returns it with its expiry.
+func (h *AuthHandler) issueVerificationToken(ctx context.Context, user db.User) (string, time.Time, error) {
+	token, err := generateRandomToken(emailVerificationTokenSize)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(emailVerificationTTL)
+	err = h.store.WithTx(ctx, func(q db.Querier) error {
+		if err := h.keepPreviousVerificationToken(ctx, q, user); err != nil {
+			return err
+		}
+		return q.SetEmailVerificationToken(ctx, db.SetEmailVerificationTokenParams{
+			ID:                         user.ID,
+			EmailVerificationTokenHash: domain.HashToken(token),
+			EmailVerificationExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		})
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// keepPreviousVerificationToken lets the link in the last verification email
+// keep working for EMAIL_VERIFICATION_PREVIOUS_TOKEN_GRACE_SECONDS after a resend
+// replaces it. Users often open whichever email arrives first, or an older one
+// still in their inbox, and would otherwise get "invalid link" right after
+// asking for a new one. The cost is that two links are live for a short while;
+// only the most recently replaced one is kept, and never past its own expiry.
+// Reusing the existing token instead is not possible because only its hash is
+// stored.
+func (h *AuthHandler) keepPreviousVerificationToken(ctx context.Context, q db.Querier, user db.User) error {
+	if h.verifyTokenGrace <= 0 || !user.EmailVerificationTokenHash.Valid || !user.EmailVerificationExpiresAt.Valid {
+		return nil
+	}
+
+	now := time.Now()
+	expiresAt := user.EmailVerificationExpiresAt.Time
+	if graceEnd := now.Add(h.verifyTokenGrace); graceEnd.Before(expiresAt) {
+		expiresAt = graceEnd
+	}
+	if !expiresAt.After(now) {
+		return nil
+	}
+	return q.SetPreviousVerificationToken(ctx, db.SetPreviousVerificationTokenParams{
+		UserID:    user.ID,
+		TokenHash: user.EmailVerificationTokenHash.String,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+}
+
+func verificationEmail(name, verificationURL string) (string, email.EmailParams) {
+	return "Verify your email", email.EmailParams{
+		Greeting:   fmt.Sprintf("Hi %s,", name),
+		BodyLines:  []string{"Please verify your email address to get started."},
+		ButtonText: "Verify Email",
+		ButtonURL:  verificationURL,
+		FooterText: "If you did not create an account, you can safely ignore this email.",
+	}
+}
+
+// rehashPassword replaces a verified password's hash with one at the current
+// Argon2 cost. Failures are logged and leave the old hash, which still works.
+func (h *AuthHandler) rehashPassword(ctx context.Context, user db.User, password string, ip *netip.Addr, userAgent string) {
+	hash, err := domain.HashPassword(password)
+	if err == nil {
+		err = h.queries.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+			ID:           user.ID,
+			PasswordHash: pgtype.Text{String: hash, Valid: true},
+		})
+	}
+	if err != nil {
+		h.logger.Warn("password rehash failed", logging.Err(err))
+		return
+	}
+	h.auditLogger.Log(ctx, "password_rehashed", user.ID, ip, userAgent, nil)
+}
+
+// refuseUnverifiedLogin answers a correct password login by a user whose email
+// is not verified under AUTH_REQUIRE_VERIFIED_EMAIL. Such users have no session
+// to request a resend with, so a new verification email goes out whenever the
+// resend cooldown allows one.
+func (h *AuthHandler) refuseUnverifiedLogin(w http.ResponseWriter, r *http.Request, user db.User, email string) {
+	ipAddress := h.ipFromRequest(r)
+	sent := false
+	if nextAt, err := h.nextVerificationSend(r.Context(), user.ID); err == nil && !time.Now().Before(nextAt) {
+		sent = h.sendVerificationEmail(r.Context(), user, ipAddress, r.UserAgent())
+	}
+	h.auditLogger.Log(r.Context(), "login_failure", user.ID, ipAddress, r.UserAgent(), map[string]any{
+		"email_hash": hashEmail(email),
+		"reason":     "email_not_verified",
+	})
+	writeErrorDetails(w, http.StatusForbidden, CodeEmailNotVerified, "verify your email to sign in", map[string]any{
+		"verification_email_sent": sent,
+	})
 }
 
 func (h *AuthHandler) sendLockoutEmail(ctx context.Context, user db.User, lockedUntil time.Time, ip *netip.Addr, userAgent string) {
@@ -941,21 +1425,12 @@ func (h *AuthHandler) sendLockoutEmail(ctx context.Context, user db.User, locked
 		name = user.Email
 	}
 
-	until := lockedUntil.UTC().Format(time.RFC1123)
-	subject := "Your account has been locked"
-	params := email.EmailParams{
-		Greeting: fmt.Sprintf("Hi %s,", name),
-		BodyLines: []string{
-			"We locked your account after too many failed login attempts.",
-			fmt.Sprintf("Lockout ends: %s", until),
-			fmt.Sprintf("IP address: %s", ipValue),
-		},
-		FooterText: "If this wasn't you, please reset your password immediately.",
-	}
+	subject, params := lockoutEmail(name, lockedUntil, ipValue)
 	textBody := email.RenderText(params)
 	htmlBody := email.RenderHTML(params)
 
 	if err := h.mailer.Send(ctx, user.Email, subject, textBody, htmlBody); err != nil {
+		h.logger.Error("email send failed", slog.String("type", "lockout"), logging.Err(err))
 		h.auditLogger.Log(ctx, "email_send_failed", user.ID, ip, userAgent, map[string]any{
 			"type":  "lockout",
 			"error": err.Error(),
@@ -963,6 +1438,18 @@ func (h *AuthHandler) sendLockoutEmail(ctx context.Context, user db.User, locked
 	}
 }
 
+func lockoutEmail(name string, lockedUntil time.Time, ipValue string) (string, email.EmailParams) {
+	return "Your account has been locked", email.EmailParams{
+		Greeting: fmt.Sprintf("Hi %s,", name),
+		BodyLines: []string{
+			"We locked your account after too many failed login attempts.",
+			fmt.Sprintf("Lockout ends: %s", lockedUntil.UTC().Format(time.RFC1123)),
+			fmt.Sprintf("IP address: %s", ipValue),
+		},
+		FooterText: "If this wasn't you, please reset your password immediately.",
+	}
+}
+
 func (h *AuthHandler) verificationURL(token string) string {
 	if h.appBaseURL == "" {
 		return "/api/auth/verify-email?token=" + url.QueryEscape(token)
@@ -970,43 +1457,38 @@ func (h *AuthHandler) verificationURL(token string) string {
 	return h.appBaseURL + "/api/auth/verify-email?token=" + url.QueryEscape(token)
 }
 
-func (h *AuthHandler) writeVerificationResponse(w http.ResponseWriter, r *http.Request, status int, title, message string) {
+// writeVerificationResponse answers the verify-email link. Browsers following the
+// link get a small HTML page; API clients get JSON, with code used for errors.
+func (h *AuthHandler) writeVerificationResponse(w http.ResponseWriter, r *http.Request, status int, code, title, message string) {
 	if wantsJSON(r) {
 		if status >= 400 {
-			writeJSON(w, status, map[string]string{"error": message})
+			writeError(w, status, code, message)
 			return
 		}
-		writeJSON(w, status, AuthStatusResponse{Status: "ok"})
+		writeJSON(w, status, VerifyEmailResponse{Status: "ok", Redirect: h.postVerifyRedirect})
 		return
 	}
 
-	link := h.appBaseURL
+	link := h.postVerifyRedirect
+	if link == "" {
+		link = h.appBaseURL
+	}
 	if link == "" {
 		link = "/"
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
-	w.WriteHeader(status)
-	_, _ = fmt.Fprintf(
-		w,
-		"<!doctype html><html><head><meta charset=\"utf-8\"><title>%s</title></head><body><main style=\"font-family:Arial, sans-serif; max-width:640px; margin:48px auto; padding:0 24px;\"><h1>%s</h1><p>%s</p><p><a href=\"%s\">Continue</a></p></main></body></html>",
+	// The styles are in a <style> element rather than a style attribute, which
+	// the CSP nonce cannot cover.
+	page := fmt.Sprintf(
+		"<!doctype html><html><head><meta charset=\"utf-8\"><title>%s</title><style>main{font-family:Arial, sans-serif; max-width:640px; margin:48px auto; padding:0 24px;}</style></head><body><main><h1>%s</h1><p>%s</p><p><a href=\"%s\">Continue</a></p></main></body></html>",
 		html.EscapeString(title),
 		html.EscapeString(title),
 		html.EscapeString(message),
 		html.EscapeString(link),
 	)
-}
-
-func userFromContext(ctx context.Context) (domain.SessionUser, bool) {
-	value := ctx.Value(contextKeyUser)
-	user, ok := value.(domain.SessionUser)
-	return user, ok
-}
-
-func sessionFromContext(ctx context.Context) (*domain.SessionInfo, bool) {
-	value := ctx.Value(contextKeySession)
-	session, ok := value.(*domain.SessionInfo)
-	return session, ok
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(injectCSPNonce(r, []byte(page)))
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
@@ -1015,21 +1497,32 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
+// wantsJSON reports whether the client expects JSON rather than an HTML page:
+// it asks for JSON, or Fetch Metadata marks the request as coming from script.
+// Navigations, such as a link opened from an email, get HTML.
 func wantsJSON(r *http.Request) bool {
 	accept := r.Header.Get("Accept")
 	if strings.Contains(accept, "application/json") {
 		return true
 	}
-	if r.Header.Get("Sec-Fetch-Mode") == "cors" {
-		return true
-	}
 	if r.Header.Get("X-Requested-With") != "" {
 		return true
 	}
-	return false
+	meta := fetchMetadataFrom(r)
+	return meta.scripted() || meta.mode == "cors"
 }
 
 func (h *AuthHandler) allowRequest(ctx context.Context, key string, r *http.Request, rule config.RateLimitRule) bool {
+	ip := h.ipFromRequest(r)
+	ipKey := "unknown"
+	if ip != nil {
+		ipKey = ip.String()
+	}
+
+	return h.allow(ctx, key+":"+ipKey, rule)
+}
+
+func (h *AuthHandler) allow(ctx context.Context, key string, rule config.RateLimitRule) bool {
 	if !h.rateLimits.Enabled {
 		return true
 	}
@@ -1038,30 +1531,47 @@ func (h *AuthHandler) allowRequest(ctx context.Context, key string, r *http.Requ
 		return true
 	}
 
-	if h.rateLimiter == nil {
+	limiter := h.rateLimiters[rule.Algorithm]
+	if limiter == nil {
 		return true
 	}
 
-	ip := h.ipFromRequest(r)
-	ipKey := "unknown"
-	if ip != nil {
-		ipKey = ip.String()
-	}
-
-	allowed, err := h.rateLimiter.Allow(ctx, key+":"+ipKey, rule.Limit, rule.Window)
+	allowed, err := limiter.Allow(ctx, key, rule.Limit, rule.Window)
 	if err != nil {
 		return false
 	}
 	return allowed
 }
 
-func (h *AuthHandler) revokeExistingSession(r *http.Request) bool {
-	cookie, err := r.Cookie(h.cookies.name)
+// newSessionTokens builds the session token settings from AUTH_SESSION_TOKEN_BYTES
+// and the AUTH_TOKEN_PEPPER* variables.
+func newSessionTokens(cfg config.AuthConfig) domain.SessionTokens {
+	return domain.SessionTokens{
+		Bytes:  cfg.SessionTokenBytes,
+		Hasher: domain.NewTokenHasher(cfg.TokenPepper, cfg.TokenPepperPrevious, cfg.AcceptUnpeppered),
+	}
+}
+
+// rotateExistingSession revokes the session the browser already holds before a
+// login creates a new one, unless AUTH_EXISTING_SESSION (or, when unset, the
+// flow's default) is "add".
+func (h *AuthHandler) rotateExistingSession(r *http.Request, flowDefault string, userID pgtype.UUID, ip *netip.Addr, userAgent string) {
+	policy := h.existingSession
+	if policy == "" {
+		policy = flowDefault
+	}
+	if policy != config.ExistingSessionRotate {
+		return
+	}
+
+	cookie, err := r.Cookie(h.cookies.SessionCookieName())
 	if err != nil || cookie.Value == "" {
-		return false
+		return
 	}
-	_ = h.sessions.RevokeByTokenHash(r.Context(), domain.HashToken(cookie.Value))
-	return true
+	_ = h.sessions.RevokeToken(r.Context(), cookie.Value)
+	h.auditLogger.Log(r.Context(), "session_revoked", userID, ip, userAgent, map[string]any{
+		"reason": "rotation",
+	})
 }
 
 func generateRandomToken(size int) (string, error) {
@@ -1072,58 +1582,107 @@ func generateRandomToken(size int) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
 
-func codeChallenge(verifier string) string {
-	sum := sha256.Sum256([]byte(verifier))
-	return base64.RawURLEncoding.EncodeToString(sum[:])
-}
-
-func setOAuthCookie(w http.ResponseWriter, cookies CookieManager, name, value string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     name,
-		Value:    value,
-		Path:     "/api/auth/google/callback",
-		HttpOnly: true,
-		Secure:   cookies.secure,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   int(oauthCookieMaxAge.Seconds()),
-	})
-}
+// saveOAuthState remembers entry until the callback. With a state store only an
+// opaque id is put in a cookie; if the store fails, or there is none, the values
+// go in cookies scoped to the callback path.
+func (h *AuthHandler) saveOAuthState(ctx context.Context, w http.ResponseWriter, cookies OAuthCookieSettings, entry oauthstate.Entry) {
+	if h.oauthStates != nil {
+		id, err := generateRandomToken(32)
+		if err == nil {
+			err = h.oauthStates.Save(ctx, id, entry, oauthCookieMaxAge)
+		}
+		if err == nil {
+			h.cookies.SetOAuthCookie(w, cookies, oauthStateIDCookieName, id, oauthCookieMaxAge)
+			return
+		}
+		h.logger.Warn("oauth state store failed, using cookies", logging.Err(err))
+	}
 
-func clearOAuthCookie(w http.ResponseWriter, cookies CookieManager, name string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     name,
-		Value:    "",
-		Path:     "/api/auth/google/callback",
-		HttpOnly: true,
-		Secure:   cookies.secure,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   -1,
-	})
+	h.cookies.SetOAuthCookie(w, cookies, oauthStateCookieName, entry.State, oauthCookieMaxAge)
+	h.cookies.SetOAuthCookie(w, cookies, oauthVerifierCookieName, entry.Verifier, oauthCookieMaxAge)
+	if entry.Redirect != "" {
+		h.cookies.SetOAuthCookie(w, cookies, oauthRedirectCookieName, h.encodeRedirectCookie(entry.State, entry.Redirect), oauthCookieMaxAge)
+	}
 }
 
-func (h *AuthHandler) ipFromRequest(r *http.Request) *netip.Addr {
-	if h.trustedProxyHeader != "" {
-		if value := r.Header.Get(h.trustedProxyHeader); value != "" {
-			raw := strings.TrimSpace(strings.SplitN(value, ",", 2)[0])
-			if addr, err := netip.ParseAddr(raw); err == nil {
-				return &addr
-			}
+// takeOAuthState returns what saveOAuthState stored for this browser and clears
+// it, so each login can be completed once.
+func (h *AuthHandler) takeOAuthState(w http.ResponseWriter, r *http.Request, cookies OAuthCookieSettings) (oauthstate.Entry, bool) {
+	if idCookie, err := r.Cookie(oauthStateIDCookieName); err == nil && idCookie.Value != "" {
+		h.cookies.ClearOAuthCookie(w, cookies, oauthStateIDCookieName)
+		if h.oauthStates == nil {
+			return oauthstate.Entry{}, false
+		}
+		entry, found, err := h.oauthStates.Take(r.Context(), idCookie.Value)
+		if err != nil {
+			h.logger.Error("oauth state lookup failed", logging.Err(err))
+			return oauthstate.Entry{}, false
 		}
+		return entry, found && entry.State != "" && entry.Verifier != ""
 	}
 
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		if addr, parseErr := netip.ParseAddr(r.RemoteAddr); parseErr == nil {
-			return &addr
+	stateCookie, err := r.Cookie(oauthStateCookieName)
+	if err != nil || stateCookie.Value == "" {
+		return oauthstate.Entry{}, false
+	}
+	verifierCookie, err := r.Cookie(oauthVerifierCookieName)
+	if err != nil || verifierCookie.Value == "" {
+		return oauthstate.Entry{}, false
+	}
+	h.cookies.ClearOAuthCookie(w, cookies, oauthStateCookieName)
+	h.cookies.ClearOAuthCookie(w, cookies, oauthVerifierCookieName)
+	entry := oauthstate.Entry{State: stateCookie.Value, Verifier: verifierCookie.Value}
+
+	if redirectCookie, err := r.Cookie(oauthRedirectCookieName); err == nil && redirectCookie.Value != "" {
+		h.cookies.ClearOAuthCookie(w, cookies, oauthRedirectCookieName)
+		if redirect, ok := h.decodeRedirectCookie(entry.State, redirectCookie.Value); ok {
+			// The cookie is client-held, so the target is checked again.
+			entry.Redirect, _ = h.returnURLs.resolve(redirect)
 		}
-		return nil
 	}
+	return entry, true
+}
+
+// encodeRedirectCookie base64url-encodes redirect, since paths may hold bytes
+// that are not valid in a cookie value, and with GOOGLE_OAUTH_STATE_KEY set
+// appends an HMAC binding it to this login's state.
+func (h *AuthHandler) encodeRedirectCookie(state, redirect string) string {
+	value := base64.RawURLEncoding.EncodeToString([]byte(redirect))
+	if h.oauthStateKeys.Empty() {
+		return value
+	}
+	return value + "." + h.oauthStateKeys.Sign(redirectSigningInput(state, redirect))
+}
 
-	addr, err := netip.ParseAddr(host)
+// decodeRedirectCookie reverses encodeRedirectCookie. With a state key, values
+// without a signature from the current or a previous key are rejected.
+func (h *AuthHandler) decodeRedirectCookie(state, value string) (string, bool) {
+	encoded, sig, signed := strings.Cut(value, ".")
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
 	if err != nil {
-		return nil
+		return "", false
+	}
+	redirect := string(raw)
+	if h.oauthStateKeys.Empty() {
+		return redirect, true
 	}
-	return &addr
+	if !signed || !h.oauthStateKeys.Verify(redirectSigningInput(state, redirect), sig) {
+		return "", false
+	}
+	return redirect, true
+}
+
+func redirectSigningInput(state, redirect string) string {
+	return "oauth_redirect\n" + state + "\n" + redirect
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (h *AuthHandler) ipFromRequest(r *http.Request) *netip.Addr {
+	return h.proxies.clientIP(r)
 }
 
 func isUniqueViolation(err error) bool {
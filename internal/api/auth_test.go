@@ -0,0 +1,255 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+const testPassword = "Correct-Horse-Battery-9"
+
+// testAuthRoutes mounts the handlers the auth tests exercise the way NewRouter
+// does.
+func testAuthRoutes(h *AuthHandler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/auth/register", h.HandleRegister)
+	mux.HandleFunc("POST /api/auth/login", h.HandleLogin)
+	mux.Handle("GET /api/auth/me", h.RequireAuthOrAPIKey(h.RequireScope(domain.ScopeProfileRead, http.HandlerFunc(h.HandleMe))))
+	mux.Handle("POST /api/auth/logout", h.RequireAuth(http.HandlerFunc(h.HandleLogout)))
+	return mux
+}
+
+// serve sends a request to handler with body encoded as JSON, and cookie when
+// it is not nil.
+func serve(t *testing.T, handler http.Handler, method, path string, body any, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// sessionCookie returns the session cookie rec set, failing the test if there
+// is none.
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	t.Fatalf("no %s cookie in response", name)
+	return nil
+}
+
+func register(t *testing.T, handler http.Handler, email string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := serve(t, handler, http.MethodPost, "/api/auth/register", RegisterRequest{Email: email, Password: testPassword, Name: "Test User"}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("register: status %d, body %s", rec.Code, rec.Body)
+	}
+	return rec
+}
+
+func TestRegisterLoginMeLogout(t *testing.T) {
+	cfg := testAuthConfig()
+	h, queries, audit := newTestAuthHandler(t, cfg)
+	routes := testAuthRoutes(h)
+
+	rec := register(t, routes, "User@Example.com")
+	var registered RegisterResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &registered); err != nil {
+		t.Fatal(err)
+	}
+	if registered.Status != "ok" || registered.EmailVerified == nil || *registered.EmailVerified {
+		t.Fatalf("register response = %s", rec.Body)
+	}
+	sessionCookie(t, rec, cfg.CookieName)
+
+	rec = serve(t, routes, http.MethodPost, "/api/auth/login", LoginRequest{Email: "user@example.com", Password: testPassword}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d, body %s", rec.Code, rec.Body)
+	}
+	cookie := sessionCookie(t, rec, cfg.CookieName)
+	if cookie.MaxAge != 0 {
+		t.Errorf("login without remember set MaxAge %d, want a browser-session cookie", cookie.MaxAge)
+	}
+	if len(audit.find("login_success")) != 1 {
+		t.Errorf("login_success events = %d, want 1", len(audit.find("login_success")))
+	}
+
+	rec = serve(t, routes, http.MethodGet, "/api/auth/me", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("me: status %d, body %s", rec.Code, rec.Body)
+	}
+	var me AuthMeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &me); err != nil {
+		t.Fatal(err)
+	}
+	if me.Email != "user@example.com" || me.Provider != "credentials" || me.Role != domain.RoleUser {
+		t.Errorf("me = %+v", me)
+	}
+	if len(me.AuthMethods) != 1 || me.AuthMethods[0] != domain.AuthMethodPassword {
+		t.Errorf("auth methods = %v, want [password]", me.AuthMethods)
+	}
+
+	rec = serve(t, routes, http.MethodPost, "/api/auth/logout", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logout: status %d, body %s", rec.Code, rec.Body)
+	}
+	if cleared := sessionCookie(t, rec, cfg.CookieName); cleared.MaxAge >= 0 || cleared.Value != "" {
+		t.Errorf("logout cookie = %+v, want it cleared", cleared)
+	}
+	// Register's session is left; only the logged-out one is gone.
+	if n := len(queries.sessions); n != 1 {
+		t.Errorf("sessions after logout = %d, want 1", n)
+	}
+
+	rec = serve(t, routes, http.MethodGet, "/api/auth/me", nil, cookie)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("me after logout: status %d, want 401", rec.Code)
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	cfg := testAuthConfig()
+	h, _, audit := newTestAuthHandler(t, cfg)
+	routes := testAuthRoutes(h)
+	register(t, routes, "user@example.com")
+
+	for _, email := range []string{"user@example.com", "nobody@example.com"} {
+		rec := serve(t, routes, http.MethodPost, "/api/auth/login", LoginRequest{Email: email, Password: "Wrong-Password-1"}, nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("login as %s: status %d, want 401", email, rec.Code)
+		}
+		var apiErr APIError
+		if err := json.Unmarshal(rec.Body.Bytes(), &apiErr); err != nil {
+			t.Fatal(err)
+		}
+		// Unknown emails and wrong passwords must look the same.
+		if apiErr.Code != CodeInvalidCredentials {
+			t.Errorf("login as %s: code %q, want %q", email, apiErr.Code, CodeInvalidCredentials)
+		}
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == cfg.CookieName {
+				t.Errorf("failed login as %s set a session cookie", email)
+			}
+		}
+	}
+	if n := len(audit.find("login_failure")); n != 2 {
+		t.Errorf("login_failure events = %d, want 2", n)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	h, queries, audit := newTestAuthHandler(t, testAuthConfig())
+	routes := testAuthRoutes(h)
+	register(t, routes, "user@example.com")
+
+	for i := range 10 {
+		rec := serve(t, routes, http.MethodPost, "/api/auth/login", LoginRequest{Email: "user@example.com", Password: "Wrong-Password-1"}, nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, rec.Code)
+		}
+		if locks := len(audit.find("account_lockout")); (i < 9 && locks != 0) || (i == 9 && locks != 1) {
+			t.Fatalf("after attempt %d: account_lockout events = %d", i+1, locks)
+		}
+	}
+
+	user, err := queries.GetUserByEmail(t.Context(), "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !domain.AccountLocked(user.LockedUntil, user.CreatedAt.Time) {
+		t.Fatalf("locked_until = %v after 10 failures, want a lock", user.LockedUntil)
+	}
+
+	// The right password does not get through a lock, and looks like a wrong one.
+	rec := serve(t, routes, http.MethodPost, "/api/auth/login", LoginRequest{Email: "user@example.com", Password: testPassword}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("login while locked: status %d, want 401", rec.Code)
+	}
+	failures := audit.find("login_failure")
+	if last := failures[len(failures)-1]; last.metadata["reason"] != "locked" {
+		t.Errorf("last login_failure reason = %v, want locked", last.metadata["reason"])
+	}
+}
+
+func TestRequireAuthClearsUnknownSessionCookie(t *testing.T) {
+	h, _, _ := newTestAuthHandler(t, testAuthConfig())
+	cookies := &recordingCookies{name: "session"}
+	h.cookies = cookies
+	protected := h.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler reached without a session")
+	}))
+
+	rec := serve(t, protected, http.MethodGet, "/api/auth/session", nil, &http.Cookie{Name: "session", Value: "unknown"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want 401", rec.Code)
+	}
+	if cookies.cleared != 1 {
+		t.Errorf("session cookie cleared %d times, want 1", cookies.cleared)
+	}
+}
+
+func TestRegisterRequiredVerificationHidesDuplicates(t *testing.T) {
+	cfg := testAuthConfig()
+	cfg.RequireVerifiedEmail = true
+	h, _, audit := newTestAuthHandler(t, cfg)
+	routes := testAuthRoutes(h)
+
+	created := register(t, routes, "user@example.com")
+	duplicate := register(t, routes, "user@example.com")
+	if len(audit.find("register_duplicate")) != 1 {
+		t.Fatalf("second register was not a duplicate")
+	}
+	if created.Body.String() != duplicate.Body.String() {
+		t.Errorf("new account body %s, duplicate body %s; want them equal", created.Body, duplicate.Body)
+	}
+	for _, rec := range []*httptest.ResponseRecorder{created, duplicate} {
+		if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("register set cookies %v, want none", cookies)
+		}
+	}
+}
+
+func TestFinishOAuthLoginRefusesLockedAccount(t *testing.T) {
+	cfg := testAuthConfig()
+	h, queries, audit := newTestAuthHandler(t, cfg)
+	user, err := queries.CreateUser(t.Context(), db.CreateUserParams{Email: "user@example.com", Name: "Test User", Provider: "google"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.LockedUntil = pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/google/callback", nil)
+	rec := httptest.NewRecorder()
+	h.finishOAuthLogin(rec, req, user, domain.AuthMethodGoogle, "", nil)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", rec.Code)
+	}
+	if len(queries.sessions) != 0 || len(rec.Result().Cookies()) != 0 {
+		t.Error("a locked account got a session")
+	}
+	failures := audit.find("oauth_login_failure")
+	if len(failures) != 1 || failures[0].metadata["reason"] != "locked" {
+		t.Errorf("oauth_login_failure events = %+v, want one with reason locked", failures)
+	}
+}
@@ -1,27 +1,61 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/imaging"
+	"github.com/mounis-bhat/starter/internal/logging"
 	"github.com/mounis-bhat/starter/internal/storage"
 	"github.com/mounis-bhat/starter/internal/storage/blob"
 	"github.com/mounis-bhat/starter/internal/storage/db"
 )
 
 const (
-	avatarMaxBytesDefault = 5 * 1024 * 1024
+	avatarMaxBytesDefault     = 5 * 1024 * 1024
+	avatarMaxDimensionDefault = 4096
+	avatarStem                = "avatar."
+	avatarUploadStem          = "upload."
 )
 
+// avatarFormats maps allowed key extensions to the format name reported by image.DecodeConfig.
+var avatarFormats = map[string]string{
+	"jpg":  "jpeg",
+	"png":  "png",
+	"webp": "webp",
+}
+
 type AvatarHandler struct {
-	queries   *db.Queries
-	blob      *blob.Client
-	maxBytes  int64
-	allowList map[string]string
+	queries       *db.Queries
+	blob          blob.Store
+	multipart     blob.MultipartStore
+	poster        blob.PostPresigner
+	maxBytes      int64
+	maxDimension  int
+	thumbnailSize int
+	partSize      int64
+	allowList     map[string]string
+	transcodeWebP bool
+	quality       int
+	downloadTTL   time.Duration
+	auditLogger   AuditRecorder
+	sessions      domain.SessionManager
+	proxies       trustedProxies
+	logger        *slog.Logger
 }
 
 type AvatarUploadURLRequest struct {
@@ -37,6 +71,13 @@ type AvatarUploadURLResponse struct {
 	ExpiresAt time.Time           `json:"expires_at"`
 }
 
+type AvatarUploadFormResponse struct {
+	Key       string            `json:"key"`
+	URL       string            `json:"url"`
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
 type AvatarConfirmRequest struct {
 	Key string `json:"key"`
 }
@@ -44,23 +85,49 @@ type AvatarConfirmRequest struct {
 type AvatarURLResponse struct {
 	URL       *string    `json:"url"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ETag      *string    `json:"etag,omitempty"`
 }
 
-func NewAvatarHandler(store *storage.Store, blobClient *blob.Client, cfg config.StorageConfig) *AvatarHandler {
+func NewAvatarHandler(store *storage.Store, blobStore blob.Store, cfg config.StorageConfig, authCfg config.AuthConfig, auditCfg config.AuditConfig, logger *slog.Logger) *AvatarHandler {
 	maxBytes := cfg.AvatarMaxBytes
 	if maxBytes <= 0 {
 		maxBytes = avatarMaxBytesDefault
 	}
 
+	partSize := cfg.MultipartPartSize
+	if partSize < blob.MinPartSize {
+		partSize = blob.MinPartSize
+	}
+
+	maxDimension := cfg.AvatarMaxDimension
+	if maxDimension <= 0 {
+		maxDimension = avatarMaxDimensionDefault
+	}
+
+	// Multipart and POST uploads are optional backend capabilities.
+	multipart, _ := blobStore.(blob.MultipartStore)
+	poster, _ := blobStore.(blob.PostPresigner)
+
 	return &AvatarHandler{
-		queries:  store.Queries,
-		blob:     blobClient,
-		maxBytes: maxBytes,
+		queries:       store.Queries,
+		blob:          blobStore,
+		multipart:     multipart,
+		poster:        poster,
+		maxBytes:      maxBytes,
+		maxDimension:  maxDimension,
+		thumbnailSize: cfg.AvatarThumbnailSize,
+		partSize:      partSize,
 		allowList: map[string]string{
 			"image/jpeg": "jpg",
 			"image/png":  "png",
 			"image/webp": "webp",
 		},
+		transcodeWebP: cfg.AvatarTranscodeWebP,
+		quality:       cfg.AvatarQuality,
+		downloadTTL:   cfg.PresignDownloadTTL,
+		auditLogger:   NewAuditLogger(store.Queries, auditCfg),
+		proxies:       newTrustedProxies(authCfg.TrustedProxy),
+		logger:        logger,
 	}
 }
 
@@ -72,52 +139,54 @@ func NewAvatarHandler(store *storage.Store, blobClient *blob.Client, cfg config.
 // @Produce      json
 // @Param        request body AvatarUploadURLRequest true "Upload URL request"
 // @Success      200  {object}  AvatarUploadURLResponse
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      503  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/avatar/upload-url [post]
 func (h *AvatarHandler) HandleAvatarUploadURL(w http.ResponseWriter, r *http.Request) {
 	if h.blob == nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "storage unavailable"})
+		writeError(w, http.StatusServiceUnavailable, CodeStorageUnavailable, "storage unavailable")
 		return
 	}
 
-	user, ok := userFromContext(r.Context())
+	user, ok := ctxkeys.User(r.Context())
 	if !ok {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	var req AvatarUploadURLRequest
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		writeBodyError(w, err)
 		return
 	}
 
 	contentType := strings.ToLower(strings.TrimSpace(strings.Split(req.ContentType, ";")[0]))
 	ext, ok := h.allowList[contentType]
 	if !ok {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported content type"})
+		writeError(w, http.StatusBadRequest, CodeUnsupportedMedia, "unsupported content type")
 		return
 	}
 
 	if req.Size <= 0 || req.Size > h.maxBytes {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid file size"})
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "invalid file size")
 		return
 	}
 
 	if user.ID == "" {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
-	key := "users/" + user.ID + "/avatar." + ext
+	key := "users/" + user.ID + "/" + h.uploadStem() + ext
 
 	presigned, err := h.blob.PresignPutObject(r.Context(), key, contentType)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create upload url"})
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, "failed to create upload url")
 		return
 	}
 
@@ -130,127 +199,289 @@ func (h *AvatarHandler) HandleAvatarUploadURL(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// HandleAvatarUploadForm creates a presigned POST form for avatar uploads
+// @Summary      Get avatar upload form
+// @Description  Creates a presigned POST form for uploading a profile image. The policy enforces the content type and size limit; send the fields followed by a "file" field as multipart/form-data.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body AvatarUploadURLRequest true "Upload form request"
+// @Success      200  {object}  AvatarUploadFormResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      501  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/avatar/upload-form [post]
+func (h *AvatarHandler) HandleAvatarUploadForm(w http.ResponseWriter, r *http.Request) {
+	if h.blob == nil {
+		writeError(w, http.StatusServiceUnavailable, CodeStorageUnavailable, "storage unavailable")
+		return
+	}
+	if h.poster == nil {
+		writeError(w, http.StatusNotImplemented, CodeNotSupported, "form uploads are not supported by the storage backend")
+		return
+	}
+
+	user, ok := ctxkeys.User(r.Context())
+	if !ok || user.ID == "" {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	var req AvatarUploadURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(req.ContentType, ";")[0]))
+	ext, ok := h.allowList[contentType]
+	if !ok {
+		writeError(w, http.StatusBadRequest, CodeUnsupportedMedia, "unsupported content type")
+		return
+	}
+
+	if req.Size <= 0 || req.Size > h.maxBytes {
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "invalid file size")
+		return
+	}
+
+	key := "users/" + user.ID + "/" + h.uploadStem() + ext
+
+	// The declared size is only a hint; the policy caps the upload at the configured maximum.
+	presigned, err := h.poster.PresignPostObject(r.Context(), key, contentType, 1, h.maxBytes)
+	if err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, "failed to create upload form")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AvatarUploadFormResponse{
+		Key:       key,
+		URL:       presigned.URL,
+		Fields:    presigned.Fields,
+		ExpiresAt: presigned.Expires,
+	})
+}
+
 // HandleAvatarConfirm confirms the uploaded avatar and saves it
 // @Summary      Confirm avatar upload
-// @Description  Validates the uploaded object and stores it on the user
+// @Description  Downloads the uploaded object, verifies it is a still image matching its extension and size limits, optionally re-encodes it, and stores it on the user
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        request body AvatarConfirmRequest true "Confirm upload request"
 // @Success      200  {object}  AvatarURLResponse
-// @Failure      400  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      503  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/avatar/confirm [post]
 func (h *AvatarHandler) HandleAvatarConfirm(w http.ResponseWriter, r *http.Request) {
 	if h.blob == nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "storage unavailable"})
+		writeError(w, http.StatusServiceUnavailable, CodeStorageUnavailable, "storage unavailable")
 		return
 	}
 
-	user, ok := userFromContext(r.Context())
+	user, ok := ctxkeys.User(r.Context())
 	if !ok {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	var req AvatarConfirmRequest
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		writeBodyError(w, err)
 		return
 	}
 
 	key := strings.TrimSpace(req.Key)
 	if key == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid key"})
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid key")
 		return
 	}
 
 	prefix := "users/" + user.ID + "/"
 	if !h.isAllowedAvatarKey(key, prefix) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid key"})
-		return
-	}
-
-	if err := h.blob.HeadObject(r.Context(), key); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "upload not found"})
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid key")
 		return
 	}
 
 	userID := uuidFromString(user.ID)
 	if !userID.Valid {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	stored, err := h.queries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	// A repeated confirm for the avatar already on the user is a no-op.
+	if stored.Picture.Valid && strings.TrimSpace(stored.Picture.String) == key {
+		h.logger.Debug("duplicate avatar confirm", slog.String("user_id", user.ID), slog.String("key", key))
+		h.writeAvatarURL(w, r, key, stored.PictureEtag.String)
+		return
+	}
+
+	data, err := h.blob.GetObject(r.Context(), key, h.maxBytes)
+	if err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		if errors.Is(err, blob.ErrObjectTooLarge) {
+			h.discardUpload(r, key)
+			writeError(w, http.StatusBadRequest, CodeInvalidUpload, "invalid file size")
+			return
+		}
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "upload not found")
+		return
+	}
+
+	if err := h.validateAvatar(data, key); err != nil {
+		h.logger.Info("avatar rejected", slog.String("key", key), logging.Err(err))
+		h.discardUpload(r, key)
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "invalid image")
 		return
 	}
 
-	_, err = h.queries.UpdateUser(r.Context(), db.UpdateUserParams{
-		ID:      userID,
-		Picture: pgtype.Text{String: key, Valid: true},
+	if h.processesUploads() {
+		canonicalKey, err := h.storeProcessedAvatar(r, data, key, prefix)
+		if err != nil {
+			h.logger.Warn("avatar processing failed", slog.String("key", key), logging.Err(err))
+			h.discardUpload(r, key)
+			writeError(w, http.StatusBadRequest, CodeInvalidUpload, "invalid image")
+			return
+		}
+		key = canonicalKey
+	}
+
+	// The ETag lets HandleAvatarURL answer conditional requests without touching storage.
+	etag := ""
+	if metadata, err := h.blob.HeadObjectMetadata(r.Context(), key); err != nil {
+		h.logger.Warn("failed to read avatar metadata", slog.String("key", key), logging.Err(err))
+	} else {
+		etag = metadata.ETag
+	}
+
+	err = h.queries.SetUserPicture(r.Context(), db.SetUserPictureParams{
+		ID:          userID,
+		Picture:     pgtype.Text{String: key, Valid: true},
+		PictureEtag: pgtype.Text{String: etag, Valid: etag != ""},
 	})
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
+	h.sessions.EvictUserSessions(r.Context(), userID)
 
 	if stored.Picture.Valid {
 		oldKey := strings.TrimSpace(stored.Picture.String)
 		if oldKey != "" && oldKey != key && shouldDeleteAvatarKey(oldKey, prefix) {
-			_ = h.blob.DeleteObject(r.Context(), oldKey)
+			if err := h.blob.DeleteObject(r.Context(), oldKey); err != nil {
+				h.logger.Warn("failed to delete previous avatar", slog.String("key", oldKey), logging.Err(err))
+			}
 		}
 	}
 
-	presigned, err := h.blob.PresignGetObject(r.Context(), key)
+	h.writeAvatarURL(w, r, key, etag)
+}
+
+// HandleAvatarDelete removes the current avatar
+// @Summary      Delete avatar
+// @Description  Clears the user's avatar and deletes the stored image when it is managed by this service
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  AvatarURLResponse
+// @Failure      401  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/avatar [delete]
+func (h *AvatarHandler) HandleAvatarDelete(w http.ResponseWriter, r *http.Request) {
+	user, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	userID := uuidFromString(user.ID)
+	if !userID.Valid {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	stored, err := h.queries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create download url"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
-	url := presigned.URL
-	writeJSON(w, http.StatusOK, AvatarURLResponse{
-		URL:       &url,
-		ExpiresAt: &presigned.Expires,
+	oldKey := strings.TrimSpace(stored.Picture.String)
+	if !stored.Picture.Valid || oldKey == "" {
+		writeJSON(w, http.StatusOK, AvatarURLResponse{})
+		return
+	}
+
+	if err := h.queries.ClearUserPicture(r.Context(), userID); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	h.sessions.EvictUserSessions(r.Context(), userID)
+
+	// External (OAuth provider) URLs are only unlinked. A managed object that
+	// is already gone is not an error.
+	objectDeleted := false
+	if h.blob != nil && shouldDeleteAvatarKey(oldKey, "users/"+user.ID+"/") {
+		if err := h.blob.DeleteObject(r.Context(), oldKey); err != nil {
+			h.logger.Warn("failed to delete avatar", slog.String("key", oldKey), logging.Err(err))
+		} else {
+			objectDeleted = true
+		}
+	}
+
+	h.auditLogger.Log(r.Context(), "avatar_deleted", userID, h.proxies.clientIP(r), r.UserAgent(), map[string]any{
+		"object_deleted": objectDeleted,
 	})
+	writeJSON(w, http.StatusOK, AvatarURLResponse{})
 }
 
 // HandleAvatarURL returns a presigned URL for the user's avatar
 // @Summary      Get avatar URL
-// @Description  Returns a presigned GET URL for the current avatar
+// @Description  Returns a presigned GET URL for the current avatar. Supports If-None-Match; a 304 means the previously returned URL is still valid.
 // @Tags         auth
 // @Produce      json
+// @Param        If-None-Match  header  string  false  "ETag from a previous response"
 // @Success      200  {object}  AvatarURLResponse
-// @Failure      401  {object}  map[string]string
-// @Failure      503  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Success      304  "Not modified"
+// @Failure      401  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Failure      500  {object}  APIError
 // @Router       /auth/avatar-url [get]
 func (h *AvatarHandler) HandleAvatarURL(w http.ResponseWriter, r *http.Request) {
 	if h.blob == nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "storage unavailable"})
+		writeError(w, http.StatusServiceUnavailable, CodeStorageUnavailable, "storage unavailable")
 		return
 	}
 
-	user, ok := userFromContext(r.Context())
+	user, ok := ctxkeys.User(r.Context())
 	if !ok {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	userID := uuidFromString(user.ID)
 	if !userID.Valid {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 		return
 	}
 
 	stored, err := h.queries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
 		return
 	}
 
@@ -265,35 +496,261 @@ func (h *AvatarHandler) HandleAvatarURL(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	presigned, err := h.blob.PresignGetObject(r.Context(), value)
+	if tag := h.avatarResponseETag(value, stored.PictureEtag.String); tag != "" {
+		w.Header().Set("ETag", tag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), tag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	h.writeAvatarURL(w, r, value, stored.PictureEtag.String)
+}
+
+func (h *AvatarHandler) writeAvatarURL(w http.ResponseWriter, r *http.Request, key, etag string) {
+	presigned, err := h.blob.PresignGetObject(r.Context(), key)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create download url"})
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, "failed to create download url")
 		return
 	}
 
 	url := presigned.URL
-	writeJSON(w, http.StatusOK, AvatarURLResponse{
+	response := AvatarURLResponse{
 		URL:       &url,
 		ExpiresAt: &presigned.Expires,
+	}
+	if etag != "" {
+		response.ETag = &etag
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleAdminAvatarDownload returns the stored avatar bytes for any user
+// @Summary      Download a user's avatar (admin)
+// @Description  Streams a user's stored avatar through the server so tooling can export avatars without storage credentials. External (OAuth provider) avatars are not served.
+// @Tags         admin
+// @Produce      image/jpeg,image/png,image/webp
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {file}    file
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /admin/users/{id}/avatar [get]
+func (h *AvatarHandler) HandleAdminAvatarDownload(w http.ResponseWriter, r *http.Request) {
+	if h.blob == nil {
+		writeError(w, http.StatusServiceUnavailable, CodeStorageUnavailable, "storage unavailable")
+		return
+	}
+
+	admin, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	userID := uuidFromString(r.PathValue("id"))
+	if !userID.Valid {
+		writeError(w, http.StatusNotFound, CodeNotFound, "avatar not found")
+		return
+	}
+
+	stored, err := h.queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, CodeNotFound, "avatar not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	key := strings.TrimSpace(stored.Picture.String)
+	if !stored.Picture.Valid || key == "" || strings.HasPrefix(key, "http://") || strings.HasPrefix(key, "https://") {
+		writeError(w, http.StatusNotFound, CodeNotFound, "avatar not found")
+		return
+	}
+
+	metadata, err := h.blob.HeadObjectMetadata(r.Context(), key)
+	if err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		h.logger.Warn("admin avatar download: object missing", slog.String("key", key), logging.Err(err))
+		writeError(w, http.StatusNotFound, CodeNotFound, "avatar not found")
+		return
+	}
+
+	data, err := h.blob.GetObject(r.Context(), key, h.maxBytes)
+	if err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		h.logger.Warn("admin avatar download failed", slog.String("key", key), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, CodeInternal, "failed to read avatar")
+		return
+	}
+
+	// Objects written before content types were recorded fall back to sniffing.
+	contentType := metadata.ContentType
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+
+	h.auditLogger.Log(r.Context(), "admin_avatar_downloaded", uuidFromString(admin.ID), h.proxies.clientIP(r), r.UserAgent(), map[string]any{
+		"target_user_id": r.PathValue("id"),
+		"key":            key,
 	})
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, r.PathValue("id"), path.Ext(key)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if metadata.ETag != "" {
+		w.Header().Set("ETag", metadata.ETag)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// avatarResponseETag derives the validator for HandleAvatarURL from the object ETag and
+// the current half-TTL window. A URL issued anywhere in a window stays valid until the
+// window ends, so answering 304 within the same window never hands back an expired URL.
+func (h *AvatarHandler) avatarResponseETag(key, objectETag string) string {
+	window := h.downloadTTL / 2
+	if objectETag == "" || window < time.Second {
+		return ""
+	}
+
+	bucket := time.Now().UnixNano() / int64(window)
+	sum := sha256.Sum256([]byte(key + "\n" + objectETag + "\n" + strconv.FormatInt(bucket, 10)))
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// writeBlobThrottled answers 503 with Retry-After when storage is shedding load,
+// reporting whether it wrote a response.
+func writeBlobThrottled(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, blob.ErrThrottled) {
+		return false
+	}
+	w.Header().Set("Retry-After", "1")
+	writeError(w, http.StatusServiceUnavailable, CodeStorageBusy, "storage busy")
+	return true
+}
+
+// etagMatches implements the weak comparison used for If-None-Match.
+func etagMatches(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAvatar checks that the uploaded bytes are a still image whose real
+// format matches the key extension and whose dimensions are within bounds.
+func (h *AvatarHandler) validateAvatar(data []byte, key string) error {
+	info, err := imaging.Inspect(data)
+	if err != nil {
+		return err
+	}
+
+	ext := key[strings.LastIndex(key, ".")+1:]
+	if avatarFormats[ext] != info.Format {
+		return fmt.Errorf("format %q does not match extension %q", info.Format, ext)
+	}
+
+	if info.Width <= 0 || info.Height <= 0 || info.Width > h.maxDimension || info.Height > h.maxDimension {
+		return fmt.Errorf("dimensions %dx%d exceed %d", info.Width, info.Height, h.maxDimension)
+	}
+	return nil
+}
+
+// storeProcessedAvatar re-encodes an uploaded avatar (optionally as a square
+// thumbnail), writes it to the canonical avatar key, and removes the upload.
+func (h *AvatarHandler) storeProcessedAvatar(r *http.Request, data []byte, uploadKey, prefix string) (string, error) {
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return "", err
+	}
+
+	if h.thumbnailSize > 0 {
+		img = imaging.SquareThumbnail(img, h.thumbnailSize)
+	}
+
+	var encoded []byte
+	contentType := imaging.JPEGContentType
+	canonicalKey := prefix + avatarStem + "jpg"
+	if h.transcodeWebP {
+		contentType = imaging.WebPContentType
+		canonicalKey = prefix + avatarStem + "webp"
+		encoded, err = imaging.EncodeWebP(img, h.quality)
+	} else {
+		encoded, err = imaging.EncodeJPEG(img, h.quality)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := h.blob.PutObject(r.Context(), canonicalKey, contentType, encoded); err != nil {
+		return "", err
+	}
+
+	h.discardUpload(r, uploadKey)
+	return canonicalKey, nil
+}
+
+func (h *AvatarHandler) discardUpload(r *http.Request, key string) {
+	if err := h.blob.DeleteObject(r.Context(), key); err != nil {
+		h.logger.Warn("failed to delete avatar upload", slog.String("key", key), logging.Err(err))
+	}
+}
+
+// processesUploads reports whether confirmed uploads are re-encoded server-side.
+func (h *AvatarHandler) processesUploads() bool {
+	return h.transcodeWebP || h.thumbnailSize > 0
+}
+
+// uploadStem returns the key stem clients upload to. When uploads are
+// processed, they land on a staging key so they never overwrite the canonical
+// avatar directly.
+func (h *AvatarHandler) uploadStem() string {
+	if h.processesUploads() {
+		return avatarUploadStem
+	}
+	return avatarStem
 }
 
 func shouldDeleteAvatarKey(value, prefix string) bool {
 	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
 		return false
 	}
-	if !strings.HasPrefix(value, prefix+"avatar.") {
+	if !strings.HasPrefix(value, prefix+avatarStem) {
 		return false
 	}
 	return true
 }
 
 func (h *AvatarHandler) isAllowedAvatarKey(key, prefix string) bool {
-	if !strings.HasPrefix(key, prefix+"avatar.") {
+	stem := prefix + h.uploadStem()
+	if !strings.HasPrefix(key, stem) {
 		return false
 	}
 
-	ext := strings.TrimPrefix(key, prefix+"avatar.")
+	ext := strings.TrimPrefix(key, stem)
 	if ext == "" {
 		return false
 	}
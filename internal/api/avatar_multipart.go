@@ -0,0 +1,312 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/storage/blob"
+)
+
+type AvatarMultipartCreateRequest struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type AvatarMultipartCreateResponse struct {
+	Key       string `json:"key"`
+	UploadID  string `json:"upload_id"`
+	PartSize  int64  `json:"part_size"`
+	PartCount int32  `json:"part_count"`
+}
+
+type AvatarMultipartPartURLRequest struct {
+	Key        string `json:"key"`
+	UploadID   string `json:"upload_id"`
+	PartNumber int32  `json:"part_number"`
+}
+
+type AvatarMultipartPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+type AvatarMultipartPartsResponse struct {
+	Parts []AvatarMultipartPart `json:"parts"`
+}
+
+type AvatarMultipartCompleteRequest struct {
+	Key      string                `json:"key"`
+	UploadID string                `json:"upload_id"`
+	Parts    []AvatarMultipartPart `json:"parts"`
+}
+
+type AvatarMultipartAbortRequest struct {
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id"`
+}
+
+// HandleAvatarMultipartCreate starts a multipart avatar upload
+// @Summary      Start multipart avatar upload
+// @Description  Starts a multipart upload for a large profile image. Upload each part with a presigned URL, then complete and confirm.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body AvatarMultipartCreateRequest true "Multipart upload request"
+// @Success      200  {object}  AvatarMultipartCreateResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      501  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/avatar/multipart [post]
+func (h *AvatarHandler) HandleAvatarMultipartCreate(w http.ResponseWriter, r *http.Request) {
+	if !h.requireMultipart(w) {
+		return
+	}
+
+	user, ok := ctxkeys.User(r.Context())
+	if !ok || user.ID == "" {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	var req AvatarMultipartCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(req.ContentType, ";")[0]))
+	ext, ok := h.allowList[contentType]
+	if !ok {
+		writeError(w, http.StatusBadRequest, CodeUnsupportedMedia, "unsupported content type")
+		return
+	}
+
+	if req.Size <= 0 || req.Size > h.maxBytes {
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "invalid file size")
+		return
+	}
+
+	partSize := h.partSize
+	partCount := (req.Size + partSize - 1) / partSize
+	if partCount > blob.MaxParts {
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "invalid file size")
+		return
+	}
+
+	key := "users/" + user.ID + "/" + h.uploadStem() + ext
+	uploadID, err := h.multipart.CreateMultipartUpload(r.Context(), key, contentType)
+	if err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, "failed to create upload")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AvatarMultipartCreateResponse{
+		Key:       key,
+		UploadID:  uploadID,
+		PartSize:  partSize,
+		PartCount: int32(partCount),
+	})
+}
+
+// HandleAvatarMultipartPartURL presigns a single part of a multipart avatar upload
+// @Summary      Get multipart part upload URL
+// @Description  Creates a presigned PUT URL for one part of a multipart avatar upload. The response ETag header must be sent back on completion.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body AvatarMultipartPartURLRequest true "Part URL request"
+// @Success      200  {object}  AvatarUploadURLResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      501  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/avatar/multipart/part-url [post]
+func (h *AvatarHandler) HandleAvatarMultipartPartURL(w http.ResponseWriter, r *http.Request) {
+	var req AvatarMultipartPartURLRequest
+	if !h.decodeMultipartRequest(w, r, &req, &req.Key, &req.UploadID) {
+		return
+	}
+
+	presigned, err := h.multipart.PresignUploadPart(r.Context(), req.Key, req.UploadID, req.PartNumber)
+	if err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid part")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AvatarUploadURLResponse{
+		Key:       req.Key,
+		URL:       presigned.URL,
+		Method:    presigned.Method,
+		Headers:   presigned.Headers,
+		ExpiresAt: presigned.Expires,
+	})
+}
+
+// HandleAvatarMultipartParts lists the parts already uploaded so a client can resume
+// @Summary      List uploaded multipart parts
+// @Description  Lists parts already received for a multipart avatar upload so an interrupted upload can resume
+// @Tags         auth
+// @Produce      json
+// @Param        key        query  string  true  "Upload key"
+// @Param        upload_id  query  string  true  "Upload ID"
+// @Success      200  {object}  AvatarMultipartPartsResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      501  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Router       /auth/avatar/multipart/parts [get]
+func (h *AvatarHandler) HandleAvatarMultipartParts(w http.ResponseWriter, r *http.Request) {
+	if !h.requireMultipart(w) {
+		return
+	}
+
+	user, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	key := strings.TrimSpace(r.URL.Query().Get("key"))
+	uploadID := strings.TrimSpace(r.URL.Query().Get("upload_id"))
+	if uploadID == "" || !h.isAllowedAvatarKey(key, "users/"+user.ID+"/") {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid key")
+		return
+	}
+
+	parts, err := h.multipart.ListParts(r.Context(), key, uploadID)
+	if err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "upload not found")
+		return
+	}
+
+	response := AvatarMultipartPartsResponse{Parts: make([]AvatarMultipartPart, 0, len(parts))}
+	for _, part := range parts {
+		response.Parts = append(response.Parts, AvatarMultipartPart{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+			Size:       part.Size,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleAvatarMultipartComplete assembles the uploaded parts into the avatar object
+// @Summary      Complete multipart avatar upload
+// @Description  Assembles uploaded parts into a single object. Call confirm with the same key afterwards.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body AvatarMultipartCompleteRequest true "Complete request"
+// @Success      200  {object}  AuthStatusResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      501  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Router       /auth/avatar/multipart/complete [post]
+func (h *AvatarHandler) HandleAvatarMultipartComplete(w http.ResponseWriter, r *http.Request) {
+	var req AvatarMultipartCompleteRequest
+	if !h.decodeMultipartRequest(w, r, &req, &req.Key, &req.UploadID) {
+		return
+	}
+
+	parts := make([]blob.CompletedPart, 0, len(req.Parts))
+	for _, part := range req.Parts {
+		parts = append(parts, blob.CompletedPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+
+	if err := h.multipart.CompleteMultipartUpload(r.Context(), req.Key, req.UploadID, parts); err != nil {
+		if writeBlobThrottled(w, err) {
+			return
+		}
+		h.logger.Info("multipart avatar completion failed", slog.String("key", req.Key), logging.Err(err))
+		writeError(w, http.StatusBadRequest, CodeInvalidUpload, "failed to complete upload")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
+}
+
+// HandleAvatarMultipartAbort cancels a multipart avatar upload and discards its parts
+// @Summary      Abort multipart avatar upload
+// @Description  Cancels a multipart avatar upload and discards any uploaded parts
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body AvatarMultipartAbortRequest true "Abort request"
+// @Success      200  {object}  AuthStatusResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      501  {object}  APIError
+// @Failure      503  {object}  APIError
+// @Router       /auth/avatar/multipart/abort [post]
+func (h *AvatarHandler) HandleAvatarMultipartAbort(w http.ResponseWriter, r *http.Request) {
+	var req AvatarMultipartAbortRequest
+	if !h.decodeMultipartRequest(w, r, &req, &req.Key, &req.UploadID) {
+		return
+	}
+
+	h.abortMultipart(r, req.Key, req.UploadID)
+	writeJSON(w, http.StatusOK, AuthStatusResponse{Status: "ok"})
+}
+
+// decodeMultipartRequest decodes a multipart request body and checks the key belongs to the caller.
+func (h *AvatarHandler) decodeMultipartRequest(w http.ResponseWriter, r *http.Request, dst any, key, uploadID *string) bool {
+	if !h.requireMultipart(w) {
+		return false
+	}
+
+	user, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+
+	*key = strings.TrimSpace(*key)
+	*uploadID = strings.TrimSpace(*uploadID)
+	if *uploadID == "" || !h.isAllowedAvatarKey(*key, "users/"+user.ID+"/") {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid key")
+		return false
+	}
+	return true
+}
+
+func (h *AvatarHandler) abortMultipart(r *http.Request, key, uploadID string) {
+	if err := h.multipart.AbortMultipartUpload(r.Context(), key, uploadID); err != nil {
+		h.logger.Warn("failed to abort multipart upload", slog.String("key", key), logging.Err(err))
+	}
+}
+
+// requireMultipart writes an error response when the storage backend cannot do multipart uploads.
+func (h *AvatarHandler) requireMultipart(w http.ResponseWriter) bool {
+	if h.blob == nil {
+		writeError(w, http.StatusServiceUnavailable, CodeStorageUnavailable, "storage unavailable")
+		return false
+	}
+	if h.multipart == nil {
+		writeError(w, http.StatusNotImplemented, CodeNotSupported, "multipart uploads are not supported by the storage backend")
+		return false
+	}
+	return true
+}
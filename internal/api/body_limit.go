@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+// WithMaxBodySize caps every request body at limit bytes by wrapping r.Body in
+// http.MaxBytesReader. overrides maps a route pattern, exactly as registered on
+// mux, to the limit for routes that legitimately take more. A request whose
+// Content-Length is already over the limit gets 413 without reaching the
+// handler; one that runs over while being read fails in the handler's decode,
+// which answers 413 through writeBodyError. A limit of zero or less leaves the
+// body unbounded.
+func WithMaxBodySize(limit int64, overrides map[string]int64, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodyLimit := limit
+		if len(overrides) > 0 {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				if override, ok := overrides[pattern]; ok {
+					bodyLimit = override
+				}
+			}
+		}
+		if bodyLimit > 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > bodyLimit {
+				writeError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// writeBodyError answers a failed body read or decode: 413 when the body ran
+// past its limit, 400 otherwise.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "request body too large")
+		return
+	}
+	writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+}
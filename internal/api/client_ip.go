@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+)
+
+// trustedProxies extracts the client address for rate limiting, audit logs and
+// IP filtering. Each proxy appends the address it received the request from to
+// header, so entries are read right to left: past count hops, or past every
+// address in cidrs. Anything further left was supplied by the client and is
+// ignored.
+type trustedProxies struct {
+	header string
+	count  int
+	cidrs  []netip.Prefix
+}
+
+// newTrustedProxies builds the resolver for cfg, which must have passed
+// Config.Validate.
+func newTrustedProxies(cfg config.TrustedProxyConfig) trustedProxies {
+	cidrs, _ := cfg.Prefixes()
+	return trustedProxies{header: cfg.Header, count: cfg.Count, cidrs: cidrs}
+}
+
+// clientIP returns the client address, falling back to RemoteAddr when no proxy
+// is trusted, the peer is not a trusted proxy, or the header is missing or
+// malformed. Inside WithRequestLogging the address is already in the context.
+func (p trustedProxies) clientIP(r *http.Request) *netip.Addr {
+	if ip, ok := ctxkeys.ClientIP(r.Context()); ok {
+		return &ip
+	}
+	remote := remoteAddr(r)
+	if p.header == "" {
+		return remote
+	}
+	value := r.Header.Get(p.header)
+	if value == "" {
+		return remote
+	}
+	entries := strings.Split(value, ",")
+
+	if len(p.cidrs) > 0 {
+		if remote == nil || !prefixesContain(p.cidrs, *remote) {
+			return remote
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+			if err != nil {
+				return remote
+			}
+			addr = addr.Unmap()
+			if i == 0 || !prefixesContain(p.cidrs, addr) {
+				return &addr
+			}
+		}
+	}
+
+	if p.count > 0 {
+		index := max(len(entries)-p.count, 0)
+		if addr, err := netip.ParseAddr(strings.TrimSpace(entries[index])); err == nil {
+			addr = addr.Unmap()
+			return &addr
+		}
+	}
+	return remote
+}
+
+func remoteAddr(r *http.Request) *netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	return &addr
+}
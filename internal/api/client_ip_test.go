@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+)
+
+func TestClientIP(t *testing.T) {
+	const proxy = "10.0.0.5:4000"
+	count1 := config.TrustedProxyConfig{Header: "X-Forwarded-For", Count: 1}
+	count2 := config.TrustedProxyConfig{Header: "X-Forwarded-For", Count: 2}
+	cidrs := config.TrustedProxyConfig{Header: "X-Forwarded-For", CIDRs: []string{"10.0.0.0/8", "192.0.2.1"}}
+
+	tests := []struct {
+		name   string
+		cfg    config.TrustedProxyConfig
+		remote string
+		xff    string // empty sends no header
+		want   string // empty wants nil
+	}{
+		{"no proxy trusted", config.TrustedProxyConfig{}, "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"header but neither count nor cidrs", config.TrustedProxyConfig{Header: "X-Forwarded-For"}, proxy, "198.51.100.1", "10.0.0.5"},
+		{"ipv4-mapped remote", config.TrustedProxyConfig{}, "[::ffff:203.0.113.7]:5000", "", "203.0.113.7"},
+		{"unparsable remote", config.TrustedProxyConfig{}, "not-an-address", "", ""},
+
+		{"count: one hop", count1, proxy, "203.0.113.7", "203.0.113.7"},
+		{"count: missing header", count1, proxy, "", "10.0.0.5"},
+		// The client put its own entry first; the proxy appended the real peer.
+		{"count: spoofed entry", count1, proxy, "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"count: two hops", count2, proxy, "1.2.3.4, 203.0.113.7, 10.0.0.9", "203.0.113.7"},
+		{"count: fewer entries than hops", count2, proxy, "203.0.113.7", "203.0.113.7"},
+		{"count: malformed entry", count1, proxy, "1.2.3.4, garbage", "10.0.0.5"},
+		{"count: mapped entry", count1, proxy, "::ffff:203.0.113.7", "203.0.113.7"},
+
+		{"cidrs: one hop", cidrs, proxy, "203.0.113.7", "203.0.113.7"},
+		{"cidrs: multi-hop through trusted proxies", cidrs, proxy, "203.0.113.7, 10.1.1.1, 192.0.2.1", "203.0.113.7"},
+		{"cidrs: spoofed entry", cidrs, proxy, "1.2.3.4, 203.0.113.7, 10.1.1.1", "203.0.113.7"},
+		// A spoofed entry is only taken when every proxy is trusted and the
+		// chain ends there, which is the leftmost entry.
+		{"cidrs: every entry trusted", cidrs, proxy, "10.9.9.9, 10.1.1.1", "10.9.9.9"},
+		{"cidrs: untrusted peer", cidrs, "203.0.113.50:5000", "1.2.3.4", "203.0.113.50"},
+		{"cidrs: malformed entry", cidrs, proxy, "203.0.113.7, garbage, 10.1.1.1", "10.0.0.5"},
+		{"cidrs: missing header", cidrs, proxy, "", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := newTrustedProxies(tt.cfg)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			got := proxies.clientIP(req)
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("clientIP() = %s, want nil", got)
+			case tt.want != "" && (got == nil || *got != netip.MustParseAddr(tt.want)):
+				t.Errorf("clientIP() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPPrefersContext(t *testing.T) {
+	proxies := newTrustedProxies(config.TrustedProxyConfig{Header: "X-Forwarded-For", Count: 1})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	want := netip.MustParseAddr("203.0.113.7")
+	req = req.WithContext(ctxkeys.WithClientIP(req.Context(), want))
+
+	if got := proxies.clientIP(req); got == nil || *got != want {
+		t.Errorf("clientIP() = %v, want %s from the context", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mounis-bhat/starter/internal/config"
+)
+
+// incompressibleTypes are content types that are already compressed, or are
+// streamed and must reach the client as each event is flushed.
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/octet-stream",
+	"text/event-stream",
+}
+
+var gzipWriters = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// WithCompression gzips responses for clients that accept it. A response is
+// only compressed once it reaches cfg.Compression.MinBytes and when it has no
+// Content-Encoding of its own (such as a pre-compressed static file), is not a
+// partial response and its Content-Type is not in incompressibleTypes. Every
+// response gets Vary: Accept-Encoding, since its encoding may depend on it.
+func WithCompression(cfg *config.Config, next http.Handler) http.Handler {
+	if !cfg.Compression.Enabled {
+		return next
+	}
+	minBytes := cfg.Compression.MinBytes
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, minBytes: minBytes, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds back the start of a response until it knows whether to
+// compress it: when the body reaches minBytes, or at Flush or Close.
+type compressWriter struct {
+	http.ResponseWriter
+	minBytes int
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader || c.decided {
+		return
+	}
+	if status >= 100 && status < 200 {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+	c.wroteHeader = true
+	if !c.compressible() {
+		c.start(false)
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.decided {
+		c.buf = append(c.buf, b...)
+		if len(c.buf) < c.minBytes {
+			return len(b), nil
+		}
+		c.start(true)
+		if err := c.flushBuffer(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.gz != nil {
+		return c.gz.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush sends what is buffered. A response still under minBytes goes out
+// uncompressed, since the handler wants it on the wire now.
+func (c *compressWriter) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.decided {
+		c.start(false)
+		_ = c.flushBuffer()
+	}
+	if c.gz != nil {
+		_ = c.gz.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Close finishes the response once the handler has returned.
+func (c *compressWriter) Close() {
+	if !c.wroteHeader {
+		// The handler wrote nothing; let net/http send its default response.
+		return
+	}
+	if !c.decided {
+		c.start(false)
+		_ = c.flushBuffer()
+	}
+	if c.gz != nil {
+		_ = c.gz.Close()
+		c.gz.Reset(nil)
+		gzipWriters.Put(c.gz)
+		c.gz = nil
+	}
+}
+
+// compressible reports from the status and headers alone whether the response
+// may be compressed.
+func (c *compressWriter) compressible() bool {
+	h := c.Header()
+	if c.status < 200 || c.status == http.StatusNoContent || c.status == http.StatusNotModified || c.status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < c.minBytes {
+		return false
+	}
+	contentType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// start writes the header, compressed or not.
+func (c *compressWriter) start(compress bool) {
+	c.decided = true
+	h := c.Header()
+	if _, ok := h["Content-Type"]; !ok && compress {
+		// net/http would sniff the gzip bytes, so sniff the plain body here.
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+	if compress && c.compressible() {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		// The compressed body is a different representation; a strong ETag must
+		// not match the uncompressed one.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		c.gz = gzipWriters.Get().(*gzip.Writer)
+		c.gz.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+}
+
+func (c *compressWriter) flushBuffer() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.gz != nil {
+		_, err = c.gz.Write(c.buf)
+	} else {
+		_, err = c.ResponseWriter.Write(c.buf)
+	}
+	c.buf = nil
+	return err
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding with
+// a non-zero quality, either by name or, when coding is not listed, through "*".
+func acceptsEncoding(header, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		accepted := true
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if quality, err := strconv.ParseFloat(q, 64); err == nil && quality == 0 {
+				accepted = false
+			}
+		}
+		switch {
+		case strings.EqualFold(name, coding):
+			return accepted
+		case name == "*":
+			wildcard = accepted
+		}
+	}
+	return wildcard
+}
+
+// addVary adds field to the Vary header unless it is already listed.
+func addVary(h http.Header, field string) {
+	for _, value := range h.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
@@ -7,42 +7,108 @@ import (
 	"github.com/mounis-bhat/starter/internal/config"
 )
 
-type CookieManager struct {
+// CookieManager sets and clears the session cookie and the short-lived OAuth
+// cookies. NewCookieManager builds it from AuthConfig; handler tests can
+// substitute a fake.
+type CookieManager interface {
+	SessionCookieName() string
+	SetSessionCookie(w http.ResponseWriter, token string, persistent bool)
+	ClearSessionCookie(w http.ResponseWriter)
+	SetOAuthCookie(w http.ResponseWriter, settings OAuthCookieSettings, name, value string, maxAge time.Duration)
+	ClearOAuthCookie(w http.ResponseWriter, settings OAuthCookieSettings, name string)
+}
+
+type cookieManager struct {
 	name     string
+	domain   string
+	path     string
 	secure   bool
 	sameSite http.SameSite
 	maxAge   time.Duration
 }
 
 func NewCookieManager(cfg config.AuthConfig) CookieManager {
-	return CookieManager{
+	return cookieManager{
 		name:     cfg.CookieName,
+		domain:   cfg.CookieDomain,
+		path:     cfg.CookiePath,
 		secure:   cfg.CookieSecure,
 		sameSite: cfg.CookieSameSite,
 		maxAge:   cfg.SessionMaxAge,
 	}
 }
 
-func (c CookieManager) SetSessionCookie(w http.ResponseWriter, token string) {
-	http.SetCookie(w, &http.Cookie{
+func (c cookieManager) SessionCookieName() string {
+	return c.name
+}
+
+// SetSessionCookie sets the session cookie. A persistent cookie lives for the
+// session max age; otherwise MaxAge is omitted and the browser drops the cookie
+// when it closes. The server-side expiry applies in both cases.
+func (c cookieManager) SetSessionCookie(w http.ResponseWriter, token string, persistent bool) {
+	cookie := &http.Cookie{
 		Name:     c.name,
 		Value:    token,
-		Path:     "/",
+		Domain:   c.domain,
+		Path:     c.path,
 		HttpOnly: true,
 		Secure:   c.secure,
 		SameSite: c.sameSite,
-		MaxAge:   int(c.maxAge.Seconds()),
-	})
+	}
+	if persistent {
+		cookie.MaxAge = int(c.maxAge.Seconds())
+	}
+	http.SetCookie(w, cookie)
 }
 
-func (c CookieManager) ClearSessionCookie(w http.ResponseWriter) {
+func (c cookieManager) ClearSessionCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     c.name,
 		Value:    "",
-		Path:     "/",
+		Domain:   c.domain,
+		Path:     c.path,
 		HttpOnly: true,
 		Secure:   c.secure,
 		SameSite: c.sameSite,
 		MaxAge:   -1,
 	})
 }
+
+// OAuthCookieSettings holds the per-provider attributes for the short-lived state and
+// PKCE verifier cookies. Secure is always taken from the session cookie settings.
+type OAuthCookieSettings struct {
+	Path     string
+	SameSite http.SameSite
+}
+
+func (c cookieManager) SetOAuthCookie(w http.ResponseWriter, settings OAuthCookieSettings, name, value string, maxAge time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     settings.Path,
+		HttpOnly: true,
+		Secure:   c.secure,
+		SameSite: c.oauthSameSite(settings),
+		MaxAge:   int(maxAge.Seconds()),
+	})
+}
+
+func (c cookieManager) ClearOAuthCookie(w http.ResponseWriter, settings OAuthCookieSettings, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     settings.Path,
+		HttpOnly: true,
+		Secure:   c.secure,
+		SameSite: c.oauthSameSite(settings),
+		MaxAge:   -1,
+	})
+}
+
+// oauthSameSite never returns None for insecure cookies, since browsers drop them.
+func (c cookieManager) oauthSameSite(settings OAuthCookieSettings) http.SameSite {
+	if settings.SameSite == 0 || (settings.SameSite == http.SameSiteNoneMode && !c.secure) {
+		return http.SameSiteLaxMode
+	}
+	return settings.SameSite
+}
@@ -46,9 +46,11 @@ func handleScalarDocs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Security-Policy", docsCSP)
+	// Scalar injects styles at runtime, so the page relaxes style-src; its
+	// scripts still need the request's nonce.
+	setPageCSP(w, r, docsCSP)
 	w.Header().Set("Content-Type", "text/html")
-	_, _ = w.Write([]byte(htmlContent))
+	_, _ = w.Write(injectCSPNonce(r, []byte(htmlContent)))
 }
 
 func buildSpecURL(r *http.Request) string {
@@ -109,4 +111,4 @@ func fetchScalarScript() ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
-const docsCSP = "default-src 'self'; base-uri 'self'; frame-ancestors 'none'; object-src 'none'; form-action 'self'; img-src 'self' data: https:; style-src 'self' 'unsafe-inline'; script-src 'self'; connect-src 'self'; font-src 'self' data:; media-src 'self'; manifest-src 'self'; worker-src 'self'; frame-src 'none'"
+const docsCSP = "default-src 'self'; base-uri 'self'; frame-ancestors 'none'; object-src 'none'; form-action 'self'; img-src 'self' data: https:; style-src 'self' 'unsafe-inline'; script-src 'self' 'nonce-{nonce}'; connect-src 'self'; font-src 'self' data:; media-src 'self'; manifest-src 'self'; worker-src 'self'; frame-src 'none'"
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/email"
+)
+
+// emailPreviews renders each email the app sends with sample data, keyed by the
+// same type names used in email_send_failed audit events.
+var emailPreviews = map[string]func() (string, email.EmailParams){
+	"verification": func() (string, email.EmailParams) {
+		return verificationEmail("Jane Doe", "https://example.com/api/auth/verify-email?token=preview-token")
+	},
+	"lockout": func() (string, email.EmailParams) {
+		return lockoutEmail("Jane Doe", time.Now().Add(15*time.Minute), "203.0.113.7")
+	},
+	"new_device": func() (string, email.EmailParams) {
+		return newDeviceEmail("Jane Doe", time.Now(), "203.0.113.7", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 Safari/605.1.15")
+	},
+	"security_reset": func() (string, email.EmailParams) {
+		return securityResetEmail("Jane Doe", true, 2, "203.0.113.7")
+	},
+}
+
+// handleEmailPreview renders an email template with sample data (dev only).
+// ?type= picks the email; ?format=text returns the plain-text part instead of
+// the HTML. The subject is sent in the X-Email-Subject header.
+func handleEmailPreview(w http.ResponseWriter, r *http.Request) {
+	build, ok := emailPreviews[r.URL.Query().Get("type")]
+	if !ok {
+		types := make([]string, 0, len(emailPreviews))
+		for name := range emailPreviews {
+			types = append(types, name)
+		}
+		slices.Sort(types)
+		writeErrorDetails(w, http.StatusBadRequest, CodeInvalidRequest, "unknown email type", map[string]any{
+			"types": types,
+		})
+		return
+	}
+
+	subject, params := build()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Email-Subject", subject)
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(email.RenderText(params)))
+		return
+	}
+	// Email markup is styled inline, which the default CSP blocks.
+	setPageCSP(w, r, docsCSP)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(email.RenderHTML(params)))
+}
@@ -0,0 +1,68 @@
+package api
+
+import "net/http"
+
+// Error codes returned in APIError.Code. Codes are stable and safe to branch on;
+// messages are for people and may change.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeInvalidEmail        = "invalid_email"
+	CodeInvalidIngredient   = "invalid_ingredient"
+	CodeWeakPassword        = "weak_password"
+	CodePasswordReused      = "password_reused"
+	CodeInvalidUpload       = "invalid_upload"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeUnauthorized        = "unauthorized"
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeReauthRequired      = "reauth_required"
+	CodeInvalidSignature    = "invalid_signature"
+	CodeOAuthFailed         = "oauth_failed"
+	CodeEmailNotVerified    = "email_not_verified"
+	CodeForbidden           = "forbidden"
+	CodeInsufficientScope   = "insufficient_scope"
+	CodeNotFound            = "not_found"
+	CodeFeatureDisabled     = "feature_disabled"
+	CodeLimitReached        = "limit_reached"
+	CodeRateLimited         = "rate_limited"
+	CodeInternal            = "internal_error"
+	CodeNotSupported        = "not_supported"
+	CodeUpstreamError       = "upstream_error"
+	CodeUpstreamTimeout     = "upstream_timeout"
+	CodeStorageUnavailable  = "storage_unavailable"
+	CodeStorageBusy         = "storage_busy"
+	CodeVerificationExpired = "verification_expired"
+	CodeVerificationInvalid = "verification_invalid"
+)
+
+// APIError is the body of every JSON error response.
+// @Description Error response
+type APIError struct {
+	Code      string         `json:"code" example:"unauthorized"`
+	Message   string         `json:"message" example:"unauthorized"`
+	Details   map[string]any `json:"details,omitempty" swaggertype:"object"`
+	RequestID string         `json:"request_id,omitempty" example:"2f1c7a1e9b6d4c3a8e5f0a1b2c3d4e5f"`
+}
+
+// newAPIError builds an error body, picking up the request ID that
+// WithRequestLogging set on the response.
+func newAPIError(w http.ResponseWriter, code, message string, details map[string]any) APIError {
+	return APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: w.Header().Get(requestIDHeader),
+	}
+}
+
+// writeError writes an APIError with the given status.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, newAPIError(w, code, message, nil))
+}
+
+// writeErrorDetails is writeError with extra machine-readable context, such as
+// per-field validation messages.
+func writeErrorDetails(w http.ResponseWriter, status int, code, message string, details map[string]any) {
+	writeJSON(w, status, newAPIError(w, code, message, details))
+}
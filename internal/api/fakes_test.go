@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+func TestMain(m *testing.M) {
+	// Handler tests hash every password they register or log in with; the
+	// production cost would make them take seconds.
+	domain.SetArgon2Params(domain.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1})
+	os.Exit(m.Run())
+}
+
+// fakeQuerier keeps users and sessions in memory. It implements the queries the
+// register, login and session paths use; any other call panics on the nil
+// embedded Querier, which points at the query a new test needs.
+type fakeQuerier struct {
+	db.Querier
+
+	mu       sync.Mutex
+	users    map[pgtype.UUID]db.User
+	sessions map[string]db.Session
+
+	lastActiveUpdates int
+}
+
+func newFakeQuerier() *fakeQuerier {
+	return &fakeQuerier{
+		users:    make(map[pgtype.UUID]db.User),
+		sessions: make(map[string]db.Session),
+	}
+}
+
+func newUUID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.New(), Valid: true}
+}
+
+func (q *fakeQuerier) CreateUser(_ context.Context, arg db.CreateUserParams) (db.User, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, user := range q.users {
+		if user.Email == arg.Email {
+			return db.User{}, &pgconn.PgError{Code: "23505"}
+		}
+	}
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	user := db.User{
+		ID:            newUUID(),
+		Email:         arg.Email,
+		EmailVerified: arg.EmailVerified,
+		Name:          arg.Name,
+		Picture:       arg.Picture,
+		PasswordHash:  arg.PasswordHash,
+		Provider:      arg.Provider,
+		GoogleID:      arg.GoogleID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Role:          domain.RoleUser,
+	}
+	q.users[user.ID] = user
+	return user, nil
+}
+
+func (q *fakeQuerier) GetUserByEmail(_ context.Context, email string) (db.User, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, user := range q.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return db.User{}, pgx.ErrNoRows
+}
+
+func (q *fakeQuerier) GetUserByID(_ context.Context, id pgtype.UUID) (db.User, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	user, ok := q.users[id]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+// updateUser applies fn to a stored user, for the queries that change one row.
+func (q *fakeQuerier) updateUser(id pgtype.UUID, fn func(*db.User)) (db.User, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	user, ok := q.users[id]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	fn(&user)
+	q.users[id] = user
+	return user, nil
+}
+
+func (q *fakeQuerier) IncrementFailedLoginAttempts(_ context.Context, id pgtype.UUID) (db.User, error) {
+	return q.updateUser(id, func(u *db.User) { u.FailedLoginAttempts++ })
+}
+
+func (q *fakeQuerier) ResetFailedLoginAttempts(_ context.Context, id pgtype.UUID) error {
+	_, err := q.updateUser(id, func(u *db.User) { u.FailedLoginAttempts = 0 })
+	return err
+}
+
+func (q *fakeQuerier) LockUser(_ context.Context, arg db.LockUserParams) error {
+	_, err := q.updateUser(arg.ID, func(u *db.User) { u.LockedUntil = arg.LockedUntil })
+	return err
+}
+
+func (q *fakeQuerier) UnlockUser(_ context.Context, id pgtype.UUID) error {
+	_, err := q.updateUser(id, func(u *db.User) {
+		u.LockedUntil = pgtype.Timestamptz{}
+		u.FailedLoginAttempts = 0
+	})
+	return err
+}
+
+func (q *fakeQuerier) CreateSession(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	session := db.Session{
+		ID:          newUUID(),
+		UserID:      arg.UserID,
+		TokenHash:   arg.TokenHash,
+		ExpiresAt:   arg.ExpiresAt,
+		IpAddress:   arg.IpAddress,
+		UserAgent:   arg.UserAgent,
+		CreatedAt:   pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		SessionType: arg.SessionType,
+		Persistent:  arg.Persistent,
+	}
+	q.sessions[session.TokenHash] = session
+	return session, nil
+}
+
+func (q *fakeQuerier) CountUserSessions(_ context.Context, userID pgtype.UUID) (int64, error) {
+	return int64(len(q.userSessions(userID))), nil
+}
+
+func (q *fakeQuerier) GetOldestUserSession(_ context.Context, userID pgtype.UUID) (db.Session, error) {
+	sessions := q.userSessions(userID)
+	if len(sessions) == 0 {
+		return db.Session{}, pgx.ErrNoRows
+	}
+	return sessions[0], nil
+}
+
+// userSessions returns a user's sessions, oldest first.
+func (q *fakeQuerier) userSessions(userID pgtype.UUID) []db.Session {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var sessions []db.Session
+	for _, session := range q.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b db.Session) int {
+		return a.CreatedAt.Time.Compare(b.CreatedAt.Time)
+	})
+	return sessions
+}
+
+func (q *fakeQuerier) GetSessionByTokenHash(_ context.Context, tokenHash string) (db.GetSessionByTokenHashRow, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	session, ok := q.sessions[tokenHash]
+	if !ok {
+		return db.GetSessionByTokenHashRow{}, pgx.ErrNoRows
+	}
+	user := q.users[session.UserID]
+	return db.GetSessionByTokenHashRow{
+		ID:                session.ID,
+		UserID:            session.UserID,
+		TokenHash:         session.TokenHash,
+		ExpiresAt:         session.ExpiresAt,
+		LastActiveAt:      session.LastActiveAt,
+		IpAddress:         session.IpAddress,
+		UserAgent:         session.UserAgent,
+		CreatedAt:         session.CreatedAt,
+		SessionType:       session.SessionType,
+		Persistent:        session.Persistent,
+		UserID_2:          user.ID,
+		UserEmail:         user.Email,
+		UserEmailVerified: user.EmailVerified,
+		UserName:          user.Name,
+		UserPicture:       user.Picture,
+		UserProvider:      user.Provider,
+		UserRole:          user.Role,
+	}, nil
+}
+
+func (q *fakeQuerier) UpdateSessionLastActive(_ context.Context, id pgtype.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.lastActiveUpdates++
+	for hash, session := range q.sessions {
+		if session.ID == id {
+			session.LastActiveAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+			q.sessions[hash] = session
+		}
+	}
+	return nil
+}
+
+func (q *fakeQuerier) DeleteSession(_ context.Context, id pgtype.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for hash, session := range q.sessions {
+		if session.ID == id {
+			delete(q.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (q *fakeQuerier) DeleteSessionByTokenHash(_ context.Context, tokenHash string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.sessions, tokenHash)
+	return nil
+}
+
+func (q *fakeQuerier) DeleteUserSessions(_ context.Context, userID pgtype.UUID) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var deleted int64
+	for hash, session := range q.sessions {
+		if session.UserID == userID {
+			delete(q.sessions, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// fakeStore runs transactions inline against the fake querier; nothing is
+// rolled back.
+type fakeStore struct {
+	queries *fakeQuerier
+}
+
+func (s fakeStore) Querier() db.Querier {
+	return s.queries
+}
+
+func (s fakeStore) WithTx(_ context.Context, fn func(q db.Querier) error) error {
+	return fn(s.queries)
+}
+
+type auditEvent struct {
+	event    string
+	userID   pgtype.UUID
+	metadata map[string]any
+}
+
+// recordingAudit is an AuditRecorder that keeps events in memory.
+type recordingAudit struct {
+	mu     sync.Mutex
+	events []auditEvent
+}
+
+func (a *recordingAudit) Log(_ context.Context, event string, userID pgtype.UUID, _ *netip.Addr, _ string, metadata map[string]any) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, auditEvent{event: event, userID: userID, metadata: metadata})
+}
+
+// find returns the events named event, in the order they were logged.
+func (a *recordingAudit) find(event string) []auditEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var found []auditEvent
+	for _, e := range a.events {
+		if e.event == event {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// recordingCookies is a CookieManager that remembers the last session cookie
+// operation instead of writing headers.
+type recordingCookies struct {
+	name    string
+	set     []string
+	cleared int
+}
+
+func (c *recordingCookies) SessionCookieName() string {
+	return c.name
+}
+
+func (c *recordingCookies) SetSessionCookie(_ http.ResponseWriter, token string, _ bool) {
+	c.set = append(c.set, token)
+}
+
+func (c *recordingCookies) ClearSessionCookie(http.ResponseWriter) {
+	c.cleared++
+}
+
+func (c *recordingCookies) SetOAuthCookie(http.ResponseWriter, OAuthCookieSettings, string, string, time.Duration) {
+}
+
+func (c *recordingCookies) ClearOAuthCookie(http.ResponseWriter, OAuthCookieSettings, string) {
+}
+
+// testAuthConfig is the AuthConfig handler tests start from: session cookies
+// without the Secure flag, so they round-trip over httptest's plain HTTP.
+func testAuthConfig() config.AuthConfig {
+	return config.AuthConfig{
+		CookieName:         "session",
+		CookiePath:         "/",
+		CookieSameSite:     http.SameSiteLaxMode,
+		SessionMaxAge:      7 * 24 * time.Hour,
+		ShortSessionMaxAge: 12 * time.Hour,
+		IdleTimeout:        time.Hour,
+		LastActiveInterval: time.Minute,
+		PasswordPolicy:     config.PasswordPolicyRules,
+		UserDenyPolicy:     config.DenyPolicyStatus,
+		AdminDenyPolicy:    config.DenyPolicyNotFound,
+	}
+}
+
+// newTestAuthHandler builds an AuthHandler over a fake querier with the audit
+// log recorded in memory.
+func newTestAuthHandler(t *testing.T, cfg config.AuthConfig) (*AuthHandler, *fakeQuerier, *recordingAudit) {
+	t.Helper()
+	queries := newFakeQuerier()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewAuthHandler(fakeStore{queries: queries}, cfg, config.GoogleOAuthConfig{}, config.EmailConfig{}, config.RateLimitConfig{}, config.AuditConfig{}, nil, nil, logger)
+	audit := &recordingAudit{}
+	h.auditLogger = audit
+	return h, queries, audit
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/domain"
+)
+
+// ConfigResponse describes what this deployment serves so clients can hide
+// features that are turned off.
+// @Description Public client configuration
+type ConfigResponse struct {
+	Features FeatureFlags `json:"features"`
+}
+
+// FeatureFlags lists the optional features and whether each is available.
+type FeatureFlags struct {
+	Recipes     bool `json:"recipes" example:"true"`
+	GoogleLogin bool `json:"google_login" example:"true"`
+	AppleLogin  bool `json:"apple_login" example:"false"`
+	OIDCLogin   bool `json:"oidc_login" example:"false"`
+	Avatars     bool `json:"avatars" example:"true"`
+}
+
+// Capabilities describes what this deployment can do, derived from config and
+// which optional components started. It is returned with the current user so
+// the client can pick its UI without probing each endpoint.
+type Capabilities struct {
+	Avatars   bool     `json:"avatars" example:"true"`
+	Recipes   bool     `json:"recipes" example:"true"`
+	Providers []string `json:"providers" example:"password,google"`
+	// TwoFactor is false until a second factor is implemented.
+	TwoFactor bool `json:"two_factor" example:"false"`
+}
+
+// FeatureFlags reduces capabilities to the public /api/config flags.
+func (c Capabilities) FeatureFlags() FeatureFlags {
+	return FeatureFlags{
+		Recipes:     c.Recipes,
+		GoogleLogin: slices.Contains(c.Providers, domain.AuthMethodGoogle),
+		AppleLogin:  slices.Contains(c.Providers, domain.AuthMethodApple),
+		OIDCLogin:   slices.Contains(c.Providers, domain.AuthMethodOIDC),
+		Avatars:     c.Avatars,
+	}
+}
+
+// makeConfigHandler returns the public client configuration
+// @Summary      Client configuration
+// @Description  Reports which optional features are enabled. Recipes are off when no AI backend is configured. Responses carry an ETag derived from the payload and support If-None-Match.
+// @Tags         system
+// @Produce      json
+// @Param        If-None-Match  header  string  false  "ETag from a previous response"
+// @Success      200  {object}  ConfigResponse
+// @Success      304  "Not modified"
+// @Router       /config [get]
+func makeConfigHandler(features FeatureFlags, maxAge time.Duration) http.HandlerFunc {
+	// The payload is fixed for the life of the process, so it is serialized once
+	// and the ETag changes exactly when the flags do.
+	body, err := json.Marshal(ConfigResponse{Features: features})
+	if err != nil {
+		panic(err)
+	}
+	body = append(body, '\n')
+	etag := contentETag(body)
+
+	cacheControl := "public, no-cache"
+	if maxAge >= time.Second {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	}
+}
+
+// handleFeatureDisabled answers requests for a feature this deployment has turned off.
+func handleFeatureDisabled(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, CodeFeatureDisabled, "this feature is disabled")
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mounis-bhat/starter/internal/config"
+)
+
+func fetchMetadataHandler(policy string, logs *bytes.Buffer) http.Handler {
+	cfg := &config.Config{Auth: config.AuthConfig{FetchMetadata: policy}}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	return WithFetchMetadata(cfg, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestWithFetchMetadataEnforce(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		site       string
+		wantStatus int
+	}{
+		{"same-origin post", http.MethodPost, "/api/auth/login", "same-origin", http.StatusOK},
+		{"same-site post", http.MethodPost, "/api/auth/login", "same-site", http.StatusOK},
+		{"user-initiated post", http.MethodPost, "/api/auth/login", "none", http.StatusOK},
+		{"post without headers", http.MethodPost, "/api/auth/login", "", http.StatusOK},
+		{"cross-site post", http.MethodPost, "/api/auth/login", "cross-site", http.StatusForbidden},
+		{"cross-site delete", http.MethodDelete, "/api/auth/sessions", "cross-site", http.StatusForbidden},
+		{"cross-site get", http.MethodGet, "/api/auth/google/callback", "cross-site", http.StatusOK},
+		{"cross-site head", http.MethodHead, "/api/health", "cross-site", http.StatusOK},
+		{"cross-site options", http.MethodOptions, "/api/auth/login", "cross-site", http.StatusOK},
+		{"cross-site post to an exempt path", http.MethodPost, "/api/auth/apple/callback", "cross-site", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			handler := fetchMetadataHandler(config.FetchMetadataEnforce, &logs)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.site != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.site)
+				req.Header.Set("Sec-Fetch-Mode", "navigate")
+				req.Header.Set("Sec-Fetch-Dest", "document")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			wantRefused := tt.wantStatus == http.StatusForbidden
+			if refused := strings.Contains(logs.String(), "refused by fetch metadata"); refused != wantRefused {
+				t.Errorf("refusal logged = %v, want %v", refused, wantRefused)
+			}
+		})
+	}
+}
+
+func TestWithFetchMetadataPolicies(t *testing.T) {
+	tests := []struct {
+		policy     string
+		wantStatus int
+		wantLog    bool
+	}{
+		{config.FetchMetadataEnforce, http.StatusForbidden, true},
+		// report lets the request through but still logs it.
+		{config.FetchMetadataReport, http.StatusOK, true},
+		{config.FetchMetadataOff, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var logs bytes.Buffer
+			handler := fetchMetadataHandler(tt.policy, &logs)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/password", nil)
+			req.Header.Set("Sec-Fetch-Site", "cross-site")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if logged := strings.Contains(logs.String(), "refused by fetch metadata"); logged != tt.wantLog {
+				t.Errorf("refusal logged = %v, want %v", logged, tt.wantLog)
+			}
+			if tt.wantLog && !strings.Contains(logs.String(), "enforced="+strconv.FormatBool(tt.policy == config.FetchMetadataEnforce)) {
+				t.Errorf("log %q does not record whether the refusal was enforced", logs.String())
+			}
+		})
+	}
+}
+
+func TestFetchMetadataScripted(t *testing.T) {
+	tests := []struct {
+		mode, dest string
+		want       bool
+	}{
+		{"cors", "empty", true},
+		{"same-origin", "empty", true},
+		{"navigate", "document", false},
+		{"no-cors", "image", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := (fetchMetadata{mode: tt.mode, dest: tt.dest}).scripted(); got != tt.want {
+			t.Errorf("scripted() with mode %q, dest %q = %v, want %v", tt.mode, tt.dest, got, tt.want)
+		}
+	}
+}
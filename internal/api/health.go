@@ -1,10 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/redis/go-redis/v9"
 )
 
+// readinessTimeout bounds all dependency checks of one readiness request.
+const readinessTimeout = 2 * time.Second
+
 // HealthResponse represents the health check response
 // @Description Health check response
 type HealthResponse struct {
@@ -22,3 +31,76 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
 }
+
+// ReadinessResponse represents the readiness check response
+// @Description Readiness check response; checks maps each dependency to "ok" or "unavailable"
+type ReadinessResponse struct {
+	Status     string            `json:"status" example:"ok" validate:"required"`
+	Checks     map[string]string `json:"checks"`
+	ValkeyPool *ValkeyPoolStats  `json:"valkey_pool,omitempty"`
+}
+
+// ValkeyPoolStats is the usage of the Valkey connection pool every component
+// shares, since startup. Timeouts that keep rising mean VALKEY_POOL_SIZE is too
+// small for the load.
+// @Description Valkey connection pool counters since startup
+type ValkeyPoolStats struct {
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+// valkeyPoolStats returns the pool counters of valkey, or nil without a client.
+func valkeyPoolStats(valkey *redis.Client) *ValkeyPoolStats {
+	if valkey == nil {
+		return nil
+	}
+	stats := valkey.PoolStats()
+	return &ValkeyPoolStats{
+		Hits:       stats.Hits,
+		Misses:     stats.Misses,
+		Timeouts:   stats.Timeouts,
+		TotalConns: stats.TotalConns,
+		IdleConns:  stats.IdleConns,
+		StaleConns: stats.StaleConns,
+	}
+}
+
+// readinessCheck is one dependency pinged by the readiness probe.
+type readinessCheck struct {
+	name string
+	ping func(context.Context) error
+}
+
+// makeReadinessHandler reports whether the API's dependencies answer
+// @Summary      Readiness check
+// @Description  Pings Postgres, and Valkey when rate limiting uses it. Answers 503 when any of them fails, so a load balancer can take the instance out of rotation. valkey_pool reports the shared Valkey connection pool.
+// @Tags         system
+// @Produce      json
+// @Success      200  {object}  ReadinessResponse
+// @Failure      503  {object}  ReadinessResponse
+// @Router       /ready [get]
+func makeReadinessHandler(checks []readinessCheck, valkey *redis.Client, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		response := ReadinessResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+		status := http.StatusOK
+		for _, check := range checks {
+			if err := check.ping(ctx); err != nil {
+				logger.Warn("readiness check failed", slog.String("dependency", check.name), logging.Err(err))
+				response.Checks[check.name] = "unavailable"
+				response.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			response.Checks[check.name] = "ok"
+		}
+		response.ValkeyPool = valkeyPoolStats(valkey)
+		writeJSON(w, status, response)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ratelimit"
+	"github.com/mounis-bhat/starter/internal/storage"
+	"github.com/mounis-bhat/starter/internal/storage/oauthstate"
+)
+
+func TestReadinessReportsValkeyPool(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := miniredis.RunT(t)
+	valkey := storage.NewValkeyClient(config.ValkeyConfig{Host: server.Host(), Port: server.Port()})
+	t.Cleanup(func() { _ = valkey.Close() })
+	checks := []readinessCheck{{name: "valkey", ping: func(ctx context.Context) error { return valkey.Ping(ctx).Err() }}}
+
+	// The limiter and the OAuth state store draw from the same pool as the probe.
+	if _, err := ratelimit.NewValkeyLimiter(valkey).Allow(t.Context(), "client", 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := oauthstate.NewValkeyStore(valkey).Save(t.Context(), "id", oauthstate.Entry{State: "state"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	makeReadinessHandler(checks, valkey, logger).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/ready", nil))
+	var response ReadinessResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || response.Checks["valkey"] != "ok" {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	// The limiter opened a connection; the store and the probe reused it.
+	pool := response.ValkeyPool
+	if pool == nil || pool.TotalConns != 1 || pool.IdleConns != 1 || pool.Misses != 1 || pool.Hits != 2 {
+		t.Errorf("valkey_pool = %+v, want one connection used three times", pool)
+	}
+}
+
+func TestReadinessWithoutValkey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	checks := []readinessCheck{{name: "postgres", ping: func(context.Context) error { return errors.New("refused") }}}
+
+	rec := httptest.NewRecorder()
+	makeReadinessHandler(checks, nil, logger).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", rec.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["valkey_pool"]; ok {
+		t.Errorf("response %s has valkey_pool without a Valkey limiter", rec.Body)
+	}
+}
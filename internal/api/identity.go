@@ -0,0 +1,147 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/oidc"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// oauthProfile is a provider account, normalized from whatever the provider
+// returned, for providers linked through user_identities.
+type oauthProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	// PrivateEmail marks a relay address, such as Apple's Hide My Email.
+	PrivateEmail bool
+}
+
+// claimsProfile maps the standard OpenID Connect claims.
+func claimsProfile(claims *oidc.Claims) oauthProfile {
+	return oauthProfile{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          strings.TrimSpace(claims.Name),
+		Picture:       claims.Picture,
+	}
+}
+
+// oauthNonce derives the ID token nonce from the login's stored verifier, so
+// the nonce binds the token to this browser without storage of its own. The
+// label keeps it distinct from the PKCE challenge derived from the same value.
+func oauthNonce(verifier string) string {
+	sum := sha256.Sum256([]byte("oauth_nonce\n" + verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// oauthDenied is a provider login refused for a reason the client is told.
+type oauthDenied struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *oauthDenied) Error() string { return e.message }
+
+// writeOAuthLoginError answers an identityUser error.
+func (h *AuthHandler) writeOAuthLoginError(w http.ResponseWriter, err error) {
+	var denied *oauthDenied
+	if errors.As(err, &denied) {
+		writeError(w, denied.status, denied.code, denied.message)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+// identityUser returns the account linked to profile's subject at provider,
+// creating it on first sign-in. Like Google, an email that already belongs to
+// another account is refused rather than linked.
+func (h *AuthHandler) identityUser(r *http.Request, provider string, profile oauthProfile, requireVerified bool) (db.User, error) {
+	ctx := r.Context()
+	identity, err := h.queries.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  profile.Subject,
+	})
+	if err == nil {
+		return h.queries.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return db.User{}, err
+	}
+
+	invalid := &oauthDenied{http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response"}
+	if profile.Subject == "" || profile.Email == "" {
+		return db.User{}, invalid
+	}
+	email, err := domain.NormalizeEmail(profile.Email)
+	if err != nil {
+		return db.User{}, invalid
+	}
+	if requireVerified && !profile.EmailVerified {
+		h.auditLogger.Log(ctx, "oauth_login_failure", pgtype.UUID{}, h.ipFromRequest(r), r.UserAgent(), map[string]any{
+			"email_hash": hashEmail(email),
+			"provider":   provider,
+			"reason":     "email_unverified",
+		})
+		return db.User{}, &oauthDenied{http.StatusForbidden, CodeEmailNotVerified, "email address is not verified with the identity provider"}
+	}
+
+	conflict := func() error {
+		h.auditLogger.Log(ctx, "oauth_login_failure", pgtype.UUID{}, h.ipFromRequest(r), r.UserAgent(), map[string]any{
+			"email_hash": hashEmail(email),
+			"provider":   provider,
+			"reason":     "email_conflict",
+		})
+		return &oauthDenied{http.StatusBadRequest, CodeOAuthFailed, "unable to authenticate"}
+	}
+	if _, err := h.queries.GetUserByEmail(ctx, email); err == nil {
+		return db.User{}, conflict()
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return db.User{}, err
+	}
+
+	name := profile.Name
+	if name == "" {
+		name = email
+	}
+
+	var user db.User
+	err = h.store.WithTx(ctx, func(q db.Querier) error {
+		var err error
+		user, err = q.CreateUser(ctx, db.CreateUserParams{
+			Email:         email,
+			EmailVerified: profile.EmailVerified,
+			Name:          name,
+			Picture:       pgtype.Text{String: profile.Picture, Valid: profile.Picture != ""},
+			Provider:      provider,
+		})
+		if err != nil {
+			return err
+		}
+		return q.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+			Provider:     provider,
+			Subject:      profile.Subject,
+			UserID:       user.ID,
+			Email:        email,
+			PrivateEmail: profile.PrivateEmail,
+		})
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return db.User{}, conflict()
+		}
+		return db.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/mounis-bhat/starter/internal/config"
+)
+
+// WithIPFilter rejects requests to cfg.IPFilter.Paths from denied networks with
+// 403 before they reach a handler. When an allowlist is set, addresses outside it
+// are denied too. Countries are read from cfg.IPFilter.CountryHeader, which only
+// a trusted proxy such as a CDN can be relied on to set. cfg must have passed
+// Config.Validate.
+func WithIPFilter(cfg *config.Config, next http.Handler) http.Handler {
+	if !cfg.IPFilter.Enabled() {
+		return next
+	}
+	allow, deny, _ := cfg.IPFilter.Prefixes()
+	filter := ipFilter{
+		allow:         allow,
+		deny:          deny,
+		paths:         cfg.IPFilter.Paths,
+		countryHeader: cfg.IPFilter.CountryHeader,
+		denyCountries: cfg.IPFilter.DenyCountries,
+		proxies:       newTrustedProxies(cfg.Auth.TrustedProxy),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filter.applies(r.URL.Path) && !filter.allowed(r) {
+			writeError(w, http.StatusForbidden, CodeForbidden, "access denied")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type ipFilter struct {
+	allow         []netip.Prefix
+	deny          []netip.Prefix
+	paths         []string
+	countryHeader string
+	denyCountries []string
+	proxies       trustedProxies
+}
+
+func (f ipFilter) applies(path string) bool {
+	for _, prefix := range f.paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f ipFilter) allowed(r *http.Request) bool {
+	if f.countryHeader != "" {
+		country := strings.TrimSpace(r.Header.Get(f.countryHeader))
+		for _, denied := range f.denyCountries {
+			if strings.EqualFold(country, denied) {
+				return false
+			}
+		}
+	}
+
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return true
+	}
+	ip := f.proxies.clientIP(r)
+	if ip == nil {
+		return len(f.allow) == 0
+	}
+	if prefixesContain(f.deny, *ip) {
+		return false
+	}
+	return len(f.allow) == 0 || prefixesContain(f.allow, *ip)
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,4 +1,110 @@
 package api
 
-// Middleware placeholder
-// Add middleware functions here as needed (logging, auth, cors, etc.)
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/logging"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	requestIDMaxLength = 128
+)
+
+// WithRequestLogging assigns each request an ID and writes a structured access log entry on completion.
+// The ID and the client IP resolved through the trusted proxies go into the request context
+// (see ctxkeys) for everything downstream.
+// Query parameters and, at debug level, headers are logged with the values named in
+// cfg.LogRedactKeys replaced.
+func WithRequestLogging(cfg *config.Config, logger *slog.Logger, next http.Handler) http.Handler {
+	redactor := logging.NewRedactor(cfg.LogRedactKeys)
+	proxies := newTrustedProxies(cfg.Auth.TrustedProxy)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		ctx := ctxkeys.WithRequestID(r.Context(), requestID)
+		remoteIP := "unknown"
+		if ip := proxies.clientIP(r); ip != nil {
+			remoteIP = ip.String()
+			ctx = ctxkeys.WithClientIP(ctx, *ip)
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		attrs := []slog.Attr{
+			slog.String("request_id", requestID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_ip", remoteIP),
+		}
+		if r.URL.RawQuery != "" {
+			attrs = append(attrs, slog.String("query", redactor.Query(r.URL.RawQuery)))
+		}
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, redactor.Headers(r.Header))
+		}
+		logger.LogAttrs(ctx, slog.LevelInfo, "request", attrs...)
+	})
+}
+
+func isValidRequestID(value string) bool {
+	if value == "" || len(value) > requestIDMaxLength {
+		return false
+	}
+	for _, r := range value {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder captures the status code and body size written by downstream handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if !s.wroteHeader {
+		s.wroteHeader = true
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
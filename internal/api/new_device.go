@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/email"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+const (
+	// newDeviceCheckTimeout bounds the background history lookup and email.
+	newDeviceCheckTimeout = 30 * time.Second
+	// newDeviceHistoryLimit caps how many distinct address/user-agent pairs are
+	// compared; a user with more than this is not short of known devices.
+	newDeviceHistoryLimit = 200
+)
+
+// checkNewDevice compares a successful login with the user's earlier ones and,
+// when neither the user agent nor the network has been seen within
+// AUTH_NEW_DEVICE_LOOKBACK_DAYS, audits login_new_device and emails the user.
+// It runs in the background, tracked by h.background, so login latency is
+// unaffected and shutdown can wait for it. Users with no earlier login in the
+// window are not notified.
+func (h *AuthHandler) checkNewDevice(ctx context.Context, user db.User, method string, ip *netip.Addr, userAgent string) {
+	if h.newDeviceLookback <= 0 {
+		return
+	}
+
+	// Only logins before this one count; its own audit event is written next.
+	loginAt := time.Now()
+	ctx = context.WithoutCancel(ctx)
+	h.background.Go(func() {
+		ctx, cancel := context.WithTimeout(ctx, newDeviceCheckTimeout)
+		defer cancel()
+
+		history, err := h.queries.ListRecentLoginDevices(ctx, db.ListRecentLoginDevicesParams{
+			UserID: user.ID,
+			Since:  pgtype.Timestamptz{Time: loginAt.Add(-h.newDeviceLookback), Valid: true},
+			Before: pgtype.Timestamptz{Time: loginAt, Valid: true},
+			Limit:  newDeviceHistoryLimit,
+		})
+		if err != nil {
+			h.logger.Warn("new device check failed", logging.Err(err))
+			return
+		}
+		if len(history) == 0 || knownDevice(history, ip, userAgent) {
+			return
+		}
+
+		h.auditLogger.Log(ctx, "login_new_device", user.ID, ip, userAgent, map[string]any{
+			"method": method,
+		})
+		h.sendNewDeviceEmail(ctx, user, loginAt, ip, userAgent)
+	})
+}
+
+// knownDevice reports whether an earlier login used the same user agent or came
+// from the same network (/24 for IPv4, /48 for IPv6).
+func knownDevice(history []db.ListRecentLoginDevicesRow, ip *netip.Addr, userAgent string) bool {
+	for _, seen := range history {
+		if userAgent != "" && seen.UserAgent.Valid && seen.UserAgent.String == userAgent {
+			return true
+		}
+		if ip != nil && seen.IpAddress != nil && sameNetwork(*ip, *seen.IpAddress) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameNetwork(a, b netip.Addr) bool {
+	a, b = a.Unmap(), b.Unmap()
+	if a.Is4() != b.Is4() {
+		return false
+	}
+	bits := 48
+	if a.Is4() {
+		bits = 24
+	}
+	prefix, err := a.Prefix(bits)
+	return err == nil && prefix.Contains(b)
+}
+
+func (h *AuthHandler) sendNewDeviceEmail(ctx context.Context, user db.User, loginAt time.Time, ip *netip.Addr, userAgent string) {
+	if h.mailer == nil {
+		return
+	}
+
+	ipValue := "unknown"
+	if ip != nil {
+		ipValue = ip.String()
+	}
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
+
+	name := strings.TrimSpace(user.Name)
+	if name == "" {
+		name = user.Email
+	}
+
+	subject, params := newDeviceEmail(name, loginAt, ipValue, userAgent)
+	textBody := email.RenderText(params)
+	htmlBody := email.RenderHTML(params)
+
+	if err := h.mailer.Send(ctx, user.Email, subject, textBody, htmlBody); err != nil {
+		h.logger.Error("email send failed", slog.String("type", "new_device"), logging.Err(err))
+		h.auditLogger.Log(ctx, "email_send_failed", user.ID, ip, userAgent, map[string]any{
+			"type":  "new_device",
+			"error": err.Error(),
+		})
+	}
+}
+
+func newDeviceEmail(name string, loginAt time.Time, ipValue, userAgent string) (string, email.EmailParams) {
+	return "New sign-in to your account", email.EmailParams{
+		Greeting: fmt.Sprintf("Hi %s,", name),
+		BodyLines: []string{
+			"Your account was just signed in to from a device or network we haven't seen recently.",
+			fmt.Sprintf("Time: %s", loginAt.UTC().Format(time.RFC1123)),
+			fmt.Sprintf("IP address: %s", ipValue),
+			fmt.Sprintf("Device: %s", userAgent),
+		},
+		FooterText: "If this was you, you can ignore this email. If not, change your password and sign out of other sessions.",
+	}
+}
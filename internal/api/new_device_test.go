@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// deviceQuerier answers the new device check with a fixed login history.
+type deviceQuerier struct {
+	db.Querier
+	history []db.ListRecentLoginDevicesRow
+}
+
+func (q deviceQuerier) ListRecentLoginDevices(context.Context, db.ListRecentLoginDevicesParams) ([]db.ListRecentLoginDevicesRow, error) {
+	return q.history, nil
+}
+
+func TestCheckNewDeviceTrackedInBackground(t *testing.T) {
+	seenIP := netip.MustParseAddr("203.0.113.7")
+	history := []db.ListRecentLoginDevicesRow{{
+		IpAddress: &seenIP,
+		UserAgent: pgtype.Text{String: "known-agent", Valid: true},
+	}}
+	tests := []struct {
+		name      string
+		ip        string
+		userAgent string
+		want      int
+	}{
+		{"new device", "198.51.100.1", "new-agent", 1},
+		{"same user agent", "198.51.100.1", "known-agent", 0},
+		{"same network", "203.0.113.200", "new-agent", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testAuthConfig()
+			cfg.NewDeviceLookback = 24 * time.Hour
+			h, _, audit := newTestAuthHandler(t, cfg)
+			h.queries = deviceQuerier{history: history}
+
+			ip := netip.MustParseAddr(tt.ip)
+			h.checkNewDevice(t.Context(), db.User{Email: "user@example.com"}, "password", &ip, tt.userAgent)
+			// Shutdown waits on the same group; once it returns the check is done.
+			h.background.Wait()
+
+			if got := len(audit.find("login_new_device")); got != tt.want {
+				t.Errorf("login_new_device logged %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/oidc"
+	"github.com/mounis-bhat/starter/internal/storage/oauthstate"
+	"golang.org/x/oauth2"
+)
+
+// oidcHTTPTimeout bounds each request to the issuer: discovery, keys, token
+// exchange and userinfo.
+const oidcHTTPTimeout = 10 * time.Second
+
+// genericOIDC signs users in through any OpenID Connect issuer. Its endpoints
+// come from the issuer's discovery document, fetched on first use and kept for
+// the life of the process; a failed fetch is retried at the next login.
+type genericOIDC struct {
+	cfg     config.OIDCConfig
+	cookies OAuthCookieSettings
+	client  *http.Client
+
+	mu        sync.Mutex
+	endpoints *oidcEndpoints
+}
+
+type oidcEndpoints struct {
+	oauth    oauth2.Config
+	verifier *oidc.Verifier
+	userinfo string
+}
+
+// newGenericOIDC returns nil when no issuer is configured.
+func newGenericOIDC(cfg config.OIDCConfig) *genericOIDC {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &genericOIDC{
+		cfg:     cfg,
+		cookies: OAuthCookieSettings{Path: cfg.CookiePath, SameSite: http.SameSiteLaxMode},
+		client:  &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+func (p *genericOIDC) discover(ctx context.Context) (*oidcEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	meta, err := oidc.Discover(ctx, p.cfg.Issuer, p.client)
+	if err != nil {
+		return nil, err
+	}
+	p.endpoints = &oidcEndpoints{
+		oauth: oauth2.Config{
+			ClientID:     p.cfg.ClientID,
+			ClientSecret: p.cfg.ClientSecret,
+			RedirectURL:  p.cfg.RedirectURI,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  meta.AuthorizationEndpoint,
+				TokenURL: meta.TokenEndpoint,
+			},
+			Scopes: p.cfg.Scopes,
+		},
+		verifier: &oidc.Verifier{
+			Issuer:   meta.Issuer,
+			ClientID: p.cfg.ClientID,
+			Keys:     oidc.NewKeySet(meta.JWKSURI, p.client),
+		},
+		userinfo: meta.UserinfoEndpoint,
+	}
+	return p.endpoints, nil
+}
+
+// HandleOIDCLogin initiates sign-in with the configured OpenID Connect issuer
+// @Summary      Login with OpenID Connect
+// @Description  Redirects to the authorization endpoint of the OIDC_ISSUER found through its discovery document. An optional redirect path under AUTH_POST_LOGIN_REDIRECT_PREFIXES is where the callback sends the user afterwards; other values are ignored.
+// @Tags         auth
+// @Produce      json
+// @Param        redirect  query  string  false  "Path to return to after login"
+// @Success      302
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Failure      502  {object}  APIError
+// @Router       /auth/oidc [get]
+func (h *AuthHandler) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if !h.allowRequest(r.Context(), "oidc", r, h.rateLimits.Google) {
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+		return
+	}
+
+	if h.oidcProvider == nil {
+		writeError(w, http.StatusInternalServerError, CodeFeatureDisabled, "oidc not configured")
+		return
+	}
+	endpoints, err := h.oidcProvider.discover(r.Context())
+	if err != nil {
+		h.logger.Warn("oidc discovery failed", slog.String("issuer", h.oidcProvider.cfg.Issuer), logging.Err(err))
+		writeError(w, http.StatusBadGateway, CodeUpstreamError, "identity provider unavailable")
+		return
+	}
+
+	state, err := generateRandomToken(32)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	verifier, err := generateRandomToken(64)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	entry := oauthstate.Entry{State: state, Verifier: verifier}
+	if raw := r.URL.Query().Get("redirect"); raw != "" {
+		if target, ok := h.returnURLs.resolve(raw); ok {
+			entry.Redirect = target
+		} else {
+			h.logger.Debug("ignoring disallowed oauth redirect", slog.String("redirect", raw))
+		}
+	}
+	h.saveOAuthState(r.Context(), w, h.oidcProvider.cookies, entry)
+
+	authURL := endpoints.oauth.AuthCodeURL(
+		state,
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oauth2.SetAuthURLParam("nonce", oauthNonce(verifier)),
+	)
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]string{"url": authURL})
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOIDCCallback handles the OpenID Connect callback
+// @Summary      OpenID Connect callback
+// @Description  Exchanges the code with PKCE, verifies the ID token (signature, iss, aud, exp, nonce) and creates a session
+// @Tags         auth
+// @Produce      json
+// @Success      302
+// @Failure      400  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Failure      502  {object}  APIError
+// @Router       /auth/oidc/callback [get]
+func (h *AuthHandler) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidcProvider == nil {
+		writeError(w, http.StatusInternalServerError, CodeFeatureDisabled, "oidc not configured")
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	code := r.URL.Query().Get("code")
+	if state == "" || code == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+		return
+	}
+
+	saved, ok := h.takeOAuthState(w, r, h.oidcProvider.cookies)
+	if !ok || subtle.ConstantTimeCompare([]byte(state), []byte(saved.State)) != 1 {
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid state")
+		return
+	}
+
+	endpoints, err := h.oidcProvider.discover(r.Context())
+	if err != nil {
+		h.logger.Warn("oidc discovery failed", slog.String("issuer", h.oidcProvider.cfg.Issuer), logging.Err(err))
+		writeError(w, http.StatusBadGateway, CodeUpstreamError, "identity provider unavailable")
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, h.oidcProvider.client)
+	token, err := endpoints.oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", saved.Verifier))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth code")
+		return
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	claims, err := endpoints.verifier.Verify(r.Context(), rawIDToken, oauthNonce(saved.Verifier))
+	if err != nil {
+		h.logger.Warn("oidc id token rejected", logging.Err(err))
+		writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response")
+		return
+	}
+
+	profile := claimsProfile(claims)
+	if profile.Email == "" && endpoints.userinfo != "" {
+		// Some issuers only put profile claims in the userinfo response.
+		info, err := fetchUserinfo(ctx, endpoints, token)
+		if err != nil {
+			h.logger.Warn("oidc userinfo failed", logging.Err(err))
+			writeError(w, http.StatusBadGateway, CodeUpstreamError, "identity provider unavailable")
+			return
+		}
+		if info.Subject != claims.Subject {
+			writeError(w, http.StatusBadRequest, CodeOAuthFailed, "invalid oauth response")
+			return
+		}
+		profile = claimsProfile(info)
+	}
+
+	user, err := h.identityUser(r, domain.AuthMethodOIDC, profile, h.oidcProvider.cfg.RequireVerifiedEmail)
+	if err != nil {
+		h.writeOAuthLoginError(w, err)
+		return
+	}
+
+	h.finishOAuthLogin(w, r, user, domain.AuthMethodOIDC, saved.Redirect, map[string]any{
+		"issuer": claims.Issuer,
+	})
+}
+
+// fetchUserinfo reads the userinfo endpoint with the access token. Its
+// response uses the same claim names as the ID token.
+func fetchUserinfo(ctx context.Context, endpoints *oidcEndpoints, token *oauth2.Token) (*oidc.Claims, error) {
+	resp, err := endpoints.oauth.Client(ctx, token).Get(endpoints.userinfo)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var info oidc.Claims
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, err
+	}
+	if info.Subject == "" {
+		return nil, errors.New("userinfo: missing sub")
+	}
+	return &info, nil
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/domain"
+)
+
+// PasswordCheckRequest is a candidate password with the account details it is
+// scored against
+// @Description Password check request
+type PasswordCheckRequest struct {
+	Password string `json:"password" example:"correct horse battery staple" validate:"required,max=1000"`
+	Email    string `json:"email,omitempty" example:"user@example.com" validate:"max=255"`
+	Name     string `json:"name,omitempty" example:"Jane Doe" validate:"max=255"`
+}
+
+// PasswordCheckResponse reports how the server would judge a password
+// @Description Password check response
+type PasswordCheckResponse struct {
+	// Score is the 0-4 strength estimate, computed under every policy.
+	Score int `json:"score" example:"3"`
+	// MinScore is the lowest score the policy accepts.
+	MinScore    int      `json:"min_score" example:"3"`
+	Acceptable  bool     `json:"acceptable" example:"true"`
+	Message     string   `json:"message,omitempty" example:"password must include a number"`
+	Warning     string   `json:"warning,omitempty" example:"This is a very common password."`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func newPasswordPolicy(cfg config.AuthConfig) domain.PasswordPolicy {
+	policy := domain.PasswordPolicy{Rules: cfg.PasswordPolicy != config.PasswordPolicyEntropy}
+	if cfg.PasswordPolicy != config.PasswordPolicyRules {
+		policy.MinScore = cfg.PasswordMinScore
+	}
+	return policy
+}
+
+// HandlePasswordCheck scores a candidate password
+// @Summary      Check password strength
+// @Description  Runs the same policy that register and password change enforce and returns the strength estimate, so a strength meter agrees with the server. Nothing is stored.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body PasswordCheckRequest true "Password check request"
+// @Success      200  {object}  PasswordCheckResponse
+// @Failure      400  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Router       /auth/password/check [post]
+func (h *AuthHandler) HandlePasswordCheck(w http.ResponseWriter, r *http.Request) {
+	if !h.allowRequest(r.Context(), "password-check", r, h.rateLimits.PasswordCheck) {
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+		return
+	}
+
+	req, ok := decodeAndValidate[PasswordCheckRequest](w, r)
+	if !ok {
+		return
+	}
+
+	strength := domain.EstimatePasswordStrength(req.Password, req.Email, req.Name)
+	response := PasswordCheckResponse{
+		Score:       strength.Score,
+		MinScore:    h.passwordPolicy.RequiredScore(),
+		Acceptable:  true,
+		Warning:     strength.Warning,
+		Suggestions: strength.Suggestions,
+	}
+	if err := h.passwordPolicy.Validate(req.Password, req.Email, req.Name); err != nil {
+		response.Acceptable = false
+		response.Message = err.Error()
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// writePasswordReused rejects a new password that matches one of the last
+// limit passwords, the current one included.
+func writePasswordReused(w http.ResponseWriter, limit int) {
+	writeErrorDetails(w, http.StatusBadRequest, CodePasswordReused, "password was used recently", map[string]any{
+		"history": limit,
+	})
+}
+
+// writePasswordError answers a password the policy rejected. Strength failures
+// carry the estimate in details so the client can show the same feedback as
+// the password check.
+func writePasswordError(w http.ResponseWriter, err error) {
+	var weak *domain.WeakPasswordError
+	if !errors.As(err, &weak) {
+		writeError(w, http.StatusBadRequest, CodeWeakPassword, err.Error())
+		return
+	}
+	writeErrorDetails(w, http.StatusBadRequest, CodeWeakPassword, err.Error(), map[string]any{
+		"score":       weak.Strength.Score,
+		"min_score":   weak.MinScore,
+		"warning":     weak.Strength.Warning,
+		"suggestions": weak.Strength.Suggestions,
+	})
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// passwordReused reports whether password matches the user's current password
+// or one of the replaced ones kept in password_history, checking at most
+// AUTH_PASSWORD_HISTORY hashes in total. Each check is a full Argon2
+// verification, so the limit is kept small.
+func (h *AuthHandler) passwordReused(ctx context.Context, user db.User, password string) (bool, error) {
+	if h.passwordHistory <= 0 {
+		return false, nil
+	}
+
+	var hashes []string
+	if user.PasswordHash.Valid && user.PasswordHash.String != "" {
+		hashes = append(hashes, user.PasswordHash.String)
+	}
+	if h.passwordHistory > 1 {
+		previous, err := h.queries.ListPasswordHistory(ctx, db.ListPasswordHistoryParams{
+			UserID: user.ID,
+			Limit:  int32(h.passwordHistory - 1),
+		})
+		if err != nil {
+			return false, err
+		}
+		hashes = append(hashes, previous...)
+	}
+
+	for _, hash := range hashes {
+		match, err := domain.VerifyPassword(password, hash)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPasswordHistory keeps the hash user is about to replace and prunes the
+// history to what passwordReused still reads. It runs in the same transaction
+// as the password update.
+func (h *AuthHandler) recordPasswordHistory(ctx context.Context, q db.Querier, user db.User) error {
+	keep := max(h.passwordHistory-1, 0)
+	if keep > 0 && user.PasswordHash.Valid && user.PasswordHash.String != "" {
+		if err := q.AddPasswordHistory(ctx, db.AddPasswordHistoryParams{
+			UserID:       user.ID,
+			PasswordHash: user.PasswordHash.String,
+		}); err != nil {
+			return err
+		}
+	}
+	_, err := q.PrunePasswordHistory(ctx, db.PrunePasswordHistoryParams{
+		UserID: user.ID,
+		Keep:   int32(keep),
+	})
+	return err
+}
@@ -1,10 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+)
+
+const (
+	recipeListDefaultLimit = 20
+	recipeListMaxLimit     = 100
 )
 
 // RecipeRequest represents the input for recipe generation.
@@ -14,9 +26,18 @@ type RecipeRequest struct {
 	DietaryRestrictions string `json:"dietaryRestrictions,omitempty" jsonschema:"description=Any dietary restrictions" example:"gluten-free"`
 }
 
+// RecipeBatchRequest represents the input for generating several recipes at once.
+// @Description Batch recipe generation request
+type RecipeBatchRequest struct {
+	Ingredient          string `json:"ingredient" example:"chicken" validate:"required"`
+	DietaryRestrictions string `json:"dietaryRestrictions,omitempty" example:"gluten-free"`
+	Count               int    `json:"count" example:"3" validate:"required,min=1"`
+}
+
 // Recipe represents a generated recipe.
 // @Description Generated recipe
 type Recipe struct {
+	ID           string   `json:"id" example:"0b9e6a7c-1c1f-4f55-9d2a-3a8e1c9b2f10" validate:"required"`
 	Title        string   `json:"title" example:"Grilled Lemon Herb Chicken" validate:"required"`
 	Description  string   `json:"description" example:"A delicious and healthy grilled chicken recipe" validate:"required"`
 	PrepTime     string   `json:"prepTime" example:"15 minutes" validate:"required"`
@@ -27,60 +48,388 @@ type Recipe struct {
 	Tips         []string `json:"tips,omitempty" example:"Let rest for 5 minutes before serving"`
 }
 
+// SavedRecipe is a stored recipe together with the request that produced it.
+// @Description Saved recipe
+type SavedRecipe struct {
+	Recipe
+	Request   RecipeRequest `json:"request" validate:"required"`
+	CreatedAt time.Time     `json:"createdAt" validate:"required"`
+}
+
+// RecipeListResponse is one page of the caller's saved recipes, newest first.
+// @Description Saved recipe page
+type RecipeListResponse struct {
+	Recipes []SavedRecipe `json:"recipes" validate:"required"`
+	Limit   int           `json:"limit" example:"20"`
+	Offset  int           `json:"offset" example:"0"`
+	HasMore bool          `json:"hasMore"`
+}
+
+// RecipeBatchResponse represents several generated recipes.
+// @Description Batch recipe generation response
+type RecipeBatchResponse struct {
+	Recipes   []Recipe `json:"recipes" validate:"required"`
+	Truncated bool     `json:"truncated"`
+}
+
 // makeRecipeHandler creates a handler for recipe generation using Genkit flow
 // @Summary      Generate a recipe
-// @Description  Uses AI to generate a recipe based on ingredients and dietary restrictions
+// @Description  Uses AI to generate a recipe based on ingredients and dietary restrictions. The recipe is saved for the caller and its id returned.
 // @Tags         recipes
 // @Accept       json
 // @Produce      json
 // @Param        request body RecipeRequest true "Recipe generation request"
 // @Success      200  {object}  Recipe
-// @Failure      400  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Failure      502  {object}  APIError
 // @Router       /recipes/generate [post]
-func makeRecipeHandler(service *apprecipes.Service) http.HandlerFunc {
+func makeRecipeHandler(service *apprecipes.Service, maxResponseBytes int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req RecipeRequest
-		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-		decoder := json.NewDecoder(r.Body)
-		decoder.DisallowUnknownFields()
-		if err := decoder.Decode(&req); err != nil {
-			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		req, ok := decodeAndValidate[RecipeRequest](w, r)
+		if !ok {
 			return
 		}
-		if req.Ingredient == "" {
-			http.Error(w, "ingredient is required", http.StatusBadRequest)
+
+		user, ok := ctxkeys.User(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 			return
 		}
-		if err := decoder.Decode(&struct{}{}); err == nil {
-			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+
+		recipe, err := service.Generate(r.Context(), user.ID, apprecipes.RecipeRequest{
+			Ingredient:          req.Ingredient,
+			DietaryRestrictions: req.DietaryRestrictions,
+		})
+		if err != nil {
+			writeRecipeError(w, err)
+			return
+		}
+
+		body, err := json.Marshal(toRecipeResponse(recipe))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "failed to write response")
+			return
+		}
+		if maxResponseBytes > 0 && len(body) > maxResponseBytes {
+			writeError(w, http.StatusBadGateway, CodeUpstreamError, "generated recipe is too large")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(append(body, '\n'))
+	}
+}
+
+// makeRecipeBatchHandler creates a handler that generates several recipes at once
+// @Summary      Generate several recipes
+// @Description  Generates up to the configured maximum number of recipes and saves each one. Recipes that would push the response past the size limit are dropped from the response and truncated is set; they remain listed under GET /recipes.
+// @Tags         recipes
+// @Accept       json
+// @Produce      json
+// @Param        request body RecipeBatchRequest true "Batch recipe generation request"
+// @Success      200  {object}  RecipeBatchResponse
+// @Failure      400  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Failure      502  {object}  APIError
+// @Router       /recipes/generate/batch [post]
+func makeRecipeBatchHandler(service *apprecipes.Service, maxResponseBytes int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeAndValidate[RecipeBatchRequest](w, r)
+		if !ok {
 			return
 		}
 
-		recipe, err := service.Generate(r.Context(), apprecipes.RecipeRequest{
+		user, ok := ctxkeys.User(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		recipes, err := service.GenerateMany(r.Context(), user.ID, apprecipes.RecipeRequest{
 			Ingredient:          req.Ingredient,
 			DietaryRestrictions: req.DietaryRestrictions,
-		})
+		}, req.Count)
 		if err != nil {
-			http.Error(w, "failed to generate recipe", http.StatusInternalServerError)
+			writeRecipeError(w, err)
 			return
 		}
 
-		response := Recipe{
-			Title:        recipe.Title,
-			Description:  recipe.Description,
-			PrepTime:     recipe.PrepTime,
-			CookTime:     recipe.CookTime,
-			Servings:     recipe.Servings,
-			Ingredients:  recipe.Ingredients,
-			Instructions: recipe.Instructions,
-			Tips:         recipe.Tips,
+		response := RecipeBatchResponse{Recipes: make([]Recipe, 0, len(recipes))}
+		for _, recipe := range recipes {
+			response.Recipes = append(response.Recipes, toRecipeResponse(recipe))
+		}
+
+		body, err := json.Marshal(response)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "failed to write response")
+			return
+		}
+		for maxResponseBytes > 0 && len(body) > maxResponseBytes && len(response.Recipes) > 1 {
+			response.Recipes = response.Recipes[:len(response.Recipes)-1]
+			response.Truncated = true
+			if body, err = json.Marshal(response); err != nil {
+				writeError(w, http.StatusInternalServerError, CodeInternal, "failed to write response")
+				return
+			}
+		}
+		if maxResponseBytes > 0 && len(body) > maxResponseBytes {
+			writeError(w, http.StatusBadGateway, CodeUpstreamError, "generated recipe is too large")
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "failed to write response", http.StatusInternalServerError)
+		_, _ = w.Write(append(body, '\n'))
+	}
+}
+
+// RecipeStreamChunk is the payload of a "chunk" event on the recipe stream.
+// @Description Partial model output
+type RecipeStreamChunk struct {
+	Text string `json:"text"`
+}
+
+// makeRecipeStreamHandler creates a handler that streams recipe generation as Server-Sent Events
+// @Summary      Stream recipe generation
+// @Description  Streams partial model output as "chunk" events, then saves the recipe and sends it, including its id, as a "done" event. Failures after the stream starts are sent as an "error" event; generation that runs past the stream timeout ends with code "upstream_timeout". When output was already streamed, the error details carry "partial": true, the recipe fields decoded so far under "recipe", and the names of the fields received in full under "complete_fields", so the client can show them and offer a retry. Closing the connection stops generation.
+// @Tags         recipes
+// @Accept       json
+// @Produce      text/event-stream
+// @Param        request body RecipeRequest true "Recipe generation request"
+// @Success      200  {object}  Recipe
+// @Failure      400  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /recipes/generate/stream [post]
+func makeRecipeStreamHandler(service *apprecipes.Service, maxResponseBytes int, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeAndValidate[RecipeRequest](w, r)
+		if !ok {
+			return
+		}
+		validated, err := service.ValidateRequest(apprecipes.RecipeRequest{
+			Ingredient:          req.Ingredient,
+			DietaryRestrictions: req.DietaryRestrictions,
+		})
+		if err != nil {
+			writeRecipeError(w, err)
+			return
+		}
+
+		user, ok := ctxkeys.User(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 			return
 		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		ctx := r.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		var streamed strings.Builder
+		recipe, err := service.GenerateStream(ctx, user.ID, validated, func(chunk string) error {
+			streamed.WriteString(chunk)
+			if maxResponseBytes > 0 && streamed.Len() > maxResponseBytes {
+				return apprecipes.ErrInvalidRecipe
+			}
+			return writeSSE(w, rc, "chunk", RecipeStreamChunk{Text: chunk})
+		})
+		if r.Context().Err() != nil {
+			return
+		}
+		if err != nil {
+			apiErr := newAPIError(w, CodeInternal, "failed to generate recipe", nil)
+			switch {
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				apiErr.Code, apiErr.Message = CodeUpstreamTimeout, "recipe generation timed out"
+			case errors.Is(err, apprecipes.ErrInvalidRecipe):
+				apiErr.Code, apiErr.Message = CodeUpstreamError, err.Error()
+			}
+			if streamed.Len() > 0 {
+				partial := apprecipes.ParsePartial(streamed.String())
+				apiErr.Details = map[string]any{
+					"partial":         true,
+					"recipe":          partial.Fields,
+					"complete_fields": partial.Complete,
+				}
+			}
+			_ = writeSSE(w, rc, "error", apiErr)
+			return
+		}
+
+		response := toRecipeResponse(recipe)
+		if body, err := json.Marshal(response); err == nil && maxResponseBytes > 0 && len(body) > maxResponseBytes {
+			_ = writeSSE(w, rc, "error", newAPIError(w, CodeUpstreamError, "generated recipe is too large", nil))
+			return
+		}
+		_ = writeSSE(w, rc, "done", response)
+	}
+}
+
+// writeSSE writes one event and flushes it. JSON encoding keeps the data on a single line.
+func writeSSE(w http.ResponseWriter, rc *http.ResponseController, event string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// makeRecipeListHandler creates a handler that lists the caller's saved recipes
+// @Summary      List saved recipes
+// @Description  Lists the caller's generated recipes, newest first. limit defaults to 20 and is capped at 100.
+// @Tags         recipes
+// @Produce      json
+// @Param        limit   query     int  false  "Page size"
+// @Param        offset  query     int  false  "Number of recipes to skip"
+// @Success      200  {object}  RecipeListResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /recipes [get]
+func makeRecipeListHandler(service *apprecipes.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ctxkeys.User(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		limit, err := queryInt(r, "limit", recipeListDefaultLimit)
+		if err != nil || limit <= 0 || limit > recipeListMaxLimit {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and 100")
+			return
+		}
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "offset must not be negative")
+			return
+		}
+
+		// Fetch one extra row to learn whether another page exists.
+		recipes, err := service.List(r.Context(), user.ID, limit+1, offset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "failed to list recipes")
+			return
+		}
+
+		response := RecipeListResponse{
+			Recipes: make([]SavedRecipe, 0, min(len(recipes), limit)),
+			Limit:   limit,
+			Offset:  offset,
+			HasMore: len(recipes) > limit,
+		}
+		for _, recipe := range recipes[:min(len(recipes), limit)] {
+			response.Recipes = append(response.Recipes, toSavedRecipeResponse(recipe))
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// makeRecipeGetHandler creates a handler that returns one of the caller's saved recipes
+// @Summary      Get saved recipe
+// @Description  Returns a saved recipe. Recipes owned by other users are reported as not found.
+// @Tags         recipes
+// @Produce      json
+// @Param        id   path      string  true  "Recipe ID"
+// @Success      200  {object}  SavedRecipe
+// @Failure      401  {object}  APIError
+// @Failure      403  {object}  APIError
+// @Failure      404  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /recipes/{id} [get]
+func makeRecipeGetHandler(service *apprecipes.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ctxkeys.User(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		recipe, err := service.Get(r.Context(), user.ID, r.PathValue("id"))
+		if err != nil {
+			if errors.Is(err, apprecipes.ErrRecipeNotFound) {
+				writeError(w, http.StatusNotFound, CodeNotFound, "recipe not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, CodeInternal, "failed to load recipe")
+			return
+		}
+		writeJSON(w, http.StatusOK, toSavedRecipeResponse(recipe))
+	}
+}
+
+// queryInt parses an integer query parameter, returning fallback when it is absent.
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func writeRecipeError(w http.ResponseWriter, err error) {
+	var validationErr *apprecipes.ValidationError
+	if errors.As(err, &validationErr) {
+		writeErrorDetails(w, http.StatusUnprocessableEntity, CodeValidationFailed, "validation failed", map[string]any{
+			"fields": validationErr.Fields,
+		})
+		return
+	}
+	if errors.Is(err, apprecipes.ErrInvalidIngredient) {
+		writeError(w, http.StatusUnprocessableEntity, CodeInvalidIngredient, err.Error())
+		return
+	}
+	if errors.Is(err, apprecipes.ErrInvalidRecipe) {
+		writeError(w, http.StatusBadGateway, CodeUpstreamError, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, CodeInternal, "failed to generate recipe")
+}
+
+func toRecipeResponse(saved *apprecipes.SavedRecipe) Recipe {
+	recipe := saved.Recipe
+	return Recipe{
+		ID:           saved.ID,
+		Title:        recipe.Title,
+		Description:  recipe.Description,
+		PrepTime:     recipe.PrepTime,
+		CookTime:     recipe.CookTime,
+		Servings:     recipe.Servings,
+		Ingredients:  recipe.Ingredients,
+		Instructions: recipe.Instructions,
+		Tips:         recipe.Tips,
+	}
+}
+
+func toSavedRecipeResponse(saved *apprecipes.SavedRecipe) SavedRecipe {
+	return SavedRecipe{
+		Recipe: toRecipeResponse(saved),
+		Request: RecipeRequest{
+			Ingredient:          saved.Request.Ingredient,
+			DietaryRestrictions: saved.Request.DietaryRestrictions,
+		},
+		CreatedAt: saved.CreatedAt,
 	}
 }
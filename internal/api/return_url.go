@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// returnURLs validates the per-request `redirect` destination for Google login.
+// Only paths under one of prefixes are accepted, as a relative path or as an
+// absolute URL on one of origins; anything else is an open redirect and is
+// dropped in favour of the configured post-login URL.
+type returnURLs struct {
+	prefixes []string
+	origins  []string
+	// base is prepended to accepted relative paths so they land on the same
+	// origin as AUTH_POST_LOGIN_REDIRECT_URL (e.g. the dev server); empty means
+	// this host.
+	base string
+}
+
+// newReturnURLs builds the validator. postLoginRedirect is the already
+// sanitized AUTH_POST_LOGIN_REDIRECT_URL; appBaseURL is APP_BASE_URL.
+func newReturnURLs(prefixes []string, postLoginRedirect, appBaseURL string) returnURLs {
+	r := returnURLs{prefixes: prefixes}
+	if origin := urlOrigin(appBaseURL); origin != "" {
+		r.origins = append(r.origins, origin)
+	}
+	if origin := urlOrigin(postLoginRedirect); origin != "" {
+		r.origins = append(r.origins, origin)
+		r.base = origin
+	}
+	return r
+}
+
+// resolve returns the redirect target for raw and whether it is allowed.
+func (r returnURLs) resolve(raw string) (string, bool) {
+	if raw == "" || len(r.prefixes) == 0 || strings.ContainsAny(raw, "\\\r\n\t") {
+		return "", false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Opaque != "" || parsed.User != nil {
+		return "", false
+	}
+	origin := r.base
+	if parsed.Scheme != "" || parsed.Host != "" {
+		origin = parsed.Scheme + "://" + parsed.Host
+		if !slices.Contains(r.origins, origin) {
+			return "", false
+		}
+	} else if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") {
+		return "", false
+	}
+
+	// Reject dot segments and doubled slashes (also percent-encoded ones, which
+	// browsers decode) so "/app/../admin" cannot pass a "/app/" prefix.
+	p := parsed.Path
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if p == "" || cleaned != p || !underPathPrefix(p, r.prefixes) {
+		return "", false
+	}
+
+	target := parsed.EscapedPath()
+	if parsed.RawQuery != "" {
+		target += "?" + parsed.RawQuery
+	}
+	if parsed.Fragment != "" {
+		target += "#" + parsed.EscapedFragment()
+	}
+	return origin + target, true
+}
+
+// underPathPrefix matches p against prefixes on segment boundaries, so "/app"
+// matches "/app" and "/app/x" but not "/apple".
+func underPathPrefix(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if p == prefix || strings.HasPrefix(p, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// urlOrigin returns "scheme://host" for an absolute http(s) URL, or "".
+func urlOrigin(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
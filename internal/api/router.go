@@ -1,57 +1,309 @@
 package api
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
 	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
 	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/domain"
 	"github.com/mounis-bhat/starter/internal/email"
+	"github.com/mounis-bhat/starter/internal/logging"
 	"github.com/mounis-bhat/starter/internal/ratelimit"
 	"github.com/mounis-bhat/starter/internal/storage"
 	"github.com/mounis-bhat/starter/internal/storage/blob"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+	"github.com/mounis-bhat/starter/internal/storage/oauthstate"
+	"github.com/mounis-bhat/starter/internal/storage/sessioncache"
+	"github.com/redis/go-redis/v9"
 )
 
-func NewRouter(cfg *config.Config, store *storage.Store, recipeService *apprecipes.Service, blobClient *blob.Client) *http.ServeMux {
+// valkeyPingTimeout bounds the startup connectivity checks against Valkey.
+const valkeyPingTimeout = 2 * time.Second
+
+func NewRouter(cfg *config.Config, store *storage.Store, valkey *redis.Client, recipeService *apprecipes.Service, blobStore blob.Store, auditBatcher *AuditBatcher, background *sync.WaitGroup, logger *slog.Logger) http.Handler {
 	mux := http.NewServeMux()
 
-	var limiter RateLimiter
+	var limiters RateLimiters
 	if cfg.RateLimit.Enabled {
-		limiter = ratelimit.NewValkeyLimiter(cfg.Valkey.Addr(), cfg.Valkey.Password)
+		limiters = newRateLimiters(cfg, valkey, logger)
 	}
-	mailer, err := email.NewGmailMailer(cfg.Email.ContactEmail, cfg.Email.GmailAppPassword)
+	var mailer email.Mailer
+	gmailMailer, err := email.NewGmailMailer(cfg.Email.ContactEmail, cfg.Email.GmailAppPassword)
 	if err != nil {
-		mailer = nil
+		logger.Warn("email disabled", logging.Err(err))
+	} else {
+		mailer = gmailMailer
+	}
+	if cfg.Auth.RequireVerifiedEmail && mailer == nil {
+		logger.Warn("AUTH_REQUIRE_VERIFIED_EMAIL is set but email is disabled; new credentials users cannot sign in")
+	}
+	authHandler := NewAuthHandler(store, cfg.Auth, cfg.Google, cfg.Email, cfg.RateLimit, cfg.Audit, limiters, mailer, logger)
+	authHandler.background = background
+	if authHandler.apple, err = newAppleSignIn(cfg.Apple); err != nil {
+		logger.Warn("sign in with apple disabled", logging.Err(err))
+	}
+	authHandler.oidcProvider = newGenericOIDC(cfg.OIDC)
+	if authHandler.oidcProvider != nil {
+		warmOIDCDiscovery(authHandler.oidcProvider, logger)
+	}
+	if (authHandler.oauthConfig != nil || authHandler.apple != nil || authHandler.oidcProvider != nil) && cfg.Google.StateStore == config.OAuthStateStoreValkey {
+		authHandler.oauthStates = newOAuthStateStore(cfg, valkey, logger)
+	}
+	authHandler.auditExports = store
+	auditLogger := NewAuditLogger(store.Queries, cfg.Audit)
+	auditLogger.batcher = auditBatcher
+	authHandler.auditLogger = auditLogger
+	if cfg.Auth.SessionCacheTTL > 0 {
+		if cache := newSessionCache(cfg, valkey, logger); cache != nil {
+			authHandler.dbSessions.UseCache(cache)
+		}
+	}
+	if cfg.Auth.SessionMode == config.SessionModeJWT {
+		if sessions := newStatelessSessions(cfg, valkey, authHandler.dbSessions, store.Querier(), logger); sessions != nil {
+			authHandler.sessions = sessions
+		}
 	}
-	authHandler := NewAuthHandler(store, cfg.Auth, cfg.Google, cfg.Email, cfg.RateLimit, limiter, mailer)
-	avatarHandler := NewAvatarHandler(store, blobClient, cfg.Storage)
+	avatarHandler := NewAvatarHandler(store, blobStore, cfg.Storage, cfg.Auth, cfg.Audit, logger)
+	avatarHandler.auditLogger = auditLogger
+	avatarHandler.sessions = authHandler.sessions
+
+	providers := []string{domain.AuthMethodPassword}
+	if authHandler.oauthConfig != nil {
+		providers = append(providers, domain.AuthMethodGoogle)
+	}
+	if authHandler.apple != nil {
+		providers = append(providers, domain.AuthMethodApple)
+	}
+	if authHandler.oidcProvider != nil {
+		providers = append(providers, domain.AuthMethodOIDC)
+	}
+	if recipeService != nil && cfg.Recipes.CacheEnabled {
+		authHandler.recipeCacheStats = recipeService.CacheStats
+	}
+	authHandler.capabilities = Capabilities{
+		Avatars:   blobStore != nil,
+		Recipes:   recipeService != nil,
+		Providers: providers,
+	}
+
+	// Each route group gets its own deadline; see RequestTimeoutConfig.
+	authRoutes := timeoutRoutes{mux, cfg.RequestTimeouts.Auth}
+	recipeRoutes := timeoutRoutes{mux, cfg.RequestTimeouts.Recipes}
+	defaultRoutes := timeoutRoutes{mux, cfg.RequestTimeouts.Default}
 
 	// API routes
-	mux.HandleFunc("GET /api/health", handleHealth)
-	mux.Handle("POST /api/recipes/generate", authHandler.RequireAuth(makeRecipeHandler(recipeService)))
+	defaultRoutes.HandleFunc("GET /api/health", handleHealth)
+	defaultRoutes.HandleFunc("GET /api/ready", makeReadinessHandler(readinessChecks(store, valkey, limiters), valkey, logger))
+	defaultRoutes.HandleFunc("GET /api/config", makeConfigHandler(authHandler.capabilities.FeatureFlags(), cfg.ConfigMaxAge))
+
+	// Recipe routes (a nil service means no AI backend is configured)
+	if recipeService != nil {
+		recipeRoutes.Handle("POST /api/recipes/generate", authHandler.RequireAuthOrAPIKey(authHandler.RequireScope(domain.ScopeRecipesGenerate, makeRecipeHandler(recipeService, cfg.Recipes.MaxResponseBytes))))
+		recipeRoutes.Handle("POST /api/recipes/generate/batch", authHandler.RequireAuthOrAPIKey(authHandler.RequireScope(domain.ScopeRecipesGenerate, makeRecipeBatchHandler(recipeService, cfg.Recipes.MaxResponseBytes))))
+		defaultRoutes.Handle("GET /api/recipes", authHandler.RequireAuthOrAPIKey(authHandler.RequireScope(domain.ScopeRecipesRead, makeRecipeListHandler(recipeService))))
+		defaultRoutes.Handle("GET /api/recipes/{id}", authHandler.RequireAuthOrAPIKey(authHandler.RequireScope(domain.ScopeRecipesRead, makeRecipeGetHandler(recipeService))))
+		mux.Handle("POST /api/recipes/generate/stream", authHandler.RequireAuthOrAPIKey(authHandler.RequireScope(domain.ScopeRecipesGenerate, makeRecipeStreamHandler(recipeService, cfg.Recipes.MaxResponseBytes, cfg.Recipes.StreamTimeout))))
+	} else {
+		defaultRoutes.HandleFunc("/api/recipes", handleFeatureDisabled)
+		defaultRoutes.HandleFunc("/api/recipes/", handleFeatureDisabled)
+	}
 
 	// Auth routes
-	mux.HandleFunc("POST /api/auth/register", authHandler.HandleRegister)
-	mux.HandleFunc("POST /api/auth/login", authHandler.HandleLogin)
-	mux.HandleFunc("GET /api/auth/google", authHandler.HandleGoogleLogin)
-	mux.HandleFunc("GET /api/auth/google/callback", authHandler.HandleGoogleCallback)
-	mux.HandleFunc("GET /api/auth/verify-email", authHandler.HandleVerifyEmail)
-	mux.Handle("GET /api/auth/me", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleMe)))
-	mux.Handle("GET /api/auth/avatar-url", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarURL)))
-	mux.Handle("POST /api/auth/avatar/upload-url", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarUploadURL)))
-	mux.Handle("POST /api/auth/avatar/confirm", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarConfirm)))
-	mux.Handle("POST /api/auth/logout", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleLogout)))
-	mux.Handle("POST /api/auth/password", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleChangePassword)))
-	mux.Handle("POST /api/auth/verify-email/resend", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleResendVerification)))
-
-	// Documentation routes (dev only)
+	authRoutes.HandleFunc("POST /api/auth/register", authHandler.HandleRegister)
+	authRoutes.HandleFunc("POST /api/auth/login", authHandler.HandleLogin)
+	authRoutes.HandleFunc("POST /api/auth/password/check", authHandler.HandlePasswordCheck)
+	authRoutes.HandleFunc("GET /api/auth/google", authHandler.HandleGoogleLogin)
+	authRoutes.HandleFunc("GET /api/auth/google/callback", authHandler.HandleGoogleCallback)
+	authRoutes.HandleFunc("GET /api/auth/apple", authHandler.HandleAppleLogin)
+	authRoutes.HandleFunc("POST /api/auth/apple/callback", authHandler.HandleAppleCallback)
+	authRoutes.HandleFunc("GET /api/auth/oidc", authHandler.HandleOIDCLogin)
+	authRoutes.HandleFunc("GET /api/auth/oidc/callback", authHandler.HandleOIDCCallback)
+	authRoutes.HandleFunc("GET /api/auth/verify-email", authHandler.HandleVerifyEmail)
+	authRoutes.Handle("GET /api/auth/me", authHandler.RequireAuthOrAPIKey(authHandler.RequireScope(domain.ScopeProfileRead, http.HandlerFunc(authHandler.HandleMe))))
+	defaultRoutes.Handle("GET /api/auth/avatar-url", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarURL)))
+	defaultRoutes.Handle("POST /api/auth/avatar/upload-url", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarUploadURL)))
+	defaultRoutes.Handle("POST /api/auth/avatar/upload-form", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarUploadForm)))
+	defaultRoutes.Handle("DELETE /api/auth/avatar", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarDelete)))
+	defaultRoutes.Handle("POST /api/auth/avatar/confirm", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarConfirm)))
+	defaultRoutes.Handle("POST /api/auth/avatar/multipart", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarMultipartCreate)))
+	defaultRoutes.Handle("POST /api/auth/avatar/multipart/part-url", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarMultipartPartURL)))
+	defaultRoutes.Handle("GET /api/auth/avatar/multipart/parts", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarMultipartParts)))
+	defaultRoutes.Handle("POST /api/auth/avatar/multipart/complete", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarMultipartComplete)))
+	defaultRoutes.Handle("POST /api/auth/avatar/multipart/abort", authHandler.RequireAuth(http.HandlerFunc(avatarHandler.HandleAvatarMultipartAbort)))
+	authRoutes.Handle("GET /api/auth/session", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleSession)))
+	authRoutes.Handle("POST /api/auth/logout", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleLogout)))
+	authRoutes.Handle("POST /api/auth/password", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleChangePassword)))
+	authRoutes.Handle("POST /api/auth/me/secure", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleSecureAccount)))
+	authRoutes.Handle("POST /api/auth/verify-email/resend", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleResendVerification)))
+	authRoutes.Handle("POST /api/auth/api-keys", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleAPIKeyCreate)))
+	authRoutes.Handle("GET /api/auth/api-keys", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleAPIKeyList)))
+	authRoutes.Handle("DELETE /api/auth/api-keys/{id}", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleAPIKeyRevoke)))
+
+	// Admin routes (session auth + AUTH_ADMIN_EMAILS)
+	defaultRoutes.Handle("GET /api/admin/users", authHandler.RequireAdmin(http.HandlerFunc(authHandler.HandleAdminListUsers)))
+	defaultRoutes.Handle("GET /api/admin/stats", authHandler.RequireAdmin(http.HandlerFunc(authHandler.HandleAdminStats)))
+	// Exports stream for as long as the range takes; a handler timeout would cut
+	// them off mid-file.
+	mux.Handle("GET /api/admin/audit/export", authHandler.RequireAdmin(http.HandlerFunc(authHandler.HandleAdminAuditExport)))
+	defaultRoutes.Handle("GET /api/admin/users/{id}/avatar", authHandler.RequireAdmin(http.HandlerFunc(avatarHandler.HandleAdminAvatarDownload)))
+	defaultRoutes.Handle("POST /api/admin/users/{id}/revoke-sessions", authHandler.RequireAdmin(http.HandlerFunc(authHandler.HandleAdminRevokeSessions)))
+	defaultRoutes.Handle("POST /api/admin/users/{id}/lock", authHandler.RequireAdmin(http.HandlerFunc(authHandler.HandleAdminLockAccount)))
+	defaultRoutes.Handle("POST /api/admin/users/{id}/unlock", authHandler.RequireAdmin(http.HandlerFunc(authHandler.HandleAdminUnlockAccount)))
+	if cfg.Auth.AdminDenyPolicy == config.DenyPolicyNotFound {
+		// Without this, unknown admin paths fall through to the SPA and wrong methods
+		// get a 405, both of which tell a probe the admin routes exist.
+		defaultRoutes.HandleFunc("/api/admin", handleAdminNotFound)
+		defaultRoutes.HandleFunc("/api/admin/", handleAdminNotFound)
+	}
+
+	// Local blob storage serves its own signed URLs and caps uploads itself
+	bodyLimits := map[string]int64{}
+	if localStore, ok := blobStore.(*blob.LocalStore); ok {
+		defaultRoutes.Handle("GET "+blob.LocalPathPrefix+"{key...}", localStore)
+		defaultRoutes.Handle("PUT "+blob.LocalPathPrefix+"{key...}", localStore)
+		bodyLimits["PUT "+blob.LocalPathPrefix+"{key...}"] = localStore.MaxObjectBytes()
+	}
+
+	// Documentation, email preview and verification shortcut routes (dev only)
 	if cfg.Env == "development" {
 		mux.HandleFunc("GET /api/openapi.json", handleOpenAPISpec)
 		mux.HandleFunc("GET /api/docs", handleScalarDocs)
 		mux.HandleFunc("GET /api/docs/scalar.js", handleScalarScript)
+		mux.HandleFunc("GET /api/dev/email-preview", handleEmailPreview)
+		authRoutes.Handle("POST /api/auth/dev/verify-email", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleDevVerifyEmail)))
+		authRoutes.Handle("POST /api/auth/dev/verify-email/token", authHandler.RequireAuth(http.HandlerFunc(authHandler.HandleDevVerificationToken)))
 	}
 
 	// Static files (SPA) - served last as catch-all
 	mux.Handle("/", staticHandler(cfg))
 
-	return mux
+	return WithMaxBodySize(cfg.MaxBodyBytes, bodyLimits, mux)
+}
+
+// pingValkey checks that Valkey is reachable with the configured credentials,
+// within valkeyPingTimeout.
+func pingValkey(valkey *redis.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), valkeyPingTimeout)
+	defer cancel()
+	return valkey.Ping(ctx).Err()
+}
+
+// newOAuthStateStore returns the Valkey state store, or nil to keep OAuth state in
+// cookies when Valkey does not answer at startup.
+func newOAuthStateStore(cfg *config.Config, valkey *redis.Client, logger *slog.Logger) OAuthStateStore {
+	if err := pingValkey(valkey); err != nil {
+		logger.Warn("valkey unreachable, keeping oauth state in cookies",
+			slog.String("addr", cfg.Valkey.Addr()), logging.Err(err))
+		return nil
+	}
+	return oauthstate.NewValkeyStore(valkey)
+}
+
+// newSessionCache returns the Valkey session cache, or nil when Valkey does not
+// answer at startup, in which case sessions are validated against Postgres only.
+func newSessionCache(cfg *config.Config, valkey *redis.Client, logger *slog.Logger) domain.SessionCache {
+	if err := pingValkey(valkey); err != nil {
+		logger.Warn("valkey unreachable, validating sessions against postgres only",
+			slog.String("addr", cfg.Valkey.Addr()), logging.Err(err))
+		return nil
+	}
+	return sessioncache.NewValkeyCache(valkey, cfg.Auth.SessionCacheTTL)
+}
+
+// newStatelessSessions returns the JWT session service, or nil when Valkey does
+// not answer: the denylist is the only record of a revocation, so sessions then
+// stay in Postgres.
+func newStatelessSessions(cfg *config.Config, valkey *redis.Client, sessions *domain.SessionService, queries db.Querier, logger *slog.Logger) domain.SessionManager {
+	if err := pingValkey(valkey); err != nil {
+		logger.Warn("valkey unreachable, keeping sessions in postgres instead of AUTH_SESSION_MODE=jwt",
+			slog.String("addr", cfg.Valkey.Addr()), logging.Err(err))
+		return nil
+	}
+	denylist := sessioncache.NewValkeyDenylist(valkey, cfg.Auth.SessionMaxAge)
+
+	signer := domain.NewHS256SessionSigner(cfg.Auth.JWTSecret, cfg.Auth.JWTSecretPrevious)
+	if cfg.Auth.JWTAlgorithm == config.JWTAlgorithmEdDSA {
+		// Validate has already parsed the key.
+		key, _ := cfg.Auth.ParseJWTPrivateKey()
+		signer = domain.NewEdDSASessionSigner(key)
+	}
+	return domain.NewStatelessSessionService(sessions, queries, signer, denylist, cfg.Auth.JWTTTL)
+}
+
+// readinessChecks lists the dependencies GET /api/ready pings: Postgres, and
+// Valkey while rate limiting depends on it, which is while the limiters are not
+// off or fell back to memory.
+func readinessChecks(store *storage.Store, valkey *redis.Client, limiters RateLimiters) []readinessCheck {
+	checks := []readinessCheck{{name: "postgres", ping: store.Pool().Ping}}
+	if _, ok := limiters[config.RateLimitSliding].(*ratelimit.ValkeyLimiter); ok {
+		checks = append(checks, readinessCheck{name: "valkey", ping: func(ctx context.Context) error {
+			return valkey.Ping(ctx).Err()
+		}})
+	}
+	return checks
+}
+
+// newRateLimiters returns the Valkey limiters after checking that Valkey answers, so
+// a bad address or password shows up at startup rather than as rejected requests.
+// When it does not answer, the in-memory limiter serves every algorithm if
+// RATE_LIMIT_MEMORY_FALLBACK is set; otherwise the Valkey limiters are kept and
+// recover once Valkey is back.
+func newRateLimiters(cfg *config.Config, valkey *redis.Client, logger *slog.Logger) RateLimiters {
+	limiter := ratelimit.NewValkeyLimiter(valkey)
+	limiters := RateLimiters{
+		config.RateLimitSliding:     limiter,
+		config.RateLimitFixed:       limiter.FixedWindow(),
+		config.RateLimitTokenBucket: limiter.TokenBucket(),
+	}
+
+	err := pingValkey(valkey)
+	if err == nil {
+		return limiters
+	}
+
+	if cfg.RateLimit.MemoryFallback {
+		logger.Warn("valkey unreachable, using in-memory rate limiter",
+			slog.String("addr", cfg.Valkey.Addr()), logging.Err(err))
+		// Rule keys are distinct, so one sliding window limiter can stand in for
+		// all algorithms.
+		memory := ratelimit.NewMemoryLimiter()
+		return RateLimiters{
+			config.RateLimitSliding:     memory,
+			config.RateLimitFixed:       memory,
+			config.RateLimitTokenBucket: memory,
+		}
+	}
+	logger.Warn("valkey unreachable, rate-limited requests will be rejected until it recovers",
+		slog.String("addr", cfg.Valkey.Addr()), logging.Err(err))
+	return limiters
+}
+
+// warmOIDCDiscovery fetches the issuer's discovery document at startup so a
+// misconfigured issuer shows up in the logs. A failure is not fatal; the first
+// login tries again.
+func warmOIDCDiscovery(provider *genericOIDC, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), oidcHTTPTimeout)
+	defer cancel()
+	if _, err := provider.discover(ctx); err != nil {
+		logger.Warn("oidc discovery failed, retrying at first login",
+			slog.String("issuer", provider.cfg.Issuer), logging.Err(err))
+	}
+}
+
+// timeoutRoutes registers handlers on mux behind WithTimeout(timeout).
+type timeoutRoutes struct {
+	mux     *http.ServeMux
+	timeout time.Duration
+}
+
+func (t timeoutRoutes) Handle(pattern string, handler http.Handler) {
+	t.mux.Handle(pattern, WithTimeout(t.timeout, handler))
+}
+
+func (t timeoutRoutes) HandleFunc(pattern string, handler http.HandlerFunc) {
+	t.Handle(pattern, handler)
 }
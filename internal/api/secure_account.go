@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/mounis-bhat/starter/internal/email"
+	"github.com/mounis-bhat/starter/internal/logging"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// secureReauthWindow is how recent a sign-in must be to count as
+// re-authentication for accounts without a password.
+const secureReauthWindow = 5 * time.Minute
+
+// SecureAccountRequest re-authenticates the caller before a security reset.
+// Accounts with a password must send both fields; accounts without one send
+// neither and must have signed in within the last five minutes.
+// @Description Security reset request
+type SecureAccountRequest struct {
+	CurrentPassword string `json:"current_password,omitempty" validate:"max=1000"`
+	NewPassword     string `json:"new_password,omitempty" validate:"max=1000"`
+}
+
+// SecureAccountResponse summarizes what a security reset revoked
+// @Description Security reset response
+type SecureAccountResponse struct {
+	Status          string `json:"status" example:"ok"`
+	PasswordChanged bool   `json:"password_changed" example:"true"`
+	APIKeysRevoked  int64  `json:"api_keys_revoked" example:"2"`
+}
+
+// HandleSecureAccount rotates every credential on the account
+// @Summary      Secure a compromised account
+// @Description  For "someone has my account": after re-authentication, replaces the password, signs out every session and revokes every API key in one transaction, then starts a fresh session for this device and emails the user. Accounts without a password re-authenticate by signing in again within the last five minutes.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body SecureAccountRequest true "Security reset request"
+// @Success      200  {object}  SecureAccountResponse
+// @Failure      400  {object}  APIError
+// @Failure      401  {object}  APIError
+// @Failure      422  {object}  APIError
+// @Failure      429  {object}  APIError
+// @Failure      500  {object}  APIError
+// @Router       /auth/me/secure [post]
+func (h *AuthHandler) HandleSecureAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := ctxkeys.User(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+	session, ok := ctxkeys.Session(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	if !h.allowRequest(r.Context(), "password:"+user.ID, r, h.rateLimits.Password) {
+		writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+		return
+	}
+
+	req, ok := decodeAndValidate[SecureAccountRequest](w, r)
+	if !ok {
+		return
+	}
+
+	stored, err := h.queries.GetUserByID(r.Context(), uuidFromString(user.ID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	userAgent := r.UserAgent()
+	ipAddress := h.ipFromRequest(r)
+	hasPassword := stored.PasswordHash.Valid && stored.PasswordHash.String != ""
+
+	var newHash string
+	if hasPassword {
+		if req.NewPassword == "" {
+			writeErrorDetails(w, http.StatusUnprocessableEntity, CodeValidationFailed, "validation failed", map[string]any{
+				"fields": map[string]string{"new_password": "is required"},
+			})
+			return
+		}
+		valid, err := domain.VerifyPassword(req.CurrentPassword, stored.PasswordHash.String)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+			return
+		}
+		if !valid {
+			h.auditLogger.Log(r.Context(), "security_reset_failure", stored.ID, ipAddress, userAgent, map[string]any{
+				"reason": "invalid_current_password",
+			})
+			writeError(w, http.StatusBadRequest, CodeInvalidCredentials, "invalid credentials")
+			return
+		}
+		if err := h.passwordPolicy.Validate(req.NewPassword, stored.Email, stored.Name); err != nil {
+			writePasswordError(w, err)
+			return
+		}
+		reused, err := h.passwordReused(r.Context(), stored, req.NewPassword)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+			return
+		}
+		if reused {
+			h.auditLogger.Log(r.Context(), "password_reuse_rejected", stored.ID, ipAddress, userAgent, map[string]any{
+				"flow": "security_reset",
+			})
+			writePasswordReused(w, h.passwordHistory)
+			return
+		}
+		if newHash, err = domain.HashPassword(req.NewPassword); err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+			return
+		}
+	} else if time.Since(session.CreatedAt) > secureReauthWindow {
+		h.auditLogger.Log(r.Context(), "security_reset_failure", stored.ID, ipAddress, userAgent, map[string]any{
+			"reason": "stale_session",
+		})
+		writeError(w, http.StatusUnauthorized, CodeReauthRequired, "sign in again to continue")
+		return
+	}
+
+	var keysRevoked int64
+	err = h.store.WithTx(r.Context(), func(q db.Querier) error {
+		if hasPassword {
+			if err := q.UpdateUserPassword(r.Context(), db.UpdateUserPasswordParams{
+				ID:           stored.ID,
+				PasswordHash: pgtype.Text{String: newHash, Valid: true},
+			}); err != nil {
+				return err
+			}
+			if err := h.recordPasswordHistory(r.Context(), q, stored); err != nil {
+				return err
+			}
+		}
+		if _, err := q.DeleteUserSessions(r.Context(), stored.ID); err != nil {
+			return err
+		}
+		var err error
+		keysRevoked, err = q.RevokeUserAPIKeys(r.Context(), stored.ID)
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	// The rows are already gone; this evicts them from the cache and denies
+	// stateless sessions, which live outside Postgres.
+	if _, err := h.sessions.RevokeUserSessions(r.Context(), stored.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+
+	h.auditLogger.Log(r.Context(), "security_reset", stored.ID, ipAddress, userAgent, map[string]any{
+		"password_changed": hasPassword,
+		"api_keys_revoked": keysRevoked,
+	})
+
+	// The caller just proved who they are, so this device keeps a session on the
+	// same terms as before; every other session is gone.
+	lifetime := domain.SessionLifetime{MaxAge: time.Until(session.ExpiresAt), Persistent: session.Persistent}
+	token, _, err := h.sessions.CreateSession(r.Context(), stored.ID, ipAddress, userAgent, lifetime)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+		return
+	}
+	h.cookies.SetSessionCookie(w, token, lifetime.Persistent)
+
+	h.sendSecurityResetEmail(r.Context(), stored, hasPassword, keysRevoked, ipAddress, userAgent)
+	writeJSON(w, http.StatusOK, SecureAccountResponse{
+		Status:          "ok",
+		PasswordChanged: hasPassword,
+		APIKeysRevoked:  keysRevoked,
+	})
+}
+
+func (h *AuthHandler) sendSecurityResetEmail(ctx context.Context, user db.User, passwordChanged bool, keysRevoked int64, ip *netip.Addr, userAgent string) {
+	if h.mailer == nil {
+		return
+	}
+
+	ipValue := "unknown"
+	if ip != nil {
+		ipValue = ip.String()
+	}
+
+	name := strings.TrimSpace(user.Name)
+	if name == "" {
+		name = user.Email
+	}
+
+	subject, params := securityResetEmail(name, passwordChanged, keysRevoked, ipValue)
+	textBody := email.RenderText(params)
+	htmlBody := email.RenderHTML(params)
+
+	if err := h.mailer.Send(ctx, user.Email, subject, textBody, htmlBody); err != nil {
+		h.logger.Error("email send failed", slog.String("type", "security_reset"), logging.Err(err))
+		h.auditLogger.Log(ctx, "email_send_failed", user.ID, ip, userAgent, map[string]any{
+			"type":  "security_reset",
+			"error": err.Error(),
+		})
+	}
+}
+
+func securityResetEmail(name string, passwordChanged bool, keysRevoked int64, ipValue string) (string, email.EmailParams) {
+	lines := []string{"Your account was secured at your request. Every other device has been signed out."}
+	if passwordChanged {
+		lines = append(lines, "Your password was changed.")
+	}
+	lines = append(lines,
+		fmt.Sprintf("API keys revoked: %d", keysRevoked),
+		fmt.Sprintf("IP address: %s", ipValue),
+	)
+	return "Your account was secured", email.EmailParams{
+		Greeting:   fmt.Sprintf("Hi %s,", name),
+		BodyLines:  lines,
+		FooterText: "If you did not do this, contact support immediately.",
+	}
+}
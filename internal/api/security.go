@@ -2,20 +2,154 @@ package api
 
 import (
 	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
 )
 
+// cspNoncePlaceholder marks where a rendered policy takes the request's nonce.
+const cspNoncePlaceholder = "{nonce}"
+
+// cspDirective is one directive of the default Content-Security-Policy.
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// defaultCSP is the strict policy: everything from the app's own origin, no
+// plugins and no framing. img-src also allows data: and any https image, so
+// avatars load from the storage host.
+var defaultCSP = []cspDirective{
+	{"default-src", []string{"'self'"}},
+	{"base-uri", []string{"'self'"}},
+	{"frame-ancestors", []string{"'none'"}},
+	{"object-src", []string{"'none'"}},
+	{"form-action", []string{"'self'"}},
+	{"img-src", []string{"'self'", "data:", "https:"}},
+	{"style-src", []string{"'self'"}},
+	{"script-src", []string{"'self'"}},
+	{"connect-src", []string{"'self'"}},
+	{"font-src", []string{"'self'", "data:"}},
+	{"media-src", []string{"'self'"}},
+	{"manifest-src", []string{"'self'"}},
+	{"worker-src", []string{"'self'"}},
+	{"frame-src", []string{"'none'"}},
+}
+
+// WithSecurityHeaders sets the security headers from cfg.Headers on every
+// response. The values are fixed at startup, except for the CSP nonce: each
+// request gets a fresh one in script-src and style-src, and in its context for
+// handlers that render HTML (see injectCSPNonce).
 func WithSecurityHeaders(cfg *config.Config, next http.Handler) http.Handler {
+	headers := cfg.Headers
+	cspHeader := "Content-Security-Policy"
+	if headers.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	csp := contentSecurityPolicy(headers)
+	var hsts string
+	if headers.HSTS {
+		hsts = "max-age=" + strconv.FormatInt(int64(headers.HSTSMaxAge.Seconds()), 10)
+		if headers.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; base-uri 'self'; frame-ancestors 'none'; object-src 'none'; form-action 'self'; img-src 'self' data: https:; style-src 'self'; script-src 'self'; connect-src 'self'; font-src 'self' data:; media-src 'self'; manifest-src 'self'; worker-src 'self'; frame-src 'none'")
+		policy, nonce := fillCSPNonce(csp)
+		if nonce != "" {
+			r = r.WithContext(ctxkeys.WithCSPNonce(r.Context(), nonce))
+		}
+		w.Header().Set("X-Frame-Options", headers.FrameOptions)
+		w.Header().Set(cspHeader, policy)
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
-		if cfg.Env == "production" {
-			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		w.Header().Set("Referrer-Policy", headers.ReferrerPolicy)
+		w.Header().Set("Permissions-Policy", headers.PermissionsPolicy)
+		if hsts != "" {
+			w.Header().Set("Strict-Transport-Security", hsts)
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// contentSecurityPolicy returns headers.CSP when set, otherwise defaultCSP with
+// the configured sources added. Adding a source to a 'none' directive replaces
+// the 'none'. script-src and style-src also get a nonce placeholder, unless
+// 'unsafe-inline' was added to them: browsers ignore 'unsafe-inline' next to a
+// nonce.
+func contentSecurityPolicy(headers config.HeadersConfig) string {
+	if headers.CSP != "" {
+		return headers.CSP
+	}
+	extra := map[string][]string{
+		"script-src":  headers.CSPScriptSources,
+		"style-src":   headers.CSPStyleSources,
+		"connect-src": headers.CSPConnectSources,
+		"img-src":     headers.CSPImgSources,
+		"font-src":    headers.CSPFontSources,
+		"frame-src":   headers.CSPFrameSources,
+	}
+	if headers.FrameOptions == "SAMEORIGIN" {
+		extra["frame-ancestors"] = []string{"'self'"}
+	}
+
+	directives := make([]string, 0, len(defaultCSP))
+	for _, directive := range defaultCSP {
+		sources := directive.sources
+		if added := extra[directive.name]; len(added) > 0 {
+			if len(sources) == 1 && sources[0] == "'none'" {
+				sources = nil
+			}
+			sources = append(append([]string(nil), sources...), added...)
+		}
+		if (directive.name == "script-src" || directive.name == "style-src") && !slices.Contains(sources, "'unsafe-inline'") {
+			sources = append(slices.Clone(sources), "'nonce-"+cspNoncePlaceholder+"'")
+		}
+		directives = append(directives, directive.name+" "+strings.Join(sources, " "))
+	}
+	return strings.Join(directives, "; ")
+}
+
+// fillCSPNonce replaces the nonce placeholder in policy with a fresh nonce and
+// returns both. A policy without the placeholder, such as a SECURITY_CSP
+// override, is returned as is with an empty nonce.
+func fillCSPNonce(policy string) (string, string) {
+	if !strings.Contains(policy, cspNoncePlaceholder) {
+		return policy, ""
+	}
+	nonce, err := generateRandomToken(16)
+	if err != nil {
+		return strings.ReplaceAll(policy, " 'nonce-"+cspNoncePlaceholder+"'", ""), ""
+	}
+	return strings.ReplaceAll(policy, cspNoncePlaceholder, nonce), nonce
+}
+
+var inlineTagPattern = regexp.MustCompile(`(?i)<(script|style)(\s|>)`)
+
+// injectCSPNonce adds the request's nonce to every <script> and <style> tag in
+// page, so the strict policy allows the page's own inline code and nothing an
+// attacker could inject later. Without a nonce page is returned unchanged.
+func injectCSPNonce(r *http.Request, page []byte) []byte {
+	nonce := ctxkeys.CSPNonce(r.Context())
+	if nonce == "" {
+		return page
+	}
+	return inlineTagPattern.ReplaceAll(page, []byte(`<$1 nonce="`+nonce+`"$2`))
+}
+
+// setPageCSP replaces the response's policy with policy, for a page that needs
+// more than the default allows. A nonce placeholder in policy takes the
+// request's nonce, or is dropped when the request has none.
+func setPageCSP(w http.ResponseWriter, r *http.Request, policy string) {
+	if nonce := ctxkeys.CSPNonce(r.Context()); nonce != "" {
+		policy = strings.ReplaceAll(policy, cspNoncePlaceholder, nonce)
+	} else {
+		policy = strings.ReplaceAll(policy, " 'nonce-"+cspNoncePlaceholder+"'", "")
+	}
+	w.Header().Del("Content-Security-Policy-Report-Only")
+	w.Header().Set("Content-Security-Policy", policy)
+}
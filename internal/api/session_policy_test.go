@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mounis-bhat/starter/internal/config"
+)
+
+// TestExistingSessionPolicy signs in while the browser already holds a session
+// and checks whether that session survives, for each flow's default and for
+// AUTH_EXISTING_SESSION set either way.
+func TestExistingSessionPolicy(t *testing.T) {
+	flows := []struct {
+		name string
+		// signIn signs in while sending existing and returns the response.
+		signIn      func(t *testing.T, h *AuthHandler, queries *fakeQuerier, existing *http.Cookie) *httptest.ResponseRecorder
+		flowDefault string
+	}{
+		{"login", func(t *testing.T, h *AuthHandler, _ *fakeQuerier, existing *http.Cookie) *httptest.ResponseRecorder {
+			return serve(t, testAuthRoutes(h), http.MethodPost, "/api/auth/login",
+				LoginRequest{Email: "first@example.com", Password: testPassword}, existing)
+		}, config.ExistingSessionAdd},
+		{"register", func(t *testing.T, h *AuthHandler, _ *fakeQuerier, existing *http.Cookie) *httptest.ResponseRecorder {
+			return serve(t, testAuthRoutes(h), http.MethodPost, "/api/auth/register",
+				RegisterRequest{Email: "second@example.com", Password: testPassword, Name: "Second User"}, existing)
+		}, config.ExistingSessionRotate},
+		{"oauth", func(t *testing.T, h *AuthHandler, queries *fakeQuerier, existing *http.Cookie) *httptest.ResponseRecorder {
+			user, err := queries.GetUserByEmail(t.Context(), "first@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/google/callback", nil)
+			req.AddCookie(existing)
+			rec := httptest.NewRecorder()
+			h.finishOAuthLogin(rec, req, user, "google", "", nil)
+			return rec
+		}, config.ExistingSessionRotate},
+	}
+
+	for _, flow := range flows {
+		for _, policy := range []string{"", config.ExistingSessionRotate, config.ExistingSessionAdd} {
+			want := policy
+			if want == "" {
+				want = flow.flowDefault
+			}
+			name := flow.name + "/" + policy
+			if policy == "" {
+				name = flow.name + "/default"
+			}
+			t.Run(name, func(t *testing.T) {
+				cfg := testAuthConfig()
+				cfg.ExistingSession = policy
+				h, queries, audit := newTestAuthHandler(t, cfg)
+				existing := sessionCookie(t, register(t, testAuthRoutes(h), "first@example.com"), cfg.CookieName)
+
+				rec := flow.signIn(t, h, queries, existing)
+				if rec.Code != http.StatusOK && rec.Code != http.StatusFound {
+					t.Fatalf("%s: status %d, body %s", flow.name, rec.Code, rec.Body)
+				}
+				wantSessions := 1
+				if want == config.ExistingSessionAdd {
+					wantSessions = 2
+				}
+				if len(queries.sessions) != wantSessions {
+					t.Errorf("%d sessions under %s, want %d", len(queries.sessions), want, wantSessions)
+				}
+
+				me := serve(t, testAuthRoutes(h), http.MethodGet, "/api/auth/me", nil, existing)
+				if kept := me.Code == http.StatusOK; kept != (want == config.ExistingSessionAdd) {
+					t.Errorf("existing session still valid = %v under %s", kept, want)
+				}
+				revoked := audit.find("session_revoked")
+				if want == config.ExistingSessionRotate {
+					if len(revoked) != 1 || revoked[0].metadata["reason"] != "rotation" {
+						t.Errorf("session_revoked events = %+v, want one with reason rotation", revoked)
+					}
+				} else if len(revoked) != 0 {
+					t.Errorf("session_revoked events = %+v, want none", revoked)
+				}
+			})
+		}
+	}
+}
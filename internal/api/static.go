@@ -1,11 +1,29 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"io/fs"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/mounis-bhat/starter/assets"
 	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+)
+
+// immutableAssetPrefix is where SvelteKit puts build output whose file names
+// carry a content hash. A changed file gets a new name, so these are cached
+// for a year without revalidation.
+const immutableAssetPrefix = "_app/immutable/"
+
+const (
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	// Everything else, index.html included, is revalidated on every use so a
+	// deploy is picked up at the next load.
+	revalidateCacheControl = "no-cache"
 )
 
 func staticHandler(cfg *config.Config) http.Handler {
@@ -28,6 +46,12 @@ func staticHandler(cfg *config.Config) http.Handler {
 		panic(err)
 	}
 
+	etags, err := staticETags(staticFS)
+	if err != nil {
+		panic(err)
+	}
+	indexETag := contentETag(indexHTML)
+
 	fileServer := http.FileServer(http.FS(staticFS))
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -38,13 +62,105 @@ func staticHandler(cfg *config.Config) http.Handler {
 			// Check if file exists
 			if f, err := staticFS.Open(path[1:]); err == nil {
 				f.Close()
+				// FileServer answers If-None-Match from the ETag set here.
+				if etag, ok := etags[path[1:]]; ok {
+					w.Header().Set("ETag", etag)
+				}
+				if strings.HasPrefix(path[1:], immutableAssetPrefix) {
+					w.Header().Set("Cache-Control", immutableCacheControl)
+				} else {
+					w.Header().Set("Cache-Control", revalidateCacheControl)
+				}
+				if servePrecompressed(w, r, staticFS, etags, path[1:]) {
+					return
+				}
 				fileServer.ServeHTTP(w, r)
 				return
 			}
 		}
 
-		// SPA fallback: serve index.html for all other routes
+		// SPA fallback: serve index.html for all other routes, with the request's
+		// CSP nonce on its inline bootstrap script. A page carrying a nonce gets no
+		// ETag: a 304 would pair the cached page's old nonce with the new policy.
+		w.Header().Set("Cache-Control", revalidateCacheControl)
+		page := injectCSPNonce(r, indexHTML)
+		if ctxkeys.CSPNonce(r.Context()) == "" {
+			w.Header().Set("ETag", indexETag)
+			if etagMatches(r.Header.Get("If-None-Match"), indexETag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write(indexHTML)
+		w.Write(page)
 	})
 }
+
+// precompressedVariants are the encodings a build may ship next to a file, as
+// name+suffix, in order of preference.
+var precompressedVariants = []struct {
+	coding string
+	suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// servePrecompressed serves a .br or .gz variant of name built alongside it,
+// when one exists and the client accepts its encoding. The Content-Type still
+// comes from name. It reports whether it wrote the response.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, fsys fs.FS, etags map[string]string, name string) bool {
+	hasVariant := false
+	for _, variant := range precompressedVariants {
+		etag, ok := etags[name+variant.suffix]
+		if !ok {
+			continue
+		}
+		hasVariant = true
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), variant.coding) {
+			continue
+		}
+		f, err := fsys.Open(name + variant.suffix)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			continue
+		}
+		addVary(w.Header(), "Accept-Encoding")
+		w.Header().Set("Content-Encoding", variant.coding)
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, name, time.Time{}, content)
+		return true
+	}
+	if hasVariant {
+		addVary(w.Header(), "Accept-Encoding")
+	}
+	return false
+}
+
+// staticETags hashes every embedded file once at startup, keyed by its path
+// in fsys.
+func staticETags(fsys fs.FS) (map[string]string, error) {
+	etags := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		etags[path] = contentETag(data)
+		return nil
+	})
+	return etags, err
+}
+
+// contentETag is a strong ETag over data: the first 12 bytes of its SHA-256.
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithTimeout gives next a context that expires after d and answers 504 if next
+// has not started its response by then. Handlers see the cancellation through
+// r.Context(); anything they write after the 504 is discarded. A response that
+// has already started is left to finish, since its status is on the wire. A
+// zero or negative d returns next unchanged.
+func WithTimeout(d time.Duration, next http.Handler) http.Handler {
+	if d <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{w: w, header: w.Header().Clone()}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case p := <-panicked:
+			// Re-panic on the server's goroutine so net/http logs and recovers it.
+			panic(p)
+		case <-ctx.Done():
+			tw.mu.Lock()
+			if tw.wroteHeader {
+				tw.mu.Unlock()
+				select {
+				case <-done:
+				case p := <-panicked:
+					panic(p)
+				}
+				return
+			}
+			tw.timedOut = true
+			tw.mu.Unlock()
+			writeError(w, http.StatusGatewayTimeout, CodeUpstreamTimeout, "request timed out")
+		}
+	})
+}
+
+// timeoutWriter keeps the handler's headers apart from the real response and
+// drops its writes once WithTimeout has answered.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (t *timeoutWriter) Header() http.Header {
+	return t.header
+}
+
+func (t *timeoutWriter) WriteHeader(status int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writeHeaderLocked(status)
+}
+
+func (t *timeoutWriter) writeHeaderLocked(status int) {
+	if t.timedOut || t.wroteHeader {
+		return
+	}
+	t.wroteHeader = true
+	dst := t.w.Header()
+	clear(dst)
+	maps.Copy(dst, t.header)
+	t.w.WriteHeader(status)
+}
+
+func (t *timeoutWriter) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	t.writeHeaderLocked(http.StatusOK)
+	return t.w.Write(b)
+}
+
+func (t *timeoutWriter) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut {
+		return
+	}
+	if flusher, ok := t.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
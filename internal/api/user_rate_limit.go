@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+)
+
+// userRateLimitExempt lists the routes a user must reach even with the budget
+// spent, for example when a stolen session spent it; each has its own limit.
+var userRateLimitExempt = []string{
+	"/api/auth/logout",
+	"/api/auth/me/secure",
+}
+
+// limitUser spends one unit of the user's RATE_LIMIT_USER_* budget, shared by
+// every route, and refuses the request with 429 once it is gone. It runs before
+// the handler, so a refused request does not also count against the route's own
+// limit. RequireAuth and the session path of RequireAuthOrAPIKey apply it once
+// per request; API keys and admin routes keep their own budgets.
+func (h *AuthHandler) limitUser(next http.Handler) http.Handler {
+	rule := h.rateLimits.User
+	if !h.rateLimits.Enabled || rule.Limit <= 0 || rule.Window <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ctxkeys.User(r.Context())
+		if ok && !slices.Contains(userRateLimitExempt, r.URL.Path) && !h.allow(r.Context(), "user:"+user.ID, rule) {
+			// The window is an upper bound on the wait: how much of the budget
+			// comes back sooner depends on the algorithm.
+			seconds := int(rule.Window.Seconds())
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit, seconds))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
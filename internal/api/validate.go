@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+)
+
+// requestValidator enforces the `validate` struct tags on request types. Field
+// errors are reported under the field's JSON name.
+var requestValidator = newRequestValidator()
+
+func newRequestValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	if err := v.RegisterValidation("notblank", validators.NotBlank); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// decodeAndValidate decodes a single JSON object into T, rejecting unknown fields
+// and trailing data, then validates it against its `validate` tags. On failure it
+// writes a 400 for malformed JSON, a 413 for a body over WithMaxBodySize's limit
+// or a 422 whose details.fields holds per-field messages, and returns false.
+func decodeAndValidate[T any](w http.ResponseWriter, r *http.Request) (T, bool) {
+	var req T
+	if err := decodeStrictJSON(r.Body, &req); err != nil {
+		writeBodyError(w, err)
+		return req, false
+	}
+
+	if err := requestValidator.Struct(req); err != nil {
+		var fieldErrs validator.ValidationErrors
+		if !errors.As(err, &fieldErrs) {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+			return req, false
+		}
+		writeErrorDetails(w, http.StatusUnprocessableEntity, CodeValidationFailed, "validation failed", map[string]any{
+			"fields": validationMessages(fieldErrs),
+		})
+		return req, false
+	}
+	return req, true
+}
+
+// validationMessages turns validator errors into a field -> message map. Nested
+// fields use their dotted JSON path without the top-level struct name.
+func validationMessages(errs validator.ValidationErrors) map[string]string {
+	fields := make(map[string]string, len(errs))
+	for _, fieldErr := range errs {
+		name := fieldErr.Namespace()
+		if _, rest, ok := strings.Cut(name, "."); ok {
+			name = rest
+		}
+		if _, exists := fields[name]; !exists {
+			fields[name] = validationMessage(fieldErr)
+		}
+	}
+	return fields
+}
+
+func validationMessage(fieldErr validator.FieldError) string {
+	isString := fieldErr.Kind() == reflect.String
+	switch fieldErr.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+		}
+		if fieldErr.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at most %s items", fieldErr.Param())
+		}
+		return "must be at most " + fieldErr.Param()
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+		}
+		if fieldErr.Kind() == reflect.Slice {
+			if fieldErr.Param() == "1" {
+				return "must not be empty"
+			}
+			return fmt.Sprintf("must have at least %s items", fieldErr.Param())
+		}
+		return "must be at least " + fieldErr.Param()
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+	default:
+		return "is invalid"
+	}
+}
+
+// decodeStrictJSON decodes a single JSON object, rejecting unknown fields and trailing data.
+func decodeStrictJSON(body io.Reader, dst any) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("unexpected trailing data")
+	}
+	return nil
+}
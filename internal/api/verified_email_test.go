@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mounis-bhat/starter/internal/ctxkeys"
+	"github.com/mounis-bhat/starter/internal/domain"
+)
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	cfg := testAuthConfig()
+	cfg.VerifiedEmailPaths = []string{"/api/recipes", "/api/auth"}
+
+	tests := []struct {
+		name       string
+		path       string
+		verified   bool
+		provider   string
+		wantStatus int
+	}{
+		{"unverified on a gated path", "/api/recipes/generate", false, "credentials", http.StatusForbidden},
+		{"verified on a gated path", "/api/recipes/generate", true, "credentials", http.StatusOK},
+		{"unverified on the prefix itself", "/api/recipes", false, "credentials", http.StatusForbidden},
+		{"unverified on another path", "/api/avatar", false, "credentials", http.StatusOK},
+		{"unverified on a lookalike path", "/api/recipesx", false, "credentials", http.StatusOK},
+		// A gated prefix never shuts the user out of getting verified.
+		{"unverified on an exempt route", "/api/auth/verify-email/resend", false, "credentials", http.StatusOK},
+		{"unverified on another route under the prefix", "/api/auth/password", false, "credentials", http.StatusForbidden},
+		// Providers may let unverified emails in under *_REQUIRE_VERIFIED_EMAIL=false.
+		{"unverified google user", "/api/recipes/generate", false, "google", http.StatusForbidden},
+		{"verified google user", "/api/recipes/generate", true, "google", http.StatusOK},
+		{"unverified oidc user", "/api/auth/avatar/upload-url", false, "oidc", http.StatusForbidden},
+		{"verified oidc user", "/api/auth/avatar/upload-url", true, "oidc", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, audit := newTestAuthHandler(t, cfg)
+			handler := h.RequireVerifiedEmail(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			req = req.WithContext(ctxkeys.WithUser(req.Context(), domain.SessionUser{
+				ID:            uuid.NewString(),
+				Email:         "user@example.com",
+				EmailVerified: tt.verified,
+				Provider:      tt.provider,
+			}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			refused := audit.find("email_verification_required")
+			if tt.wantStatus == http.StatusForbidden {
+				if len(refused) != 1 || refused[0].metadata["path"] != tt.path {
+					t.Errorf("email_verification_required events = %+v, want one for %s", refused, tt.path)
+				}
+			} else if len(refused) != 0 {
+				t.Errorf("a request that passed was audited as refused")
+			}
+		})
+	}
+}
+
+func TestRequireVerifiedEmailWithoutPaths(t *testing.T) {
+	h, _, _ := newTestAuthHandler(t, testAuthConfig())
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	// With AUTH_VERIFIED_EMAIL_PATHS unset no path is gated.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/recipes", nil)
+	req = req.WithContext(ctxkeys.WithUser(req.Context(), domain.SessionUser{ID: uuid.NewString(), Provider: "credentials"}))
+	h.RequireVerifiedEmail(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want 200 with no gated paths", rec.Code)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/webhook"
+)
+
+// maxWebhookBodyBytes caps payloads read by RequireWebhookSignature, which may
+// be mounted outside NewRouter's WithMaxBodySize.
+const maxWebhookBodyBytes = 1 << 20
+
+// RequireWebhookSignature guards an inbound webhook route. It reads the body (up
+// to maxWebhookBodyBytes), verifies it with webhook.Verify against secret and
+// answers 401 for unsigned, badly signed or stale payloads. The body is restored
+// for next. A zero tolerance uses webhook.DefaultTolerance.
+func RequireWebhookSignature(secret string, tolerance time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+
+		if err := webhook.Verify([]byte(secret), r.Header, body, tolerance, time.Now()); err != nil {
+			message := "invalid signature"
+			switch {
+			case errors.Is(err, webhook.ErrMissingSignature):
+				message = "missing signature"
+			case errors.Is(err, webhook.ErrStaleTimestamp):
+				message = "stale signature"
+			}
+			writeError(w, http.StatusUnauthorized, CodeInvalidSignature, message)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
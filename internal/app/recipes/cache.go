@@ -0,0 +1,77 @@
+package recipes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const cacheKeyPrefix = "recipe:v1:"
+
+// Option configures a Service.
+type Option func(*Service)
+
+// WithCache serves repeated requests from cache for ttl instead of calling the
+// generator. A nil cache or non-positive ttl disables caching.
+func WithCache(cache Cache, ttl time.Duration) Option {
+	return func(s *Service) {
+		if cache == nil || ttl <= 0 {
+			s.cache = nil
+			return
+		}
+		s.cache = cache
+		s.cacheTTL = ttl
+	}
+}
+
+// CacheStats counts cache lookups since the service started.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+type cacheCounters struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheStats reports cache hits and misses. Both stay zero when caching is disabled.
+func (s *Service) CacheStats() CacheStats {
+	return CacheStats{Hits: s.counters.hits.Load(), Misses: s.counters.misses.Load()}
+}
+
+// cached returns a cached recipe for req. Cache failures count as misses so an
+// unavailable cache never blocks generation.
+func (s *Service) cached(ctx context.Context, req RecipeRequest) (*Recipe, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+	recipe, ok, err := s.cache.Get(ctx, cacheKey(req))
+	if err != nil || !ok || recipe == nil {
+		s.counters.misses.Add(1)
+		return nil, false
+	}
+	s.counters.hits.Add(1)
+	return recipe, true
+}
+
+func (s *Service) storeCached(ctx context.Context, req RecipeRequest, recipe *Recipe) {
+	if s.cache == nil {
+		return
+	}
+	_ = s.cache.Set(ctx, cacheKey(req), recipe, s.cacheTTL)
+}
+
+// cacheKey hashes the request after lowercasing, trimming and collapsing whitespace,
+// so "Chicken" and " chicken " share an entry.
+func cacheKey(req RecipeRequest) string {
+	sum := sha256.Sum256([]byte(normalize(req.Ingredient) + "\x00" + normalize(req.DietaryRestrictions)))
+	return cacheKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+func normalize(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), " ")
+}
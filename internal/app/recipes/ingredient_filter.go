@@ -0,0 +1,114 @@
+package recipes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Ingredient filter modes.
+const (
+	IngredientFilterOff       = "off"
+	IngredientFilterAllowlist = "allowlist"
+	IngredientFilterDenylist  = "denylist"
+)
+
+// ErrInvalidIngredient is returned for ingredients the configured filter rejects.
+var ErrInvalidIngredient = errors.New("ingredient is not allowed")
+
+// IngredientFilter keeps requests on topic before any generation is spent. In
+// allowlist mode the ingredient must mention a listed term; in denylist mode it
+// must mention none. Terms match whole words, case-insensitively, and a
+// trailing "s" or "es" on the ingredient is ignored, so "tomato" matches
+// "Roasted Tomatoes".
+type IngredientFilter struct {
+	mode  string
+	terms [][]string
+}
+
+// NewIngredientFilter builds a filter for mode. An empty mode is off. Allowlist
+// and denylist modes need at least one term.
+func NewIngredientFilter(mode string, terms []string) (IngredientFilter, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", IngredientFilterOff:
+		return IngredientFilter{}, nil
+	case IngredientFilterAllowlist, IngredientFilterDenylist:
+	default:
+		return IngredientFilter{}, fmt.Errorf("unknown ingredient filter %q", mode)
+	}
+
+	filter := IngredientFilter{mode: mode}
+	for _, term := range terms {
+		if words := ingredientWords(term); len(words) > 0 {
+			filter.terms = append(filter.terms, words)
+		}
+	}
+	if len(filter.terms) == 0 {
+		return IngredientFilter{}, fmt.Errorf("ingredient %s has no terms", mode)
+	}
+	return filter, nil
+}
+
+// WithIngredientFilter makes ValidateRequest reject ingredients filter does not
+// allow with ErrInvalidIngredient, before the cache or the generator is consulted.
+func WithIngredientFilter(filter IngredientFilter) Option {
+	return func(s *Service) {
+		s.filter = filter
+	}
+}
+
+// ParseIngredientTerms reads one term per line, skipping blank lines and lines
+// starting with #.
+func ParseIngredientTerms(data []byte) []string {
+	var terms []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, line)
+	}
+	return terms
+}
+
+// Allows reports whether ingredient passes the filter. A zero filter allows everything.
+func (f IngredientFilter) Allows(ingredient string) bool {
+	switch f.mode {
+	case IngredientFilterAllowlist:
+		return f.mentions(ingredient)
+	case IngredientFilterDenylist:
+		return !f.mentions(ingredient)
+	default:
+		return true
+	}
+}
+
+func (f IngredientFilter) mentions(ingredient string) bool {
+	words := ingredientWords(ingredient)
+	for _, term := range f.terms {
+		for start := 0; start+len(term) <= len(words); start++ {
+			if wordsMatch(words[start:start+len(term)], term) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func wordsMatch(words, term []string) bool {
+	for i, word := range words {
+		if word != term[i] && word != term[i]+"s" && word != term[i]+"es" {
+			return false
+		}
+	}
+	return true
+}
+
+// ingredientWords lowercases value and splits it into letter and digit runs.
+func ingredientWords(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
@@ -0,0 +1,92 @@
+package recipes
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PartialRecipe is what could be recovered from a recipe's JSON encoding that was
+// cut off mid-stream.
+type PartialRecipe struct {
+	// Fields holds each value decoded so far, keyed by its Recipe JSON name. An
+	// array that was cut off keeps the elements that were complete.
+	Fields map[string]json.RawMessage
+	// Complete lists the fields whose values were received in full.
+	Complete []string
+}
+
+// ParsePartial recovers the fields of a recipe from streamed model output that
+// stopped early. Output before the opening brace, such as a code fence, is
+// skipped. It returns an empty result when nothing usable was received.
+func ParsePartial(text string) PartialRecipe {
+	partial := PartialRecipe{Fields: map[string]json.RawMessage{}}
+	start := strings.IndexByte(text, '{')
+	if start < 0 {
+		return partial
+	}
+	body := text[start:]
+	dec := json.NewDecoder(strings.NewReader(body))
+	if _, err := dec.Token(); err != nil {
+		return partial
+	}
+
+	for dec.More() {
+		keyToken, err := dec.Token()
+		if err != nil {
+			break
+		}
+		key, ok := keyToken.(string)
+		if !ok {
+			break
+		}
+		valueToken, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		if delim, ok := valueToken.(json.Delim); ok {
+			if delim != '[' {
+				break
+			}
+			elements, complete := decodeArrayElements(dec)
+			if len(elements) > 0 || complete {
+				raw, _ := json.Marshal(elements)
+				partial.Fields[key] = raw
+			}
+			if !complete {
+				break
+			}
+			partial.Complete = append(partial.Complete, key)
+			continue
+		}
+
+		// A number at the very end of the text may still have had digits to come.
+		if _, isNumber := valueToken.(float64); isNumber && dec.InputOffset() >= int64(len(body)) {
+			break
+		}
+		raw, err := json.Marshal(valueToken)
+		if err != nil {
+			break
+		}
+		partial.Fields[key] = raw
+		partial.Complete = append(partial.Complete, key)
+	}
+	return partial
+}
+
+// decodeArrayElements reads array elements after the opening bracket and reports
+// whether the closing bracket was reached.
+func decodeArrayElements(dec *json.Decoder) ([]json.RawMessage, bool) {
+	elements := []json.RawMessage{}
+	for dec.More() {
+		var element json.RawMessage
+		if err := dec.Decode(&element); err != nil {
+			return elements, false
+		}
+		elements = append(elements, element)
+	}
+	if _, err := dec.Token(); err != nil {
+		return elements, false
+	}
+	return elements, true
+}
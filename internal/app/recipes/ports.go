@@ -1,8 +1,30 @@
 package recipes
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Generator defines the AI capability for recipe generation.
 type Generator interface {
 	Generate(ctx context.Context, req RecipeRequest) (*Recipe, error)
+	// GenerateStream calls onChunk with partial model output as it arrives and
+	// returns the structured recipe once generation completes. An error from
+	// onChunk stops generation.
+	GenerateStream(ctx context.Context, req RecipeRequest, onChunk func(chunk string) error) (*Recipe, error)
+}
+
+// Repository persists generated recipes. Lookups are scoped to the owning user.
+type Repository interface {
+	Save(ctx context.Context, userID string, req RecipeRequest, recipe *Recipe) (*SavedRecipe, error)
+	ListForUser(ctx context.Context, userID string, limit, offset int) ([]*SavedRecipe, error)
+	// Get returns ErrRecipeNotFound when the recipe does not exist or belongs to another user.
+	Get(ctx context.Context, userID, id string) (*SavedRecipe, error)
+}
+
+// Cache stores generated recipes by normalized request. Implementations report a
+// miss, not an error, for absent keys.
+type Cache interface {
+	Get(ctx context.Context, key string) (*Recipe, bool, error)
+	Set(ctx context.Context, key string, recipe *Recipe, ttl time.Duration) error
 }
@@ -1,16 +1,165 @@
 package recipes
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
 
-// Service orchestrates recipe generation.
+var (
+	ErrInvalidRecipe  = errors.New("generated recipe is invalid")
+	ErrInvalidCount   = errors.New("invalid recipe count")
+	ErrRecipeNotFound = errors.New("recipe not found")
+)
+
+// Limits bounds the size of recipe requests and generated recipes.
+type Limits struct {
+	MaxCount              int
+	MaxTitleLength        int
+	MaxInstructions       int
+	MaxIngredients        int
+	MaxIngredientLength   int
+	MaxRestrictionsLength int
+}
+
+// Service orchestrates recipe generation and keeps every valid result for its owner.
 type Service struct {
-	generator Generator
+	generator  Generator
+	repository Repository
+	limits     Limits
+	filter     IngredientFilter
+	cache      Cache
+	cacheTTL   time.Duration
+	counters   cacheCounters
+}
+
+func NewService(generator Generator, repository Repository, limits Limits, opts ...Option) *Service {
+	if limits.MaxCount <= 0 {
+		limits.MaxCount = 1
+	}
+	if limits.MaxIngredientLength <= 0 {
+		limits.MaxIngredientLength = defaultMaxIngredientLength
+	}
+	if limits.MaxRestrictionsLength <= 0 {
+		limits.MaxRestrictionsLength = defaultMaxRestrictionsLength
+	}
+	s := &Service{generator: generator, repository: repository, limits: limits}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Generate returns a cached recipe for an identical request when caching is enabled,
+// and otherwise calls the generator.
+func (s *Service) Generate(ctx context.Context, userID string, req RecipeRequest) (*SavedRecipe, error) {
+	req, err := s.ValidateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if recipe, ok := s.cached(ctx, req); ok {
+		return s.save(ctx, userID, req, recipe)
+	}
+	return s.generate(ctx, userID, req)
+}
+
+// GenerateStream generates a recipe, passing partial output to onChunk. Only the
+// final recipe is validated and saved; chunks are raw model text. A cache hit
+// returns immediately without calling onChunk.
+func (s *Service) GenerateStream(ctx context.Context, userID string, req RecipeRequest, onChunk func(chunk string) error) (*SavedRecipe, error) {
+	req, err := s.ValidateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if recipe, ok := s.cached(ctx, req); ok {
+		return s.save(ctx, userID, req, recipe)
+	}
+
+	recipe, err := s.generator.GenerateStream(ctx, req, onChunk)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.save(ctx, userID, req, recipe)
+	if err != nil {
+		return nil, err
+	}
+	s.storeCached(ctx, req, recipe)
+	return saved, nil
+}
+
+// GenerateMany generates up to count recipes, clamping count to the configured maximum.
+func (s *Service) GenerateMany(ctx context.Context, userID string, req RecipeRequest, count int) ([]*SavedRecipe, error) {
+	if count <= 0 {
+		return nil, ErrInvalidCount
+	}
+	if count > s.limits.MaxCount {
+		count = s.limits.MaxCount
+	}
+	req, err := s.ValidateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Batches always call the generator; serving them from cache would repeat one recipe.
+	recipes := make([]*SavedRecipe, 0, count)
+	for range count {
+		recipe, err := s.generate(ctx, userID, req)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+	return recipes, nil
+}
+
+// List returns the user's recipes, newest first.
+func (s *Service) List(ctx context.Context, userID string, limit, offset int) ([]*SavedRecipe, error) {
+	return s.repository.ListForUser(ctx, userID, limit, offset)
+}
+
+func (s *Service) Get(ctx context.Context, userID, id string) (*SavedRecipe, error) {
+	return s.repository.Get(ctx, userID, id)
+}
+
+// generate calls the generator and caches the validated result.
+func (s *Service) generate(ctx context.Context, userID string, req RecipeRequest) (*SavedRecipe, error) {
+	recipe, err := s.generator.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.save(ctx, userID, req, recipe)
+	if err != nil {
+		return nil, err
+	}
+	s.storeCached(ctx, req, recipe)
+	return saved, nil
 }
 
-func NewService(generator Generator) *Service {
-	return &Service{generator: generator}
+func (s *Service) save(ctx context.Context, userID string, req RecipeRequest, recipe *Recipe) (*SavedRecipe, error) {
+	if err := s.validate(recipe); err != nil {
+		return nil, err
+	}
+	saved, err := s.repository.Save(ctx, userID, req, recipe)
+	if err != nil {
+		return nil, fmt.Errorf("save recipe: %w", err)
+	}
+	return saved, nil
 }
 
-func (s *Service) Generate(ctx context.Context, req RecipeRequest) (*Recipe, error) {
-	return s.generator.Generate(ctx, req)
+func (s *Service) validate(recipe *Recipe) error {
+	if recipe == nil {
+		return ErrInvalidRecipe
+	}
+	if s.limits.MaxTitleLength > 0 && utf8.RuneCountInString(recipe.Title) > s.limits.MaxTitleLength {
+		return fmt.Errorf("%w: title exceeds %d characters", ErrInvalidRecipe, s.limits.MaxTitleLength)
+	}
+	if s.limits.MaxInstructions > 0 && len(recipe.Instructions) > s.limits.MaxInstructions {
+		return fmt.Errorf("%w: more than %d instructions", ErrInvalidRecipe, s.limits.MaxInstructions)
+	}
+	if s.limits.MaxIngredients > 0 && len(recipe.Ingredients) > s.limits.MaxIngredients {
+		return fmt.Errorf("%w: more than %d ingredients", ErrInvalidRecipe, s.limits.MaxIngredients)
+	}
+	return nil
 }
@@ -0,0 +1,111 @@
+package recipes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stubChunkSize is the number of bytes of recipe JSON sent per streamed chunk.
+const stubChunkSize = 64
+
+// StubGenerator returns deterministic recipes without calling a model. It is meant
+// for CI, integration tests and offline development.
+type StubGenerator struct {
+	fixtures map[string]Recipe
+}
+
+var _ Generator = (*StubGenerator)(nil)
+
+// NewStubGenerator returns a generator that serves fixtures by ingredient (matched
+// case-insensitively) and builds a recipe from the request for anything else.
+func NewStubGenerator(fixtures map[string]Recipe) *StubGenerator {
+	normalized := make(map[string]Recipe, len(fixtures))
+	for ingredient, recipe := range fixtures {
+		normalized[normalize(ingredient)] = recipe
+	}
+	return &StubGenerator{fixtures: normalized}
+}
+
+// LoadStubFixtures decodes a JSON object mapping ingredients to recipes.
+func LoadStubFixtures(data []byte) (map[string]Recipe, error) {
+	var fixtures map[string]Recipe
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("decode stub fixtures: %w", err)
+	}
+	return fixtures, nil
+}
+
+func (g *StubGenerator) Generate(ctx context.Context, req RecipeRequest) (*Recipe, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if recipe, ok := g.fixtures[normalize(req.Ingredient)]; ok {
+		return &recipe, nil
+	}
+	return stubRecipe(req), nil
+}
+
+// GenerateStream sends the recipe's JSON encoding in fixed-size chunks, mimicking a
+// model streaming structured output.
+func (g *StubGenerator) GenerateStream(ctx context.Context, req RecipeRequest, onChunk func(chunk string) error) (*Recipe, error) {
+	recipe, err := g.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(recipe)
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(data); {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := min(start+stubChunkSize, len(data))
+		// Never split a multi-byte character across chunks.
+		for end < len(data) && end > start+1 && !utf8.RuneStart(data[end]) {
+			end--
+		}
+		if err := onChunk(string(data[start:end])); err != nil {
+			return nil, err
+		}
+		start = end
+	}
+	return recipe, nil
+}
+
+func stubRecipe(req RecipeRequest) *Recipe {
+	ingredient := strings.TrimSpace(req.Ingredient)
+	description := fmt.Sprintf("A simple dish built around %s.", ingredient)
+	if restrictions := strings.TrimSpace(req.DietaryRestrictions); restrictions != "" {
+		description = fmt.Sprintf("A simple %s dish built around %s.", restrictions, ingredient)
+	}
+
+	return &Recipe{
+		Title:       "Simple " + titleCase(ingredient),
+		Description: description,
+		PrepTime:    "10 minutes",
+		CookTime:    "20 minutes",
+		Servings:    2,
+		Ingredients: []string{ingredient, "olive oil", "salt", "black pepper"},
+		Instructions: []string{
+			"Prepare the " + ingredient + ".",
+			"Heat the olive oil in a pan over medium heat.",
+			"Cook the " + ingredient + " until done, seasoning with salt and pepper.",
+		},
+		Tips: []string{"Taste and adjust the seasoning before serving."},
+	}
+}
+
+func titleCase(value string) string {
+	words := strings.Fields(value)
+	for i, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(first)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
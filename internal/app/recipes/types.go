@@ -1,5 +1,7 @@
 package recipes
 
+import "time"
+
 // RecipeRequest represents the input for recipe generation.
 type RecipeRequest struct {
 	Ingredient          string `json:"ingredient" jsonschema:"description=Main ingredient or cuisine type" example:"chicken" validate:"required"`
@@ -17,3 +19,11 @@ type Recipe struct {
 	Instructions []string `json:"instructions" example:"Marinate chicken,Preheat grill,Grill for 12 minutes" validate:"required"`
 	Tips         []string `json:"tips,omitempty" example:"Let rest for 5 minutes before serving"`
 }
+
+// SavedRecipe is a generated recipe stored for its owner.
+type SavedRecipe struct {
+	ID        string
+	Request   RecipeRequest
+	Recipe    Recipe
+	CreatedAt time.Time
+}
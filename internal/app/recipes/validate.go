@@ -0,0 +1,111 @@
+package recipes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxIngredientLength   = 100
+	defaultMaxRestrictionsLength = 200
+)
+
+// ValidationError reports invalid request fields, keyed by JSON field name.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+": "+e.Fields[name])
+	}
+	return "invalid recipe request: " + strings.Join(parts, "; ")
+}
+
+// promptInjectionMarkers matches chat-template tokens, role prefixes and instruction
+// overrides that have no place in an ingredient list. Matches are removed, not rejected.
+var promptInjectionMarkers = regexp.MustCompile(`(?i)` + strings.Join([]string{
+	"```+",
+	`<\|[^|]*\|>`,
+	`<\||\|>`,
+	`\[/?inst\]`,
+	`<</?sys>>`,
+	`#{2,}`,
+	`\b(?:system|assistant|user)\s*:`,
+	`\b(?:ignore|disregard|forget)\s+(?:all\s+)?(?:the\s+)?(?:previous|prior|above)\s+(?:instructions|prompts?|rules)\b`,
+	`\bsystem\s+prompt\b`,
+}, "|"))
+
+// ValidateRequest trims and sanitizes a request before it reaches the prompt. Control
+// characters and characters outside the allowlist are rejected, prompt-injection
+// markers are stripped, and both fields are capped in length. A well-formed
+// ingredient the ingredient filter rejects returns ErrInvalidIngredient.
+func (s *Service) ValidateRequest(req RecipeRequest) (RecipeRequest, error) {
+	fields := map[string]string{}
+
+	ingredient, problem := sanitizeField(req.Ingredient, s.limits.MaxIngredientLength)
+	if problem == "" && ingredient == "" {
+		problem = "is required"
+	}
+	if problem != "" {
+		fields["ingredient"] = problem
+	}
+
+	restrictions, problem := sanitizeField(req.DietaryRestrictions, s.limits.MaxRestrictionsLength)
+	if problem != "" {
+		fields["dietaryRestrictions"] = problem
+	}
+
+	if len(fields) > 0 {
+		return RecipeRequest{}, &ValidationError{Fields: fields}
+	}
+	if !s.filter.Allows(ingredient) {
+		return RecipeRequest{}, ErrInvalidIngredient
+	}
+	return RecipeRequest{Ingredient: ingredient, DietaryRestrictions: restrictions}, nil
+}
+
+// sanitizeField returns the cleaned value, or a description of why it was rejected.
+func sanitizeField(value string, maxLength int) (string, string) {
+	if !utf8.ValidString(value) {
+		return "", "must be valid UTF-8"
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return "", "must not contain control characters"
+		}
+	}
+
+	value = promptInjectionMarkers.ReplaceAllString(value, " ")
+	value = strings.Join(strings.Fields(value), " ")
+
+	for _, r := range value {
+		if !allowedRune(r) {
+			return "", "contains unsupported characters"
+		}
+	}
+	if maxLength > 0 && utf8.RuneCountInString(value) > maxLength {
+		return "", fmt.Sprintf("must be at most %d characters", maxLength)
+	}
+	return value, ""
+}
+
+// allowedRune permits letters, digits, spaces and the punctuation found in ordinary
+// ingredient lists and dietary notes.
+func allowedRune(r rune) bool {
+	if unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == ' ' {
+		return true
+	}
+	return strings.ContainsRune(",.-'&/()%+", r)
+}
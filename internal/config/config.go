@@ -1,10 +1,19 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -12,26 +21,170 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// googleCallbackPath is where the router serves the Google OAuth callback.
+const googleCallbackPath = "/api/auth/google/callback"
+
+// oidcCallbackPath is where the router serves the generic OpenID Connect callback.
+const oidcCallbackPath = "/api/auth/oidc/callback"
+
+// appleCallbackPath is where the router serves the Sign in with Apple callback.
+const appleCallbackPath = "/api/auth/apple/callback"
+
+// defaultLogRedactKeys are the query parameters and headers whose values are never logged.
+var defaultLogRedactKeys = []string{"token", "code", "Authorization", "Cookie", "X-API-Key"}
+
+// defaultAuditRedactKeys and defaultAuditDropKeys are the audit metadata keys
+// stored as a fingerprint or not at all.
+var (
+	defaultAuditRedactKeys = []string{"session_token_hash"}
+	defaultAuditDropKeys   = []string{"password", "token", "secret", "authorization", "cookie"}
+)
+
 type Config struct {
-	Port      string
-	Env       string
-	Database  DatabaseConfig
-	Valkey    ValkeyConfig
-	RateLimit RateLimitConfig
-	Auth      AuthConfig
-	Google    GoogleOAuthConfig
-	Audit     AuditConfig
-	Email     EmailConfig
-	Storage   StorageConfig
+	BindAddress     string
+	Port            string
+	Env             string
+	LogLevel        string
+	LogRedactKeys   []string
+	ShutdownTimeout time.Duration
+	ConfigMaxAge    time.Duration
+	RequestTimeouts RequestTimeoutConfig
+	ServerTimeouts  ServerTimeoutConfig
+	MaxBodyBytes    int64
+	Headers         HeadersConfig
+	Compression     CompressionConfig
+	TLS             TLSConfig
+	Database        DatabaseConfig
+	Valkey          ValkeyConfig
+	RateLimit       RateLimitConfig
+	Auth            AuthConfig
+	IPFilter        IPFilterConfig
+	Google          GoogleOAuthConfig
+	Apple           AppleOAuthConfig
+	OIDC            OIDCConfig
+	Audit           AuditConfig
+	Email           EmailConfig
+	Storage         StorageConfig
+	Recipes         RecipesConfig
+	AI              AIConfig
+	// loadErrs are problems Load could not report itself, such as an unreadable
+	// secret file; Validate returns them.
+	loadErrs []error
+}
+
+// RequestTimeoutConfig bounds how long each route group may take before the
+// client gets a 504. Zero disables the timeout for that group. Streamed recipe
+// generation is bounded by RecipesConfig.StreamTimeout instead.
+type RequestTimeoutConfig struct {
+	// Auth covers /api/auth except the avatar routes, including the OAuth
+	// callbacks and verification mail.
+	Auth time.Duration
+	// Recipes covers the non-streaming generation routes, which wait on the model.
+	Recipes time.Duration
+	// Default covers every other API route.
+	Default time.Duration
+}
+
+// ServerTimeoutConfig bounds each connection of the HTTP servers, so slow or
+// idle clients cannot hold connections open. Zero disables a timeout. There is
+// no write timeout: streamed recipe generation writes for as long as the model
+// does.
+type ServerTimeoutConfig struct {
+	// ReadHeader is how long a client may take to send the request headers.
+	ReadHeader time.Duration
+	// Read is how long a client may take to send the whole request, body
+	// included, so it must leave room for avatar and local blob uploads.
+	Read time.Duration
+	// Idle is how long a keep-alive connection may wait for its next request.
+	Idle time.Duration
+}
+
+// HeadersConfig controls the security headers set on every response. The
+// defaults are the strict same-origin policy; the CSP source lists extend it
+// without replacing it.
+type HeadersConfig struct {
+	// CSP replaces the generated Content-Security-Policy entirely when set, and
+	// the source lists below are ignored.
+	CSP string
+	// CSPScriptSources and the other source lists are added to the matching
+	// directive of the default policy, such as a font CDN or an API origin.
+	CSPScriptSources  []string
+	CSPStyleSources   []string
+	CSPConnectSources []string
+	CSPImgSources     []string
+	CSPFontSources    []string
+	CSPFrameSources   []string
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only, so
+	// a new policy can be tried without breaking the page.
+	CSPReportOnly bool
+	// FrameOptions is DENY or SAMEORIGIN; the CSP frame-ancestors directive
+	// follows it.
+	FrameOptions      string
+	ReferrerPolicy    string
+	PermissionsPolicy string
+	// HSTS sends Strict-Transport-Security. It defaults to on in production;
+	// turn it off when a proxy in front of the app sets its own.
+	HSTS                  bool
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+}
+
+// CompressionConfig controls gzip compression of responses. Static files built
+// with .br or .gz variants are served from those regardless.
+type CompressionConfig struct {
+	Enabled bool
+	// MinBytes is the smallest body worth compressing.
+	MinBytes int
+}
+
+// TLSConfig turns on HTTPS served by the app itself, for deployments without a
+// reverse proxy. It is enabled by CertFile and KeyFile or by AutocertDomains,
+// never both. Without either the app serves plain HTTP and expects a proxy to
+// terminate TLS.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// AutocertDomains are the host names to obtain Let's Encrypt certificates
+	// for. The ACME HTTP-01 challenge is answered on the redirect listener, so
+	// RedirectPort must be reachable as port 80 from the internet.
+	AutocertDomains []string
+	// AutocertCacheDir keeps issued certificates and the account key across
+	// restarts, so Let's Encrypt rate limits are not hit on every deploy.
+	AutocertCacheDir string
+	AutocertEmail    string
+	// RedirectPort serves the HTTP to HTTPS redirect. Empty turns the listener
+	// off, which autocert does not allow.
+	RedirectPort string
+}
+
+// Enabled reports whether the app terminates TLS itself.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || len(t.AutocertDomains) > 0
+}
+
+// Autocert reports whether certificates come from Let's Encrypt.
+func (t TLSConfig) Autocert() bool {
+	return len(t.AutocertDomains) > 0
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	Database string
-	SSLMode  string
+	Host            string
+	Port            string
+	User            string
+	Password        string
+	Database        string
+	SSLMode         string
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// ConnectAttempts and ConnectTimeout bound how long startup waits for the
+	// database to accept connections before failing.
+	ConnectAttempts int
+	ConnectTimeout  time.Duration
+	// AutoMigrate applies pending migrations at startup instead of only
+	// checking that some have been applied.
+	AutoMigrate bool
 }
 
 func (d DatabaseConfig) ConnectionString() string {
@@ -49,21 +202,35 @@ type ValkeyConfig struct {
 	Host     string
 	Port     string
 	Password string
+	// PoolSize caps the connections of the one client every Valkey user
+	// shares; zero keeps the client default of 10 per CPU.
+	PoolSize int
 }
 
 type RateLimitRule struct {
 	Limit  int
 	Window time.Duration
+	// Algorithm is RateLimitSliding, RateLimitFixed or RateLimitTokenBucket.
+	Algorithm string
 }
 
 type RateLimitConfig struct {
 	Enabled           bool
+	MemoryFallback    bool
 	Register          RateLimitRule
 	Login             RateLimitRule
 	Password          RateLimitRule
 	VerifyEmailResend RateLimitRule
 	Google            RateLimitRule
 	Logout            RateLimitRule
+	APIKey            RateLimitRule
+	Admin             RateLimitRule
+	PasswordCheck     RateLimitRule
+	// User is a budget per signed-in user across all session routes; a zero
+	// limit (the default) disables it.
+	User RateLimitRule
+	// Algorithm is the default for rules without their own _ALGORITHM setting.
+	Algorithm string
 }
 
 type AuthConfig struct {
@@ -71,38 +238,408 @@ type AuthConfig struct {
 	CookieSecure         bool
 	CookieSameSite       http.SameSite
 	SessionMaxAge        time.Duration
+	ShortSessionMaxAge   time.Duration
 	IdleTimeout          time.Duration
+	ServiceSessionMaxAge time.Duration
+	APIKeyMaxPerUser     int
 	PostLoginRedirectURL string
-	TrustedProxyHeader   string
+	TrustedProxy         TrustedProxyConfig
+	// ReturnPathPrefixes lists the path prefixes a Google login may ask to return
+	// to with ?redirect=; empty ignores the parameter.
+	ReturnPathPrefixes []string
+	// VerifiedEmailPaths lists the path prefixes that users of any provider may only
+	// use once their email is verified; empty gates nothing.
+	VerifiedEmailPaths []string
+	// RequireVerifiedEmail keeps credentials users from signing in at all until
+	// their email is verified: registration starts no session and password
+	// login is refused.
+	RequireVerifiedEmail bool
+	// AdminEmails lists the lowercased emails allowed to use /api/admin endpoints.
+	AdminEmails []string
+	// BootstrapAdminEmail is promoted to the admin role on its first verified login.
+	BootstrapAdminEmail string
+	// TokenCleanupCron schedules clearing of expired auth tokens; empty disables it.
+	TokenCleanupCron string
+	// SessionCleanupCron schedules deletion of expired and idle sessions; empty disables it.
+	SessionCleanupCron string
+	// PasswordPolicy is "rules" (character classes), "entropy" (strength estimate
+	// of at least PasswordMinScore, 0-4) or "both".
+	PasswordPolicy   string
+	PasswordMinScore int
+	// Argon2 cost for new password hashes; stored hashes below it are rehashed
+	// on the next successful login. Zero keeps the built-in default.
+	Argon2MemoryKiB   int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	// PasswordHistory is how many recent passwords, the current one included, a
+	// password change may not reuse; zero disables the check.
+	PasswordHistory int
+	// UserDenyPolicy and AdminDenyPolicy decide how protected routes of each
+	// class refuse unauthenticated or unauthorized requests.
+	UserDenyPolicy  string
+	AdminDenyPolicy string
+	// ExistingSession decides what a successful login does with the session the
+	// browser already holds: "rotate" revokes it, "add" keeps it. Empty keeps
+	// the per-flow default (add for password login, rotate otherwise).
+	ExistingSession string
+	// NewDeviceLookback is how far back logins count as known devices for new
+	// sign-in alerts; zero disables the alerts.
+	NewDeviceLookback time.Duration
+	// SessionTokenBytes is the random length of new session tokens (min 16).
+	SessionTokenBytes int
+	// TokenPepper, when set, stores session token hashes as HMAC-SHA256 with it.
+	// Sessions stored under a TokenPepperPrevious entry, or as bare SHA-256 while
+	// AcceptUnpeppered is set, still validate and are rehashed on use.
+	TokenPepper         string
+	TokenPepperPrevious []string
+	AcceptUnpeppered    bool
+	// FetchMetadata decides what happens to cross-site state-changing requests
+	// identified by Sec-Fetch-* headers: "enforce" refuses them, "report" only
+	// logs them, "off" skips the check.
+	FetchMetadata string
+	// SessionCacheTTL, when positive, caches validated sessions in Valkey for that
+	// long, so most authenticated requests skip Postgres; zero keeps sessions
+	// DB-only.
+	SessionCacheTTL time.Duration
+	// LastActiveInterval is how old a session's last_active_at may get before a
+	// request writes it again; the idle timeout allows it as slack.
+	LastActiveInterval time.Duration
+	// SessionMode is "opaque" (random tokens looked up in Postgres) or "jwt"
+	// (signed tokens checked without Postgres and revoked through Valkey).
+	SessionMode string
+	// JWTAlgorithm is HS256, signed with JWTSecret while JWTSecretPrevious
+	// entries still verify, or EdDSA, signed with the Ed25519 JWTPrivateKey.
+	JWTAlgorithm      string
+	JWTSecret         string
+	JWTSecretPrevious []string
+	JWTPrivateKey     string
+	// JWTTTL is how long each token is valid. Active clients get a new one once
+	// half of it has passed, so it also works as the idle timeout.
+	JWTTTL time.Duration
+	// CookieDomain, when set, shares the session cookie with subdomains of it;
+	// CookiePath limits it to a path ("/" by default). Either one rules out the
+	// __Host- prefix, so the cookie is then named __Secure-session.
+	CookieDomain string
+	CookiePath   string
 }
 
+// ParseJWTPrivateKey decodes JWTPrivateKey, a PKCS #8 Ed25519 key in PEM form.
+// Escaped newlines are accepted so the key can be set on one line.
+func (c AuthConfig) ParseJWTPrivateKey() (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(c.JWTPrivateKey, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("not a PEM-encoded key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return key, nil
+}
+
+// Where the OAuth state and PKCE verifier are kept between login and callback.
+const (
+	OAuthStateStoreCookie = "cookie"
+	OAuthStateStoreValkey = "valkey"
+)
+
 type GoogleOAuthConfig struct {
-	ClientID     string
-	ClientSecret string
-	RedirectURI  string
+	ClientID             string
+	ClientSecret         string
+	RedirectURI          string
+	RedirectSchemes      []string
+	AllowRedirectHost    bool
+	RequireVerifiedEmail bool
+	CookiePath           string
+	CookieSameSite       http.SameSite
+	StateStore           string
+	StateKey             string
+	StateKeyPrevious     []string
+}
+
+// AppleOAuthConfig configures Sign in with Apple. ClientID is the Services ID,
+// and PrivateKey the PEM contents of the .p8 key created for it, which signs
+// the short-lived client secret sent with each token exchange.
+type AppleOAuthConfig struct {
+	ClientID    string
+	TeamID      string
+	KeyID       string
+	PrivateKey  string
+	RedirectURI string
+	CookiePath  string
+}
+
+// Enabled reports whether Sign in with Apple is configured.
+func (c AppleOAuthConfig) Enabled() bool {
+	return c.ClientID != "" && c.TeamID != "" && c.KeyID != "" && c.PrivateKey != "" && c.RedirectURI != ""
+}
+
+// ParsePrivateKey decodes PrivateKey. Escaped newlines are accepted so the key
+// can be set on one line.
+func (c AppleOAuthConfig) ParsePrivateKey() (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(c.PrivateKey, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("not a PEM-encoded key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an EC private key")
+	}
+	return key, nil
+}
+
+// OIDCConfig configures sign-in through any OpenID Connect issuer, such as
+// Keycloak, Auth0 or Okta, found through its discovery document. RedirectURI
+// defaults to the callback route under APP_BASE_URL.
+type OIDCConfig struct {
+	Issuer               string
+	ClientID             string
+	ClientSecret         string
+	RedirectURI          string
+	Scopes               []string
+	RequireVerifiedEmail bool
+	IssuerSchemes        []string
+	CookiePath           string
+}
+
+// Enabled reports whether an OpenID Connect issuer is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != "" && c.ClientSecret != ""
+}
+
+// TrustedProxyConfig says which proxies may report the client IP in Header.
+// With CIDRs, Header is only read when the direct peer is in one of them, and
+// the client is the rightmost entry outside them. Otherwise the client is the
+// Count-th entry from the right. With neither, Header is ignored.
+type TrustedProxyConfig struct {
+	Header string
+	Count  int
+	CIDRs  []string
+}
+
+// Enabled reports whether any proxy is trusted.
+func (c TrustedProxyConfig) Enabled() bool {
+	return c.Header != "" && (c.Count > 0 || len(c.CIDRs) > 0)
+}
+
+// Prefixes parses CIDRs. A bare address becomes a single-host prefix.
+func (c TrustedProxyConfig) Prefixes() ([]netip.Prefix, error) {
+	prefixes, err := parsePrefixes(c.CIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXY_CIDRS: %w", err)
+	}
+	return prefixes, nil
+}
+
+// IPFilterConfig lists networks to block from the paths under Paths. Entries are
+// CIDRs or single addresses; Prefixes parses them.
+type IPFilterConfig struct {
+	Allow         []string
+	Deny          []string
+	Paths         []string
+	CountryHeader string
+	DenyCountries []string
+}
+
+// Enabled reports whether any rule is configured.
+func (c IPFilterConfig) Enabled() bool {
+	return len(c.Allow) > 0 || len(c.Deny) > 0 || (c.CountryHeader != "" && len(c.DenyCountries) > 0)
+}
+
+// Prefixes parses the allow and deny lists. A bare address becomes a single-host prefix.
+func (c IPFilterConfig) Prefixes() (allow, deny []netip.Prefix, err error) {
+	if allow, err = parsePrefixes(c.Allow); err != nil {
+		return nil, nil, fmt.Errorf("IP_ALLOWLIST: %w", err)
+	}
+	if deny, err = parsePrefixes(c.Deny); err != nil {
+		return nil, nil, fmt.Errorf("IP_DENYLIST: %w", err)
+	}
+	return allow, deny, nil
 }
 
 type AuditConfig struct {
 	CleanupCron   string
 	RetentionDays int
+	// RedactKeys are metadata keys whose values are stored as a SHA-256
+	// fingerprint, so events can still be matched up without keeping the value.
+	RedactKeys []string
+	// DropKeys are metadata keys removed before an event is stored.
+	DropKeys []string
+	// MetadataMaxBytes caps the stored metadata JSON. Larger metadata keeps the
+	// fields that fit and is marked truncated; zero removes the cap.
+	MetadataMaxBytes int
+	// ExportMaxRange is the longest from-to span one audit export may cover.
+	ExportMaxRange time.Duration
+	// BatchSize turns on batched audit writes: events are queued and inserted
+	// BatchSize at a time, or every BatchFlushInterval. Zero writes each event
+	// as it is logged.
+	BatchSize          int
+	BatchFlushInterval time.Duration
+	// BatchBuffer is how many events may wait for a flush. When it is full,
+	// events are written synchronously instead.
+	BatchBuffer int
 }
 
+// Deny policies: answer with 401/403, or with 404 so the route's existence is
+// not disclosed.
+const (
+	DenyPolicyStatus   = "status"
+	DenyPolicyNotFound = "not_found"
+)
+
+// How sessions are represented.
+const (
+	SessionModeOpaque = "opaque"
+	SessionModeJWT    = "jwt"
+)
+
+// Signing algorithms for AUTH_SESSION_MODE=jwt.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// Rate limit algorithms.
+const (
+	RateLimitSliding     = "sliding"
+	RateLimitFixed       = "fixed"
+	RateLimitTokenBucket = "token_bucket"
+)
+
+// What a new login does with the browser's current session.
+const (
+	ExistingSessionRotate = "rotate"
+	ExistingSessionAdd    = "add"
+)
+
+// Fetch Metadata policies for cross-site state-changing requests.
+const (
+	FetchMetadataEnforce = "enforce"
+	FetchMetadataReport  = "report"
+	FetchMetadataOff     = "off"
+)
+
+// Password policies.
+const (
+	PasswordPolicyRules   = "rules"
+	PasswordPolicyEntropy = "entropy"
+	PasswordPolicyBoth    = "both"
+)
+
+// Verification email resend policies.
+const (
+	VerificationResendRateLimit = "ratelimit"
+	VerificationResendBackoff   = "backoff"
+)
+
 type EmailConfig struct {
 	AppBaseURL       string
 	ContactEmail     string
 	GmailAppPassword string
+	// PostVerificationRedirectURL is where the "Continue" link of the verify-email
+	// page points, and the redirect returned to JSON clients. It must pass the
+	// AUTH_POST_LOGIN_REDIRECT_PREFIXES allowlist; empty keeps APP_BASE_URL.
+	PostVerificationRedirectURL string
+	// VerificationResendPolicy is "ratelimit" (the flat RATE_LIMIT_VERIFY_EMAIL_* window)
+	// or "backoff" (per-user exponential delays between sends).
+	VerificationResendPolicy       string
+	VerificationResendBackoff      []time.Duration
+	VerificationResendBackoffReset time.Duration
+	// VerificationResendCooldown is the minimum time between two verification
+	// emails to one user, enforced under either resend policy; zero disables it.
+	VerificationResendCooldown time.Duration
+	// VerificationTokenGrace keeps the link from the previous verification email
+	// working for this long after a resend replaces it; zero invalidates it at once.
+	VerificationTokenGrace time.Duration
 }
 
 type StorageConfig struct {
-	Endpoint           string
-	Region             string
-	Bucket             string
-	AccessKeyID        string
-	SecretAccessKey    string
-	ForcePathStyle     bool
-	PresignUploadTTL   time.Duration
-	PresignDownloadTTL time.Duration
-	AvatarMaxBytes     int64
+	Backend             string
+	LocalDir            string
+	LocalBaseURL        string
+	LocalSecret         string
+	Endpoint            string
+	Region              string
+	Bucket              string
+	AccessKeyID         string
+	SecretAccessKey     string
+	ForcePathStyle      bool
+	PresignUploadTTL    time.Duration
+	PresignDownloadTTL  time.Duration
+	AvatarMaxBytes      int64
+	AvatarMaxDimension  int
+	MultipartPartSize   int64
+	AvatarThumbnailSize int
+	AvatarTranscodeWebP bool
+	AvatarQuality       int
+	// MaxConcurrentOps caps in-flight S3 calls; QueueTimeout is how long a call
+	// waits for a slot before failing as throttled.
+	MaxConcurrentOps int
+	QueueTimeout     time.Duration
+}
+
+type RecipesConfig struct {
+	// Enabled turns the recipe routes on. It is false when RECIPES_ENABLED=false or
+	// no AI backend is configured, which leaves a pure auth starter.
+	Enabled          bool
+	MaxCount         int
+	MaxResponseBytes int
+	MaxTitleLength   int
+	MaxInstructions  int
+	MaxIngredients   int
+	// MaxIngredientLength and MaxRestrictionsLength cap the request fields in characters.
+	MaxIngredientLength   int
+	MaxRestrictionsLength int
+	CacheEnabled          bool
+	CacheTTL              time.Duration
+	// StreamTimeout bounds a streamed generation; zero leaves it to the client.
+	StreamTimeout time.Duration
+	// IngredientFilter is "off", "allowlist" or "denylist". The terms come from
+	// IngredientTerms and, when set, one per line from IngredientTermsFile.
+	IngredientFilter    string
+	IngredientTerms     []string
+	IngredientTermsFile string
+}
+
+// AIConfig selects the recipe generator. Backend is "genkit" (Gemini via Genkit),
+// "stub", which returns deterministic recipes without credentials, or "none".
+type AIConfig struct {
+	Backend          string
+	APIKey           string
+	StubFixturesFile string
+	// Temperature, TopP and MaxOutputTokens tune the genkit backend. Unset values
+	// keep the model's defaults; ranges are checked when the generator starts.
+	Temperature     *float64
+	TopP            *float64
+	MaxOutputTokens int
+}
+
+// Configured reports whether the selected backend can run. Genkit needs a Google
+// AI key; unknown backends count as configured so startup reports them.
+func (c AIConfig) Configured() bool {
+	switch c.Backend {
+	case "none":
+		return false
+	case "genkit":
+		return c.APIKey != ""
+	default:
+		return true
+	}
+}
+
+// ListenAddr is the host:port the main server listens on. BindAddress defaults
+// to 127.0.0.1, so only a proxy on the same machine can reach the app; empty or
+// 0.0.0.0 listens on every interface.
+func (c *Config) ListenAddr() string {
+	return net.JoinHostPort(c.BindAddress, c.Port)
 }
 
 func (v ValkeyConfig) Addr() string {
@@ -136,14 +673,68 @@ func Load() *Config {
 		appBaseURL = fmt.Sprintf("http://localhost:%s", port)
 	}
 
+	var loadErrs []error
+	secret := func(key string) string {
+		value, err := getSecretEnv(key)
+		if err != nil {
+			loadErrs = append(loadErrs, err)
+		}
+		return value
+	}
+	// secretList reads a comma-separated key ring such as AUTH_JWT_SECRET_PREVIOUS
+	// the same way; a file may also hold one entry per line.
+	secretList := func(key string) []string {
+		return splitList(secret(key))
+	}
+
 	authConfig := AuthConfig{
 		CookieName:           "session",
 		CookieSecure:         false,
 		CookieSameSite:       http.SameSiteLaxMode,
+		CookieDomain:         strings.TrimPrefix(strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_COOKIE_DOMAIN"))), "."),
+		CookiePath:           getEnvOrDefault("AUTH_COOKIE_PATH", "/"),
 		SessionMaxAge:        7 * 24 * time.Hour,
+		ShortSessionMaxAge:   time.Duration(getEnvIntOrDefault("AUTH_SHORT_SESSION_MAX_AGE_HOURS", 12)) * time.Hour,
 		IdleTimeout:          30 * time.Minute,
+		ServiceSessionMaxAge: time.Duration(getEnvIntOrDefault("AUTH_SERVICE_SESSION_MAX_AGE_DAYS", 90)) * 24 * time.Hour,
+		APIKeyMaxPerUser:     getEnvIntOrDefault("AUTH_API_KEY_MAX_PER_USER", 10),
 		PostLoginRedirectURL: os.Getenv("AUTH_POST_LOGIN_REDIRECT_URL"),
-		TrustedProxyHeader:   os.Getenv("TRUSTED_PROXY_HEADER"),
+		ReturnPathPrefixes:   getEnvListOrDefault("AUTH_POST_LOGIN_REDIRECT_PREFIXES", nil),
+		VerifiedEmailPaths:   []string{"/api/recipes/generate", "/api/auth/avatar/"},
+		RequireVerifiedEmail: getEnvBoolOrDefault("AUTH_REQUIRE_VERIFIED_EMAIL", false),
+		TokenCleanupCron:     getEnvOrDefault("AUTH_TOKEN_CLEANUP_CRON", "30 * * * *"),
+		SessionCleanupCron:   getEnvOrDefault("AUTH_SESSION_CLEANUP_CRON", "*/15 * * * *"),
+		BootstrapAdminEmail:  strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_BOOTSTRAP_ADMIN_EMAIL"))),
+		PasswordPolicy:       strings.ToLower(strings.TrimSpace(getEnvOrDefault("AUTH_PASSWORD_POLICY", PasswordPolicyRules))),
+		PasswordMinScore:     getEnvIntOrDefault("AUTH_PASSWORD_MIN_SCORE", 3),
+		Argon2MemoryKiB:      max(getEnvIntOrDefault("AUTH_ARGON2_MEMORY_KIB", 64*1024), 0),
+		Argon2Iterations:     max(getEnvIntOrDefault("AUTH_ARGON2_ITERATIONS", 3), 0),
+		Argon2Parallelism:    min(max(getEnvIntOrDefault("AUTH_ARGON2_PARALLELISM", 4), 0), 255),
+		PasswordHistory:      getEnvIntOrDefault("AUTH_PASSWORD_HISTORY", 5),
+		UserDenyPolicy:       strings.ToLower(getEnvOrDefault("AUTH_DENY_POLICY", DenyPolicyStatus)),
+		AdminDenyPolicy:      strings.ToLower(getEnvOrDefault("AUTH_ADMIN_DENY_POLICY", DenyPolicyNotFound)),
+		ExistingSession:      strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_EXISTING_SESSION"))),
+		NewDeviceLookback:    time.Duration(max(getEnvIntOrDefault("AUTH_NEW_DEVICE_LOOKBACK_DAYS", 90), 0)) * 24 * time.Hour,
+		SessionTokenBytes:    getEnvIntOrDefault("AUTH_SESSION_TOKEN_BYTES", 32),
+		TokenPepper:          secret("AUTH_TOKEN_PEPPER"),
+		TokenPepperPrevious:  secretList("AUTH_TOKEN_PEPPER_PREVIOUS"),
+		AcceptUnpeppered:     getEnvBoolOrDefault("AUTH_TOKEN_ACCEPT_UNPEPPERED", true),
+		FetchMetadata:        strings.ToLower(getEnvOrDefault("AUTH_FETCH_METADATA_POLICY", FetchMetadataEnforce)),
+		SessionCacheTTL:      time.Duration(getEnvIntOrDefault("AUTH_SESSION_CACHE_TTL_SECONDS", 0)) * time.Second,
+		LastActiveInterval:   time.Duration(getEnvIntOrDefault("AUTH_LAST_ACTIVE_INTERVAL_SECONDS", 60)) * time.Second,
+		SessionMode:          strings.ToLower(getEnvOrDefault("AUTH_SESSION_MODE", SessionModeOpaque)),
+		JWTAlgorithm:         getEnvOrDefault("AUTH_JWT_ALGORITHM", JWTAlgorithmHS256),
+		JWTSecret:            secret("AUTH_JWT_SECRET"),
+		JWTSecretPrevious:    secretList("AUTH_JWT_SECRET_PREVIOUS"),
+		JWTPrivateKey:        secret("AUTH_JWT_PRIVATE_KEY"),
+		JWTTTL:               time.Duration(getEnvIntOrDefault("AUTH_JWT_TTL_SECONDS", 300)) * time.Second,
+	}
+	// Set but empty turns the gate off rather than falling back to the default.
+	if _, ok := os.LookupEnv("AUTH_VERIFIED_EMAIL_PATHS"); ok {
+		authConfig.VerifiedEmailPaths = getEnvListOrDefault("AUTH_VERIFIED_EMAIL_PATHS", nil)
+	}
+	for _, email := range getEnvListOrDefault("AUTH_ADMIN_EMAILS", nil) {
+		authConfig.AdminEmails = append(authConfig.AdminEmails, strings.ToLower(email))
 	}
 
 	rateLimitEnabled := true
@@ -151,33 +742,78 @@ func Load() *Config {
 		rateLimitEnabled = value
 	}
 
+	rateLimitAlgorithm := strings.ToLower(getEnvOrDefault("RATE_LIMIT_ALGORITHM", RateLimitSliding))
 	rateLimitConfig := RateLimitConfig{
-		Enabled: rateLimitEnabled,
+		Enabled:        rateLimitEnabled,
+		MemoryFallback: getEnvBoolOrDefault("RATE_LIMIT_MEMORY_FALLBACK", true),
+		Algorithm:      rateLimitAlgorithm,
 		Register: RateLimitRule{
-			Limit:  getEnvIntOrDefault("RATE_LIMIT_REGISTER_LIMIT", 3),
-			Window: time.Duration(getEnvIntOrDefault("RATE_LIMIT_REGISTER_WINDOW_SECONDS", 3600)) * time.Second,
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_REGISTER_LIMIT", 3),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_REGISTER_WINDOW_SECONDS", 3600)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_REGISTER_ALGORITHM", rateLimitAlgorithm)),
 		},
 		Login: RateLimitRule{
-			Limit:  getEnvIntOrDefault("RATE_LIMIT_LOGIN_LIMIT", 5),
-			Window: time.Duration(getEnvIntOrDefault("RATE_LIMIT_LOGIN_WINDOW_SECONDS", 900)) * time.Second,
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_LOGIN_LIMIT", 5),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_LOGIN_WINDOW_SECONDS", 900)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_LOGIN_ALGORITHM", rateLimitAlgorithm)),
 		},
 		Password: RateLimitRule{
-			Limit:  getEnvIntOrDefault("RATE_LIMIT_PASSWORD_LIMIT", 5),
-			Window: time.Duration(getEnvIntOrDefault("RATE_LIMIT_PASSWORD_WINDOW_SECONDS", 900)) * time.Second,
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_PASSWORD_LIMIT", 5),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_PASSWORD_WINDOW_SECONDS", 900)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_PASSWORD_ALGORITHM", rateLimitAlgorithm)),
 		},
 		VerifyEmailResend: RateLimitRule{
-			Limit:  getEnvIntOrDefault("RATE_LIMIT_VERIFY_EMAIL_LIMIT", 3),
-			Window: time.Duration(getEnvIntOrDefault("RATE_LIMIT_VERIFY_EMAIL_WINDOW_SECONDS", 3600)) * time.Second,
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_VERIFY_EMAIL_LIMIT", 3),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_VERIFY_EMAIL_WINDOW_SECONDS", 3600)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_VERIFY_EMAIL_ALGORITHM", rateLimitAlgorithm)),
 		},
 		Google: RateLimitRule{
-			Limit:  getEnvIntOrDefault("RATE_LIMIT_GOOGLE_LIMIT", 10),
-			Window: time.Duration(getEnvIntOrDefault("RATE_LIMIT_GOOGLE_WINDOW_SECONDS", 900)) * time.Second,
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_GOOGLE_LIMIT", 10),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_GOOGLE_WINDOW_SECONDS", 900)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_GOOGLE_ALGORITHM", rateLimitAlgorithm)),
 		},
 		Logout: RateLimitRule{
-			Limit:  getEnvIntOrDefault("RATE_LIMIT_LOGOUT_LIMIT", 10),
-			Window: time.Duration(getEnvIntOrDefault("RATE_LIMIT_LOGOUT_WINDOW_SECONDS", 60)) * time.Second,
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_LOGOUT_LIMIT", 10),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_LOGOUT_WINDOW_SECONDS", 60)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_LOGOUT_ALGORITHM", rateLimitAlgorithm)),
+		},
+		APIKey: RateLimitRule{
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_API_KEY_LIMIT", 60),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_API_KEY_WINDOW_SECONDS", 60)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_API_KEY_ALGORITHM", rateLimitAlgorithm)),
+		},
+		Admin: RateLimitRule{
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_ADMIN_LIMIT", 60),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_ADMIN_WINDOW_SECONDS", 60)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_ADMIN_ALGORITHM", rateLimitAlgorithm)),
+		},
+		PasswordCheck: RateLimitRule{
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_PASSWORD_CHECK_LIMIT", 60),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_PASSWORD_CHECK_WINDOW_SECONDS", 60)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_PASSWORD_CHECK_ALGORITHM", rateLimitAlgorithm)),
 		},
+		User: RateLimitRule{
+			Limit:     getEnvIntOrDefault("RATE_LIMIT_USER_LIMIT", 0),
+			Window:    time.Duration(getEnvIntOrDefault("RATE_LIMIT_USER_WINDOW_SECONDS", 60)) * time.Second,
+			Algorithm: strings.ToLower(getEnvOrDefault("RATE_LIMIT_USER_ALGORITHM", rateLimitAlgorithm)),
+		},
+	}
+
+	// A proxy header alone used to be enough, so it still implies one proxy; a count
+	// or CIDR list alone implies the de facto standard header.
+	trustedProxy := TrustedProxyConfig{
+		Header: os.Getenv("TRUSTED_PROXY_HEADER"),
+		CIDRs:  getEnvListOrDefault("TRUSTED_PROXY_CIDRS", nil),
+	}
+	defaultProxyCount := 0
+	if trustedProxy.Header != "" && len(trustedProxy.CIDRs) == 0 {
+		defaultProxyCount = 1
+	}
+	trustedProxy.Count = max(getEnvIntOrDefault("TRUSTED_PROXY_COUNT", defaultProxyCount), 0)
+	if trustedProxy.Header == "" && (trustedProxy.Count > 0 || len(trustedProxy.CIDRs) > 0) {
+		trustedProxy.Header = "X-Forwarded-For"
 	}
+	authConfig.TrustedProxy = trustedProxy
 
 	if env == "production" {
 		authConfig.CookieName = "__Host-session"
@@ -191,50 +827,825 @@ func Load() *Config {
 			authConfig.CookieName = "session"
 		}
 	}
+	// None lets the cookie reach the app when it is embedded in another site;
+	// Validate requires Secure and the Fetch Metadata check along with it.
+	authConfig.CookieSameSite = parseSameSite(os.Getenv("AUTH_COOKIE_SAMESITE"), authConfig.CookieSameSite)
+	// Browsers reject __Host- cookies that carry a Domain or a Path other than
+	// "/"; __Secure- only requires the Secure flag, which is still set here.
+	if authConfig.CookieName == "__Host-session" && (authConfig.CookieDomain != "" || authConfig.CookiePath != "/") {
+		authConfig.CookieName = "__Secure-session"
+	}
+
+	googleConfig := GoogleOAuthConfig{
+		ClientID:             os.Getenv("GOOGLE_CLIENT_ID"),
+		ClientSecret:         secret("GOOGLE_CLIENT_SECRET"),
+		RedirectURI:          os.Getenv("GOOGLE_REDIRECT_URI"),
+		RedirectSchemes:      getEnvListOrDefault("GOOGLE_REDIRECT_SCHEMES", defaultRedirectSchemes(env)),
+		AllowRedirectHost:    getEnvBoolOrDefault("GOOGLE_REDIRECT_ALLOW_OTHER_HOST", false),
+		RequireVerifiedEmail: getEnvBoolOrDefault("GOOGLE_REQUIRE_VERIFIED_EMAIL", true),
+		CookiePath:           oauthCookiePath(os.Getenv("GOOGLE_OAUTH_COOKIE_PATH"), os.Getenv("GOOGLE_REDIRECT_URI"), googleCallbackPath),
+		CookieSameSite:       parseSameSite(os.Getenv("GOOGLE_OAUTH_COOKIE_SAMESITE"), http.SameSiteLaxMode),
+		StateStore:           strings.ToLower(getEnvOrDefault("GOOGLE_OAUTH_STATE_STORE", OAuthStateStoreCookie)),
+		StateKey:             secret("GOOGLE_OAUTH_STATE_KEY"),
+		StateKeyPrevious:     secretList("GOOGLE_OAUTH_STATE_KEY_PREVIOUS"),
+	}
 
-	return &Config{
-		Port: port,
-		Env:  env,
+	// SameSite=None cookies are rejected by browsers unless they are also Secure, and the
+	// OAuth cookies always share the session cookie's Secure flag.
+	if googleConfig.CookieSameSite == http.SameSiteNoneMode && !authConfig.CookieSecure {
+		googleConfig.CookieSameSite = http.SameSiteLaxMode
+	}
+
+	appleConfig := AppleOAuthConfig{
+		ClientID:    os.Getenv("APPLE_CLIENT_ID"),
+		TeamID:      os.Getenv("APPLE_TEAM_ID"),
+		KeyID:       os.Getenv("APPLE_KEY_ID"),
+		PrivateKey:  secret("APPLE_PRIVATE_KEY"),
+		RedirectURI: os.Getenv("APPLE_REDIRECT_URI"),
+		CookiePath:  oauthCookiePath("", os.Getenv("APPLE_REDIRECT_URI"), appleCallbackPath),
+	}
+
+	oidcRedirectURI := os.Getenv("OIDC_REDIRECT_URI")
+	if oidcRedirectURI == "" {
+		oidcRedirectURI = appBaseURL + oidcCallbackPath
+	}
+	oidcConfig := OIDCConfig{
+		Issuer:               os.Getenv("OIDC_ISSUER"),
+		ClientID:             os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:         secret("OIDC_CLIENT_SECRET"),
+		RedirectURI:          oidcRedirectURI,
+		Scopes:               getEnvListOrDefault("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+		RequireVerifiedEmail: getEnvBoolOrDefault("OIDC_REQUIRE_VERIFIED_EMAIL", true),
+		IssuerSchemes:        defaultRedirectSchemes(env),
+		CookiePath:           oauthCookiePath("", oidcRedirectURI, oidcCallbackPath),
+	}
+
+	geminiAPIKey := secret("GEMINI_API_KEY")
+	if geminiAPIKey == "" {
+		geminiAPIKey = secret("GOOGLE_API_KEY")
+	}
+	aiConfig := AIConfig{
+		Backend:          strings.ToLower(getEnvOrDefault("AI_BACKEND", "genkit")),
+		APIKey:           geminiAPIKey,
+		StubFixturesFile: os.Getenv("AI_STUB_FIXTURES_FILE"),
+		Temperature:      getEnvFloat("AI_TEMPERATURE"),
+		TopP:             getEnvFloat("AI_TOP_P"),
+		MaxOutputTokens:  getEnvIntOrDefault("AI_MAX_OUTPUT_TOKENS", 0),
+	}
+
+	tlsConfig := TLSConfig{
+		CertFile:         os.Getenv("TLS_CERT_FILE"),
+		KeyFile:          os.Getenv("TLS_KEY_FILE"),
+		AutocertDomains:  getEnvListOrDefault("TLS_AUTOCERT_DOMAINS", nil),
+		AutocertCacheDir: getEnvOrDefault("TLS_AUTOCERT_CACHE_DIR", "autocert-cache"),
+		AutocertEmail:    os.Getenv("TLS_AUTOCERT_EMAIL"),
+		RedirectPort:     getEnvOrDefault("TLS_REDIRECT_PORT", "80"),
+	}
+	// Serving TLS itself means there is no proxy in front, so the app has to be
+	// reachable from outside unless BIND_ADDRESS says otherwise.
+	bindAddress := "127.0.0.1"
+	if tlsConfig.Enabled() {
+		bindAddress = ""
+	}
+	if value, ok := os.LookupEnv("BIND_ADDRESS"); ok {
+		bindAddress = strings.Trim(strings.TrimSpace(value), "[]")
+	}
+
+	resendBackoff, err := getEnvSecondsListOrDefault("EMAIL_VERIFICATION_RESEND_BACKOFF_SECONDS", []time.Duration{
+		30 * time.Second, time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour,
+	})
+	if err != nil {
+		loadErrs = append(loadErrs, err)
+	}
+
+	cfg := &Config{
+		BindAddress:     bindAddress,
+		Port:            port,
+		Env:             env,
+		LogLevel:        getEnvOrDefault("LOG_LEVEL", "info"),
+		LogRedactKeys:   getEnvListOrDefault("LOG_REDACT_KEYS", defaultLogRedactKeys),
+		ShutdownTimeout: time.Duration(getEnvIntOrDefault("SHUTDOWN_TIMEOUT_SECONDS", 30)) * time.Second,
+		ConfigMaxAge:    time.Duration(max(getEnvIntOrDefault("CONFIG_CACHE_MAX_AGE_SECONDS", 60), 0)) * time.Second,
+		MaxBodyBytes:    int64(getEnvIntOrDefault("MAX_REQUEST_BODY_BYTES", 1<<20)),
+		TLS:             tlsConfig,
+		Headers: HeadersConfig{
+			CSP:                   os.Getenv("SECURITY_CSP"),
+			CSPScriptSources:      getEnvListOrDefault("SECURITY_CSP_SCRIPT_SRC", nil),
+			CSPStyleSources:       getEnvListOrDefault("SECURITY_CSP_STYLE_SRC", nil),
+			CSPConnectSources:     getEnvListOrDefault("SECURITY_CSP_CONNECT_SRC", nil),
+			CSPImgSources:         getEnvListOrDefault("SECURITY_CSP_IMG_SRC", nil),
+			CSPFontSources:        getEnvListOrDefault("SECURITY_CSP_FONT_SRC", nil),
+			CSPFrameSources:       getEnvListOrDefault("SECURITY_CSP_FRAME_SRC", nil),
+			CSPReportOnly:         getEnvBoolOrDefault("SECURITY_CSP_REPORT_ONLY", false),
+			FrameOptions:          strings.ToUpper(getEnvOrDefault("SECURITY_FRAME_OPTIONS", "DENY")),
+			ReferrerPolicy:        getEnvOrDefault("SECURITY_REFERRER_POLICY", "strict-origin-when-cross-origin"),
+			PermissionsPolicy:     getEnvOrDefault("SECURITY_PERMISSIONS_POLICY", "camera=(), microphone=(), geolocation=()"),
+			HSTS:                  getEnvBoolOrDefault("SECURITY_HSTS", env == "production"),
+			HSTSMaxAge:            time.Duration(getEnvIntOrDefault("SECURITY_HSTS_MAX_AGE_SECONDS", 31536000)) * time.Second,
+			HSTSIncludeSubdomains: getEnvBoolOrDefault("SECURITY_HSTS_INCLUDE_SUBDOMAINS", true),
+		},
+		Compression: CompressionConfig{
+			Enabled:  getEnvBoolOrDefault("COMPRESSION_ENABLED", true),
+			MinBytes: max(getEnvIntOrDefault("COMPRESSION_MIN_BYTES", 1024), 0),
+		},
+		RequestTimeouts: RequestTimeoutConfig{
+			Auth:    time.Duration(max(getEnvIntOrDefault("REQUEST_TIMEOUT_AUTH_SECONDS", 15), 0)) * time.Second,
+			Recipes: time.Duration(max(getEnvIntOrDefault("REQUEST_TIMEOUT_RECIPES_SECONDS", 120), 0)) * time.Second,
+			Default: time.Duration(max(getEnvIntOrDefault("REQUEST_TIMEOUT_DEFAULT_SECONDS", 30), 0)) * time.Second,
+		},
+		ServerTimeouts: ServerTimeoutConfig{
+			ReadHeader: time.Duration(getEnvIntOrDefault("SERVER_READ_HEADER_TIMEOUT_SECONDS", 10)) * time.Second,
+			Read:       time.Duration(getEnvIntOrDefault("SERVER_READ_TIMEOUT_SECONDS", 60)) * time.Second,
+			Idle:       time.Duration(getEnvIntOrDefault("SERVER_IDLE_TIMEOUT_SECONDS", 120)) * time.Second,
+		},
 		Database: DatabaseConfig{
-			Host:     getEnvOrDefault("POSTGRES_HOST", "localhost"),
-			Port:     getEnvOrDefault("POSTGRES_PORT", "5432"),
-			User:     getEnvOrDefault("POSTGRES_USER", "app"),
-			Password: os.Getenv("POSTGRES_PASSWORD"),
-			Database: getEnvOrDefault("POSTGRES_DB", "app"),
-			SSLMode:  getEnvOrDefault("POSTGRES_SSLMODE", "disable"),
+			Host:            getEnvOrDefault("POSTGRES_HOST", "localhost"),
+			Port:            getEnvOrDefault("POSTGRES_PORT", "5432"),
+			User:            getEnvOrDefault("POSTGRES_USER", "app"),
+			Password:        secret("POSTGRES_PASSWORD"),
+			Database:        getEnvOrDefault("POSTGRES_DB", "app"),
+			SSLMode:         getEnvOrDefault("POSTGRES_SSLMODE", "disable"),
+			MaxConns:        int32(getEnvIntOrDefault("POSTGRES_MAX_CONNS", 0)),
+			MinConns:        int32(getEnvIntOrDefault("POSTGRES_MIN_CONNS", 0)),
+			MaxConnLifetime: time.Duration(getEnvIntOrDefault("POSTGRES_MAX_CONN_LIFETIME_SECONDS", 0)) * time.Second,
+			MaxConnIdleTime: time.Duration(getEnvIntOrDefault("POSTGRES_MAX_CONN_IDLE_TIME_SECONDS", 0)) * time.Second,
+			ConnectAttempts: getEnvIntOrDefault("POSTGRES_CONNECT_ATTEMPTS", 10),
+			ConnectTimeout:  time.Duration(getEnvIntOrDefault("POSTGRES_CONNECT_TIMEOUT_SECONDS", 60)) * time.Second,
+			AutoMigrate:     getEnvBoolOrDefault("AUTO_MIGRATE", false),
 		},
 		Valkey: ValkeyConfig{
 			Host:     getEnvOrDefault("VALKEY_HOST", "localhost"),
 			Port:     getEnvOrDefault("VALKEY_PORT", "6379"),
-			Password: os.Getenv("VALKEY_PASSWORD"),
+			Password: secret("VALKEY_PASSWORD"),
+			PoolSize: getEnvIntOrDefault("VALKEY_POOL_SIZE", 0),
 		},
 		RateLimit: rateLimitConfig,
 		Auth:      authConfig,
-		Google: GoogleOAuthConfig{
-			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-			RedirectURI:  os.Getenv("GOOGLE_REDIRECT_URI"),
-		},
+		Google:    googleConfig,
+		Apple:     appleConfig,
+		OIDC:      oidcConfig,
 		Audit: AuditConfig{
-			CleanupCron:   getEnvOrDefault("AUDIT_CLEANUP_CRON", "0 3 * * *"),
-			RetentionDays: getEnvIntOrDefault("AUDIT_RETENTION_DAYS", 90),
+			CleanupCron:        getEnvOrDefault("AUDIT_CLEANUP_CRON", "0 3 * * *"),
+			RetentionDays:      getEnvIntOrDefault("AUDIT_RETENTION_DAYS", 90),
+			RedactKeys:         getEnvListOrDefault("AUDIT_REDACT_KEYS", defaultAuditRedactKeys),
+			DropKeys:           getEnvListOrDefault("AUDIT_DROP_KEYS", defaultAuditDropKeys),
+			MetadataMaxBytes:   getEnvIntOrDefault("AUDIT_METADATA_MAX_BYTES", 4096),
+			ExportMaxRange:     time.Duration(getEnvIntOrDefault("AUDIT_EXPORT_MAX_DAYS", 31)) * 24 * time.Hour,
+			BatchSize:          getEnvIntOrDefault("AUDIT_BATCH_SIZE", 0),
+			BatchFlushInterval: time.Duration(getEnvIntOrDefault("AUDIT_BATCH_FLUSH_INTERVAL_MS", 250)) * time.Millisecond,
+			BatchBuffer:        getEnvIntOrDefault("AUDIT_BATCH_BUFFER", 1024),
+		},
+		IPFilter: IPFilterConfig{
+			Allow:         getEnvListOrDefault("IP_ALLOWLIST", nil),
+			Deny:          getEnvListOrDefault("IP_DENYLIST", nil),
+			Paths:         getEnvListOrDefault("IP_FILTER_PATHS", []string{"/api/auth/"}),
+			CountryHeader: os.Getenv("IP_FILTER_COUNTRY_HEADER"),
+			DenyCountries: getEnvListOrDefault("IP_DENY_COUNTRIES", nil),
 		},
 		Email: EmailConfig{
-			AppBaseURL:       appBaseURL,
-			ContactEmail:     os.Getenv("CONTACT_EMAIL"),
-			GmailAppPassword: os.Getenv("GMAIL_APP_PASSWORD"),
+			AppBaseURL:                     appBaseURL,
+			ContactEmail:                   os.Getenv("CONTACT_EMAIL"),
+			GmailAppPassword:               secret("GMAIL_APP_PASSWORD"),
+			VerificationResendPolicy:       strings.ToLower(strings.TrimSpace(getEnvOrDefault("EMAIL_VERIFICATION_RESEND_POLICY", VerificationResendRateLimit))),
+			VerificationResendBackoff:      resendBackoff,
+			VerificationResendBackoffReset: time.Duration(getEnvIntOrDefault("EMAIL_VERIFICATION_RESEND_BACKOFF_RESET_SECONDS", 86400)) * time.Second,
+			PostVerificationRedirectURL:    strings.TrimSpace(os.Getenv("EMAIL_POST_VERIFICATION_REDIRECT_URL")),
+			VerificationResendCooldown:     time.Duration(getEnvIntOrDefault("EMAIL_VERIFICATION_RESEND_COOLDOWN_SECONDS", 60)) * time.Second,
+			VerificationTokenGrace:         time.Duration(getEnvIntOrDefault("EMAIL_VERIFICATION_PREVIOUS_TOKEN_GRACE_SECONDS", 900)) * time.Second,
 		},
 		Storage: StorageConfig{
-			Endpoint:           strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
-			Region:             getEnvOrDefault("S3_REGION", "us-east-1"),
-			Bucket:             os.Getenv("S3_BUCKET"),
-			AccessKeyID:        os.Getenv("S3_ACCESS_KEY_ID"),
-			SecretAccessKey:    os.Getenv("S3_SECRET_ACCESS_KEY"),
-			ForcePathStyle:     getEnvBoolOrDefault("S3_FORCE_PATH_STYLE", true),
-			PresignUploadTTL:   time.Duration(getEnvIntOrDefault("S3_PRESIGN_UPLOAD_TTL_SECONDS", 900)) * time.Second,
-			PresignDownloadTTL: time.Duration(getEnvIntOrDefault("S3_PRESIGN_DOWNLOAD_TTL_SECONDS", 600)) * time.Second,
-			AvatarMaxBytes:     int64(getEnvIntOrDefault("S3_AVATAR_MAX_BYTES", 5*1024*1024)),
+			Backend:             strings.ToLower(getEnvOrDefault("STORAGE_BACKEND", "s3")),
+			LocalDir:            os.Getenv("STORAGE_LOCAL_DIR"),
+			LocalBaseURL:        strings.TrimRight(os.Getenv("STORAGE_LOCAL_BASE_URL"), "/"),
+			LocalSecret:         secret("STORAGE_LOCAL_SECRET"),
+			Endpoint:            strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+			Region:              getEnvOrDefault("S3_REGION", "us-east-1"),
+			Bucket:              os.Getenv("S3_BUCKET"),
+			AccessKeyID:         os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey:     secret("S3_SECRET_ACCESS_KEY"),
+			ForcePathStyle:      getEnvBoolOrDefault("S3_FORCE_PATH_STYLE", true),
+			PresignUploadTTL:    time.Duration(getEnvIntOrDefault("S3_PRESIGN_UPLOAD_TTL_SECONDS", 900)) * time.Second,
+			PresignDownloadTTL:  time.Duration(getEnvIntOrDefault("S3_PRESIGN_DOWNLOAD_TTL_SECONDS", 600)) * time.Second,
+			AvatarMaxBytes:      int64(getEnvIntOrDefault("S3_AVATAR_MAX_BYTES", 5*1024*1024)),
+			AvatarMaxDimension:  getEnvIntOrDefault("S3_AVATAR_MAX_DIMENSION", 4096),
+			MultipartPartSize:   int64(getEnvIntOrDefault("S3_MULTIPART_PART_SIZE", 5*1024*1024)),
+			AvatarThumbnailSize: getEnvIntOrDefault("S3_AVATAR_THUMBNAIL_SIZE", 0),
+			AvatarTranscodeWebP: getEnvBoolOrDefault("S3_AVATAR_TRANSCODE_WEBP", false),
+			AvatarQuality:       getEnvIntOrDefault("S3_AVATAR_QUALITY", 80),
+			MaxConcurrentOps:    getEnvIntOrDefault("S3_MAX_CONCURRENT_OPS", 32),
+			QueueTimeout:        time.Duration(getEnvIntOrDefault("S3_QUEUE_TIMEOUT_SECONDS", 5)) * time.Second,
+		},
+		Recipes: RecipesConfig{
+			Enabled:               getEnvBoolOrDefault("RECIPES_ENABLED", true) && aiConfig.Configured(),
+			MaxCount:              getEnvIntOrDefault("RECIPE_MAX_COUNT", 3),
+			MaxResponseBytes:      getEnvIntOrDefault("RECIPE_MAX_RESPONSE_BYTES", 64*1024),
+			MaxTitleLength:        getEnvIntOrDefault("RECIPE_MAX_TITLE_LENGTH", 200),
+			MaxInstructions:       getEnvIntOrDefault("RECIPE_MAX_INSTRUCTIONS", 30),
+			MaxIngredients:        getEnvIntOrDefault("RECIPE_MAX_INGREDIENTS", 40),
+			MaxIngredientLength:   getEnvIntOrDefault("RECIPE_MAX_INGREDIENT_LENGTH", 100),
+			MaxRestrictionsLength: getEnvIntOrDefault("RECIPE_MAX_DIETARY_RESTRICTIONS_LENGTH", 200),
+			CacheEnabled:          getEnvBoolOrDefault("RECIPE_CACHE_ENABLED", true),
+			CacheTTL:              time.Duration(getEnvIntOrDefault("RECIPE_CACHE_TTL_SECONDS", 86400)) * time.Second,
+			StreamTimeout:         time.Duration(max(getEnvIntOrDefault("RECIPE_STREAM_TIMEOUT_SECONDS", 60), 0)) * time.Second,
+			IngredientFilter:      getEnvOrDefault("RECIPE_INGREDIENT_FILTER", "off"),
+			IngredientTerms:       getEnvListOrDefault("RECIPE_INGREDIENT_TERMS", nil),
+			IngredientTermsFile:   os.Getenv("RECIPE_INGREDIENT_TERMS_FILE"),
 		},
+		AI: aiConfig,
+	}
+	cfg.loadErrs = loadErrs
+	return cfg
+}
+
+// Validate reports settings that would otherwise only fail at runtime, such as
+// an OAuth redirect URI Google will reject or send users to the wrong place.
+func (c *Config) Validate() error {
+	errs := append([]error(nil), c.loadErrs...)
+	if err := validateListenAddr(c.BindAddress, c.Port); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Env == "production" {
+		if c.Database.Password == "" {
+			errs = append(errs, errors.New("POSTGRES_PASSWORD: required in production"))
+		}
+		if !c.Auth.CookieSecure {
+			errs = append(errs, errors.New("AUTH_COOKIE_SECURE: must not be false in production"))
+		}
+	}
+	// A partial set leaves the feature silently disabled at runtime.
+	if err := requireTogether(
+		envVar{"GOOGLE_CLIENT_ID", c.Google.ClientID},
+		envVar{"GOOGLE_CLIENT_SECRET", c.Google.ClientSecret},
+		envVar{"GOOGLE_REDIRECT_URI", c.Google.RedirectURI},
+	); err != nil {
+		errs = append(errs, err)
+	}
+	if err := requireTogether(
+		envVar{"CONTACT_EMAIL", c.Email.ContactEmail},
+		envVar{"GMAIL_APP_PASSWORD", c.Email.GmailAppPassword},
+	); err != nil {
+		errs = append(errs, err)
+	}
+	if err := requireTogether(
+		envVar{"APPLE_CLIENT_ID", c.Apple.ClientID},
+		envVar{"APPLE_TEAM_ID", c.Apple.TeamID},
+		envVar{"APPLE_KEY_ID", c.Apple.KeyID},
+		envVar{"APPLE_PRIVATE_KEY", c.Apple.PrivateKey},
+		envVar{"APPLE_REDIRECT_URI", c.Apple.RedirectURI},
+	); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Apple.PrivateKey != "" {
+		if _, err := c.Apple.ParsePrivateKey(); err != nil {
+			errs = append(errs, fmt.Errorf("APPLE_PRIVATE_KEY: %w", err))
+		}
+	}
+	if c.Apple.RedirectURI != "" {
+		if err := validateAppleRedirectURI(c.Apple.RedirectURI); err != nil {
+			errs = append(errs, fmt.Errorf("APPLE_REDIRECT_URI: %w", err))
+		}
+		// Apple posts the callback from its own site, so the state cookies must be
+		// SameSite=None, which browsers only accept on Secure cookies.
+		if !c.Auth.CookieSecure {
+			errs = append(errs, errors.New("APPLE_REDIRECT_URI: Sign in with Apple requires AUTH_COOKIE_SECURE=true"))
+		}
+	}
+	if err := requireTogether(
+		envVar{"OIDC_ISSUER", c.OIDC.Issuer},
+		envVar{"OIDC_CLIENT_ID", c.OIDC.ClientID},
+		envVar{"OIDC_CLIENT_SECRET", c.OIDC.ClientSecret},
+	); err != nil {
+		errs = append(errs, err)
+	}
+	if c.OIDC.Enabled() {
+		if err := validateOIDC(c.OIDC); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Google.RedirectURI != "" {
+		if err := validateRedirectURI(c.Google, c.Email.AppBaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("GOOGLE_REDIRECT_URI: %w", err))
+		}
+	}
+	for _, prefix := range c.Auth.VerifiedEmailPaths {
+		if !strings.HasPrefix(prefix, "/") || strings.ContainsAny(prefix, "?#") {
+			errs = append(errs, fmt.Errorf("AUTH_VERIFIED_EMAIL_PATHS: %q must be a path starting with /", prefix))
+		}
+	}
+	for _, prefix := range c.Auth.ReturnPathPrefixes {
+		if !strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") || strings.ContainsAny(prefix, "?#\\") {
+			errs = append(errs, fmt.Errorf("AUTH_POST_LOGIN_REDIRECT_PREFIXES: %q must be a path starting with a single /", prefix))
+		}
+	}
+	if c.Email.PostVerificationRedirectURL != "" && len(c.Auth.ReturnPathPrefixes) == 0 {
+		errs = append(errs, errors.New("EMAIL_POST_VERIFICATION_REDIRECT_URL: requires AUTH_POST_LOGIN_REDIRECT_PREFIXES to allow its path"))
+	}
+	if c.Database.ConnectAttempts < 1 {
+		errs = append(errs, fmt.Errorf("POSTGRES_CONNECT_ATTEMPTS: %d must be at least 1", c.Database.ConnectAttempts))
+	}
+	if c.Audit.MetadataMaxBytes != 0 && c.Audit.MetadataMaxBytes < 256 {
+		errs = append(errs, fmt.Errorf("AUDIT_METADATA_MAX_BYTES: %d must be 0 (no cap) or at least 256", c.Audit.MetadataMaxBytes))
+	}
+	if c.Audit.ExportMaxRange <= 0 {
+		errs = append(errs, errors.New("AUDIT_EXPORT_MAX_DAYS: must be at least 1"))
+	}
+	if c.Audit.BatchSize < 0 {
+		errs = append(errs, fmt.Errorf("AUDIT_BATCH_SIZE: %d must not be negative", c.Audit.BatchSize))
+	} else if c.Audit.BatchSize > 0 {
+		if c.Audit.BatchFlushInterval <= 0 {
+			errs = append(errs, errors.New("AUDIT_BATCH_FLUSH_INTERVAL_MS: must be at least 1 when AUDIT_BATCH_SIZE is set"))
+		}
+		if c.Audit.BatchBuffer < c.Audit.BatchSize {
+			errs = append(errs, fmt.Errorf("AUDIT_BATCH_BUFFER: %d must be at least AUDIT_BATCH_SIZE (%d)", c.Audit.BatchBuffer, c.Audit.BatchSize))
+		}
+	}
+	errs = append(errs, c.RateLimit.validateAlgorithms()...)
+	if c.RateLimit.User.Limit < 0 {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_USER_LIMIT: %d must not be negative", c.RateLimit.User.Limit))
+	}
+	if c.Valkey.PoolSize < 0 {
+		errs = append(errs, fmt.Errorf("VALKEY_POOL_SIZE: %d must not be negative", c.Valkey.PoolSize))
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT_SECONDS", c.ServerTimeouts.ReadHeader},
+		{"SERVER_READ_TIMEOUT_SECONDS", c.ServerTimeouts.Read},
+		{"SERVER_IDLE_TIMEOUT_SECONDS", c.ServerTimeouts.Idle},
+	} {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Errorf("%s: %d must not be negative", timeout.name, int(timeout.value/time.Second)))
+		}
+	}
+	if c.MaxBodyBytes < 1 {
+		errs = append(errs, fmt.Errorf("MAX_REQUEST_BODY_BYTES: %d must be at least 1", c.MaxBodyBytes))
+	}
+	if c.Database.ConnectTimeout < 0 {
+		errs = append(errs, errors.New("POSTGRES_CONNECT_TIMEOUT_SECONDS: must not be negative"))
+	}
+	if p := c.Email.VerificationResendPolicy; p != VerificationResendRateLimit && p != VerificationResendBackoff {
+		errs = append(errs, fmt.Errorf("EMAIL_VERIFICATION_RESEND_POLICY: unknown policy %q (want %s or %s)", p, VerificationResendRateLimit, VerificationResendBackoff))
+	}
+	if c.Email.VerificationResendCooldown < 0 {
+		errs = append(errs, errors.New("EMAIL_VERIFICATION_RESEND_COOLDOWN_SECONDS: must not be negative"))
+	}
+	if c.Email.VerificationTokenGrace < 0 {
+		errs = append(errs, errors.New("EMAIL_VERIFICATION_PREVIOUS_TOKEN_GRACE_SECONDS: must not be negative"))
+	}
+	if c.Auth.SessionTokenBytes < 16 || c.Auth.SessionTokenBytes > 128 {
+		errs = append(errs, fmt.Errorf("AUTH_SESSION_TOKEN_BYTES: %d is outside 16-128", c.Auth.SessionTokenBytes))
+	}
+	if c.Auth.SessionCacheTTL < 0 {
+		errs = append(errs, errors.New("AUTH_SESSION_CACHE_TTL_SECONDS: must not be negative"))
+	}
+	if c.Auth.LastActiveInterval < 0 {
+		errs = append(errs, errors.New("AUTH_LAST_ACTIVE_INTERVAL_SECONDS: must not be negative"))
+	} else if c.Auth.IdleTimeout > 0 && c.Auth.LastActiveInterval >= c.Auth.IdleTimeout {
+		errs = append(errs, fmt.Errorf("AUTH_LAST_ACTIVE_INTERVAL_SECONDS: %s must be shorter than the idle timeout (%s)", c.Auth.LastActiveInterval, c.Auth.IdleTimeout))
+	}
+	// Every remembered hash costs one Argon2 verification per password change.
+	if c.Auth.PasswordHistory < 0 || c.Auth.PasswordHistory > 24 {
+		errs = append(errs, fmt.Errorf("AUTH_PASSWORD_HISTORY: %d is outside 0-24", c.Auth.PasswordHistory))
+	}
+	if err := validateKeyRing("AUTH_TOKEN_PEPPER", c.Auth.TokenPepper, c.Auth.TokenPepperPrevious); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateKeyRing("GOOGLE_OAUTH_STATE_KEY", c.Google.StateKey, c.Google.StateKeyPrevious); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.Auth.validateSessionMode()...)
+	errs = append(errs, c.Auth.validateSessionCookie()...)
+	if s := c.Auth.ExistingSession; s != "" && s != ExistingSessionRotate && s != ExistingSessionAdd {
+		errs = append(errs, fmt.Errorf("AUTH_EXISTING_SESSION: unknown value %q (want %s or %s)", s, ExistingSessionRotate, ExistingSessionAdd))
+	}
+	switch c.Auth.FetchMetadata {
+	case FetchMetadataEnforce, FetchMetadataReport, FetchMetadataOff:
+	default:
+		errs = append(errs, fmt.Errorf("AUTH_FETCH_METADATA_POLICY: unknown policy %q (want %s, %s or %s)", c.Auth.FetchMetadata, FetchMetadataEnforce, FetchMetadataReport, FetchMetadataOff))
+	}
+	switch c.Auth.PasswordPolicy {
+	case PasswordPolicyRules, PasswordPolicyEntropy, PasswordPolicyBoth:
+	default:
+		errs = append(errs, fmt.Errorf("AUTH_PASSWORD_POLICY: unknown policy %q (want %s, %s or %s)", c.Auth.PasswordPolicy, PasswordPolicyRules, PasswordPolicyEntropy, PasswordPolicyBoth))
+	}
+	if c.Auth.PasswordMinScore < 0 || c.Auth.PasswordMinScore > 4 {
+		errs = append(errs, fmt.Errorf("AUTH_PASSWORD_MIN_SCORE: %d is outside 0-4", c.Auth.PasswordMinScore))
+	}
+	if err := validateDenyPolicy("AUTH_DENY_POLICY", c.Auth.UserDenyPolicy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateDenyPolicy("AUTH_ADMIN_DENY_POLICY", c.Auth.AdminDenyPolicy); err != nil {
+		errs = append(errs, err)
+	}
+	if s := c.Google.StateStore; s != OAuthStateStoreCookie && s != OAuthStateStoreValkey {
+		errs = append(errs, fmt.Errorf("GOOGLE_OAUTH_STATE_STORE: unknown store %q (want %s or %s)", s, OAuthStateStoreCookie, OAuthStateStoreValkey))
+	}
+	if _, _, err := c.IPFilter.Prefixes(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.Auth.TrustedProxy.Prefixes(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateHeaders(c.Headers); err != nil {
+		errs = append(errs, err)
+	}
+	if c.TLS.Enabled() {
+		if err := validateTLS(c.TLS, c.Port); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.IPFilter.CountryHeader != "" && !c.Auth.TrustedProxy.Enabled() {
+		errs = append(errs, errors.New("IP_FILTER_COUNTRY_HEADER: requires a trusted proxy (TRUSTED_PROXY_COUNT or TRUSTED_PROXY_CIDRS), or clients could set the header themselves"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateHeaders checks the security header settings. CSP sources are single
+// tokens such as https://cdn.example.com or 'unsafe-inline'; whitespace or a
+// semicolon in one would splice in another source or directive.
+func validateHeaders(h HeadersConfig) error {
+	var errs []error
+	if strings.ContainsAny(h.CSP, "\r\n") {
+		errs = append(errs, errors.New("SECURITY_CSP: must be a single line"))
+	}
+	for _, list := range []struct {
+		name    string
+		sources []string
+	}{
+		{"SECURITY_CSP_SCRIPT_SRC", h.CSPScriptSources},
+		{"SECURITY_CSP_STYLE_SRC", h.CSPStyleSources},
+		{"SECURITY_CSP_CONNECT_SRC", h.CSPConnectSources},
+		{"SECURITY_CSP_IMG_SRC", h.CSPImgSources},
+		{"SECURITY_CSP_FONT_SRC", h.CSPFontSources},
+		{"SECURITY_CSP_FRAME_SRC", h.CSPFrameSources},
+	} {
+		for _, source := range list.sources {
+			if strings.ContainsAny(source, " \t\r\n;") {
+				errs = append(errs, fmt.Errorf("%s: invalid source %q", list.name, source))
+			}
+		}
+	}
+	if h.FrameOptions != "DENY" && h.FrameOptions != "SAMEORIGIN" {
+		errs = append(errs, fmt.Errorf("SECURITY_FRAME_OPTIONS: unknown value %q (want DENY or SAMEORIGIN)", h.FrameOptions))
+	}
+	if strings.ContainsAny(h.ReferrerPolicy+h.PermissionsPolicy, "\r\n") {
+		errs = append(errs, errors.New("SECURITY_REFERRER_POLICY / SECURITY_PERMISSIONS_POLICY: must be a single line"))
+	}
+	if h.HSTS && h.HSTSMaxAge <= 0 {
+		errs = append(errs, errors.New("SECURITY_HSTS_MAX_AGE_SECONDS: must be positive when SECURITY_HSTS is on"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateListenAddr checks that BIND_ADDRESS is an IP address or host name and
+// PORT a port number, so a typo fails here instead of as a listen error.
+func validateListenAddr(host, port string) error {
+	var errs []error
+	if host != "" {
+		if _, err := netip.ParseAddr(host); err != nil && !validHostname(host) {
+			errs = append(errs, fmt.Errorf("BIND_ADDRESS: %q is not an IP address or host name", host))
+		}
+	}
+	if !validPort(port) {
+		errs = append(errs, fmt.Errorf("PORT: %q is not a port number", port))
+	}
+	return errors.Join(errs...)
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+// validHostname reports whether host is made of DNS labels of letters, digits
+// and hyphens.
+func validHostname(host string) bool {
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateTLS checks the built-in TLS settings, loading the certificate files so
+// a bad path or a mismatched key fails at startup rather than at the first
+// handshake.
+func validateTLS(t TLSConfig, port string) error {
+	var errs []error
+	if err := requireTogether(
+		envVar{"TLS_CERT_FILE", t.CertFile},
+		envVar{"TLS_KEY_FILE", t.KeyFile},
+	); err != nil {
+		errs = append(errs, err)
+	}
+	switch {
+	case t.Autocert() && (t.CertFile != "" || t.KeyFile != ""):
+		errs = append(errs, errors.New("TLS_AUTOCERT_DOMAINS: cannot be combined with TLS_CERT_FILE and TLS_KEY_FILE"))
+	case t.Autocert():
+		if t.RedirectPort == "" {
+			errs = append(errs, errors.New("TLS_REDIRECT_PORT: required with TLS_AUTOCERT_DOMAINS to answer ACME challenges"))
+		}
+		if t.AutocertCacheDir == "" {
+			errs = append(errs, errors.New("TLS_AUTOCERT_CACHE_DIR: required with TLS_AUTOCERT_DOMAINS"))
+		}
+	case t.CertFile != "" && t.KeyFile != "":
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("TLS_CERT_FILE: %w", err))
+		}
+	}
+	if t.RedirectPort != "" && !validPort(t.RedirectPort) {
+		errs = append(errs, fmt.Errorf("TLS_REDIRECT_PORT: %q is not a port number", t.RedirectPort))
+	}
+	if t.RedirectPort != "" && t.RedirectPort == port {
+		errs = append(errs, fmt.Errorf("TLS_REDIRECT_PORT: %s is already PORT", port))
+	}
+	return errors.Join(errs...)
+}
+
+type envVar struct {
+	name  string
+	value string
+}
+
+// requireTogether checks a group of variables that only work as a set: either
+// all of them are set or none are.
+func requireTogether(vars ...envVar) error {
+	names := make([]string, 0, len(vars))
+	var missing []string
+	for _, v := range vars {
+		names = append(names, v.name)
+		if strings.TrimSpace(v.value) == "" {
+			missing = append(missing, v.name)
+		}
+	}
+	if len(missing) == 0 || len(missing) == len(vars) {
+		return nil
+	}
+	return fmt.Errorf("%s: must be set together (missing %s)", strings.Join(names, ", "), strings.Join(missing, ", "))
+}
+
+// validateRedirectURI checks that redirectURI is an absolute URL with an allowed
+// scheme, on the app's host unless cfg.AllowRedirectHost is set, pointing at the
+// callback route.
+func validateRedirectURI(cfg GoogleOAuthConfig, appBaseURL string) error {
+	parsed, err := url.Parse(cfg.RedirectURI)
+	if err != nil {
+		return fmt.Errorf("not a valid URL: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("%q must be an absolute URL such as https://example.com%s", cfg.RedirectURI, googleCallbackPath)
+	}
+	if !containsFold(cfg.RedirectSchemes, parsed.Scheme) {
+		return fmt.Errorf("scheme %q is not allowed (GOOGLE_REDIRECT_SCHEMES=%s)", parsed.Scheme, strings.Join(cfg.RedirectSchemes, ","))
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("%q must not have a query or fragment", cfg.RedirectURI)
+	}
+	if !strings.HasSuffix(parsed.Path, googleCallbackPath) {
+		return fmt.Errorf("path %q must end in %s (check for a trailing slash)", parsed.Path, googleCallbackPath)
+	}
+	if !cfg.AllowRedirectHost {
+		base, err := url.Parse(appBaseURL)
+		if err != nil || base.Host == "" {
+			return fmt.Errorf("cannot compare with APP_BASE_URL %q; set GOOGLE_REDIRECT_ALLOW_OTHER_HOST=true to skip the check", appBaseURL)
+		}
+		if !strings.EqualFold(parsed.Hostname(), base.Hostname()) {
+			return fmt.Errorf("host %q does not match APP_BASE_URL host %q; set GOOGLE_REDIRECT_ALLOW_OTHER_HOST=true if this is intended", parsed.Hostname(), base.Hostname())
+		}
+	}
+	return nil
+}
+
+// validateAppleRedirectURI checks that redirectURI is an absolute https URL
+// pointing at the callback route; Apple refuses any other return URL.
+func validateAppleRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return fmt.Errorf("not a valid URL: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%q must be an absolute https URL such as https://example.com%s", redirectURI, appleCallbackPath)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("%q must not have a query or fragment", redirectURI)
+	}
+	if !strings.HasSuffix(parsed.Path, appleCallbackPath) {
+		return fmt.Errorf("path %q must end in %s (check for a trailing slash)", parsed.Path, appleCallbackPath)
+	}
+	return nil
+}
+
+// validateOIDC checks the issuer and redirect URI of the generic OpenID Connect
+// provider. The issuer itself is only contacted at first use.
+func validateOIDC(cfg OIDCConfig) error {
+	issuer, err := url.Parse(cfg.Issuer)
+	if err != nil || issuer.Host == "" || !containsFold(cfg.IssuerSchemes, issuer.Scheme) {
+		return fmt.Errorf("OIDC_ISSUER: %q must be an absolute %s URL", cfg.Issuer, strings.Join(cfg.IssuerSchemes, " or "))
+	}
+	if issuer.RawQuery != "" || issuer.Fragment != "" {
+		return fmt.Errorf("OIDC_ISSUER: %q must not have a query or fragment", cfg.Issuer)
+	}
+	redirect, err := url.Parse(cfg.RedirectURI)
+	if err != nil || redirect.Host == "" || !containsFold(cfg.IssuerSchemes, redirect.Scheme) {
+		return fmt.Errorf("OIDC_REDIRECT_URI: %q must be an absolute %s URL", cfg.RedirectURI, strings.Join(cfg.IssuerSchemes, " or "))
+	}
+	if !strings.HasSuffix(redirect.Path, oidcCallbackPath) {
+		return fmt.Errorf("OIDC_REDIRECT_URI: path %q must end in %s", redirect.Path, oidcCallbackPath)
+	}
+	if !slices.Contains(cfg.Scopes, "openid") {
+		return errors.New("OIDC_SCOPES: must include openid")
+	}
+	return nil
+}
+
+// minSecretLength is the shortest accepted HMAC secret, in bytes.
+const minSecretLength = 32
+
+// validateKeyRing checks a rotating secret: a primary named name plus previous
+// values in name_PREVIOUS, which are only meaningful alongside a primary.
+func validateKeyRing(name, primary string, previous []string) error {
+	if primary == "" {
+		if len(previous) > 0 {
+			return fmt.Errorf("%s_PREVIOUS: requires %s", name, name)
+		}
+		return nil
+	}
+	if len(primary) < minSecretLength {
+		return fmt.Errorf("%s: %d bytes is too short (want at least %d)", name, len(primary), minSecretLength)
+	}
+	return nil
+}
+
+// validateSessionMode checks the stateless session settings, which only
+// matter with AUTH_SESSION_MODE=jwt.
+func (c AuthConfig) validateSessionMode() []error {
+	switch c.SessionMode {
+	case SessionModeOpaque:
+		return nil
+	case SessionModeJWT:
+	default:
+		return []error{fmt.Errorf("AUTH_SESSION_MODE: unknown mode %q (want %s or %s)", c.SessionMode, SessionModeOpaque, SessionModeJWT)}
+	}
+
+	var errs []error
+	switch c.JWTAlgorithm {
+	case JWTAlgorithmHS256:
+		if c.JWTSecret == "" {
+			errs = append(errs, errors.New("AUTH_JWT_SECRET: required for HS256"))
+		} else if err := validateKeyRing("AUTH_JWT_SECRET", c.JWTSecret, c.JWTSecretPrevious); err != nil {
+			errs = append(errs, err)
+		}
+	case JWTAlgorithmEdDSA:
+		if _, err := c.ParseJWTPrivateKey(); err != nil {
+			errs = append(errs, fmt.Errorf("AUTH_JWT_PRIVATE_KEY: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("AUTH_JWT_ALGORITHM: unknown algorithm %q (want %s or %s)", c.JWTAlgorithm, JWTAlgorithmHS256, JWTAlgorithmEdDSA))
+	}
+	if c.JWTTTL <= 0 || c.JWTTTL >= c.SessionMaxAge {
+		errs = append(errs, fmt.Errorf("AUTH_JWT_TTL_SECONDS: %s must be positive and shorter than the session max age (%s)", c.JWTTTL, c.SessionMaxAge))
+	}
+	return errs
+}
+
+// validateSessionCookie checks the session cookie attributes. Go drops an
+// invalid Domain from the cookie without an error, so it is caught here.
+func (c AuthConfig) validateSessionCookie() []error {
+	var errs []error
+	if c.CookieDomain != "" {
+		parsed, err := url.Parse("//" + c.CookieDomain)
+		if err != nil || parsed.Host != c.CookieDomain || parsed.Port() != "" || net.ParseIP(c.CookieDomain) != nil {
+			errs = append(errs, fmt.Errorf("AUTH_COOKIE_DOMAIN: %q must be a host name such as example.com, without scheme, port or path", c.CookieDomain))
+		}
+	}
+	if !strings.HasPrefix(c.CookiePath, "/") || strings.ContainsAny(c.CookiePath, ";?#") {
+		errs = append(errs, fmt.Errorf("AUTH_COOKIE_PATH: %q must be a path starting with /", c.CookiePath))
+	}
+	if strings.HasPrefix(c.CookieName, "__Host-") && (c.CookieDomain != "" || c.CookiePath != "/") {
+		errs = append(errs, fmt.Errorf("AUTH_COOKIE_DOMAIN, AUTH_COOKIE_PATH: cookie %s cannot have a Domain or a Path other than /", c.CookieName))
+	}
+	// A SameSite=None cookie is sent with requests from any site, so the Fetch
+	// Metadata check is then the only thing refusing cross-site posts.
+	if c.CookieSameSite == http.SameSiteNoneMode {
+		if !c.CookieSecure {
+			errs = append(errs, errors.New("AUTH_COOKIE_SAMESITE: none requires AUTH_COOKIE_SECURE=true, browsers drop SameSite=None cookies that are not Secure"))
+		}
+		if c.FetchMetadata != FetchMetadataEnforce {
+			errs = append(errs, fmt.Errorf("AUTH_COOKIE_SAMESITE: none requires AUTH_FETCH_METADATA_POLICY=%s for CSRF protection", FetchMetadataEnforce))
+		}
+	}
+	return errs
+}
+
+// validateAlgorithms checks RATE_LIMIT_ALGORITHM and the per-rule overrides.
+// Rules that inherit an unknown default are not reported again.
+func (c RateLimitConfig) validateAlgorithms() []error {
+	known := func(algorithm string) bool {
+		return algorithm == RateLimitSliding || algorithm == RateLimitFixed || algorithm == RateLimitTokenBucket
+	}
+	var errs []error
+	if !known(c.Algorithm) {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_ALGORITHM: unknown algorithm %q (want %s, %s or %s)", c.Algorithm, RateLimitSliding, RateLimitFixed, RateLimitTokenBucket))
+	}
+	for _, rule := range []struct {
+		name string
+		rule RateLimitRule
+	}{
+		{"REGISTER", c.Register},
+		{"LOGIN", c.Login},
+		{"PASSWORD", c.Password},
+		{"VERIFY_EMAIL", c.VerifyEmailResend},
+		{"GOOGLE", c.Google},
+		{"LOGOUT", c.Logout},
+		{"API_KEY", c.APIKey},
+		{"ADMIN", c.Admin},
+		{"PASSWORD_CHECK", c.PasswordCheck},
+		{"USER", c.User},
+	} {
+		if rule.rule.Algorithm != c.Algorithm && !known(rule.rule.Algorithm) {
+			errs = append(errs, fmt.Errorf("RATE_LIMIT_%s_ALGORITHM: unknown algorithm %q (want %s, %s or %s)", rule.name, rule.rule.Algorithm, RateLimitSliding, RateLimitFixed, RateLimitTokenBucket))
+		}
+	}
+	return errs
+}
+
+func validateDenyPolicy(name, policy string) error {
+	if policy != DenyPolicyStatus && policy != DenyPolicyNotFound {
+		return fmt.Errorf("%s: unknown policy %q (want %s or %s)", name, policy, DenyPolicyStatus, DenyPolicyNotFound)
+	}
+	return nil
+}
+
+// defaultRedirectSchemes allows plain HTTP redirects outside production only.
+func defaultRedirectSchemes(env string) []string {
+	if env == "production" {
+		return []string{"https"}
+	}
+	return []string{"http", "https"}
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// oauthCookiePath returns the explicit path if set, otherwise the path of the redirect URI,
+// so the state cookies are only sent to the provider's callback.
+func oauthCookiePath(explicit, redirectURI, defaultValue string) string {
+	if strings.HasPrefix(explicit, "/") {
+		return explicit
+	}
+	if parsed, err := url.Parse(redirectURI); err == nil && strings.HasPrefix(parsed.Path, "/") {
+		return parsed.Path
+	}
+	return defaultValue
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func parseSameSite(value string, defaultValue http.SameSite) http.SameSite {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return defaultValue
 	}
 }
 
@@ -245,6 +1656,71 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvListOrDefault reads a comma-separated list, dropping empty entries.
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return splitList(value)
+}
+
+// splitList splits value on commas and newlines, dropping empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvSecondsListOrDefault reads a comma-separated list of positive second counts.
+// An invalid entry is an error naming key; the default is returned with it.
+func getEnvSecondsListOrDefault(key string, defaultValue []time.Duration) ([]time.Duration, error) {
+	items := getEnvListOrDefault(key, nil)
+	if len(items) == 0 {
+		return defaultValue, nil
+	}
+	durations := make([]time.Duration, 0, len(items))
+	for _, item := range items {
+		seconds, err := strconv.Atoi(item)
+		if err != nil || seconds <= 0 {
+			return defaultValue, fmt.Errorf("%s: %q is not a positive number of seconds", key, item)
+		}
+		durations = append(durations, time.Duration(seconds)*time.Second)
+	}
+	return durations, nil
+}
+
+// getEnvFloat returns nil when key is unset or not a number.
+func getEnvFloat(key string) *float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// getSecretEnv reads a sensitive setting from key, or when key is unset, from
+// the file named by key_FILE (trimmed), so Docker and Kubernetes secret mounts
+// can keep it out of the environment. key takes precedence when both are set.
+func getSecretEnv(key string) (string, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", key, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 func getEnvBool(key string) (bool, bool) {
 	value := os.Getenv(key)
 	if value == "" {
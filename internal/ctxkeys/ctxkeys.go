@@ -0,0 +1,91 @@
+// Package ctxkeys holds the values middleware attaches to a request context.
+// Each value has one typed setter and getter here, so handlers and middleware
+// in any package agree on the key and the type without sharing strings.
+package ctxkeys
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/mounis-bhat/starter/internal/domain"
+)
+
+// key is unexported, so no other package can build a colliding key.
+type key int
+
+const (
+	keyUser key = iota
+	keySession
+	keyAPIKey
+	keyRequestID
+	keyClientIP
+	keyCSPNonce
+)
+
+// WithUser attaches the authenticated user, from a session or an API key.
+func WithUser(ctx context.Context, user domain.SessionUser) context.Context {
+	return context.WithValue(ctx, keyUser, user)
+}
+
+// User returns the authenticated user set by WithUser.
+func User(ctx context.Context) (domain.SessionUser, bool) {
+	user, ok := ctx.Value(keyUser).(domain.SessionUser)
+	return user, ok
+}
+
+// WithSession attaches the session of a cookie-authenticated request.
+func WithSession(ctx context.Context, session *domain.SessionInfo) context.Context {
+	return context.WithValue(ctx, keySession, session)
+}
+
+// Session returns the session set by WithSession. Requests authenticated with
+// an API key have none.
+func Session(ctx context.Context) (*domain.SessionInfo, bool) {
+	session, ok := ctx.Value(keySession).(*domain.SessionInfo)
+	return session, ok
+}
+
+// WithAPIKey attaches the API key a request was authenticated with.
+func WithAPIKey(ctx context.Context, info *domain.APIKeyInfo) context.Context {
+	return context.WithValue(ctx, keyAPIKey, info)
+}
+
+// APIKey returns the API key set by WithAPIKey.
+func APIKey(ctx context.Context) (*domain.APIKeyInfo, bool) {
+	info, ok := ctx.Value(keyAPIKey).(*domain.APIKeyInfo)
+	return info, ok
+}
+
+// WithRequestID attaches the ID echoed in the X-Request-ID header.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, keyRequestID, requestID)
+}
+
+// RequestID returns the request ID, or "" outside a logged request.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(keyRequestID).(string)
+	return requestID
+}
+
+// WithClientIP attaches the client address resolved through the trusted
+// proxies.
+func WithClientIP(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, keyClientIP, ip)
+}
+
+// ClientIP returns the address set by WithClientIP.
+func ClientIP(ctx context.Context) (netip.Addr, bool) {
+	ip, ok := ctx.Value(keyClientIP).(netip.Addr)
+	return ip, ok
+}
+
+// WithCSPNonce attaches the nonce of the response's Content-Security-Policy.
+func WithCSPNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, keyCSPNonce, nonce)
+}
+
+// CSPNonce returns the CSP nonce, or "" when the policy has none.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(keyCSPNonce).(string)
+	return nonce
+}
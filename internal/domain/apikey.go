@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a session token.
+const APIKeyPrefix = "sk_"
+
+// API key scopes. Session-authenticated requests are not scoped.
+const (
+	ScopeRecipesGenerate = "recipes:generate"
+	ScopeRecipesRead     = "recipes:read"
+	ScopeProfileRead     = "profile:read"
+)
+
+// APIKeyScopes lists every scope a key can be granted.
+var APIKeyScopes = []string{ScopeRecipesGenerate, ScopeRecipesRead, ScopeProfileRead}
+
+const (
+	apiKeyDisplayLength = 8
+	apiKeyNameMaxLength = 100
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrAPIKeyExpired      = errors.New("api key expired")
+	ErrAPIKeyOwnerLocked  = errors.New("api key owner is locked")
+	ErrAPIKeyLimitReached = errors.New("api key limit reached")
+	ErrInvalidAPIKeyName  = errors.New("api key name must be 1-100 characters")
+	ErrInvalidAPIKeyScope = errors.New("api key scopes must be a non-empty list of known scopes")
+)
+
+// APIKeyInfo is the resolved identity behind a valid API key.
+type APIKeyInfo struct {
+	ID         pgtype.UUID
+	Name       string
+	LastUsedAt *time.Time
+	Scopes     []string
+	User       SessionUser
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKeyInfo) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+type APIKeyService struct {
+	queries    db.Querier
+	maxPerUser int
+}
+
+func NewAPIKeyService(queries db.Querier, maxPerUser int) *APIKeyService {
+	return &APIKeyService{
+		queries:    queries,
+		maxPerUser: maxPerUser,
+	}
+}
+
+// Create issues a new key for the user. The raw key is returned once and only its hash is stored.
+func (s *APIKeyService) Create(ctx context.Context, userID pgtype.UUID, name string, scopes []string, ttl time.Duration) (string, db.ApiKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > apiKeyNameMaxLength {
+		return "", db.ApiKey{}, ErrInvalidAPIKeyName
+	}
+
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", db.ApiKey{}, err
+	}
+
+	if s.maxPerUser > 0 {
+		count, err := s.queries.CountActiveUserAPIKeys(ctx, userID)
+		if err != nil {
+			return "", db.ApiKey{}, err
+		}
+		if count >= int64(s.maxPerUser) {
+			return "", db.ApiKey{}, ErrAPIKeyLimitReached
+		}
+	}
+
+	secret, err := generateToken(32)
+	if err != nil {
+		return "", db.ApiKey{}, err
+	}
+	rawKey := APIKeyPrefix + secret
+
+	expiresAt := pgtype.Timestamptz{}
+	if ttl > 0 {
+		expiresAt = pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true}
+	}
+
+	key, err := s.queries.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      name,
+		KeyPrefix: rawKey[:len(APIKeyPrefix)+apiKeyDisplayLength],
+		KeyHash:   HashToken(rawKey),
+		ExpiresAt: expiresAt,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return "", db.ApiKey{}, err
+	}
+
+	return rawKey, key, nil
+}
+
+// Validate resolves a raw key to its owner and records the use. Keys of a
+// locked account are refused with ErrAPIKeyOwnerLocked until the lock ends.
+func (s *APIKeyService) Validate(ctx context.Context, rawKey string) (*APIKeyInfo, error) {
+	if !strings.HasPrefix(rawKey, APIKeyPrefix) {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	row, err := s.queries.GetAPIKeyByHash(ctx, HashToken(rawKey))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	if row.ExpiresAt.Valid && row.ExpiresAt.Time.Before(time.Now()) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	if AccountLocked(row.UserLockedUntil, time.Now()) {
+		return nil, ErrAPIKeyOwnerLocked
+	}
+
+	if err := s.queries.TouchAPIKey(ctx, row.ID); err != nil {
+		return nil, err
+	}
+
+	info := &APIKeyInfo{
+		ID:     row.ID,
+		Name:   row.Name,
+		Scopes: row.Scopes,
+		User: SessionUser{
+			ID:            uuidToString(row.UserID_2),
+			Email:         row.UserEmail,
+			EmailVerified: row.UserEmailVerified,
+			Name:          row.UserName,
+			Picture:       textToPointer(row.UserPicture),
+			Provider:      row.UserProvider,
+			Role:          row.UserRole,
+		},
+	}
+	if row.LastUsedAt.Valid {
+		lastUsedAt := row.LastUsedAt.Time
+		info.LastUsedAt = &lastUsedAt
+	}
+	return info, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, userID pgtype.UUID) ([]db.ApiKey, error) {
+	return s.queries.ListUserAPIKeys(ctx, userID)
+}
+
+// Revoke revokes one of the user's keys. Keys owned by other users are reported as not found.
+func (s *APIKeyService) Revoke(ctx context.Context, userID, keyID pgtype.UUID) error {
+	affected, err := s.queries.RevokeAPIKey(ctx, db.RevokeAPIKeyParams{ID: keyID, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// normalizeScopes rejects unknown scopes and returns the rest sorted and deduplicated.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidAPIKeyScope
+	}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(APIKeyScopes, scope) {
+			return nil, ErrInvalidAPIKeyScope
+		}
+		normalized = append(normalized, scope)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// apiKeyQuerier serves one API key row by hash and counts touches.
+type apiKeyQuerier struct {
+	db.Querier
+	row     db.GetAPIKeyByHashRow
+	touches int
+}
+
+func (q *apiKeyQuerier) GetAPIKeyByHash(_ context.Context, keyHash string) (db.GetAPIKeyByHashRow, error) {
+	if keyHash != q.row.KeyHash {
+		return db.GetAPIKeyByHashRow{}, pgx.ErrNoRows
+	}
+	return q.row, nil
+}
+
+func (q *apiKeyQuerier) TouchAPIKey(context.Context, pgtype.UUID) error {
+	q.touches++
+	return nil
+}
+
+func TestAPIKeyValidateRefusesLockedOwner(t *testing.T) {
+	const rawKey = APIKeyPrefix + "secret"
+	tests := []struct {
+		name        string
+		lockedUntil pgtype.Timestamptz
+		wantErr     error
+	}{
+		{"not locked", pgtype.Timestamptz{}, nil},
+		{"lock expired", pgtype.Timestamptz{Time: time.Now().Add(-time.Minute), Valid: true}, nil},
+		{"failed-login lockout", pgtype.Timestamptz{Time: time.Now().Add(time.Minute), Valid: true}, ErrAPIKeyOwnerLocked},
+		{"indefinite admin lock", pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}, ErrAPIKeyOwnerLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := &apiKeyQuerier{row: db.GetAPIKeyByHashRow{
+				KeyHash:         HashToken(rawKey),
+				UserEmail:       "user@example.com",
+				UserLockedUntil: tt.lockedUntil,
+			}}
+			info, err := NewAPIKeyService(queries, 0).Validate(t.Context(), rawKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if info != nil || queries.touches != 0 {
+					t.Error("a refused key was returned or recorded as used")
+				}
+				return
+			}
+			if info.User.Email != "user@example.com" || queries.touches != 1 {
+				t.Errorf("Validate() = %+v with %d touches", info, queries.touches)
+			}
+		})
+	}
+}
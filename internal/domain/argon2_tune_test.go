@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Flags for BenchmarkArgon2/calibrated, passed after -args:
+//
+//	go test ./internal/domain -run '^$' -bench Argon2/calibrated -benchtime 5x -v -args -argon2.target 500ms
+var (
+	calibrateTarget      = flag.Duration("argon2.target", 500*time.Millisecond, "hash time BenchmarkArgon2/calibrated aims for")
+	calibrateMemory      = flag.Uint("argon2.memory", uint(DefaultArgon2Params.Memory), "starting memory in KiB; lowered if one pass is slower than -argon2.target")
+	calibrateParallelism = flag.Uint("argon2.parallelism", uint(DefaultArgon2Params.Parallelism), "threads per hash")
+)
+
+// argon2MinMemory is the lowest memory calibrateArgon2 will choose, in KiB. It is
+// the OWASP minimum for Argon2id (19 MiB).
+const argon2MinMemory = 19 * 1024
+
+// argon2MaxIterations bounds calibrateArgon2 on hosts fast enough that more
+// passes stop being a sensible way to spend the time budget.
+const argon2MaxIterations = 16
+
+// measureArgon2 returns the mean time of runs hashes with p on this host.
+func measureArgon2(p Argon2Params, runs int) time.Duration {
+	runs = max(runs, 1)
+	password := []byte("calibration-password")
+	salt := make([]byte, argon2SaltLength)
+	start := time.Now()
+	for range runs {
+		_ = argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
+	}
+	return time.Since(start) / time.Duration(runs)
+}
+
+// calibrateArgon2 picks parameters whose hash takes about target on this host,
+// starting from base. It keeps base's memory and parallelism and raises the
+// iterations while the hash is faster than target. If a single pass is already
+// slower, it halves the memory instead, down to argon2MinMemory. It returns the
+// parameters and their measured time.
+func calibrateArgon2(target time.Duration, base Argon2Params, runs int) (Argon2Params, time.Duration) {
+	params := base
+	params.Iterations = 1
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2Params.Memory
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2Params.Parallelism
+	}
+
+	elapsed := measureArgon2(params, runs)
+	for elapsed > target && params.Memory/2 >= argon2MinMemory {
+		params.Memory /= 2
+		elapsed = measureArgon2(params, runs)
+	}
+
+	for elapsed < target && params.Iterations < argon2MaxIterations {
+		next := params
+		next.Iterations++
+		nextElapsed := measureArgon2(next, runs)
+		if nextElapsed > target && target-elapsed < nextElapsed-target {
+			break
+		}
+		params, elapsed = next, nextElapsed
+	}
+	return params, elapsed
+}
+
+// BenchmarkArgon2 times one password hash, which is what every login, register
+// and password change pays, for the default cost, the OWASP minimum and
+// parameters calibrated to -argon2.target on this host. Run it on the hardware
+// that serves logins; numbers from a laptop do not carry over. With -v the
+// calibrated case logs AUTH_ARGON2_* lines to copy into the server environment.
+// Existing hashes keep verifying and are upgraded on the next successful login.
+func BenchmarkArgon2(b *testing.B) {
+	b.Run("default", func(b *testing.B) {
+		benchmarkHash(b, DefaultArgon2Params)
+	})
+	b.Run("owasp_min", func(b *testing.B) {
+		benchmarkHash(b, Argon2Params{Memory: argon2MinMemory, Iterations: 2, Parallelism: 1})
+	})
+	b.Run("calibrated", func(b *testing.B) {
+		if *calibrateTarget <= 0 || *calibrateMemory == 0 || *calibrateParallelism == 0 || *calibrateParallelism > 255 {
+			b.Fatal("-argon2.target, -argon2.memory and -argon2.parallelism must be positive, parallelism at most 255")
+		}
+		base := Argon2Params{Memory: uint32(*calibrateMemory), Parallelism: uint8(*calibrateParallelism)}
+		params, elapsed := calibrateArgon2(*calibrateTarget, base, 3)
+		b.Logf("m=%d t=%d p=%d took %s (target %s)", params.Memory, params.Iterations, params.Parallelism,
+			elapsed.Round(time.Millisecond), *calibrateTarget)
+		b.Logf("\nAUTH_ARGON2_MEMORY_KIB=%d\nAUTH_ARGON2_ITERATIONS=%d\nAUTH_ARGON2_PARALLELISM=%d",
+			params.Memory, params.Iterations, params.Parallelism)
+		benchmarkHash(b, params)
+	})
+}
+
+func benchmarkHash(b *testing.B, params Argon2Params) {
+	for b.Loop() {
+		if _, err := params.Hash("benchmark-password"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(params.Memory), "KiB")
+}
+
+func TestCalibrateArgon2LowersMemoryToTheFloor(t *testing.T) {
+	// No hash is this fast, so memory is halved while it stays at or above
+	// the OWASP floor and a single pass is kept.
+	params, _ := calibrateArgon2(time.Nanosecond, Argon2Params{Memory: 64 * 1024, Parallelism: 1}, 1)
+	want := Argon2Params{Memory: 32 * 1024, Iterations: 1, Parallelism: 1}
+	if params != want {
+		t.Errorf("calibrateArgon2() = %+v, want %+v", params, want)
+	}
+}
+
+func TestCalibrateArgon2CapsIterations(t *testing.T) {
+	// Every cost fits in an hour, so only argon2MaxIterations stops the search.
+	// The memory is below the floor, which only limits halving, to keep it quick.
+	params, _ := calibrateArgon2(time.Hour, Argon2Params{Memory: 1024, Parallelism: 1}, 1)
+	want := Argon2Params{Memory: 1024, Iterations: argon2MaxIterations, Parallelism: 1}
+	if params != want {
+		t.Errorf("calibrateArgon2() = %+v, want %+v", params, want)
+	}
+}
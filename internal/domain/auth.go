@@ -9,25 +9,90 @@ import (
 	"net/mail"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
 	"golang.org/x/crypto/argon2"
 )
 
 const (
 	passwordMinLength = 8
 	passwordMaxLength = 1000
-	argon2Memory      = 64 * 1024
-	argon2Iterations  = 3
-	argon2Parallelism = 4
 	argon2SaltLength  = 16
 	argon2KeyLength   = 32
 )
 
+// Argon2Params are the Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params are used for new hashes unless SetArgon2Params overrides them.
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 4}
+
+// argon2Target is the cost for new hashes; stored hashes below it need a rehash.
+var argon2Target = DefaultArgon2Params
+
+// SetArgon2Params sets the cost for new hashes, keeping the default for zero
+// fields. Call it once at startup, before any hashing.
+func SetArgon2Params(params Argon2Params) {
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2Params.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = DefaultArgon2Params.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2Params.Parallelism
+	}
+	argon2Target = params
+}
+
+const (
+	AuthMethodPassword = "password"
+	AuthMethodGoogle   = "google"
+	AuthMethodApple    = "apple"
+	AuthMethodOIDC     = "oidc"
+)
+
+// User roles, stored in users.role.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 var (
 	ErrInvalidEmail    = errors.New("invalid email")
 	ErrInvalidPassword = errors.New("invalid password")
 )
 
+// AuthMethods lists the ways a user can currently authenticate.
+func AuthMethods(user db.User) []string {
+	methods := make([]string, 0, 2)
+	if user.PasswordHash.Valid && user.PasswordHash.String != "" {
+		methods = append(methods, AuthMethodPassword)
+	}
+	if user.GoogleID.Valid && user.GoogleID.String != "" {
+		methods = append(methods, AuthMethodGoogle)
+	}
+	if user.Provider == AuthMethodApple || user.Provider == AuthMethodOIDC {
+		methods = append(methods, user.Provider)
+	}
+	return methods
+}
+
+// AccountLocked reports whether lockedUntil still locks an account at now. An
+// admin lock without a duration is stored as infinity.
+func AccountLocked(lockedUntil pgtype.Timestamptz, now time.Time) bool {
+	if !lockedUntil.Valid {
+		return false
+	}
+	return lockedUntil.InfinityModifier == pgtype.Infinity || lockedUntil.Time.After(now)
+}
+
 func NormalizeEmail(value string) (string, error) {
 	email := strings.TrimSpace(strings.ToLower(value))
 	if email == "" || len(email) > 255 {
@@ -39,40 +104,100 @@ func NormalizeEmail(value string) (string, error) {
 	return email, nil
 }
 
-func ValidatePassword(value string) error {
+// PasswordPolicy chooses how new passwords are checked. Length limits and the
+// common-password list always apply.
+type PasswordPolicy struct {
+	// Rules requires an uppercase letter, a number and a special character.
+	Rules bool
+	// MinScore rejects passwords whose EstimatePasswordStrength score is lower.
+	// Scores below passwordScoreFloor are rejected under every policy.
+	MinScore int
+}
+
+// passwordScoreFloor is the lowest score any policy accepts. Scores 0 and 1 are
+// under a million guesses, which rule-compliant passwords such as "Abcdefgh1!"
+// or "Jane.doe1!" (for jane.doe@...) still reach.
+const passwordScoreFloor = 2
+
+// RequiredScore is the lowest strength score the policy accepts.
+func (p PasswordPolicy) RequiredScore() int {
+	return max(p.MinScore, passwordScoreFloor)
+}
+
+// WeakPasswordError reports a password that the strength estimate rejected.
+type WeakPasswordError struct {
+	Strength PasswordEstimate
+	MinScore int
+}
+
+func (e *WeakPasswordError) Error() string {
+	return "password is too weak"
+}
+
+// Validate checks password against the policy. userInputs (email, name) count
+// against the strength estimate. Failures of the estimate are *WeakPasswordError.
+func (p PasswordPolicy) Validate(value string, userInputs ...string) error {
 	if len(value) < passwordMinLength {
 		return fmt.Errorf("password must be at least %d characters", passwordMinLength)
 	}
 	if len(value) > passwordMaxLength {
 		return fmt.Errorf("password must be at most %d characters", passwordMaxLength)
 	}
-	if !hasUppercase(value) {
-		return errors.New("password must include an uppercase letter")
-	}
-	if !hasNumber(value) {
-		return errors.New("password must include a number")
-	}
-	if !hasSpecial(value) {
-		return errors.New("password must include a special character")
+	if p.Rules {
+		if !hasUppercase(value) {
+			return errors.New("password must include an uppercase letter")
+		}
+		if !hasNumber(value) {
+			return errors.New("password must include a number")
+		}
+		if !hasSpecial(value) {
+			return errors.New("password must include a special character")
+		}
 	}
 	if isCommonPassword(value) {
 		return errors.New("password is too common")
 	}
+	if strength := EstimatePasswordStrength(value, userInputs...); strength.Score < p.RequiredScore() {
+		return &WeakPasswordError{Strength: strength, MinScore: p.RequiredScore()}
+	}
 	return nil
 }
 
+// HashPassword hashes password with the parameters set by SetArgon2Params.
 func HashPassword(password string) (string, error) {
+	return argon2Target.Hash(password)
+}
+
+// Hash hashes password with p. The parameters are encoded in the result, so
+// VerifyPassword keeps working after the target changes.
+func (p Argon2Params) Hash(password string) (string, error) {
 	salt := make([]byte, argon2SaltLength)
 	if _, err := rand.Read(salt); err != nil {
 		return "", err
 	}
-	hash := argon2.IDKey([]byte(password), salt, argon2Iterations, argon2Memory, argon2Parallelism, argon2KeyLength)
+	hash := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
-	encoded := fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", argon2Memory, argon2Iterations, argon2Parallelism, b64Salt, b64Hash)
+	encoded := fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", p.Memory, p.Iterations, p.Parallelism, b64Salt, b64Hash)
 	return encoded, nil
 }
 
+// NeedsRehash reports whether encoded should be replaced by a fresh HashPassword
+// after the password has been verified: it is not an Argon2id hash this package
+// understands, or its cost, salt or key length is below the current target.
+func NeedsRehash(encoded string) bool {
+	params, salt, hash, err := decodeArgon2idHash(encoded)
+	if err != nil {
+		return true
+	}
+	target := argon2Target
+	return params.memory < target.Memory ||
+		params.iterations < target.Iterations ||
+		params.parallelism < target.Parallelism ||
+		len(salt) < argon2SaltLength ||
+		len(hash) < argon2KeyLength
+}
+
 func VerifyPassword(password, encoded string) (bool, error) {
 	params, salt, hash, err := decodeArgon2idHash(encoded)
 	if err != nil {
@@ -88,7 +213,8 @@ func VerifyPassword(password, encoded string) (bool, error) {
 func FakePasswordHash(password string) {
 	salt := make([]byte, argon2SaltLength)
 	_, _ = rand.Read(salt)
-	_ = argon2.IDKey([]byte(password), salt, argon2Iterations, argon2Memory, argon2Parallelism, argon2KeyLength)
+	params := argon2Target
+	_ = argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, argon2KeyLength)
 }
 
 type argon2Params struct {
@@ -157,7 +283,7 @@ func parseArgon2Param(input, label string) (int, error) {
 
 func isCommonPassword(value string) bool {
 	candidate := strings.ToLower(value)
-	_, ok := commonPasswords[candidate]
+	_, ok := passwordWordRanks[candidate]
 	return ok
 }
 
@@ -188,70 +314,3 @@ func hasSpecial(value string) bool {
 	}
 	return false
 }
-
-var commonPasswords = map[string]struct{}{
-	"password1!":   {},
-	"password1@":   {},
-	"password1#":   {},
-	"password1$":   {},
-	"password12!":  {},
-	"password123!": {},
-	"welcome1!":    {},
-	"welcome123!":  {},
-	"welcome2024!": {},
-	"welcome2025!": {},
-	"qwerty123!":   {},
-	"qwerty123@":   {},
-	"qwerty123#":   {},
-	"qwerty123$":   {},
-	"qwerty12!":    {},
-	"admin123!":    {},
-	"admin123@":    {},
-	"admin123#":    {},
-	"admin123$":    {},
-	"letmein1!":    {},
-	"letmein123!":  {},
-	"letmein123@":  {},
-	"iloveyou1!":   {},
-	"iloveyou123!": {},
-	"monk3y123!":   {},
-	"dragon123!":   {},
-	"princess1!":   {},
-	"sunshine1!":   {},
-	"football1!":   {},
-	"baseball1!":   {},
-	"starwars1!":   {},
-	"trustno1!":    {},
-	"shadow123!":   {},
-	"master123!":   {},
-	"login123!":    {},
-	"passw0rd1!":   {},
-	"passw0rd1@":   {},
-	"passw0rd1#":   {},
-	"c0mputer1!":   {},
-	"c0mputer123!": {},
-	"n1nja123!":    {},
-	"n1nja2024!":   {},
-	"s0ccer123!":   {},
-	"hockey123!":   {},
-	"p@ssw0rd1":    {},
-	"p@ssword1":    {},
-	"p@ssword1!":   {},
-	"p@ssword123!": {},
-	"ch@ngeme1!":   {},
-	"default1!":    {},
-	"temppass1!":   {},
-	"temppass2@":   {},
-	"test1234!":    {},
-	"test12345!":   {},
-	"welcome12!":   {},
-	"welcome1234!": {},
-	"qwerty12@":    {},
-	"qwerty1234!":  {},
-	"admin2024!":   {},
-	"admin2025!":   {},
-	"user1234!":    {},
-	"user12345!":   {},
-	"user2024!":    {},
-	"user2025!":    {},
-}
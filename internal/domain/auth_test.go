@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestAccountLocked(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		lockedUntil pgtype.Timestamptz
+		want        bool
+	}{
+		{"never locked", pgtype.Timestamptz{}, false},
+		{"lock in force", pgtype.Timestamptz{Time: now.Add(time.Minute), Valid: true}, true},
+		{"lock expired", pgtype.Timestamptz{Time: now.Add(-time.Minute), Valid: true}, false},
+		{"indefinite admin lock", pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AccountLocked(tt.lockedUntil, now); got != tt.want {
+				t.Errorf("AccountLocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
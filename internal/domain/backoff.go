@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// ResendBackoff spaces out repeated sends of the same message. After the n-th send the
+// next one waits Schedule[n-1]; the last step repeats. A streak starts over once Reset
+// has passed without a send.
+type ResendBackoff struct {
+	Schedule []time.Duration
+	Reset    time.Duration
+}
+
+// NextAllowed returns when another send is allowed after attempts sends, the latest at lastSentAt.
+func (b ResendBackoff) NextAllowed(attempts int, lastSentAt time.Time) time.Time {
+	if attempts <= 0 || len(b.Schedule) == 0 {
+		return lastSentAt
+	}
+	if b.Reset > 0 && time.Since(lastSentAt) >= b.Reset {
+		return lastSentAt
+	}
+	step := min(attempts, len(b.Schedule)) - 1
+	return lastSentAt.Add(b.Schedule[step])
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// KeyRing holds a primary secret plus previous ones kept during a rotation: new
+// values are produced with the primary, and values produced with any key are
+// still accepted until the old key is removed from configuration.
+type KeyRing struct {
+	primary  []byte
+	previous [][]byte
+}
+
+// NewKeyRing returns a key ring for primary and previous. An empty primary gives
+// an empty ring; empty or duplicate previous entries are dropped.
+func NewKeyRing(primary string, previous []string) KeyRing {
+	var r KeyRing
+	if primary == "" {
+		return r
+	}
+	r.primary = []byte(primary)
+	for _, p := range previous {
+		if p != "" && p != primary {
+			r.previous = append(r.previous, []byte(p))
+		}
+	}
+	return r
+}
+
+// Empty reports whether no primary key is configured.
+func (r KeyRing) Empty() bool {
+	return r.primary == nil
+}
+
+// Sign returns the base64url HMAC-SHA256 of msg under the primary key.
+func (r KeyRing) Sign(msg string) string {
+	return base64.RawURLEncoding.EncodeToString(hmacSHA256(r.primary, msg))
+}
+
+// Verify reports whether sig is the HMAC of msg under any key in the ring.
+func (r KeyRing) Verify(msg, sig string) bool {
+	if r.Empty() {
+		return false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	for _, key := range r.keys() {
+		if hmac.Equal(raw, hmacSHA256(key, msg)) {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the primary key followed by the previous ones.
+func (r KeyRing) keys() [][]byte {
+	if r.Empty() {
+		return nil
+	}
+	return append([][]byte{r.primary}, r.previous...)
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,478 @@
+package domain
+
+import (
+	_ "embed"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// PasswordEstimate is a zxcvbn-style estimate: the password is split into the
+// cheapest sequence of guessable patterns (common words, repeats, sequences,
+// keyboard rows, years, the user's own details) plus brute-forced characters, and
+// the total guess count is mapped to a 0-4 score.
+type PasswordEstimate struct {
+	Score        int
+	GuessesLog10 float64
+	Warning      string
+	Suggestions  []string
+}
+
+// Score thresholds in log10 guesses, as in zxcvbn: below 10^3 is 0, below 10^6
+// is 1, below 10^8 is 2, below 10^10 is 3, anything else is 4.
+var passwordScoreThresholds = []float64{3, 6, 8, 10}
+
+const (
+	// bruteForceCardinality is the guesses per character not covered by a pattern.
+	bruteForceCardinality = 10
+	minPatternLength      = 3
+	minUserInputLength    = 3
+)
+
+type passwordPattern int
+
+const (
+	patternDictionary passwordPattern = iota
+	patternUserInput
+	patternRepeat
+	patternSequence
+	patternKeyboard
+	patternYear
+)
+
+type passwordMatch struct {
+	start, end   int // rune offsets, end exclusive
+	guessesLog10 float64
+	pattern      passwordPattern
+	rank         int
+	l33t         bool
+	capitalized  bool
+}
+
+// PasswordStrength returns the 0-4 score for value and feedback explaining a
+// low one, warning first.
+func PasswordStrength(value string) (score int, feedback []string) {
+	estimate := EstimatePasswordStrength(value)
+	return estimate.Score, estimate.Feedback()
+}
+
+// Feedback returns the warning, if any, followed by the suggestions.
+func (e PasswordEstimate) Feedback() []string {
+	if e.Warning == "" {
+		return e.Suggestions
+	}
+	return append([]string{e.Warning}, e.Suggestions...)
+}
+
+// EstimatePasswordStrength scores password. userInputs are values an attacker
+// targeting this account would try first, such as the email and name.
+func EstimatePasswordStrength(password string, userInputs ...string) PasswordEstimate {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return PasswordEstimate{Score: 0, Warning: "Enter a password."}
+	}
+
+	matches := findPasswordMatches(runes, userInputs)
+	path, guessesLog10 := cheapestPasswordPath(len(runes), matches)
+
+	score := len(passwordScoreThresholds)
+	for i, threshold := range passwordScoreThresholds {
+		if guessesLog10 < threshold {
+			score = i
+			break
+		}
+	}
+
+	strength := PasswordEstimate{Score: score, GuessesLog10: math.Round(guessesLog10*100) / 100}
+	strength.Warning, strength.Suggestions = passwordFeedback(score, path, len(runes))
+	return strength
+}
+
+func findPasswordMatches(runes []rune, userInputs []string) []passwordMatch {
+	lower := []rune(strings.ToLower(string(runes)))
+	unleeted := unleet(lower)
+
+	inputs := passwordUserInputs(userInputs)
+	var matches []passwordMatch
+	for i := 0; i < len(lower); i++ {
+		for j := i + minPatternLength; j <= len(lower); j++ {
+			word := string(lower[i:j])
+			plain := string(unleeted[i:j])
+			l33t := plain != word
+			capitalized := string(runes[i:j]) != word
+
+			if _, ok := inputs[plain]; ok {
+				matches = append(matches, dictionaryMatch(i, j, 1, patternUserInput, l33t, capitalized, runes[i:j]))
+			}
+			if rank, ok := passwordWordRanks[plain]; ok {
+				matches = append(matches, dictionaryMatch(i, j, rank, patternDictionary, l33t, capitalized, runes[i:j]))
+			}
+		}
+	}
+
+	matches = append(matches, repeatMatches(lower)...)
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, yearMatches(lower)...)
+	return matches
+}
+
+// passwordUserInputs splits user inputs into lowercased tokens, so that both
+// "jane.doe@example.com" and its "jane" and "doe" parts are matched.
+func passwordUserInputs(userInputs []string) map[string]struct{} {
+	inputs := make(map[string]struct{})
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			input = local
+		}
+		if len(input) >= minUserInputLength {
+			inputs[input] = struct{}{}
+		}
+		for _, part := range strings.FieldsFunc(input, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			if len(part) >= minUserInputLength {
+				inputs[part] = struct{}{}
+			}
+		}
+	}
+	return inputs
+}
+
+func dictionaryMatch(start, end, rank int, pattern passwordPattern, l33t, capitalized bool, original []rune) passwordMatch {
+	guesses := math.Log10(float64(rank))
+	if capitalized {
+		guesses += math.Log10(capitalizationVariations(original))
+	}
+	if l33t {
+		// Each common substitution roughly doubles the search space.
+		guesses += math.Log10(2)
+	}
+	return passwordMatch{
+		start:        start,
+		end:          end,
+		guessesLog10: max(guesses, 1),
+		pattern:      pattern,
+		rank:         rank,
+		l33t:         l33t,
+		capitalized:  capitalized,
+	}
+}
+
+// capitalizationVariations is how many casings an attacker tries before reaching
+// this one: a leading capital or all caps are the first guesses.
+func capitalizationVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if upper == len(word) || (upper == 1 && unicode.IsUpper(word[0])) || (upper == 1 && unicode.IsUpper(word[len(word)-1])) {
+		return 2
+	}
+	variations := 0.0
+	for k := 1; k <= upper; k++ {
+		variations += binomial(len(word), k)
+	}
+	return variations
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+func unleet(runes []rune) []rune {
+	out := make([]rune, len(runes))
+	for i, r := range runes {
+		if plain, ok := leetSubstitutions[r]; ok {
+			out[i] = plain
+		} else {
+			out[i] = r
+		}
+	}
+	return out
+}
+
+func repeatMatches(runes []rune) []passwordMatch {
+	var matches []passwordMatch
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		if j-i >= minPatternLength {
+			matches = append(matches, passwordMatch{
+				start:        i,
+				end:          j,
+				guessesLog10: math.Log10(charCardinality(runes[i]) * float64(j-i)),
+				pattern:      patternRepeat,
+			})
+		}
+		i = j
+	}
+	return matches
+}
+
+// sequenceMatches finds runs like "abc", "9876" or "aceg" with a constant step.
+func sequenceMatches(runes []rune) []passwordMatch {
+	var matches []passwordMatch
+	for i := 0; i+1 < len(runes); {
+		delta := runes[i+1] - runes[i]
+		j := i + 1
+		for j+1 < len(runes) && runes[j+1]-runes[j] == delta {
+			j++
+		}
+		if length := j - i + 1; length >= minPatternLength && delta != 0 && delta >= -5 && delta <= 5 {
+			// Sequences starting at an obvious character are tried first.
+			start := charCardinality(runes[i])
+			switch runes[i] {
+			case 'a', 'z', '0', '1', '9':
+				start = 4
+			}
+			guesses := start * float64(length)
+			if delta < 0 || delta > 1 {
+				guesses *= 2
+			}
+			matches = append(matches, passwordMatch{
+				start:        i,
+				end:          j + 1,
+				guessesLog10: math.Log10(guesses),
+				pattern:      patternSequence,
+			})
+		}
+		i = j
+	}
+	return matches
+}
+
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./", "qazwsxedcrfvtgbyhnujmikolp"}
+
+func keyboardMatches(runes []rune) []passwordMatch {
+	var matches []passwordMatch
+	for i := range runes {
+		for j := len(runes); j-i > minPatternLength; j-- {
+			token := string(runes[i:j])
+			if !onKeyboardRow(token) {
+				continue
+			}
+			matches = append(matches, passwordMatch{
+				start:        i,
+				end:          j,
+				guessesLog10: math.Log10(float64(len(keyboardRows)) * 2 * 44 * float64(j-i)),
+				pattern:      patternKeyboard,
+			})
+			break
+		}
+	}
+	return matches
+}
+
+func onKeyboardRow(token string) bool {
+	reversed := []rune(token)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	for _, row := range keyboardRows {
+		if strings.Contains(row, token) || strings.Contains(row, string(reversed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// yearMatches finds 19xx and 20xx years, which attackers try early.
+func yearMatches(runes []rune) []passwordMatch {
+	var matches []passwordMatch
+	for i := 0; i+4 <= len(runes); i++ {
+		token := string(runes[i : i+4])
+		if (strings.HasPrefix(token, "19") || strings.HasPrefix(token, "20")) && isDigits(token) {
+			matches = append(matches, passwordMatch{
+				start:        i,
+				end:          i + 4,
+				guessesLog10: math.Log10(150),
+				pattern:      patternYear,
+			})
+		}
+	}
+	return matches
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func charCardinality(r rune) float64 {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case r >= 'a' && r <= 'z':
+		return 26
+	case r >= 'A' && r <= 'Z':
+		return 26
+	default:
+		return 33
+	}
+}
+
+// cheapestPasswordPath picks the segmentation with the fewest total guesses.
+// Characters outside any match cost bruteForceCardinality each. As in zxcvbn,
+// the attacker also pays for not knowing the order of the parts, so the product
+// of the segment guesses is multiplied by the factorial of the segment count.
+func cheapestPasswordPath(length int, matches []passwordMatch) ([]passwordMatch, float64) {
+	byEnd := make([][]passwordMatch, length+1)
+	for _, m := range matches {
+		byEnd[m.end] = append(byEnd[m.end], m)
+	}
+
+	type step struct {
+		cost     float64
+		segments int
+		match    *passwordMatch
+		prev     int
+	}
+	steps := make([]step, length+1)
+	for end := 1; end <= length; end++ {
+		best := step{cost: math.Inf(1)}
+		for start := 0; start < end; start++ {
+			cost := steps[start].cost + float64(end-start)*math.Log10(bruteForceCardinality)
+			segments := steps[start].segments + 1
+			if better(cost, segments, best.cost, best.segments) {
+				best = step{cost: cost, segments: segments, prev: start}
+			}
+		}
+		for i := range byEnd[end] {
+			m := &byEnd[end][i]
+			cost := steps[m.start].cost + m.guessesLog10
+			segments := steps[m.start].segments + 1
+			if better(cost, segments, best.cost, best.segments) {
+				best = step{cost: cost, segments: segments, match: m, prev: m.start}
+			}
+		}
+		steps[end] = best
+	}
+
+	var path []passwordMatch
+	for end := length; end > 0; end = steps[end].prev {
+		if steps[end].match != nil {
+			path = append(path, *steps[end].match)
+		}
+	}
+	sort.Slice(path, func(i, j int) bool { return path[i].start < path[j].start })
+
+	return path, steps[length].cost + logFactorial(steps[length].segments)
+}
+
+func better(cost float64, segments int, bestCost float64, bestSegments int) bool {
+	total := cost + logFactorial(segments)
+	bestTotal := bestCost + logFactorial(bestSegments)
+	return total < bestTotal || (total == bestTotal && segments < bestSegments)
+}
+
+func logFactorial(n int) float64 {
+	total := 0.0
+	for k := 2; k <= n; k++ {
+		total += math.Log10(float64(k))
+	}
+	return total
+}
+
+// passwordFeedback explains a weak score using the match that contributed the
+// most to it.
+func passwordFeedback(score int, path []passwordMatch, length int) (string, []string) {
+	if score >= 3 {
+		return "", nil
+	}
+
+	suggestions := []string{"Add another word or two. Uncommon words are better."}
+	if len(path) == 0 {
+		if length < passwordMinLength {
+			return "This password is too short.", append(suggestions, "Use a longer passphrase.")
+		}
+		return "", suggestions
+	}
+
+	longest := path[0]
+	for _, m := range path[1:] {
+		if m.end-m.start > longest.end-longest.start {
+			longest = m
+		}
+	}
+
+	var warning string
+	switch longest.pattern {
+	case patternDictionary:
+		switch {
+		case longest.end-longest.start == length && longest.rank <= 10:
+			warning = "This is a top-10 common password."
+		case longest.end-longest.start == length:
+			warning = "This is a very common password."
+		default:
+			warning = "A common word by itself is easy to guess."
+		}
+	case patternUserInput:
+		warning = "Avoid using your name or email address."
+	case patternRepeat:
+		warning = `Repeats like "aaa" are easy to guess.`
+		suggestions = append(suggestions, "Avoid repeated words and characters.")
+	case patternSequence:
+		warning = "Sequences like abc or 6543 are easy to guess."
+		suggestions = append(suggestions, "Avoid sequences.")
+	case patternKeyboard:
+		warning = "Straight rows of keys are easy to guess."
+		suggestions = append(suggestions, "Use a longer keyboard pattern with more turns.")
+	case patternYear:
+		warning = "Recent years are easy to guess."
+		suggestions = append(suggestions, "Avoid years that are associated with you.")
+	}
+
+	for _, m := range path {
+		if m.capitalized {
+			suggestions = append(suggestions, "Capitalization doesn't help very much.")
+			break
+		}
+	}
+	for _, m := range path {
+		if m.l33t {
+			suggestions = append(suggestions, `Predictable substitutions like "@" instead of "a" don't help very much.`)
+			break
+		}
+	}
+	return warning, suggestions
+}
+
+// commonPasswordList is one password or password word per line, most common
+// first. Rank is the line number, roughly the guesses an attacker needs to reach it.
+//
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var passwordWordRanks = rankWords(strings.Fields(commonPasswordList))
+
+func rankWords(words []string) map[string]int {
+	ranks := make(map[string]int, len(words))
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}
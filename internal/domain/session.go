@@ -21,6 +21,17 @@ var (
 	ErrSessionExpired  = errors.New("session expired")
 )
 
+const (
+	// SessionTypeInteractive is a browser login subject to the idle timeout and the per-user session limit.
+	SessionTypeInteractive = "interactive"
+	// SessionTypeService is a long-lived programmatic session. It skips the idle timeout but still
+	// expires at its absolute expiry, and is only created through an explicit operator action.
+	SessionTypeService = "service"
+	// SessionTypeStateless is a signed token session that exists only in the
+	// token itself; see StatelessSessionService.
+	SessionTypeStateless = "stateless"
+)
+
 type SessionUser struct {
 	ID            string
 	Email         string
@@ -28,49 +39,136 @@ type SessionUser struct {
 	Name          string
 	Picture       *string
 	Provider      string
+	Role          string
 }
 
 type SessionInfo struct {
-	ID           pgtype.UUID
+	ID pgtype.UUID
+	// TokenHash identifies the session in logs and revocation. For stateless
+	// sessions it is the token's jti.
 	TokenHash    string
 	ExpiresAt    time.Time
 	LastActiveAt time.Time
-	User         SessionUser
+	CreatedAt    time.Time
+	// IdleExpiresAt is when the session ends without further activity, counted
+	// from this validation. It is zero for service sessions or when the idle
+	// timeout is off.
+	IdleExpiresAt time.Time
+	Type          string
+	// Persistent is false for sessions created without "remember me".
+	Persistent bool
+	User       SessionUser
+	// RenewedToken is set when validation issued a token to replace the one
+	// presented, which the caller must send back to the client.
+	RenewedToken string
+}
+
+// SessionManager is what handlers need from a session backend. SessionService
+// keeps sessions in Postgres; StatelessSessionService issues signed tokens.
+type SessionManager interface {
+	Lifetime(remember bool) SessionLifetime
+	CreateSession(ctx context.Context, userID pgtype.UUID, ipAddress *netip.Addr, userAgent string, lifetime SessionLifetime) (string, db.Session, error)
+	ValidateToken(ctx context.Context, token string) (*SessionInfo, error)
+	// RevokeToken ends the session of a raw token, if it has one.
+	RevokeToken(ctx context.Context, token string) error
+	// RevokeSession ends a session returned by ValidateToken.
+	RevokeSession(ctx context.Context, session *SessionInfo) error
+	RevokeUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error)
+	// EvictUserSessions makes the user's sessions pick up changed user fields,
+	// and drops cached state for sessions deleted from Postgres directly.
+	EvictUserSessions(ctx context.Context, userID pgtype.UUID)
+}
+
+// SessionLifetime sets how long an interactive session lasts and whether its
+// cookie outlives the browser.
+type SessionLifetime struct {
+	MaxAge     time.Duration
+	Persistent bool
+}
+
+// SessionCache holds session rows by token hash in front of Postgres. A miss
+// or an error falls back to the database, so the cache only has to be fast and
+// honor deletes: once Delete or DeleteUser returns, Get must not return the
+// deleted sessions, and Set must not bring them back.
+type SessionCache interface {
+	Get(ctx context.Context, tokenHash string) (db.GetSessionByTokenHashRow, bool, error)
+	Set(ctx context.Context, tokenHash string, row db.GetSessionByTokenHashRow) error
+	Delete(ctx context.Context, tokenHashes ...string) error
+	DeleteUser(ctx context.Context, userID pgtype.UUID) error
 }
 
 type SessionService struct {
-	queries       *db.Queries
-	sessionMaxAge time.Duration
-	idleTimeout   time.Duration
+	queries            db.Querier
+	sessionMaxAge      time.Duration
+	shortSessionMaxAge time.Duration
+	idleTimeout        time.Duration
+	tokens             SessionTokens
+	cache              SessionCache
+	lastActiveInterval time.Duration
 }
 
-func NewSessionService(queries *db.Queries, sessionMaxAge, idleTimeout time.Duration) *SessionService {
+// NewSessionService returns a service whose sessions end after idleTimeout
+// without requests. last_active_at is only written once it is
+// lastActiveInterval old, so a busy client does not cause a write per request;
+// the idle check allows the same interval of slack.
+func NewSessionService(queries db.Querier, sessionMaxAge, shortSessionMaxAge, idleTimeout, lastActiveInterval time.Duration, tokens SessionTokens) *SessionService {
 	return &SessionService{
-		queries:       queries,
-		sessionMaxAge: sessionMaxAge,
-		idleTimeout:   idleTimeout,
+		queries:            queries,
+		sessionMaxAge:      sessionMaxAge,
+		shortSessionMaxAge: shortSessionMaxAge,
+		idleTimeout:        idleTimeout,
+		lastActiveInterval: lastActiveInterval,
+		tokens:             tokens,
+	}
+}
+
+// UseCache puts cache in front of session lookups. With last_active_at
+// debounced, a request served from the cache usually makes no database call at
+// all. Cache errors are not returned: lookups fall back to Postgres, and a
+// failed delete leaves the entry until it expires.
+func (s *SessionService) UseCache(cache SessionCache) {
+	s.cache = cache
+}
+
+// Lifetime returns the lifetime for a login with or without "remember me".
+//
+// Remembered sessions get a persistent cookie and the full session max age, so a
+// stolen device or cookie jar stays signed in for days. Other sessions get a
+// browser-session cookie, dropped when the browser closes (unless it restores
+// sessions), and a short absolute expiry that bounds the damage either way. The
+// idle timeout applies to both.
+func (s *SessionService) Lifetime(remember bool) SessionLifetime {
+	if remember || s.shortSessionMaxAge <= 0 {
+		return SessionLifetime{MaxAge: s.sessionMaxAge, Persistent: true}
 	}
+	return SessionLifetime{MaxAge: min(s.shortSessionMaxAge, s.sessionMaxAge), Persistent: false}
 }
 
-func (s *SessionService) CreateSession(ctx context.Context, userID pgtype.UUID, ipAddress *netip.Addr, userAgent string) (string, db.Session, error) {
+func (s *SessionService) CreateSession(ctx context.Context, userID pgtype.UUID, ipAddress *netip.Addr, userAgent string, lifetime SessionLifetime) (string, db.Session, error) {
+	if lifetime.MaxAge <= 0 {
+		lifetime.MaxAge = s.sessionMaxAge
+	}
+
 	if err := s.enforceSessionLimit(ctx, userID, 5); err != nil {
 		return "", db.Session{}, err
 	}
 
-	token, err := generateToken(32)
+	token, err := generateToken(s.tokens.size())
 	if err != nil {
 		return "", db.Session{}, err
 	}
 
-	tokenHash := HashToken(token)
+	tokenHash := s.tokens.Hasher.Hash(token)
 	userAgentText := pgtype.Text{String: userAgent, Valid: userAgent != ""}
 
 	session, err := s.queries.CreateSession(ctx, db.CreateSessionParams{
-		UserID:    userID,
-		TokenHash: tokenHash,
-		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(s.sessionMaxAge), Valid: true},
-		IpAddress: ipAddress,
-		UserAgent: userAgentText,
+		UserID:      userID,
+		TokenHash:   tokenHash,
+		ExpiresAt:   pgtype.Timestamptz{Time: time.Now().Add(lifetime.MaxAge), Valid: true},
+		IpAddress:   ipAddress,
+		UserAgent:   userAgentText,
+		SessionType: SessionTypeInteractive,
+		Persistent:  lifetime.Persistent,
 	})
 	if err != nil {
 		return "", db.Session{}, err
@@ -83,8 +181,57 @@ func (s *SessionService) CreateSession(ctx context.Context, userID pgtype.UUID,
 	return token, session, nil
 }
 
-func (s *SessionService) RevokeUserSessions(ctx context.Context, userID pgtype.UUID) error {
-	return s.queries.DeleteUserSessions(ctx, userID)
+// CreateServiceSession creates a session that is exempt from the idle timeout and from the
+// interactive session limit. Callers are responsible for restricting who may create one.
+func (s *SessionService) CreateServiceSession(ctx context.Context, userID pgtype.UUID, maxAge time.Duration, description string) (string, db.Session, error) {
+	if maxAge <= 0 {
+		return "", db.Session{}, errors.New("service session max age must be positive")
+	}
+
+	token, err := generateToken(s.tokens.size())
+	if err != nil {
+		return "", db.Session{}, err
+	}
+
+	session, err := s.queries.CreateSession(ctx, db.CreateSessionParams{
+		UserID:      userID,
+		TokenHash:   s.tokens.Hasher.Hash(token),
+		ExpiresAt:   pgtype.Timestamptz{Time: time.Now().Add(maxAge), Valid: true},
+		UserAgent:   pgtype.Text{String: description, Valid: description != ""},
+		SessionType: SessionTypeService,
+		Persistent:  true,
+	})
+	if err != nil {
+		return "", db.Session{}, err
+	}
+
+	return token, session, nil
+}
+
+// RevokeUserSessions deletes every session of a user, service sessions
+// included, and returns how many there were.
+func (s *SessionService) RevokeUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	revoked, err := s.queries.DeleteUserSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	s.EvictUserSessions(ctx, userID)
+	return revoked, nil
+}
+
+// EvictUserSessions drops a user's sessions from the cache, for callers that
+// delete them from Postgres themselves, such as inside a transaction, or that
+// change the user fields cached with them.
+func (s *SessionService) EvictUserSessions(ctx context.Context, userID pgtype.UUID) {
+	if s.cache != nil {
+		_ = s.cache.DeleteUser(ctx, userID)
+	}
+}
+
+func (s *SessionService) evict(ctx context.Context, tokenHashes ...string) {
+	if s.cache != nil {
+		_ = s.cache.Delete(ctx, tokenHashes...)
+	}
 }
 
 func (s *SessionService) enforceSessionLimit(ctx context.Context, userID pgtype.UUID, limit int) error {
@@ -108,6 +255,7 @@ func (s *SessionService) enforceSessionLimit(ctx context.Context, userID pgtype.
 		if err := s.queries.DeleteSession(ctx, oldest.ID); err != nil {
 			return err
 		}
+		s.evict(ctx, oldest.TokenHash)
 	}
 }
 
@@ -116,8 +264,7 @@ func (s *SessionService) ValidateToken(ctx context.Context, token string) (*Sess
 		return nil, ErrSessionNotFound
 	}
 
-	tokenHash := HashToken(token)
-	row, err := s.queries.GetSessionByTokenHash(ctx, tokenHash)
+	row, tokenHash, cached, err := s.cachedLookup(ctx, token)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrSessionNotFound
@@ -130,25 +277,47 @@ func (s *SessionService) ValidateToken(ctx context.Context, token string) (*Sess
 		lastActiveAt = row.CreatedAt.Time
 	}
 
-	if s.idleTimeout > 0 && lastActiveAt.Add(s.idleTimeout).Before(time.Now()) {
+	// The stored last_active_at may trail the last request by up to
+	// lastActiveInterval, so that much is added as slack.
+	if row.SessionType != SessionTypeService && s.idleTimeout > 0 && lastActiveAt.Add(s.idleTimeout+s.lastActiveInterval).Before(time.Now()) {
 		_ = s.queries.DeleteSessionByTokenHash(ctx, tokenHash)
+		s.evict(ctx, tokenHash)
 		return nil, ErrSessionExpired
 	}
 
 	if row.ExpiresAt.Valid && row.ExpiresAt.Time.Before(time.Now()) {
 		_ = s.queries.DeleteSessionByTokenHash(ctx, tokenHash)
+		s.evict(ctx, tokenHash)
 		return nil, ErrSessionExpired
 	}
 
-	if err := s.queries.UpdateSessionLastActive(ctx, row.ID); err != nil {
-		return nil, err
+	if time.Since(lastActiveAt) >= s.lastActiveInterval {
+		if err := s.queries.UpdateSessionLastActive(ctx, row.ID); err != nil {
+			return nil, err
+		}
+		if s.cache != nil {
+			row.LastActiveAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+			cached = false
+		}
+	}
+	if s.cache != nil && !cached {
+		_ = s.cache.Set(ctx, tokenHash, row)
+	}
+
+	var idleExpiresAt time.Time
+	if row.SessionType != SessionTypeService && s.idleTimeout > 0 {
+		idleExpiresAt = time.Now().Add(s.idleTimeout)
 	}
 
 	return &SessionInfo{
-		ID:           row.ID,
-		TokenHash:    tokenHash,
-		ExpiresAt:    row.ExpiresAt.Time,
-		LastActiveAt: lastActiveAt,
+		ID:            row.ID,
+		TokenHash:     tokenHash,
+		ExpiresAt:     row.ExpiresAt.Time,
+		LastActiveAt:  lastActiveAt,
+		CreatedAt:     row.CreatedAt.Time,
+		IdleExpiresAt: idleExpiresAt,
+		Type:          row.SessionType,
+		Persistent:    row.Persistent,
 		User: SessionUser{
 			ID:            uuidToString(row.UserID_2),
 			Email:         row.UserEmail,
@@ -156,15 +325,80 @@ func (s *SessionService) ValidateToken(ctx context.Context, token string) (*Sess
 			Name:          row.UserName,
 			Picture:       textToPointer(row.UserPicture),
 			Provider:      row.UserProvider,
+			Role:          row.UserRole,
 		},
 	}, nil
 }
 
+// cachedLookup is lookup with the cache in front of it. cached reports whether
+// the row came from the cache.
+func (s *SessionService) cachedLookup(ctx context.Context, token string) (db.GetSessionByTokenHashRow, string, bool, error) {
+	if s.cache != nil {
+		tokenHash := s.tokens.Hasher.Hash(token)
+		if row, found, err := s.cache.Get(ctx, tokenHash); err == nil && found {
+			return row, tokenHash, true, nil
+		}
+	}
+	row, tokenHash, err := s.lookup(ctx, token)
+	return row, tokenHash, false, err
+}
+
+// lookup finds the session for token under the current hash, then under the
+// hashes of previous peppers. A session found under an old hash is rewritten to
+// the current one; the returned hash is the one the row is stored under.
+func (s *SessionService) lookup(ctx context.Context, token string) (db.GetSessionByTokenHashRow, string, error) {
+	tokenHash := s.tokens.Hasher.Hash(token)
+	row, err := s.queries.GetSessionByTokenHash(ctx, tokenHash)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return row, tokenHash, err
+	}
+
+	for _, oldHash := range s.tokens.Hasher.fallbacks(token) {
+		row, err = s.queries.GetSessionByTokenHash(ctx, oldHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return row, oldHash, err
+		}
+		// A failed rewrite leaves the old hash valid; it is retried next time.
+		if err := s.queries.UpdateSessionTokenHash(ctx, db.UpdateSessionTokenHashParams{ID: row.ID, TokenHash: tokenHash}); err != nil {
+			return row, oldHash, nil
+		}
+		return row, tokenHash, nil
+	}
+	return row, tokenHash, pgx.ErrNoRows
+}
+
+// RevokeToken deletes the session for a raw token under any accepted hash.
+func (s *SessionService) RevokeToken(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	tokenHashes := append([]string{s.tokens.Hasher.Hash(token)}, s.tokens.Hasher.fallbacks(token)...)
+	for _, tokenHash := range tokenHashes {
+		if err := s.queries.DeleteSessionByTokenHash(ctx, tokenHash); err != nil {
+			return err
+		}
+	}
+	s.evict(ctx, tokenHashes...)
+	return nil
+}
+
+// RevokeSession deletes the session ValidateToken returned.
+func (s *SessionService) RevokeSession(ctx context.Context, session *SessionInfo) error {
+	return s.RevokeByTokenHash(ctx, session.TokenHash)
+}
+
 func (s *SessionService) RevokeByTokenHash(ctx context.Context, tokenHash string) error {
 	if tokenHash == "" {
 		return nil
 	}
-	return s.queries.DeleteSessionByTokenHash(ctx, tokenHash)
+	if err := s.queries.DeleteSessionByTokenHash(ctx, tokenHash); err != nil {
+		return err
+	}
+	s.evict(ctx, tokenHash)
+	return nil
 }
 
 func HashToken(token string) string {
@@ -0,0 +1,340 @@
+package domain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+var errInvalidSessionToken = errors.New("invalid session token")
+
+// SessionDenylist records revoked stateless sessions. Check must fail rather
+// than report a session as allowed when the store cannot be read, since it is
+// the only place a revocation lives.
+type SessionDenylist interface {
+	// Deny refuses the session with id sessionID until until.
+	Deny(ctx context.Context, sessionID string, until time.Time) error
+	// DenyUser refuses every session of userID that started before at.
+	DenyUser(ctx context.Context, userID string, at time.Time) error
+	// RefreshUser makes sessions of userID issued before at reload the user.
+	RefreshUser(ctx context.Context, userID string, at time.Time) error
+	Check(ctx context.Context, sessionID, userID string) (SessionDenial, error)
+}
+
+// SessionDenial is what the denylist holds for one session and its user. Zero
+// times mean no entry.
+type SessionDenial struct {
+	Denied        bool
+	UserDeniedAt  time.Time
+	UserRefreshAt time.Time
+}
+
+// SessionSigner signs and verifies stateless session tokens as compact JWS.
+type SessionSigner struct {
+	alg  string
+	keys KeyRing
+	key  ed25519.PrivateKey
+}
+
+// NewHS256SessionSigner signs with secret. Tokens signed with a previous
+// secret still verify until it is removed.
+func NewHS256SessionSigner(secret string, previous []string) SessionSigner {
+	return SessionSigner{alg: "HS256", keys: NewKeyRing(secret, previous)}
+}
+
+// NewEdDSASessionSigner signs with an Ed25519 key.
+func NewEdDSASessionSigner(key ed25519.PrivateKey) SessionSigner {
+	return SessionSigner{alg: "EdDSA", key: key}
+}
+
+// sessionClaims is the payload of a stateless session token. The jti is the
+// session id and stays the same across renewals, so denying it ends them all.
+type sessionClaims struct {
+	Subject   string `json:"sub"`
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// AuthTime is when the session started, to the millisecond, so revoking a
+	// user's sessions does not also catch a login in the same second.
+	AuthTime float64 `json:"auth_time"`
+	// SessionExpiresAt is the session's absolute expiry; renewals stop there.
+	SessionExpiresAt int64   `json:"session_exp"`
+	Persistent       bool    `json:"persistent,omitempty"`
+	Email            string  `json:"email"`
+	EmailVerified    bool    `json:"email_verified"`
+	Name             string  `json:"name"`
+	Picture          *string `json:"picture,omitempty"`
+	Provider         string  `json:"provider"`
+	Role             string  `json:"role"`
+}
+
+func (s SessionSigner) sign(claims sessionClaims) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	if s.alg == "EdDSA" {
+		return signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(s.key, []byte(signed))), nil
+	}
+	return signed + "." + s.keys.Sign(signed), nil
+}
+
+// parse verifies token's signature and returns its claims. The header must
+// name the signer's algorithm, so a token cannot pick a weaker one. Expiry is
+// left to the caller.
+func (s SessionSigner) parse(token string) (sessionClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return sessionClaims{}, errInvalidSessionToken
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return sessionClaims{}, errInvalidSessionToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil || header.Alg != s.alg {
+		return sessionClaims{}, errInvalidSessionToken
+	}
+
+	signed := parts[0] + "." + parts[1]
+	if s.alg == "EdDSA" {
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || !ed25519.Verify(s.key.Public().(ed25519.PublicKey), []byte(signed), sig) {
+			return sessionClaims{}, errInvalidSessionToken
+		}
+	} else if !s.keys.Verify(signed, parts[2]) {
+		return sessionClaims{}, errInvalidSessionToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return sessionClaims{}, errInvalidSessionToken
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" || claims.Subject == "" {
+		return sessionClaims{}, errInvalidSessionToken
+	}
+	return claims, nil
+}
+
+// StatelessSessionService issues sessions as signed tokens that carry the user,
+// so validating one needs no database call. Each token lives for ttl; a client
+// that is still active gets a new one, reloaded from Postgres, once half of it
+// has passed, so ttl also acts as the idle timeout. Revocations are kept in the
+// denylist and take effect at once.
+//
+// Opaque tokens are passed to the database-backed service, so service sessions
+// and sessions from before the switch keep working.
+type StatelessSessionService struct {
+	sessions *SessionService
+	queries  db.Querier
+	signer   SessionSigner
+	denylist SessionDenylist
+	ttl      time.Duration
+}
+
+func NewStatelessSessionService(sessions *SessionService, queries db.Querier, signer SessionSigner, denylist SessionDenylist, ttl time.Duration) *StatelessSessionService {
+	return &StatelessSessionService{
+		sessions: sessions,
+		queries:  queries,
+		signer:   signer,
+		denylist: denylist,
+		ttl:      ttl,
+	}
+}
+
+func (s *StatelessSessionService) Lifetime(remember bool) SessionLifetime {
+	return s.sessions.Lifetime(remember)
+}
+
+// CreateSession signs a token for userID. Nothing is stored, so the per-user
+// session limit does not apply; the returned row is only a description.
+func (s *StatelessSessionService) CreateSession(ctx context.Context, userID pgtype.UUID, ipAddress *netip.Addr, userAgent string, lifetime SessionLifetime) (string, db.Session, error) {
+	if lifetime.MaxAge <= 0 {
+		lifetime.MaxAge = s.sessions.sessionMaxAge
+	}
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", db.Session{}, err
+	}
+
+	id := uuid.New()
+	now := time.Now()
+	expiresAt := now.Add(lifetime.MaxAge)
+	claims := sessionClaims{
+		ID:               id.String(),
+		AuthTime:         float64(now.UnixMilli()) / 1000,
+		SessionExpiresAt: expiresAt.Unix(),
+		Persistent:       lifetime.Persistent,
+	}
+	token, err := s.issue(&claims, user, now)
+	if err != nil {
+		return "", db.Session{}, err
+	}
+
+	return token, db.Session{
+		ID:           pgtype.UUID{Bytes: id, Valid: true},
+		UserID:       userID,
+		TokenHash:    claims.ID,
+		ExpiresAt:    pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		LastActiveAt: pgtype.Timestamptz{Time: now, Valid: true},
+		IpAddress:    ipAddress,
+		UserAgent:    pgtype.Text{String: userAgent, Valid: userAgent != ""},
+		CreatedAt:    pgtype.Timestamptz{Time: now, Valid: true},
+		SessionType:  SessionTypeStateless,
+		Persistent:   lifetime.Persistent,
+	}, nil
+}
+
+// issue fills the per-token claims of claims from user and now and signs it.
+func (s *StatelessSessionService) issue(claims *sessionClaims, user db.User, now time.Time) (string, error) {
+	claims.Subject = uuidToString(user.ID)
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = min(now.Add(s.ttl).Unix(), claims.SessionExpiresAt)
+	claims.Email = user.Email
+	claims.EmailVerified = user.EmailVerified
+	claims.Name = user.Name
+	claims.Picture = textToPointer(user.Picture)
+	claims.Provider = user.Provider
+	claims.Role = user.Role
+	return s.signer.sign(*claims)
+}
+
+func (s *StatelessSessionService) ValidateToken(ctx context.Context, token string) (*SessionInfo, error) {
+	if !isSessionJWT(token) {
+		return s.sessions.ValidateToken(ctx, token)
+	}
+	claims, err := s.signer.parse(token)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	now := time.Now()
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrSessionExpired
+	}
+
+	denial, err := s.denylist.Check(ctx, claims.ID, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	// Session start times only keep milliseconds, so a login in the same
+	// millisecond as the revocation survives it.
+	if denial.Denied || authTime(claims).Before(denial.UserDeniedAt.Truncate(time.Millisecond)) {
+		return nil, ErrSessionNotFound
+	}
+
+	var renewed string
+	stale := time.Unix(claims.IssuedAt, 0).Before(denial.UserRefreshAt)
+	halfway := now.Sub(time.Unix(claims.IssuedAt, 0)) >= s.ttl/2 && claims.ExpiresAt < claims.SessionExpiresAt
+	if stale || halfway {
+		user, err := s.queries.GetUserByID(ctx, uuidFromString(claims.Subject))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrSessionNotFound
+			}
+			return nil, err
+		}
+		if renewed, err = s.issue(&claims, user, now); err != nil {
+			return nil, err
+		}
+	}
+
+	id, _ := uuid.Parse(claims.ID)
+	return &SessionInfo{
+		ID:            pgtype.UUID{Bytes: id, Valid: true},
+		TokenHash:     claims.ID,
+		ExpiresAt:     time.Unix(claims.SessionExpiresAt, 0),
+		LastActiveAt:  time.Unix(claims.IssuedAt, 0),
+		CreatedAt:     authTime(claims),
+		IdleExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		Type:          SessionTypeStateless,
+		Persistent:    claims.Persistent,
+		User: SessionUser{
+			ID:            claims.Subject,
+			Email:         claims.Email,
+			EmailVerified: claims.EmailVerified,
+			Name:          claims.Name,
+			Picture:       claims.Picture,
+			Provider:      claims.Provider,
+			Role:          claims.Role,
+		},
+		RenewedToken: renewed,
+	}, nil
+}
+
+// RevokeToken denies the session of a signed token until its absolute expiry.
+// Tokens that do not verify have no session to revoke.
+func (s *StatelessSessionService) RevokeToken(ctx context.Context, token string) error {
+	if !isSessionJWT(token) {
+		return s.sessions.RevokeToken(ctx, token)
+	}
+	claims, err := s.signer.parse(token)
+	if err != nil {
+		return nil
+	}
+	return s.denylist.Deny(ctx, claims.ID, time.Unix(claims.SessionExpiresAt, 0))
+}
+
+func (s *StatelessSessionService) RevokeSession(ctx context.Context, session *SessionInfo) error {
+	if session.Type != SessionTypeStateless {
+		return s.sessions.RevokeSession(ctx, session)
+	}
+	return s.denylist.Deny(ctx, session.TokenHash, session.ExpiresAt)
+}
+
+// RevokeUserSessions deletes the user's database sessions and denies every
+// stateless one started until now. Only the deleted rows are counted, since
+// stateless sessions are not recorded anywhere.
+func (s *StatelessSessionService) RevokeUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	revoked, err := s.sessions.RevokeUserSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.denylist.DenyUser(ctx, uuidToString(userID), time.Now()); err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// EvictUserSessions also makes the user's stateless sessions reload the user on
+// their next request, instead of at the next renewal.
+func (s *StatelessSessionService) EvictUserSessions(ctx context.Context, userID pgtype.UUID) {
+	s.sessions.EvictUserSessions(ctx, userID)
+	_ = s.denylist.RefreshUser(ctx, uuidToString(userID), time.Now())
+}
+
+// isSessionJWT tells signed tokens from opaque ones, which are base64url and
+// never contain a dot.
+func isSessionJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func authTime(claims sessionClaims) time.Time {
+	return time.UnixMilli(int64(math.Round(claims.AuthTime * 1000)))
+}
+
+func uuidFromString(value string) pgtype.UUID {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return pgtype.UUID{}
+	}
+	return pgtype.UUID{Bytes: id, Valid: true}
+}
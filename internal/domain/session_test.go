@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// sessionQuerier serves one session row and counts last_active_at updates and
+// deletes.
+type sessionQuerier struct {
+	db.Querier
+	row               db.GetSessionByTokenHashRow
+	lastActiveUpdates int
+	deletes           int
+}
+
+func (q *sessionQuerier) GetSessionByTokenHash(_ context.Context, tokenHash string) (db.GetSessionByTokenHashRow, error) {
+	if tokenHash != q.row.TokenHash {
+		return db.GetSessionByTokenHashRow{}, pgx.ErrNoRows
+	}
+	return q.row, nil
+}
+
+func (q *sessionQuerier) UpdateSessionLastActive(context.Context, pgtype.UUID) error {
+	q.lastActiveUpdates++
+	q.row.LastActiveAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (q *sessionQuerier) DeleteSessionByTokenHash(context.Context, string) error {
+	q.deletes++
+	return nil
+}
+
+func TestValidateTokenDebouncesLastActive(t *testing.T) {
+	const token = "session-token"
+	const interval = time.Minute
+
+	tests := []struct {
+		name       string
+		lastActive time.Duration // how long ago the session was last active
+		validates  int
+		want       int
+	}{
+		{"inside the interval", interval / 2, 1, 0},
+		{"past the interval", interval + time.Second, 1, 1},
+		// The first request writes; the ones after it are inside the new interval.
+		{"repeated past the interval", interval + time.Second, 5, 1},
+		{"repeated inside the interval", interval / 2, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			queries := &sessionQuerier{row: db.GetSessionByTokenHashRow{
+				TokenHash:    HashToken(token),
+				ExpiresAt:    pgtype.Timestamptz{Time: now.Add(time.Hour), Valid: true},
+				LastActiveAt: pgtype.Timestamptz{Time: now.Add(-tt.lastActive), Valid: true},
+				CreatedAt:    pgtype.Timestamptz{Time: now.Add(-time.Hour), Valid: true},
+				SessionType:  SessionTypeInteractive,
+			}}
+			sessions := NewSessionService(queries, 24*time.Hour, time.Hour, 30*time.Minute, interval, SessionTokens{})
+
+			for range tt.validates {
+				if _, err := sessions.ValidateToken(t.Context(), token); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if queries.lastActiveUpdates != tt.want {
+				t.Errorf("UpdateSessionLastActive called %d times, want %d", queries.lastActiveUpdates, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTokenIdleTimeoutAllowsDebounceSlack(t *testing.T) {
+	const token = "session-token"
+	const idle = 30 * time.Minute
+	const interval = time.Minute
+
+	// last_active_at may trail the last request by up to the interval, so a
+	// session is only idle once both have passed.
+	for _, tt := range []struct {
+		lastActive time.Duration
+		wantErr    error
+	}{
+		{idle + interval/2, nil},
+		{idle + interval + time.Second, ErrSessionExpired},
+	} {
+		now := time.Now()
+		queries := &sessionQuerier{row: db.GetSessionByTokenHashRow{
+			TokenHash:    HashToken(token),
+			ExpiresAt:    pgtype.Timestamptz{Time: now.Add(time.Hour), Valid: true},
+			LastActiveAt: pgtype.Timestamptz{Time: now.Add(-tt.lastActive), Valid: true},
+			SessionType:  SessionTypeInteractive,
+		}}
+		sessions := NewSessionService(queries, 24*time.Hour, time.Hour, idle, interval, SessionTokens{})
+		if _, err := sessions.ValidateToken(t.Context(), token); !errors.Is(err, tt.wantErr) {
+			t.Errorf("last active %v ago: ValidateToken() error = %v, want %v", tt.lastActive, err, tt.wantErr)
+		}
+		if expired := tt.wantErr != nil; (queries.deletes == 1) != expired {
+			t.Errorf("last active %v ago: %d deletes, want the session deleted only if expired", tt.lastActive, queries.deletes)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package domain
+
+import "encoding/hex"
+
+const (
+	defaultSessionTokenBytes = 32
+	// minSessionTokenBytes keeps tokens at 128 bits of entropy or more.
+	minSessionTokenBytes = 16
+)
+
+// SessionTokens sets how session tokens are generated and stored. The zero value
+// gives 32-byte tokens stored as bare SHA-256, as before peppering existed.
+type SessionTokens struct {
+	// Bytes is the random token length before base64url encoding.
+	Bytes  int
+	Hasher TokenHasher
+}
+
+func (t SessionTokens) size() int {
+	if t.Bytes <= 0 {
+		return defaultSessionTokenBytes
+	}
+	return max(t.Bytes, minSessionTokenBytes)
+}
+
+// TokenHasher derives the stored token_hash of a session token. With a pepper
+// the hash is HMAC-SHA256(pepper, token), so leaked hashes cannot be checked
+// against guesses without the server-side secret.
+//
+// To rotate, move the old pepper to the previous list: sessions stored under it
+// (or as bare SHA-256 while unpeppered hashes are accepted) still validate, and
+// are rewritten to the current hash the next time they are used.
+type TokenHasher struct {
+	peppers          KeyRing
+	acceptUnpeppered bool
+}
+
+// NewTokenHasher returns a hasher for pepper. An empty pepper means bare
+// SHA-256. acceptUnpeppered keeps bare SHA-256 hashes valid after a pepper is
+// introduced; turn it off once the sessions created before have expired.
+func NewTokenHasher(pepper string, previous []string, acceptUnpeppered bool) TokenHasher {
+	return TokenHasher{peppers: NewKeyRing(pepper, previous), acceptUnpeppered: acceptUnpeppered}
+}
+
+// Hash returns the hash new and migrated sessions are stored under.
+func (h TokenHasher) Hash(token string) string {
+	if h.peppers.Empty() {
+		return HashToken(token)
+	}
+	return hex.EncodeToString(hmacSHA256(h.peppers.primary, token))
+}
+
+// fallbacks returns the older hashes token may still be stored under, most
+// recent pepper first.
+func (h TokenHasher) fallbacks(token string) []string {
+	if h.peppers.Empty() {
+		return nil
+	}
+	hashes := make([]string, 0, len(h.peppers.previous)+1)
+	for _, p := range h.peppers.previous {
+		hashes = append(hashes, hex.EncodeToString(hmacSHA256(p, token)))
+	}
+	if h.acceptUnpeppered {
+		hashes = append(hashes, HashToken(token))
+	}
+	return hashes
+}
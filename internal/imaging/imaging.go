@@ -0,0 +1,134 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	JPEGContentType = "image/jpeg"
+	WebPContentType = "image/webp"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image")
+	ErrAnimatedImage    = errors.New("animated images are not supported")
+)
+
+// Info describes an image without decoding its pixels.
+type Info struct {
+	Format string
+	Width  int
+	Height int
+}
+
+// Inspect reads the image header to determine its real format and dimensions.
+// Animated PNG and WebP payloads are rejected.
+func Inspect(data []byte) (Info, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if isAnimated(format, data) {
+		return Info{}, ErrAnimatedImage
+	}
+	return Info{Format: format, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// Decode parses a JPEG, PNG, or WebP image.
+func Decode(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	return img, format, nil
+}
+
+// TranscodeWebP decodes an image and re-encodes it as WebP at the given quality (0-100).
+func TranscodeWebP(data []byte, quality int) ([]byte, error) {
+	img, _, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWebP(img, quality)
+}
+
+// SquareThumbnail center-crops img to a square and scales it to size x size.
+func SquareThumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// EncodeJPEG encodes img as JPEG at the given quality (0-100).
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: clampQuality(quality)}); err != nil {
+		return nil, fmt.Errorf("encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func clampQuality(quality int) int {
+	if quality <= 0 || quality > 100 {
+		return 80
+	}
+	return quality
+}
+
+func isAnimated(format string, data []byte) bool {
+	switch format {
+	case "png":
+		return hasPNGAnimationControl(data)
+	case "webp":
+		return hasWebPAnimationFlag(data)
+	default:
+		return false
+	}
+}
+
+// hasPNGAnimationControl reports whether an acTL chunk appears before the image data (APNG).
+func hasPNGAnimationControl(data []byte) bool {
+	const signatureLength = 8
+	offset := signatureLength
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		chunkType := string(data[offset+4 : offset+8])
+		switch chunkType {
+		case "acTL":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+		offset += 12 + length
+	}
+	return false
+}
+
+// hasWebPAnimationFlag checks the animation bit of the extended (VP8X) header.
+func hasWebPAnimationFlag(data []byte) bool {
+	const (
+		chunkHeaderOffset = 12
+		flagsOffset       = 20
+		animationFlag     = 0x02
+	)
+	if len(data) <= flagsOffset || string(data[chunkHeaderOffset:chunkHeaderOffset+4]) != "VP8X" {
+		return false
+	}
+	return data[flagsOffset]&animationFlag != 0
+}
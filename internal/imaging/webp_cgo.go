@@ -0,0 +1,20 @@
+//go:build cgo
+
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+
+	"github.com/chai2010/webp"
+)
+
+// EncodeWebP encodes img as lossy WebP at the given quality (0-100).
+func EncodeWebP(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := webp.Encode(&buf, img, &webp.Options{Quality: float32(clampQuality(quality))}); err != nil {
+		return nil, fmt.Errorf("encode webp: %w", err)
+	}
+	return buf.Bytes(), nil
+}
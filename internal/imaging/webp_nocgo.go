@@ -0,0 +1,13 @@
+//go:build !cgo
+
+package imaging
+
+import (
+	"errors"
+	"image"
+)
+
+// EncodeWebP is unavailable without cgo because the encoder wraps libwebp.
+func EncodeWebP(_ image.Image, _ int) ([]byte, error) {
+	return nil, errors.New("webp encoding requires cgo")
+}
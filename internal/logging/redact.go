@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values in logs.
+const RedactedValue = "***"
+
+// Redactor masks the values of sensitive query parameters and headers. Names are
+// matched case-insensitively and kept, so logs still show which fields were sent.
+type Redactor struct {
+	keys map[string]struct{}
+}
+
+func NewRedactor(keys []string) *Redactor {
+	r := &Redactor{keys: make(map[string]struct{}, len(keys))}
+	for _, key := range keys {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			r.keys[key] = struct{}{}
+		}
+	}
+	return r
+}
+
+func (r *Redactor) redacts(name string) bool {
+	_, ok := r.keys[strings.ToLower(name)]
+	return ok
+}
+
+// Query returns rawQuery with the values of sensitive parameters replaced, keeping the
+// original order and encoding of everything else. Parameters whose names cannot be
+// decoded are redacted.
+func (r *Redactor) Query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		rawName, _, hasValue := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil || (hasValue && r.redacts(name)) {
+			parts[i] = rawName + "=" + RedactedValue
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Headers returns a log group of the request headers with sensitive values replaced.
+func (r *Redactor) Headers(header http.Header) slog.Attr {
+	attrs := make([]any, 0, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if r.redacts(name) {
+			value = RedactedValue
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.Group("headers", attrs...)
+}
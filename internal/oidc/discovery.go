@@ -0,0 +1,59 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const maxDiscoverySize = 1 << 20
+
+// ProviderMetadata is the part of an issuer's discovery document the app uses.
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover fetches issuer's /.well-known/openid-configuration. The document
+// must name the same issuer, character for character, or tokens it issues
+// would not verify. A nil client uses http.DefaultClient.
+func Discover(ctx context.Context, issuer string, client *http.Client) (*ProviderMetadata, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDiscoverySize))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+
+	var meta ProviderMetadata
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return nil, fmt.Errorf("oidc: decode discovery document: %w", err)
+	}
+	if meta.Issuer != issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q, not %q", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery document for %q is missing endpoints", issuer)
+	}
+	return &meta, nil
+}
@@ -0,0 +1,113 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// clockSkew is how far the provider's clock may be ahead of ours.
+const clockSkew = time.Minute
+
+var ErrInvalidClaims = errors.New("oidc: invalid token claims")
+
+// Claims are the ID token claims the app reads.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	// IsPrivateEmail is set by Apple when Email is a relay address created with
+	// Hide My Email.
+	IsPrivateEmail flexBool `json:"is_private_email"`
+	Name           string   `json:"name"`
+	Picture        string   `json:"picture"`
+}
+
+// Verifier checks ID tokens issued by one provider for one client.
+type Verifier struct {
+	Issuer   string
+	ClientID string
+	Keys     *KeySet
+	// OtherIssuers lists further accepted iss values, for providers such as
+	// Google that issue tokens under more than one spelling.
+	OtherIssuers []string
+}
+
+// Verify checks token's signature, issuer, audience and expiry, and that its
+// nonce claim equals nonce, then returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token, nonce string) (*Claims, error) {
+	h, payload, signed, sig, err := splitToken(token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := v.Keys.key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, key, signed, sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if claims.Issuer != v.Issuer && !slices.Contains(v.OtherIssuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidClaims, claims.Issuer)
+	}
+	if !slices.Contains(claims.Audience, v.ClientID) {
+		return nil, fmt.Errorf("%w: audience does not include client", ErrInvalidClaims)
+	}
+	if claims.Expiry == 0 || time.Now().Add(-clockSkew).Unix() >= claims.Expiry {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidClaims)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidClaims)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidClaims)
+	}
+	return &claims, nil
+}
+
+// audience is the aud claim, which is either a single string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// flexBool accepts a JSON boolean or the strings "true" and "false"; Apple
+// sends its boolean claims as strings.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	case "false", `"false"`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("oidc: invalid boolean %s", data)
+	}
+	return nil
+}
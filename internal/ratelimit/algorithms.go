@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ValkeyFixedWindowLimiter counts requests per window aligned to the Unix
+// epoch, with one INCR and one PEXPIRE per request. It is the cheapest
+// algorithm, but a client can get up to twice the limit through by spreading
+// its requests across the end of one window and the start of the next.
+type ValkeyFixedWindowLimiter struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+// FixedWindow returns a fixed window limiter sharing l's connection pool. Its
+// keys are apart from the sliding window ones, so a rule can switch algorithm
+// without the two reading each other's entries.
+func (l *ValkeyLimiter) FixedWindow() *ValkeyFixedWindowLimiter {
+	return &ValkeyFixedWindowLimiter{client: l.client, prefix: l.prefix + "fixed:", now: l.now}
+}
+
+func (l *ValkeyFixedWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	if l == nil || l.client == nil {
+		return true, nil
+	}
+
+	index := l.now().UnixMilli() / window.Milliseconds()
+	redisKey := l.prefix + key + ":" + strconv.FormatInt(index, 10)
+
+	pipe := l.client.Pipeline()
+	countCmd := pipe.Incr(ctx, redisKey)
+	pipe.PExpire(ctx, redisKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	return countCmd.Val() <= int64(limit), nil
+}
+
+// tokenBucketScript takes a token from the bucket in KEYS[1] after refilling it
+// for the time since the last request. ARGV: capacity, refill time for a full
+// bucket in milliseconds, now in Unix milliseconds. Returns 1 when a token was
+// taken.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * capacity / window)
+	ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], window)
+return allowed
+`)
+
+// ValkeyTokenBucketLimiter gives each key a bucket of limit tokens that refills
+// at limit per window. A full bucket allows a burst of limit requests, after
+// which requests go through at the refill rate. Refused requests take no
+// token, unlike the window algorithms, which count them too.
+type ValkeyTokenBucketLimiter struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+// TokenBucket returns a token bucket limiter sharing l's connection pool.
+func (l *ValkeyLimiter) TokenBucket() *ValkeyTokenBucketLimiter {
+	return &ValkeyTokenBucketLimiter{client: l.client, prefix: l.prefix + "bucket:", now: l.now}
+}
+
+func (l *ValkeyTokenBucketLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	if l == nil || l.client == nil {
+		return true, nil
+	}
+
+	allowed, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key}, limit, window.Milliseconds(), l.now().UnixMilli()).Int()
+	if err != nil {
+		return false, err
+	}
+	return allowed == 1, nil
+}
@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testClock is a settable clock for the limiters' now.
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// newTestLimiter returns a limiter on a fresh miniredis whose clock stands one
+// second before the end of a one-minute window.
+func newTestLimiter(t *testing.T) (*ValkeyLimiter, *testClock) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	limiter := NewValkeyLimiter(client)
+	clock := &testClock{t: time.Date(2026, 1, 1, 12, 0, 59, 0, time.UTC)}
+	limiter.now = clock.now
+	return limiter, clock
+}
+
+// burst sends n requests for key and returns how many were allowed.
+func burst(t *testing.T, limiter Limiter, key string, n, limit int, window time.Duration) int {
+	t.Helper()
+	allowed := 0
+	for range n {
+		ok, err := limiter.Allow(t.Context(), key, limit, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+// TestAlgorithmsAcrossWindowEdge sends a full burst just before a window ends
+// and another just after. Only the fixed window lets both through, twice the
+// limit within two seconds.
+func TestAlgorithmsAcrossWindowEdge(t *testing.T) {
+	const limit = 10
+	const window = time.Minute
+
+	tests := []struct {
+		name      string
+		limiter   func(*ValkeyLimiter) Limiter
+		wantAfter int
+	}{
+		{"sliding", func(l *ValkeyLimiter) Limiter { return l }, 0},
+		{"fixed", func(l *ValkeyLimiter) Limiter { return l.FixedWindow() }, limit},
+		// Two seconds refill a third of a token.
+		{"token_bucket", func(l *ValkeyLimiter) Limiter { return l.TokenBucket() }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, clock := newTestLimiter(t)
+			limiter := tt.limiter(base)
+
+			if got := burst(t, limiter, "client", limit, limit, window); got != limit {
+				t.Fatalf("first burst: %d allowed, want %d", got, limit)
+			}
+			clock.advance(2 * time.Second)
+			if got := burst(t, limiter, "client", limit, limit, window); got != tt.wantAfter {
+				t.Errorf("burst after the window edge: %d allowed, want %d", got, tt.wantAfter)
+			}
+		})
+	}
+}
+
+// TestAlgorithmsRecovery shows how each algorithm gives capacity back after a
+// client spent it and kept retrying.
+func TestAlgorithmsRecovery(t *testing.T) {
+	const limit = 10
+	const window = time.Minute
+
+	t.Run("sliding counts refused requests", func(t *testing.T) {
+		limiter, clock := newTestLimiter(t)
+		burst(t, limiter, "client", limit, limit, window)
+		clock.advance(30 * time.Second)
+		if got := burst(t, limiter, "client", limit, limit, window); got != 0 {
+			t.Fatalf("retries at 30s: %d allowed, want 0", got)
+		}
+		// The first burst has left the window, but the refused retries have not.
+		clock.advance(31 * time.Second)
+		if got := burst(t, limiter, "client", 1, limit, window); got != 0 {
+			t.Errorf("at 61s: %d allowed, want 0 while the retries are in the window", got)
+		}
+		clock.advance(window)
+		if got := burst(t, limiter, "client", 1, limit, window); got != 1 {
+			t.Errorf("once the retries left the window: %d allowed, want 1", got)
+		}
+	})
+
+	t.Run("token bucket refills at a steady rate", func(t *testing.T) {
+		base, clock := newTestLimiter(t)
+		limiter := base.TokenBucket()
+		burst(t, limiter, "client", limit, limit, window)
+		// One token comes back every window/limit. Refused requests take none,
+		// so retrying does not push the next token back.
+		for i := range 3 {
+			clock.advance(window / limit / 2)
+			if got := burst(t, limiter, "client", 3, limit, window); got != 0 {
+				t.Fatalf("step %d, half a token in: %d allowed, want 0", i, got)
+			}
+			clock.advance(window / limit / 2)
+			if got := burst(t, limiter, "client", 3, limit, window); got != 1 {
+				t.Fatalf("step %d, one token in: %d allowed, want 1", i, got)
+			}
+		}
+	})
+
+	t.Run("fixed window resets at the edge", func(t *testing.T) {
+		base, clock := newTestLimiter(t)
+		limiter := base.FixedWindow()
+		clock.advance(-58 * time.Second) // the start of the window
+		burst(t, limiter, "client", limit+5, limit, window)
+		clock.advance(58 * time.Second)
+		if got := burst(t, limiter, "client", 1, limit, window); got != 0 {
+			t.Fatalf("end of the window: %d allowed, want 0", got)
+		}
+		clock.advance(time.Second)
+		if got := burst(t, limiter, "client", limit+1, limit, window); got != limit {
+			t.Errorf("next window: %d allowed, want %d", got, limit)
+		}
+	})
+}
+
+func TestAlgorithmsKeepSeparateKeys(t *testing.T) {
+	const limit = 2
+	base, _ := newTestLimiter(t)
+	limiters := map[string]Limiter{"sliding": base, "fixed": base.FixedWindow(), "token_bucket": base.TokenBucket()}
+	for name, limiter := range limiters {
+		if got := burst(t, limiter, "shared", limit, limit, time.Minute); got != limit {
+			t.Errorf("%s: %d allowed, want %d; another algorithm's entries were counted", name, got, limit)
+		}
+	}
+}
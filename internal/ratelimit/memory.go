@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often MemoryLimiter drops keys whose window has passed.
+const memorySweepInterval = time.Minute
+
+// MemoryLimiter is an in-process sliding window limiter. Limits are per instance
+// and reset on restart, so it is only meant as a fallback when Valkey is down.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryWindow
+	lastSweep time.Time
+}
+
+type memoryWindow struct {
+	hits   []time.Time
+	expiry time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		windows:   make(map[string]*memoryWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	now := time.Now()
+	windowStart := now.Add(-window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= memorySweepInterval {
+		l.sweep(now)
+	}
+
+	entry, ok := l.windows[key]
+	if !ok {
+		entry = &memoryWindow{}
+		l.windows[key] = entry
+	}
+
+	kept := entry.hits[:0]
+	for _, hit := range entry.hits {
+		if hit.After(windowStart) {
+			kept = append(kept, hit)
+		}
+	}
+	entry.hits = append(kept, now)
+	entry.expiry = now.Add(window)
+
+	return len(entry.hits) <= limit, nil
+}
+
+// sweep removes keys with no hits left in their window. l.mu must be held.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, entry := range l.windows {
+		if now.After(entry.expiry) {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
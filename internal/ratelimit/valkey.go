@@ -17,17 +17,17 @@ type Limiter interface {
 type ValkeyLimiter struct {
 	client *redis.Client
 	prefix string
+	// now is time.Now; tests set it to step across window edges.
+	now func() time.Time
 }
 
-func NewValkeyLimiter(addr, password string) *ValkeyLimiter {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-	})
-
+// NewValkeyLimiter uses client, which the caller owns and closes. Its timeouts
+// bound how long a stalled Valkey holds a rate-limited request.
+func NewValkeyLimiter(client *redis.Client) *ValkeyLimiter {
 	return &ValkeyLimiter{
 		client: client,
 		prefix: "rl:",
+		now:    time.Now,
 	}
 }
 
@@ -36,7 +36,7 @@ func (l *ValkeyLimiter) Allow(ctx context.Context, key string, limit int, window
 		return true, nil
 	}
 
-	now := time.Now().UnixMilli()
+	now := l.now().UnixMilli()
 	windowStart := now - window.Milliseconds()
 	redisKey := l.prefix + key
 	member := fmt.Sprintf("%d-%s", now, randomSuffix())
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// sessionCleanupBatchSize bounds each DELETE so a large backlog is removed in
+// short transactions instead of one long lock on the sessions table.
+const sessionCleanupBatchSize = 1000
+
+// SessionCleanupService deletes sessions that can no longer be used: past their
+// absolute expiry, or interactive sessions idle for longer than the idle timeout.
+// Validation already rejects both; this keeps abandoned rows from piling up.
+type SessionCleanupService struct {
+	queries     *db.Queries
+	idleTimeout time.Duration
+}
+
+func NewSessionCleanupService(queries *db.Queries, idleTimeout time.Duration) *SessionCleanupService {
+	return &SessionCleanupService{queries: queries, idleTimeout: idleTimeout}
+}
+
+// DeleteExpired removes expired sessions in batches until none are left and
+// returns how many were deleted. A zero idle timeout only removes sessions past
+// their absolute expiry.
+func (s *SessionCleanupService) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	if s == nil || s.queries == nil {
+		return 0, errors.New("session cleanup service not initialized")
+	}
+
+	params := db.DeleteExpiredSessionsParams{BatchSize: sessionCleanupBatchSize}
+	if s.idleTimeout > 0 {
+		params.IdleCutoff = pgtype.Timestamptz{Time: now.Add(-s.idleTimeout).UTC(), Valid: true}
+	}
+
+	var total int64
+	for {
+		deleted, err := s.queries.DeleteExpiredSessions(ctx, params)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted < sessionCleanupBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// expiredTokenGrace keeps expired verification tokens for a while so a late click
+// still gets "link expired" instead of "invalid link".
+const expiredTokenGrace = 7 * 24 * time.Hour
+
+// TokenCleanupService clears expired one-time auth token hashes from user rows.
+type TokenCleanupService struct {
+	queries *db.Queries
+}
+
+func NewTokenCleanupService(queries *db.Queries) *TokenCleanupService {
+	return &TokenCleanupService{queries: queries}
+}
+
+// ClearExpiredTokens nulls verification token hashes that expired more than
+// expiredTokenGrace before now, deletes superseded tokens kept after a resend
+// once they pass the same cutoff, and returns how many rows were affected.
+func (s *TokenCleanupService) ClearExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	if s == nil || s.queries == nil {
+		return 0, errors.New("token cleanup service not initialized")
+	}
+
+	cutoff := pgtype.Timestamptz{Time: now.Add(-expiredTokenGrace).UTC(), Valid: true}
+	cleared, err := s.queries.ClearExpiredAuthTokens(ctx, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := s.queries.DeleteExpiredPreviousVerificationTokens(ctx, cutoff)
+	if err != nil {
+		return cleared, err
+	}
+	return cleared + deleted, nil
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// exportAuditLogs is hand-written because sqlc's :many collects every row into a
+// slice before returning.
+const exportAuditLogs = `SELECT id, user_id, event_type, ip_address, user_agent, metadata, created_at
+FROM audit_logs
+WHERE created_at >= $1
+  AND created_at < $2
+ORDER BY created_at, id`
+
+// ExportAuditLogs calls fn for each audit log created in [from, to), oldest
+// first. Rows are read from the connection one at a time, so an export runs in
+// constant memory however many rows match. An error from fn stops the export
+// and is returned.
+func (s *Store) ExportAuditLogs(ctx context.Context, from, to time.Time, fn func(db.AuditLog) error) error {
+	rows, err := s.pool.Query(ctx, exportAuditLogs, from, to)
+	if err != nil {
+		return err
+	}
+	var row db.AuditLog
+	_, err = pgx.ForEachRow(rows, []any{&row.ID, &row.UserID, &row.EventType, &row.IpAddress, &row.UserAgent, &row.Metadata, &row.CreatedAt}, func() error {
+		return fn(row)
+	})
+	return err
+}
@@ -1,23 +1,29 @@
 package blob
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
+var ErrObjectTooLarge = errors.New("object exceeds size limit")
+
 type Client struct {
 	bucket        string
 	client        *s3.Client
 	presignClient *s3.PresignClient
 	uploadTTL     time.Duration
 	downloadTTL   time.Duration
+	limiter       *opLimiter
 }
 
 type PresignedRequest struct {
@@ -27,6 +33,20 @@ type PresignedRequest struct {
 	Expires time.Time
 }
 
+// ObjectMetadata describes a stored object without its body.
+type ObjectMetadata struct {
+	Size        int64
+	ContentType string
+	ETag        string
+}
+
+// PresignedPost is a browser form upload: POST the fields plus a trailing "file" field to URL.
+type PresignedPost struct {
+	URL     string
+	Fields  map[string]string
+	Expires time.Time
+}
+
 type Config struct {
 	Endpoint           string
 	Region             string
@@ -36,6 +56,10 @@ type Config struct {
 	ForcePathStyle     bool
 	PresignUploadTTL   time.Duration
 	PresignDownloadTTL time.Duration
+	// MaxConcurrentOps caps in-flight backend calls (default 32). A call that
+	// waits longer than QueueTimeout (default 5s) for a slot fails with ErrThrottled.
+	MaxConcurrentOps int
+	QueueTimeout     time.Duration
 }
 
 func New(ctx context.Context, cfg Config) (*Client, error) {
@@ -71,6 +95,7 @@ func New(ctx context.Context, cfg Config) (*Client, error) {
 		presignClient: s3.NewPresignClient(s3Client),
 		uploadTTL:     cfg.PresignUploadTTL,
 		downloadTTL:   cfg.PresignDownloadTTL,
+		limiter:       newOpLimiter(cfg.MaxConcurrentOps, cfg.QueueTimeout),
 	}, nil
 }
 
@@ -81,10 +106,14 @@ func (c *Client) PresignPutObject(ctx context.Context, key, contentType string)
 		ContentType: aws.String(contentType),
 	}
 
-	res, err := c.presignClient.PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
-		if c.uploadTTL > 0 {
-			opts.Expires = c.uploadTTL
-		}
+	var res *v4.PresignedHTTPRequest
+	err := c.limiter.do(ctx, "presign_put", func(ctx context.Context) (err error) {
+		res, err = c.presignClient.PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
+			if c.uploadTTL > 0 {
+				opts.Expires = c.uploadTTL
+			}
+		})
+		return err
 	})
 	if err != nil {
 		return PresignedRequest{}, fmt.Errorf("presign put object: %w", err)
@@ -98,16 +127,58 @@ func (c *Client) PresignPutObject(ctx context.Context, key, contentType string)
 	}, nil
 }
 
+// PresignPostObject creates a presigned POST form whose policy pins the key and content type and
+// only accepts bodies between minBytes and maxBytes.
+func (c *Client) PresignPostObject(ctx context.Context, key, contentType string, minBytes, maxBytes int64) (PresignedPost, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}
+
+	var res *s3.PresignedPostRequest
+	err := c.limiter.do(ctx, "presign_post", func(ctx context.Context) (err error) {
+		res, err = c.presignClient.PresignPostObject(ctx, input, func(opts *s3.PresignPostOptions) {
+			if c.uploadTTL > 0 {
+				opts.Expires = c.uploadTTL
+			}
+			opts.Conditions = []interface{}{
+				[]interface{}{"content-length-range", minBytes, maxBytes},
+				map[string]string{"Content-Type": contentType},
+			}
+		})
+		return err
+	})
+	if err != nil {
+		return PresignedPost{}, fmt.Errorf("presign post object: %w", err)
+	}
+
+	fields := make(map[string]string, len(res.Values)+1)
+	for name, value := range res.Values {
+		fields[name] = value
+	}
+	fields["Content-Type"] = contentType
+
+	return PresignedPost{
+		URL:     res.URL,
+		Fields:  fields,
+		Expires: expiresAt(c.uploadTTL),
+	}, nil
+}
+
 func (c *Client) PresignGetObject(ctx context.Context, key string) (PresignedRequest, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
 	}
 
-	res, err := c.presignClient.PresignGetObject(ctx, input, func(opts *s3.PresignOptions) {
-		if c.downloadTTL > 0 {
-			opts.Expires = c.downloadTTL
-		}
+	var res *v4.PresignedHTTPRequest
+	err := c.limiter.do(ctx, "presign_get", func(ctx context.Context) (err error) {
+		res, err = c.presignClient.PresignGetObject(ctx, input, func(opts *s3.PresignOptions) {
+			if c.downloadTTL > 0 {
+				opts.Expires = c.downloadTTL
+			}
+		})
+		return err
 	})
 	if err != nil {
 		return PresignedRequest{}, fmt.Errorf("presign get object: %w", err)
@@ -122,9 +193,12 @@ func (c *Client) PresignGetObject(ctx context.Context, key string) (PresignedReq
 }
 
 func (c *Client) HeadObject(ctx context.Context, key string) error {
-	_, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(c.bucket),
-		Key:    aws.String(key),
+	err := c.limiter.do(ctx, "head", func(ctx context.Context) error {
+		_, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("head object: %w", err)
@@ -132,10 +206,78 @@ func (c *Client) HeadObject(ctx context.Context, key string) error {
 	return nil
 }
 
+func (c *Client) HeadObjectMetadata(ctx context.Context, key string) (ObjectMetadata, error) {
+	var res *s3.HeadObjectOutput
+	err := c.limiter.do(ctx, "head", func(ctx context.Context) (err error) {
+		res, err = c.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		})
+		return err
+	})
+	if err != nil {
+		return ObjectMetadata{}, fmt.Errorf("head object: %w", err)
+	}
+	return ObjectMetadata{
+		Size:        aws.ToInt64(res.ContentLength),
+		ContentType: aws.ToString(res.ContentType),
+		ETag:        aws.ToString(res.ETag),
+	}, nil
+}
+
+// GetObject downloads an object, failing if it is larger than maxBytes.
+func (c *Client) GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error) {
+	// The slot is held until the body is read, since the connection is busy until then.
+	var data []byte
+	err := c.limiter.do(ctx, "get", func(ctx context.Context) error {
+		res, err := c.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("get object: %w", err)
+		}
+		defer res.Body.Close()
+
+		data, err = io.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+		if err != nil {
+			return fmt.Errorf("read object: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrObjectTooLarge
+	}
+	return data, nil
+}
+
+func (c *Client) PutObject(ctx context.Context, key, contentType string, data []byte) error {
+	err := c.limiter.do(ctx, "put", func(ctx context.Context) error {
+		_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(c.bucket),
+			Key:           aws.String(key),
+			ContentType:   aws.String(contentType),
+			ContentLength: aws.Int64(int64(len(data))),
+			Body:          bytes.NewReader(data),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) DeleteObject(ctx context.Context, key string) error {
-	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(c.bucket),
-		Key:    aws.String(key),
+	err := c.limiter.do(ctx, "delete", func(ctx context.Context) error {
+		_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("delete object: %w", err)
@@ -0,0 +1,155 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// ErrThrottled means the operation was not attempted because too many blob
+// operations were already in flight, or the backend kept throttling it after the
+// SDK's own retries. It is safe to retry later.
+var ErrThrottled = errors.New("storage is throttling requests")
+
+const (
+	defaultMaxConcurrentOps = 32
+	defaultQueueTimeout     = 5 * time.Second
+)
+
+var throttleErrors = retry.ThrottleErrorCode{Codes: retry.DefaultThrottleErrorCodes}
+
+// OpStats aggregates one kind of blob operation since the client was created.
+// Count, Errors and the latencies cover calls that reached the backend; Throttled
+// is the subset of Errors the backend throttled. Rejected counts calls that gave
+// up waiting for a slot.
+type OpStats struct {
+	Count        int64
+	Errors       int64
+	Throttled    int64
+	Rejected     int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// AvgLatency returns the mean backend latency.
+func (s OpStats) AvgLatency() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Count)
+}
+
+// opLimiter bounds concurrent backend calls with a semaphore and records
+// per-operation stats.
+type opLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*OpStats
+}
+
+func newOpLimiter(maxConcurrent int, queueTimeout time.Duration) *opLimiter {
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrentOps
+	}
+	if queueTimeout <= 0 {
+		queueTimeout = defaultQueueTimeout
+	}
+	return &opLimiter{
+		slots:        make(chan struct{}, maxConcurrent),
+		queueTimeout: queueTimeout,
+		stats:        make(map[string]*OpStats),
+	}
+}
+
+// do runs fn once a slot is free, waiting at most queueTimeout. Backend
+// throttling errors are wrapped with ErrThrottled.
+func (l *opLimiter) do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	if err := l.acquire(ctx); err != nil {
+		l.reject(op)
+		return err
+	}
+	defer func() { <-l.slots }()
+
+	start := time.Now()
+	err := fn(ctx)
+	if err != nil && throttleErrors.IsErrorThrottle(err) == aws.TrueTernary {
+		err = fmt.Errorf("%w: %w", ErrThrottled, err)
+	}
+	l.record(op, time.Since(start), err)
+	return err
+}
+
+func (l *opLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return fmt.Errorf("%w: %d operations in flight", ErrThrottled, cap(l.slots))
+	}
+}
+
+func (l *opLimiter) record(op string, latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.statsFor(op)
+	stats.Count++
+	stats.TotalLatency += latency
+	stats.MaxLatency = max(stats.MaxLatency, latency)
+	if err != nil {
+		stats.Errors++
+		if errors.Is(err, ErrThrottled) {
+			stats.Throttled++
+		}
+	}
+}
+
+func (l *opLimiter) reject(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.statsFor(op).Rejected++
+}
+
+// statsFor returns the entry for op, creating it. l.mu must be held.
+func (l *opLimiter) statsFor(op string) *OpStats {
+	stats, ok := l.stats[op]
+	if !ok {
+		stats = &OpStats{}
+		l.stats[op] = stats
+	}
+	return stats
+}
+
+func (l *opLimiter) snapshot() map[string]OpStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := make(map[string]OpStats, len(l.stats))
+	for op, stats := range l.stats {
+		out[op] = *stats
+	}
+	return out
+}
+
+// Stats reports call counts, errors and latency per operation ("head", "get",
+// "presign_put", ...).
+func (c *Client) Stats() map[string]OpStats {
+	return c.limiter.snapshot()
+}
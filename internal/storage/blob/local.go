@@ -0,0 +1,345 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalPathPrefix is the route under which a LocalStore serves its signed URLs.
+const LocalPathPrefix = "/api/blob/"
+
+const (
+	localDefaultTTL            = 15 * time.Minute
+	localDefaultMaxObjectBytes = 32 * 1024 * 1024
+)
+
+var errInvalidKey = errors.New("invalid object key")
+
+// LocalStore keeps objects on the local filesystem and hands out HMAC-signed URLs
+// that it serves itself. It is meant for development without S3 or MinIO.
+type LocalStore struct {
+	root           *os.Root
+	baseURL        string
+	secret         []byte
+	maxObjectBytes int64
+	uploadTTL      time.Duration
+	downloadTTL    time.Duration
+}
+
+type LocalConfig struct {
+	// Dir holds the objects. Defaults to a directory under os.TempDir.
+	Dir string
+	// BaseURL is prepended to signed URLs. Empty yields same-origin relative URLs.
+	BaseURL string
+	// Secret signs URLs. A random secret is generated when empty, which invalidates
+	// outstanding URLs on restart.
+	Secret             []byte
+	MaxObjectBytes     int64
+	PresignUploadTTL   time.Duration
+	PresignDownloadTTL time.Duration
+}
+
+func NewLocalStore(cfg LocalConfig) (*LocalStore, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "starter-blobs")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create storage dir: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open storage dir: %w", err)
+	}
+
+	secret := cfg.Secret
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("generate signing secret: %w", err)
+		}
+	}
+
+	maxObjectBytes := cfg.MaxObjectBytes
+	if maxObjectBytes <= 0 {
+		maxObjectBytes = localDefaultMaxObjectBytes
+	}
+
+	return &LocalStore{
+		root:           root,
+		baseURL:        strings.TrimRight(cfg.BaseURL, "/"),
+		secret:         secret,
+		maxObjectBytes: maxObjectBytes,
+		uploadTTL:      ttlOrDefault(cfg.PresignUploadTTL),
+		downloadTTL:    ttlOrDefault(cfg.PresignDownloadTTL),
+	}, nil
+}
+
+// MaxObjectBytes returns the largest body ServeHTTP accepts for a PUT.
+func (s *LocalStore) MaxObjectBytes() int64 {
+	return s.maxObjectBytes
+}
+
+// Dir returns the directory objects are stored in.
+func (s *LocalStore) Dir() string {
+	return s.root.Name()
+}
+
+func (s *LocalStore) Close() error {
+	return s.root.Close()
+}
+
+func (s *LocalStore) PresignPutObject(_ context.Context, key, contentType string) (PresignedRequest, error) {
+	if err := validateKey(key); err != nil {
+		return PresignedRequest{}, fmt.Errorf("presign put object: %w", err)
+	}
+
+	expires := time.Now().Add(s.uploadTTL)
+	return PresignedRequest{
+		URL:     s.signedURL(http.MethodPut, key, contentType, expires),
+		Method:  http.MethodPut,
+		Headers: map[string][]string{"Content-Type": {contentType}},
+		Expires: expires,
+	}, nil
+}
+
+func (s *LocalStore) PresignGetObject(_ context.Context, key string) (PresignedRequest, error) {
+	if err := validateKey(key); err != nil {
+		return PresignedRequest{}, fmt.Errorf("presign get object: %w", err)
+	}
+
+	expires := time.Now().Add(s.downloadTTL)
+	return PresignedRequest{
+		URL:     s.signedURL(http.MethodGet, key, "", expires),
+		Method:  http.MethodGet,
+		Headers: map[string][]string{},
+		Expires: expires,
+	}, nil
+}
+
+func (s *LocalStore) HeadObject(_ context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("head object: %w", err)
+	}
+	if _, err := s.root.Stat(key); err != nil {
+		return fmt.Errorf("head object: %w", err)
+	}
+	return nil
+}
+
+// HeadObjectMetadata derives the ETag from the modification time and size, which
+// changes whenever an object is rewritten.
+func (s *LocalStore) HeadObjectMetadata(_ context.Context, key string) (ObjectMetadata, error) {
+	if err := validateKey(key); err != nil {
+		return ObjectMetadata{}, fmt.Errorf("head object: %w", err)
+	}
+	info, err := s.root.Stat(key)
+	if err != nil {
+		return ObjectMetadata{}, fmt.Errorf("head object: %w", err)
+	}
+	return ObjectMetadata{
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ETag:        localETag(info),
+	}, nil
+}
+
+// GetObject reads an object, failing if it is larger than maxBytes.
+func (s *LocalStore) GetObject(_ context.Context, key string, maxBytes int64) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+
+	file, err := s.root.Open(key)
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read object: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrObjectTooLarge
+	}
+	return data, nil
+}
+
+func (s *LocalStore) PutObject(_ context.Context, key, _ string, data []byte) error {
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	if err := s.writeObject(key, data); err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	return nil
+}
+
+// DeleteObject removes an object. Deleting a missing object succeeds, as it does on S3.
+func (s *LocalStore) DeleteObject(_ context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	if err := s.root.Remove(key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP handles GET and PUT requests for signed URLs. The route must expose the
+// object key as the "key" path value, e.g. "GET /api/blob/{key...}".
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if validateKey(key) != nil {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+
+	contentType := ""
+	if r.Method == http.MethodPut {
+		contentType = r.Header.Get("Content-Type")
+	}
+	if !s.verify(r.Method, key, contentType, r.URL.Query()) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxObjectBytes))
+		if err != nil {
+			http.Error(w, "object too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := s.writeObject(key, body); err != nil {
+			http.Error(w, "failed to store object", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		file, err := s.root.Open(key)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Cache-Control", "private, max-age=0")
+		w.Header().Set("ETag", localETag(info))
+		http.ServeContent(w, r, path.Base(key), info.ModTime(), file)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeObject writes to a temporary file and renames it so readers never see partial objects.
+func (s *LocalStore) writeObject(key string, data []byte) error {
+	if dir := path.Dir(key); dir != "." {
+		if err := s.root.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmp := key + ".tmp-" + hex.EncodeToString(suffix)
+	if err := s.root.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := s.root.Rename(tmp, key); err != nil {
+		_ = s.root.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) signedURL(method, key, contentType string, expires time.Time) string {
+	expiresValue := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiresValue)
+	query.Set("signature", s.sign(method, key, contentType, expiresValue))
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.baseURL + LocalPathPrefix + strings.Join(segments, "/") + "?" + query.Encode()
+}
+
+func (s *LocalStore) verify(method, key, contentType string, query url.Values) bool {
+	// HEAD is allowed wherever GET is.
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	expiresValue := query.Get("expires")
+	expires, err := strconv.ParseInt(expiresValue, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(s.sign(method, key, contentType, expiresValue))
+	return hmac.Equal(signature, expected)
+}
+
+func (s *LocalStore) sign(method, key, contentType, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(method + "\n" + key + "\n" + contentType + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateKey rejects keys that are not clean, relative, slash-separated paths.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.Contains(key, "\\") {
+		return errInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." || segment == "." {
+			return errInvalidKey
+		}
+	}
+	return nil
+}
+
+func localETag(info fs.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size())
+}
+
+func ttlOrDefault(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return localDefaultTTL
+	}
+	return ttl
+}
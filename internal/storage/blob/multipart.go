@@ -0,0 +1,163 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Multipart uploads that are never completed or aborted keep their parts (and
+// storage cost) around indefinitely. Handlers abort on explicit cancel, but a
+// client can simply disappear, so the bucket should also carry a lifecycle rule
+// with AbortIncompleteMultipartUpload (e.g. DaysAfterInitiation: 1) to expire
+// stragglers. MinIO supports the same rule via `mc ilm rule add`.
+
+// MinPartSize is the smallest part S3 accepts for every part except the last.
+const MinPartSize = 5 * 1024 * 1024
+
+// MaxParts is the maximum number of parts in a single multipart upload.
+const MaxParts = 10000
+
+var ErrInvalidPart = errors.New("invalid multipart part")
+
+type CompletedPart struct {
+	PartNumber int32
+	ETag       string
+}
+
+type UploadedPart struct {
+	PartNumber int32
+	ETag       string
+	Size       int64
+}
+
+func (c *Client) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	var res *s3.CreateMultipartUploadOutput
+	err := c.limiter.do(ctx, "multipart_create", func(ctx context.Context) (err error) {
+		res, err = c.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      aws.String(c.bucket),
+			Key:         aws.String(key),
+			ContentType: aws.String(contentType),
+		})
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("create multipart upload: %w", err)
+	}
+	return aws.ToString(res.UploadId), nil
+}
+
+func (c *Client) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32) (PresignedRequest, error) {
+	if partNumber < 1 || partNumber > MaxParts {
+		return PresignedRequest{}, ErrInvalidPart
+	}
+
+	var res *v4.PresignedHTTPRequest
+	err := c.limiter.do(ctx, "presign_part", func(ctx context.Context) (err error) {
+		res, err = c.presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(c.bucket),
+			Key:        aws.String(key),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int32(partNumber),
+		}, func(opts *s3.PresignOptions) {
+			if c.uploadTTL > 0 {
+				opts.Expires = c.uploadTTL
+			}
+		})
+		return err
+	})
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("presign upload part: %w", err)
+	}
+
+	return PresignedRequest{
+		URL:     res.URL,
+		Method:  res.Method,
+		Headers: res.SignedHeader,
+		Expires: expiresAt(c.uploadTTL),
+	}, nil
+}
+
+// ListParts returns the parts uploaded so far so a client can resume an interrupted upload.
+func (c *Client) ListParts(ctx context.Context, key, uploadID string) ([]UploadedPart, error) {
+	parts := make([]UploadedPart, 0)
+	paginator := s3.NewListPartsPaginator(c.client, &s3.ListPartsInput{
+		Bucket:   aws.String(c.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	for paginator.HasMorePages() {
+		var page *s3.ListPartsOutput
+		err := c.limiter.do(ctx, "multipart_list", func(ctx context.Context) (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list parts: %w", err)
+		}
+		for _, part := range page.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber: aws.ToInt32(part.PartNumber),
+				ETag:       aws.ToString(part.ETag),
+				Size:       aws.ToInt64(part.Size),
+			})
+		}
+	}
+	return parts, nil
+}
+
+func (c *Client) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	if len(parts) == 0 {
+		return ErrInvalidPart
+	}
+
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		if part.PartNumber < 1 || part.PartNumber > MaxParts || part.ETag == "" {
+			return ErrInvalidPart
+		}
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
+	slices.SortFunc(completed, func(a, b types.CompletedPart) int {
+		return int(aws.ToInt32(a.PartNumber) - aws.ToInt32(b.PartNumber))
+	})
+
+	err := c.limiter.do(ctx, "multipart_complete", func(ctx context.Context) error {
+		_, err := c.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(c.bucket),
+			Key:             aws.String(key),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	err := c.limiter.do(ctx, "multipart_abort", func(ctx context.Context) error {
+		_, err := c.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(c.bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(uploadID),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("abort multipart upload: %w", err)
+	}
+	return nil
+}
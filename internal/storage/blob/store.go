@@ -0,0 +1,35 @@
+package blob
+
+import "context"
+
+// Store is the set of object operations every blob backend provides.
+type Store interface {
+	PresignPutObject(ctx context.Context, key, contentType string) (PresignedRequest, error)
+	PresignGetObject(ctx context.Context, key string) (PresignedRequest, error)
+	HeadObject(ctx context.Context, key string) error
+	HeadObjectMetadata(ctx context.Context, key string) (ObjectMetadata, error)
+	GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error)
+	PutObject(ctx context.Context, key, contentType string, data []byte) error
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// PostPresigner is implemented by backends that support presigned POST form uploads.
+type PostPresigner interface {
+	PresignPostObject(ctx context.Context, key, contentType string, minBytes, maxBytes int64) (PresignedPost, error)
+}
+
+// MultipartStore is implemented by backends that support multipart uploads.
+type MultipartStore interface {
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32) (PresignedRequest, error)
+	ListParts(ctx context.Context, key, uploadID string) ([]UploadedPart, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+var (
+	_ Store          = (*Client)(nil)
+	_ PostPresigner  = (*Client)(nil)
+	_ MultipartStore = (*Client)(nil)
+	_ Store          = (*LocalStore)(nil)
+)
@@ -10,6 +10,19 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ApiKey struct {
+	ID         pgtype.UUID        `json:"id"`
+	UserID     pgtype.UUID        `json:"user_id"`
+	Name       string             `json:"name"`
+	KeyPrefix  string             `json:"key_prefix"`
+	KeyHash    string             `json:"key_hash"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	Scopes     []string           `json:"scopes"`
+}
+
 type AuditLog struct {
 	ID        pgtype.UUID        `json:"id"`
 	UserID    pgtype.UUID        `json:"user_id"`
@@ -20,6 +33,33 @@ type AuditLog struct {
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
+type EmailVerificationPreviousToken struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+type EmailVerificationSend struct {
+	UserID     pgtype.UUID        `json:"user_id"`
+	Attempts   int32              `json:"attempts"`
+	LastSentAt pgtype.Timestamptz `json:"last_sent_at"`
+}
+
+type PasswordHistory struct {
+	ID           pgtype.UUID        `json:"id"`
+	UserID       pgtype.UUID        `json:"user_id"`
+	PasswordHash string             `json:"password_hash"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type Recipe struct {
+	ID        pgtype.UUID        `json:"id"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	Request   []byte             `json:"request"`
+	Recipe    []byte             `json:"recipe"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
 type Session struct {
 	ID           pgtype.UUID        `json:"id"`
 	UserID       pgtype.UUID        `json:"user_id"`
@@ -29,6 +69,8 @@ type Session struct {
 	IpAddress    *netip.Addr        `json:"ip_address"`
 	UserAgent    pgtype.Text        `json:"user_agent"`
 	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	SessionType  string             `json:"session_type"`
+	Persistent   bool               `json:"persistent"`
 }
 
 type User struct {
@@ -46,4 +88,15 @@ type User struct {
 	LockedUntil                pgtype.Timestamptz `json:"locked_until"`
 	CreatedAt                  pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt                  pgtype.Timestamptz `json:"updated_at"`
+	PictureEtag                pgtype.Text        `json:"picture_etag"`
+	Role                       string             `json:"role"`
+}
+
+type UserIdentity struct {
+	Provider     string             `json:"provider"`
+	Subject      string             `json:"subject"`
+	UserID       pgtype.UUID        `json:"user_id"`
+	Email        string             `json:"email"`
+	PrivateEmail bool               `json:"private_email"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
 }
@@ -11,32 +11,76 @@ import (
 )
 
 type Querier interface {
+	AddPasswordHistory(ctx context.Context, arg AddPasswordHistoryParams) error
+	ClearExpiredAuthTokens(ctx context.Context, emailVerificationExpiresAt pgtype.Timestamptz) (int64, error)
+	ClearUserPicture(ctx context.Context, id pgtype.UUID) error
+	// Sessions in use on each UTC day from since up to until: created before the
+	// day ended and last active after it began. Sessions deleted by logout or
+	// cleanup are no longer counted.
+	CountActiveSessionsByDay(ctx context.Context, arg CountActiveSessionsByDayParams) ([]CountActiveSessionsByDayRow, error)
+	CountActiveUserAPIKeys(ctx context.Context, userID pgtype.UUID) (int64, error)
+	// Audit events of the given types per UTC day. Days without one are left out.
+	CountAuditEventsByDay(ctx context.Context, arg CountAuditEventsByDayParams) ([]CountAuditEventsByDayRow, error)
 	CountUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error)
+	// New accounts per UTC day, for every sign-up method. Days without one are
+	// left out.
+	CountUsersCreatedByDay(ctx context.Context, arg CountUsersCreatedByDayParams) ([]CountUsersCreatedByDayRow, error)
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error)
 	// Audit logs
 	CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) error
+	// Inserts one row per array index, in order. Empty IP, user agent and metadata
+	// strings are stored as NULL; created_at is the time each event was logged.
+	CreateAuditLogBatch(ctx context.Context, arg CreateAuditLogBatchParams) error
+	CreateRecipe(ctx context.Context, arg CreateRecipeParams) (Recipe, error)
 	// Sessions
 	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	// Users
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
-	DeleteExpiredSessions(ctx context.Context) error
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) error
+	DeleteExpiredPreviousVerificationTokens(ctx context.Context, expiresAt pgtype.Timestamptz) (int64, error)
+	DeleteExpiredSessions(ctx context.Context, arg DeleteExpiredSessionsParams) (int64, error)
+	DeletePreviousVerificationToken(ctx context.Context, userID pgtype.UUID) error
 	DeleteSession(ctx context.Context, id pgtype.UUID) error
 	DeleteSessionByTokenHash(ctx context.Context, tokenHash string) error
-	DeleteUserSessions(ctx context.Context, userID pgtype.UUID) error
+	DeleteUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (GetAPIKeyByHashRow, error)
+	GetEmailVerificationSend(ctx context.Context, userID pgtype.UUID) (EmailVerificationSend, error)
 	GetOldestUserSession(ctx context.Context, userID pgtype.UUID) (Session, error)
+	GetPreviousVerificationToken(ctx context.Context, tokenHash string) (EmailVerificationPreviousToken, error)
+	GetRecipeByID(ctx context.Context, arg GetRecipeByIDParams) (Recipe, error)
 	GetSessionByTokenHash(ctx context.Context, tokenHash string) (GetSessionByTokenHashRow, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserByEmailVerificationTokenHash(ctx context.Context, emailVerificationTokenHash string) (User, error)
 	GetUserByGoogleID(ctx context.Context, googleID pgtype.Text) (User, error)
 	GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
+	// User identities
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
 	IncrementFailedLoginAttempts(ctx context.Context, id pgtype.UUID) (User, error)
+	ListPasswordHistory(ctx context.Context, arg ListPasswordHistoryParams) ([]string, error)
+	// Distinct addresses and user agents the user signed in from between since and
+	// before, taken from login audit events because sessions are deleted on logout.
+	ListRecentLoginDevices(ctx context.Context, arg ListRecentLoginDevicesParams) ([]ListRecentLoginDevicesRow, error)
+	ListRecipesForUser(ctx context.Context, arg ListRecipesForUserParams) ([]Recipe, error)
+	ListUserAPIKeys(ctx context.Context, userID pgtype.UUID) ([]ApiKey, error)
+	ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUsersRow, error)
 	LockUser(ctx context.Context, arg LockUserParams) error
+	PrunePasswordHistory(ctx context.Context, arg PrunePasswordHistoryParams) (int64, error)
 	PurgeAuditLogsBefore(ctx context.Context, createdAt pgtype.Timestamptz) (int64, error)
+	RecordEmailVerificationSend(ctx context.Context, arg RecordEmailVerificationSendParams) (EmailVerificationSend, error)
 	ResetFailedLoginAttempts(ctx context.Context, id pgtype.UUID) error
+	RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error)
+	RevokeUserAPIKeys(ctx context.Context, userID pgtype.UUID) (int64, error)
 	SetEmailVerificationToken(ctx context.Context, arg SetEmailVerificationTokenParams) error
+	// Previous email verification tokens
+	SetPreviousVerificationToken(ctx context.Context, arg SetPreviousVerificationTokenParams) error
+	SetUserPicture(ctx context.Context, arg SetUserPictureParams) error
+	TouchAPIKey(ctx context.Context, id pgtype.UUID) error
 	UnlockUser(ctx context.Context, id pgtype.UUID) error
 	UpdateSessionLastActive(ctx context.Context, id pgtype.UUID) error
+	UpdateSessionTokenHash(ctx context.Context, arg UpdateSessionTokenHashParams) error
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
 	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
 	UpsertUserByGoogleID(ctx context.Context, arg UpsertUserByGoogleIDParams) (User, error)
 	VerifyUserEmail(ctx context.Context, id pgtype.UUID) (User, error)
 }
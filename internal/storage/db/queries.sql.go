@@ -13,7 +13,7 @@ import (
 )
 
 const countUserSessions = `-- name: CountUserSessions :one
-SELECT COUNT(*) FROM sessions WHERE user_id = $1
+SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND session_type = 'interactive'
 `
 
 func (q *Queries) CountUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error) {
@@ -51,17 +51,19 @@ func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams)
 
 const createSession = `-- name: CreateSession :one
 
-INSERT INTO sessions (user_id, token_hash, expires_at, ip_address, user_agent)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, user_id, token_hash, expires_at, last_active_at, ip_address, user_agent, created_at
+INSERT INTO sessions (user_id, token_hash, expires_at, ip_address, user_agent, session_type, persistent)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, user_id, token_hash, expires_at, last_active_at, ip_address, user_agent, created_at, session_type, persistent
 `
 
 type CreateSessionParams struct {
-	UserID    pgtype.UUID        `json:"user_id"`
-	TokenHash string             `json:"token_hash"`
-	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
-	IpAddress *netip.Addr        `json:"ip_address"`
-	UserAgent pgtype.Text        `json:"user_agent"`
+	UserID      pgtype.UUID        `json:"user_id"`
+	TokenHash   string             `json:"token_hash"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	IpAddress   *netip.Addr        `json:"ip_address"`
+	UserAgent   pgtype.Text        `json:"user_agent"`
+	SessionType string             `json:"session_type"`
+	Persistent  bool               `json:"persistent"`
 }
 
 // Sessions
@@ -72,6 +74,8 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 		arg.ExpiresAt,
 		arg.IpAddress,
 		arg.UserAgent,
+		arg.SessionType,
+		arg.Persistent,
 	)
 	var i Session
 	err := row.Scan(
@@ -83,6 +87,8 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 		&i.IpAddress,
 		&i.UserAgent,
 		&i.CreatedAt,
+		&i.SessionType,
+		&i.Persistent,
 	)
 	return i, err
 }
@@ -91,7 +97,7 @@ const createUser = `-- name: CreateUser :one
 
 INSERT INTO users (email, email_verified, name, picture, password_hash, provider, google_id)
 VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role
 `
 
 type CreateUserParams struct {
@@ -131,17 +137,36 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
 
-const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
-DELETE FROM sessions WHERE expires_at < NOW()
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :execrows
+DELETE FROM sessions
+WHERE id IN (
+    SELECT id FROM sessions
+    WHERE expires_at < NOW()
+       OR ($1::timestamptz IS NOT NULL
+           AND session_type <> 'service'
+           AND COALESCE(last_active_at, created_at) < $1::timestamptz)
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
 `
 
-func (q *Queries) DeleteExpiredSessions(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, deleteExpiredSessions)
-	return err
+type DeleteExpiredSessionsParams struct {
+	IdleCutoff pgtype.Timestamptz `json:"idle_cutoff"`
+	BatchSize  int32              `json:"batch_size"`
+}
+
+func (q *Queries) DeleteExpiredSessions(ctx context.Context, arg DeleteExpiredSessionsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredSessions, arg.IdleCutoff, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const deleteSession = `-- name: DeleteSession :exec
@@ -162,18 +187,21 @@ func (q *Queries) DeleteSessionByTokenHash(ctx context.Context, tokenHash string
 	return err
 }
 
-const deleteUserSessions = `-- name: DeleteUserSessions :exec
+const deleteUserSessions = `-- name: DeleteUserSessions :execrows
 DELETE FROM sessions WHERE user_id = $1
 `
 
-func (q *Queries) DeleteUserSessions(ctx context.Context, userID pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, deleteUserSessions, userID)
-	return err
+func (q *Queries) DeleteUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserSessions, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getOldestUserSession = `-- name: GetOldestUserSession :one
-SELECT id, user_id, token_hash, expires_at, last_active_at, ip_address, user_agent, created_at FROM sessions
-WHERE user_id = $1
+SELECT id, user_id, token_hash, expires_at, last_active_at, ip_address, user_agent, created_at, session_type, persistent FROM sessions
+WHERE user_id = $1 AND session_type = 'interactive'
 ORDER BY created_at ASC
 LIMIT 1
 `
@@ -190,13 +218,15 @@ func (q *Queries) GetOldestUserSession(ctx context.Context, userID pgtype.UUID)
 		&i.IpAddress,
 		&i.UserAgent,
 		&i.CreatedAt,
+		&i.SessionType,
+		&i.Persistent,
 	)
 	return i, err
 }
 
 const getSessionByTokenHash = `-- name: GetSessionByTokenHash :one
-SELECT s.id, s.user_id, s.token_hash, s.expires_at, s.last_active_at, s.ip_address, s.user_agent, s.created_at, u.id AS "user.id", u.email AS "user.email", u.email_verified AS "user.email_verified",
-       u.name AS "user.name", u.picture AS "user.picture", u.provider AS "user.provider"
+SELECT s.id, s.user_id, s.token_hash, s.expires_at, s.last_active_at, s.ip_address, s.user_agent, s.created_at, s.session_type, s.persistent, u.id AS "user.id", u.email AS "user.email", u.email_verified AS "user.email_verified",
+       u.name AS "user.name", u.picture AS "user.picture", u.provider AS "user.provider", u.role AS "user.role"
 FROM sessions s
 JOIN users u ON s.user_id = u.id
 WHERE s.token_hash = $1 AND s.expires_at > NOW()
@@ -211,12 +241,15 @@ type GetSessionByTokenHashRow struct {
 	IpAddress         *netip.Addr        `json:"ip_address"`
 	UserAgent         pgtype.Text        `json:"user_agent"`
 	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	SessionType       string             `json:"session_type"`
+	Persistent        bool               `json:"persistent"`
 	UserID_2          pgtype.UUID        `json:"user.id_2"`
 	UserEmail         string             `json:"user.email"`
 	UserEmailVerified bool               `json:"user.email_verified"`
 	UserName          string             `json:"user.name"`
 	UserPicture       pgtype.Text        `json:"user.picture"`
 	UserProvider      string             `json:"user.provider"`
+	UserRole          string             `json:"user.role"`
 }
 
 func (q *Queries) GetSessionByTokenHash(ctx context.Context, tokenHash string) (GetSessionByTokenHashRow, error) {
@@ -231,18 +264,21 @@ func (q *Queries) GetSessionByTokenHash(ctx context.Context, tokenHash string) (
 		&i.IpAddress,
 		&i.UserAgent,
 		&i.CreatedAt,
+		&i.SessionType,
+		&i.Persistent,
 		&i.UserID_2,
 		&i.UserEmail,
 		&i.UserEmailVerified,
 		&i.UserName,
 		&i.UserPicture,
 		&i.UserProvider,
+		&i.UserRole,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at FROM users WHERE email = $1
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -263,12 +299,14 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserByGoogleID = `-- name: GetUserByGoogleID :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at FROM users WHERE google_id = $1
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role FROM users WHERE google_id = $1
 `
 
 func (q *Queries) GetUserByGoogleID(ctx context.Context, googleID pgtype.Text) (User, error) {
@@ -289,12 +327,14 @@ func (q *Queries) GetUserByGoogleID(ctx context.Context, googleID pgtype.Text) (
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at FROM users WHERE id = $1
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error) {
@@ -315,6 +355,8 @@ func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
@@ -323,7 +365,7 @@ const incrementFailedLoginAttempts = `-- name: IncrementFailedLoginAttempts :one
 UPDATE users
 SET failed_login_attempts = failed_login_attempts + 1
 WHERE id = $1
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role
 `
 
 func (q *Queries) IncrementFailedLoginAttempts(ctx context.Context, id pgtype.UUID) (User, error) {
@@ -344,6 +386,8 @@ func (q *Queries) IncrementFailedLoginAttempts(ctx context.Context, id pgtype.UU
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
@@ -380,6 +424,54 @@ func (q *Queries) PurgeAuditLogsBefore(ctx context.Context, createdAt pgtype.Tim
 	return count, err
 }
 
+const listRecentLoginDevices = `-- name: ListRecentLoginDevices :many
+SELECT DISTINCT ip_address, user_agent FROM audit_logs
+WHERE user_id = $1
+  AND event_type IN ('login_success', 'oauth_login', 'register_success')
+  AND created_at >= $2
+  AND created_at < $3
+LIMIT $4
+`
+
+type ListRecentLoginDevicesParams struct {
+	UserID pgtype.UUID        `json:"user_id"`
+	Since  pgtype.Timestamptz `json:"since"`
+	Before pgtype.Timestamptz `json:"before"`
+	Limit  int32              `json:"limit"`
+}
+
+type ListRecentLoginDevicesRow struct {
+	IpAddress *netip.Addr `json:"ip_address"`
+	UserAgent pgtype.Text `json:"user_agent"`
+}
+
+// Distinct addresses and user agents the user signed in from between since and
+// before, taken from login audit events because sessions are deleted on logout.
+func (q *Queries) ListRecentLoginDevices(ctx context.Context, arg ListRecentLoginDevicesParams) ([]ListRecentLoginDevicesRow, error) {
+	rows, err := q.db.Query(ctx, listRecentLoginDevices,
+		arg.UserID,
+		arg.Since,
+		arg.Before,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRecentLoginDevicesRow{}
+	for rows.Next() {
+		var i ListRecentLoginDevicesRow
+		if err := rows.Scan(&i.IpAddress, &i.UserAgent); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const resetFailedLoginAttempts = `-- name: ResetFailedLoginAttempts :exec
 UPDATE users
 SET failed_login_attempts = 0
@@ -413,6 +505,22 @@ func (q *Queries) UpdateSessionLastActive(ctx context.Context, id pgtype.UUID) e
 	return err
 }
 
+const updateSessionTokenHash = `-- name: UpdateSessionTokenHash :exec
+UPDATE sessions
+SET token_hash = $2
+WHERE id = $1
+`
+
+type UpdateSessionTokenHashParams struct {
+	ID        pgtype.UUID `json:"id"`
+	TokenHash string      `json:"token_hash"`
+}
+
+func (q *Queries) UpdateSessionTokenHash(ctx context.Context, arg UpdateSessionTokenHashParams) error {
+	_, err := q.db.Exec(ctx, updateSessionTokenHash, arg.ID, arg.TokenHash)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET name = COALESCE($1, name),
@@ -420,7 +528,7 @@ SET name = COALESCE($1, name),
     email_verified = COALESCE($3, email_verified),
     password_hash = COALESCE($4, password_hash)
 WHERE id = $5
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role
 `
 
 type UpdateUserParams struct {
@@ -455,6 +563,8 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
@@ -478,7 +588,7 @@ func (q *Queries) SetEmailVerificationToken(ctx context.Context, arg SetEmailVer
 }
 
 const getUserByEmailVerificationTokenHash = `-- name: GetUserByEmailVerificationTokenHash :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role
 FROM users
 WHERE email_verification_token_hash = $1
 `
@@ -501,6 +611,8 @@ func (q *Queries) GetUserByEmailVerificationTokenHash(ctx context.Context, email
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
@@ -511,7 +623,7 @@ SET email_verified = TRUE,
     email_verification_token_hash = NULL,
     email_verification_expires_at = NULL
 WHERE id = $1
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role
 `
 
 func (q *Queries) VerifyUserEmail(ctx context.Context, id pgtype.UUID) (User, error) {
@@ -532,6 +644,8 @@ func (q *Queries) VerifyUserEmail(ctx context.Context, id pgtype.UUID) (User, er
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
 	)
 	return i, err
 }
@@ -561,7 +675,7 @@ SET email = EXCLUDED.email,
     name = EXCLUDED.name,
     picture = EXCLUDED.picture,
     provider = 'google'
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role
 `
 
 type UpsertUserByGoogleIDParams struct {
@@ -596,6 +710,811 @@ func (q *Queries) UpsertUserByGoogleID(ctx context.Context, arg UpsertUserByGoog
 		&i.LockedUntil,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
+	)
+	return i, err
+}
+
+const clearUserPicture = `-- name: ClearUserPicture :exec
+UPDATE users
+SET picture = NULL,
+    picture_etag = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ClearUserPicture(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, clearUserPicture, id)
+	return err
+}
+
+const setUserPicture = `-- name: SetUserPicture :exec
+UPDATE users
+SET picture = $2,
+    picture_etag = $3
+WHERE id = $1
+`
+
+type SetUserPictureParams struct {
+	ID          pgtype.UUID `json:"id"`
+	Picture     pgtype.Text `json:"picture"`
+	PictureEtag pgtype.Text `json:"picture_etag"`
+}
+
+func (q *Queries) SetUserPicture(ctx context.Context, arg SetUserPictureParams) error {
+	_, err := q.db.Exec(ctx, setUserPicture, arg.ID, arg.Picture, arg.PictureEtag)
+	return err
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+
+INSERT INTO api_keys (user_id, name, key_prefix, key_hash, expires_at, scopes)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, user_id, name, key_prefix, key_hash, expires_at, last_used_at, revoked_at, created_at, scopes
+`
+
+type CreateAPIKeyParams struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	Name      string             `json:"name"`
+	KeyPrefix string             `json:"key_prefix"`
+	KeyHash   string             `json:"key_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	Scopes    []string           `json:"scopes"`
+}
+
+// API keys
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, createAPIKey,
+		arg.UserID,
+		arg.Name,
+		arg.KeyPrefix,
+		arg.KeyHash,
+		arg.ExpiresAt,
+		arg.Scopes,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.KeyPrefix,
+		&i.KeyHash,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+		&i.Scopes,
+	)
+	return i, err
+}
+
+const getAPIKeyByHash = `-- name: GetAPIKeyByHash :one
+SELECT k.id, k.user_id, k.name, k.key_prefix, k.key_hash, k.expires_at, k.last_used_at, k.revoked_at, k.created_at, k.scopes, u.id AS "user.id", u.email AS "user.email", u.email_verified AS "user.email_verified",
+       u.name AS "user.name", u.picture AS "user.picture", u.provider AS "user.provider", u.role AS "user.role",
+       u.locked_until AS "user.locked_until"
+FROM api_keys k
+JOIN users u ON k.user_id = u.id
+WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+`
+
+type GetAPIKeyByHashRow struct {
+	ID                pgtype.UUID        `json:"id"`
+	UserID            pgtype.UUID        `json:"user_id"`
+	Name              string             `json:"name"`
+	KeyPrefix         string             `json:"key_prefix"`
+	KeyHash           string             `json:"key_hash"`
+	ExpiresAt         pgtype.Timestamptz `json:"expires_at"`
+	LastUsedAt        pgtype.Timestamptz `json:"last_used_at"`
+	RevokedAt         pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	Scopes            []string           `json:"scopes"`
+	UserID_2          pgtype.UUID        `json:"user.id_2"`
+	UserEmail         string             `json:"user.email"`
+	UserEmailVerified bool               `json:"user.email_verified"`
+	UserName          string             `json:"user.name"`
+	UserPicture       pgtype.Text        `json:"user.picture"`
+	UserProvider      string             `json:"user.provider"`
+	UserRole          string             `json:"user.role"`
+	UserLockedUntil   pgtype.Timestamptz `json:"user.locked_until"`
+}
+
+func (q *Queries) GetAPIKeyByHash(ctx context.Context, keyHash string) (GetAPIKeyByHashRow, error) {
+	row := q.db.QueryRow(ctx, getAPIKeyByHash, keyHash)
+	var i GetAPIKeyByHashRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.KeyPrefix,
+		&i.KeyHash,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+		&i.Scopes,
+		&i.UserID_2,
+		&i.UserEmail,
+		&i.UserEmailVerified,
+		&i.UserName,
+		&i.UserPicture,
+		&i.UserProvider,
+		&i.UserRole,
+		&i.UserLockedUntil,
+	)
+	return i, err
+}
+
+const listUserAPIKeys = `-- name: ListUserAPIKeys :many
+SELECT id, user_id, name, key_prefix, key_hash, expires_at, last_used_at, revoked_at, created_at, scopes FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListUserAPIKeys(ctx context.Context, userID pgtype.UUID) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, listUserAPIKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ApiKey{}
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.KeyPrefix,
+			&i.KeyHash,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+			&i.CreatedAt,
+			&i.Scopes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countActiveUserAPIKeys = `-- name: CountActiveUserAPIKeys :one
+SELECT COUNT(*) FROM api_keys
+WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+`
+
+func (q *Queries) CountActiveUserAPIKeys(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countActiveUserAPIKeys, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeAPIKeyParams struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID pgtype.UUID `json:"user_id"`
+}
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAPIKey, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TouchAPIKey(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, touchAPIKey, id)
+	return err
+}
+
+const revokeUserAPIKeys = `-- name: RevokeUserAPIKeys :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserAPIKeys(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeUserAPIKeys, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createRecipe = `-- name: CreateRecipe :one
+
+INSERT INTO recipes (user_id, request, recipe)
+VALUES ($1, $2, $3)
+RETURNING id, user_id, request, recipe, created_at
+`
+
+type CreateRecipeParams struct {
+	UserID  pgtype.UUID `json:"user_id"`
+	Request []byte      `json:"request"`
+	Recipe  []byte      `json:"recipe"`
+}
+
+// Recipes
+func (q *Queries) CreateRecipe(ctx context.Context, arg CreateRecipeParams) (Recipe, error) {
+	row := q.db.QueryRow(ctx, createRecipe, arg.UserID, arg.Request, arg.Recipe)
+	var i Recipe
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Request,
+		&i.Recipe,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listRecipesForUser = `-- name: ListRecipesForUser :many
+SELECT id, user_id, request, recipe, created_at FROM recipes
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListRecipesForUserParams struct {
+	UserID pgtype.UUID `json:"user_id"`
+	Limit  int32       `json:"limit"`
+	Offset int32       `json:"offset"`
+}
+
+func (q *Queries) ListRecipesForUser(ctx context.Context, arg ListRecipesForUserParams) ([]Recipe, error) {
+	rows, err := q.db.Query(ctx, listRecipesForUser, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Recipe{}
+	for rows.Next() {
+		var i Recipe
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Request,
+			&i.Recipe,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecipeByID = `-- name: GetRecipeByID :one
+SELECT id, user_id, request, recipe, created_at FROM recipes
+WHERE id = $1 AND user_id = $2
+`
+
+type GetRecipeByIDParams struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID pgtype.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetRecipeByID(ctx context.Context, arg GetRecipeByIDParams) (Recipe, error) {
+	row := q.db.QueryRow(ctx, getRecipeByID, arg.ID, arg.UserID)
+	var i Recipe
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Request,
+		&i.Recipe,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getEmailVerificationSend = `-- name: GetEmailVerificationSend :one
+
+SELECT user_id, attempts, last_sent_at FROM email_verification_sends
+WHERE user_id = $1
+`
+
+// Email verification sends
+func (q *Queries) GetEmailVerificationSend(ctx context.Context, userID pgtype.UUID) (EmailVerificationSend, error) {
+	row := q.db.QueryRow(ctx, getEmailVerificationSend, userID)
+	var i EmailVerificationSend
+	err := row.Scan(&i.UserID, &i.Attempts, &i.LastSentAt)
+	return i, err
+}
+
+const recordEmailVerificationSend = `-- name: RecordEmailVerificationSend :one
+INSERT INTO email_verification_sends (user_id, attempts, last_sent_at)
+VALUES ($1, 1, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET attempts = CASE
+        WHEN email_verification_sends.last_sent_at < $2 THEN 1
+        ELSE email_verification_sends.attempts + 1
+    END,
+    last_sent_at = NOW()
+RETURNING user_id, attempts, last_sent_at
+`
+
+type RecordEmailVerificationSendParams struct {
+	UserID      pgtype.UUID        `json:"user_id"`
+	ResetBefore pgtype.Timestamptz `json:"reset_before"`
+}
+
+func (q *Queries) RecordEmailVerificationSend(ctx context.Context, arg RecordEmailVerificationSendParams) (EmailVerificationSend, error) {
+	row := q.db.QueryRow(ctx, recordEmailVerificationSend, arg.UserID, arg.ResetBefore)
+	var i EmailVerificationSend
+	err := row.Scan(&i.UserID, &i.Attempts, &i.LastSentAt)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, email, name, provider, role, email_verified, locked_until, created_at FROM users
+WHERE ($1::text IS NULL OR provider = $1::text)
+  AND ($2::boolean IS NULL OR email_verified = $2::boolean)
+  AND ($3::timestamptz IS NULL
+       OR (created_at, id) < ($3::timestamptz, $4::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type ListUsersParams struct {
+	Provider        pgtype.Text        `json:"provider"`
+	EmailVerified   pgtype.Bool        `json:"email_verified"`
+	BeforeCreatedAt pgtype.Timestamptz `json:"before_created_at"`
+	BeforeID        pgtype.UUID        `json:"before_id"`
+	Limit           int32              `json:"limit"`
+}
+
+type ListUsersRow struct {
+	ID            pgtype.UUID        `json:"id"`
+	Email         string             `json:"email"`
+	Name          string             `json:"name"`
+	Provider      string             `json:"provider"`
+	Role          string             `json:"role"`
+	EmailVerified bool               `json:"email_verified"`
+	LockedUntil   pgtype.Timestamptz `json:"locked_until"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUsersRow, error) {
+	rows, err := q.db.Query(ctx, listUsers,
+		arg.Provider,
+		arg.EmailVerified,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUsersRow{}
+	for rows.Next() {
+		var i ListUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Name,
+			&i.Provider,
+			&i.Role,
+			&i.EmailVerified,
+			&i.LockedUntil,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clearExpiredAuthTokens = `-- name: ClearExpiredAuthTokens :execrows
+UPDATE users
+SET email_verification_token_hash = NULL,
+    email_verification_expires_at = NULL
+WHERE email_verification_expires_at < $1
+`
+
+func (q *Queries) ClearExpiredAuthTokens(ctx context.Context, emailVerificationExpiresAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, clearExpiredAuthTokens, emailVerificationExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE id = $1
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag, role
+`
+
+type UpdateUserRoleParams struct {
+	ID   pgtype.UUID `json:"id"`
+	Role string      `json:"role"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.EmailVerified,
+		&i.Name,
+		&i.Picture,
+		&i.PasswordHash,
+		&i.Provider,
+		&i.GoogleID,
+		&i.EmailVerificationTokenHash,
+		&i.EmailVerificationExpiresAt,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PictureEtag,
+		&i.Role,
+	)
+	return i, err
+}
+
+const listPasswordHistory = `-- name: ListPasswordHistory :many
+SELECT password_hash FROM password_history
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2
+`
+
+type ListPasswordHistoryParams struct {
+	UserID pgtype.UUID `json:"user_id"`
+	Limit  int32       `json:"limit"`
+}
+
+func (q *Queries) ListPasswordHistory(ctx context.Context, arg ListPasswordHistoryParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, listPasswordHistory, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var password_hash string
+		if err := rows.Scan(&password_hash); err != nil {
+			return nil, err
+		}
+		items = append(items, password_hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const addPasswordHistory = `-- name: AddPasswordHistory :exec
+INSERT INTO password_history (user_id, password_hash)
+VALUES ($1, $2)
+`
+
+type AddPasswordHistoryParams struct {
+	UserID       pgtype.UUID `json:"user_id"`
+	PasswordHash string      `json:"password_hash"`
+}
+
+func (q *Queries) AddPasswordHistory(ctx context.Context, arg AddPasswordHistoryParams) error {
+	_, err := q.db.Exec(ctx, addPasswordHistory, arg.UserID, arg.PasswordHash)
+	return err
+}
+
+const prunePasswordHistory = `-- name: PrunePasswordHistory :execrows
+DELETE FROM password_history
+WHERE user_id = $1
+  AND id NOT IN (
+    SELECT id FROM password_history
+    WHERE user_id = $1
+    ORDER BY created_at DESC, id DESC
+    LIMIT $2
+  )
+`
+
+type PrunePasswordHistoryParams struct {
+	UserID pgtype.UUID `json:"user_id"`
+	Keep   int32       `json:"keep"`
+}
+
+func (q *Queries) PrunePasswordHistory(ctx context.Context, arg PrunePasswordHistoryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, prunePasswordHistory, arg.UserID, arg.Keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setPreviousVerificationToken = `-- name: SetPreviousVerificationToken :exec
+
+INSERT INTO email_verification_previous_tokens (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET token_hash = EXCLUDED.token_hash,
+    expires_at = EXCLUDED.expires_at
+`
+
+type SetPreviousVerificationTokenParams struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+// Previous email verification tokens
+func (q *Queries) SetPreviousVerificationToken(ctx context.Context, arg SetPreviousVerificationTokenParams) error {
+	_, err := q.db.Exec(ctx, setPreviousVerificationToken, arg.UserID, arg.TokenHash, arg.ExpiresAt)
+	return err
+}
+
+const getPreviousVerificationToken = `-- name: GetPreviousVerificationToken :one
+SELECT user_id, token_hash, expires_at FROM email_verification_previous_tokens
+WHERE token_hash = $1
+`
+
+func (q *Queries) GetPreviousVerificationToken(ctx context.Context, tokenHash string) (EmailVerificationPreviousToken, error) {
+	row := q.db.QueryRow(ctx, getPreviousVerificationToken, tokenHash)
+	var i EmailVerificationPreviousToken
+	err := row.Scan(&i.UserID, &i.TokenHash, &i.ExpiresAt)
+	return i, err
+}
+
+const deletePreviousVerificationToken = `-- name: DeletePreviousVerificationToken :exec
+DELETE FROM email_verification_previous_tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) DeletePreviousVerificationToken(ctx context.Context, userID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deletePreviousVerificationToken, userID)
+	return err
+}
+
+const deleteExpiredPreviousVerificationTokens = `-- name: DeleteExpiredPreviousVerificationTokens :execrows
+DELETE FROM email_verification_previous_tokens
+WHERE expires_at < $1
+`
+
+func (q *Queries) DeleteExpiredPreviousVerificationTokens(ctx context.Context, expiresAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredPreviousVerificationTokens, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getUserIdentity = `-- name: GetUserIdentity :one
+
+SELECT provider, subject, user_id, email, private_email, created_at FROM user_identities
+WHERE provider = $1 AND subject = $2
+`
+
+type GetUserIdentityParams struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+// User identities
+func (q *Queries) GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error) {
+	row := q.db.QueryRow(ctx, getUserIdentity, arg.Provider, arg.Subject)
+	var i UserIdentity
+	err := row.Scan(
+		&i.Provider,
+		&i.Subject,
+		&i.UserID,
+		&i.Email,
+		&i.PrivateEmail,
+		&i.CreatedAt,
 	)
 	return i, err
 }
+
+const createUserIdentity = `-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (provider, subject, user_id, email, private_email)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateUserIdentityParams struct {
+	Provider     string      `json:"provider"`
+	Subject      string      `json:"subject"`
+	UserID       pgtype.UUID `json:"user_id"`
+	Email        string      `json:"email"`
+	PrivateEmail bool        `json:"private_email"`
+}
+
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, createUserIdentity,
+		arg.Provider,
+		arg.Subject,
+		arg.UserID,
+		arg.Email,
+		arg.PrivateEmail,
+	)
+	return err
+}
+
+const countActiveSessionsByDay = `-- name: CountActiveSessionsByDay :many
+SELECT (d.day AT TIME ZONE 'UTC')::date AS day, COUNT(s.id) AS count
+FROM generate_series($1::timestamptz, $2::timestamptz - interval '24 hours', interval '24 hours') AS d(day)
+LEFT JOIN sessions s
+  ON s.last_active_at >= d.day
+ AND s.created_at < d.day + interval '24 hours'
+GROUP BY d.day
+ORDER BY d.day
+`
+
+type CountActiveSessionsByDayParams struct {
+	Since pgtype.Timestamptz `json:"since"`
+	Until pgtype.Timestamptz `json:"until"`
+}
+
+type CountActiveSessionsByDayRow struct {
+	Day   pgtype.Date `json:"day"`
+	Count int64       `json:"count"`
+}
+
+// Sessions in use on each UTC day from since up to until: created before the
+// day ended and last active after it began. Sessions deleted by logout or
+// cleanup are no longer counted.
+func (q *Queries) CountActiveSessionsByDay(ctx context.Context, arg CountActiveSessionsByDayParams) ([]CountActiveSessionsByDayRow, error) {
+	rows, err := q.db.Query(ctx, countActiveSessionsByDay, arg.Since, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountActiveSessionsByDayRow{}
+	for rows.Next() {
+		var i CountActiveSessionsByDayRow
+		if err := rows.Scan(&i.Day, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countUsersCreatedByDay = `-- name: CountUsersCreatedByDay :many
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count
+FROM users
+WHERE created_at >= $1
+  AND created_at < $2
+GROUP BY day
+ORDER BY day
+`
+
+type CountUsersCreatedByDayParams struct {
+	Since pgtype.Timestamptz `json:"since"`
+	Until pgtype.Timestamptz `json:"until"`
+}
+
+type CountUsersCreatedByDayRow struct {
+	Day   pgtype.Date `json:"day"`
+	Count int64       `json:"count"`
+}
+
+// New accounts per UTC day, for every sign-up method. Days without one are
+// left out.
+func (q *Queries) CountUsersCreatedByDay(ctx context.Context, arg CountUsersCreatedByDayParams) ([]CountUsersCreatedByDayRow, error) {
+	rows, err := q.db.Query(ctx, countUsersCreatedByDay, arg.Since, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountUsersCreatedByDayRow{}
+	for rows.Next() {
+		var i CountUsersCreatedByDayRow
+		if err := rows.Scan(&i.Day, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countAuditEventsByDay = `-- name: CountAuditEventsByDay :many
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count
+FROM audit_logs
+WHERE event_type = ANY($1::text[])
+  AND created_at >= $2
+  AND created_at < $3
+GROUP BY day
+ORDER BY day
+`
+
+type CountAuditEventsByDayParams struct {
+	EventTypes []string           `json:"event_types"`
+	Since      pgtype.Timestamptz `json:"since"`
+	Until      pgtype.Timestamptz `json:"until"`
+}
+
+type CountAuditEventsByDayRow struct {
+	Day   pgtype.Date `json:"day"`
+	Count int64       `json:"count"`
+}
+
+// Audit events of the given types per UTC day. Days without one are left out.
+func (q *Queries) CountAuditEventsByDay(ctx context.Context, arg CountAuditEventsByDayParams) ([]CountAuditEventsByDayRow, error) {
+	rows, err := q.db.Query(ctx, countAuditEventsByDay, arg.EventTypes, arg.Since, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountAuditEventsByDayRow{}
+	for rows.Next() {
+		var i CountAuditEventsByDayRow
+		if err := rows.Scan(&i.Day, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createAuditLogBatch = `-- name: CreateAuditLogBatch :exec
+INSERT INTO audit_logs (user_id, event_type, ip_address, user_agent, metadata, created_at)
+SELECT e.user_id, e.event_type, NULLIF(e.ip_address, '')::inet, NULLIF(e.user_agent, ''), NULLIF(e.metadata, '')::jsonb, e.created_at
+FROM unnest(
+    $1::uuid[],
+    $2::text[],
+    $3::text[],
+    $4::text[],
+    $5::text[],
+    $6::timestamptz[]
+) WITH ORDINALITY AS e(user_id, event_type, ip_address, user_agent, metadata, created_at, n)
+ORDER BY e.n
+`
+
+type CreateAuditLogBatchParams struct {
+	UserIds     []pgtype.UUID        `json:"user_ids"`
+	EventTypes  []string             `json:"event_types"`
+	IpAddresses []string             `json:"ip_addresses"`
+	UserAgents  []string             `json:"user_agents"`
+	Metadata    []string             `json:"metadata"`
+	CreatedAts  []pgtype.Timestamptz `json:"created_ats"`
+}
+
+// Inserts one row per array index, in order. Empty IP, user agent and metadata
+// strings are stored as NULL; created_at is the time each event was logged.
+func (q *Queries) CreateAuditLogBatch(ctx context.Context, arg CreateAuditLogBatchParams) error {
+	_, err := q.db.Exec(ctx, createAuditLogBatch,
+		arg.UserIds,
+		arg.EventTypes,
+		arg.IpAddresses,
+		arg.UserAgents,
+		arg.Metadata,
+		arg.CreatedAts,
+	)
+	return err
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+
+	"github.com/mounis-bhat/starter/migrations"
+)
+
+// applyMigrations runs every pending embedded migration (AUTO_MIGRATE=true).
+// goose holds a Postgres advisory lock while it works, so when several
+// instances start together one applies the migrations and the rest wait, then
+// find nothing left to do.
+func applyMigrations(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger) error {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return fmt.Errorf("failed to create migration lock: %w", err)
+	}
+
+	// Closing the *sql.DB releases its connections but leaves the pool open.
+	sqlDB := stdlib.OpenDBFromPool(pool)
+	defer sqlDB.Close()
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, sqlDB, migrations.FS, goose.WithSessionLocker(locker))
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	results, err := provider.Up(ctx)
+	var partial *goose.PartialError
+	if errors.As(err, &partial) {
+		results = partial.Applied
+	}
+	for _, result := range results {
+		logger.Info("migration applied",
+			slog.Int64("version", result.Source.Version),
+			slog.String("file", path.Base(result.Source.Path)),
+			slog.Duration("duration", result.Duration),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	version, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	logger.Info("database schema up to date", slog.Int64("version", version), slog.Int("applied", len(results)))
+	return nil
+}
@@ -0,0 +1,60 @@
+package oauthstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "oauth:state:"
+
+// Entry is what the OAuth callback needs from the login that started the flow.
+type Entry struct {
+	State string `json:"state"`
+	// Verifier is the PKCE code verifier. The ID token nonce is derived from it
+	// too, which for Apple, with no PKCE, is its only use.
+	Verifier string `json:"verifier"`
+	// Redirect is the validated post-login destination requested at login, if any.
+	Redirect string `json:"redirect,omitempty"`
+}
+
+// ValkeyStore keeps OAuth state and PKCE verifiers server-side, keyed by an
+// opaque id, so only the id reaches the browser.
+type ValkeyStore struct {
+	client *redis.Client
+}
+
+// NewValkeyStore uses client, which the caller owns and closes.
+func NewValkeyStore(client *redis.Client) *ValkeyStore {
+	return &ValkeyStore{client: client}
+}
+
+// Save stores entry under id until ttl elapses.
+func (s *ValkeyStore) Save(ctx context.Context, id string, entry Entry, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, keyPrefix+id, data, ttl).Err()
+}
+
+// Take returns and deletes the entry for id in one step, so a callback can only
+// be completed once. found is false when the entry expired or was already used.
+func (s *ValkeyStore) Take(ctx context.Context, id string) (Entry, bool, error) {
+	data, err := s.client.GetDel(ctx, keyPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return Entry{}, false, nil
+		}
+		return Entry{}, false, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, false, err
+	}
+	return entry, true, nil
+}
@@ -3,16 +3,16 @@
 -- name: CreateUser :one
 INSERT INTO users (email, email_verified, name, picture, password_hash, provider, google_id)
 VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at;
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag;
 
 -- name: GetUserByID :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at FROM users WHERE id = $1;
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag FROM users WHERE id = $1;
 
 -- name: GetUserByEmail :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at FROM users WHERE email = $1;
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag FROM users WHERE email = $1;
 
 -- name: GetUserByGoogleID :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at FROM users WHERE google_id = $1;
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag FROM users WHERE google_id = $1;
 
 -- name: UpsertUserByGoogleID :one
 INSERT INTO users (email, email_verified, name, picture, password_hash, provider, google_id)
@@ -23,7 +23,7 @@ SET email = EXCLUDED.email,
     name = EXCLUDED.name,
     picture = EXCLUDED.picture,
     provider = 'google'
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at;
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag;
 
 -- name: UpdateUser :one
 UPDATE users
@@ -32,7 +32,7 @@ SET name = COALESCE(sqlc.narg('name'), name),
     email_verified = COALESCE(sqlc.narg('email_verified'), email_verified),
     password_hash = COALESCE(sqlc.narg('password_hash'), password_hash)
 WHERE id = sqlc.arg('id')
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at;
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag;
 
 -- name: SetEmailVerificationToken :exec
 UPDATE users
@@ -41,7 +41,7 @@ SET email_verification_token_hash = $2,
 WHERE id = $1;
 
 -- name: GetUserByEmailVerificationTokenHash :one
-SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at
+SELECT id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag
 FROM users
 WHERE email_verification_token_hash = $1;
 
@@ -51,7 +51,7 @@ SET email_verified = TRUE,
     email_verification_token_hash = NULL,
     email_verification_expires_at = NULL
 WHERE id = $1
-RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at;
+RETURNING id, email, email_verified, name, picture, password_hash, provider, google_id, email_verification_token_hash, email_verification_expires_at, failed_login_attempts, locked_until, created_at, updated_at, picture_etag;
 
 -- name: UpdateUserPassword :exec
 UPDATE users
@@ -79,16 +79,49 @@ UPDATE users
 SET locked_until = NULL, failed_login_attempts = 0
 WHERE id = $1;
 
+-- name: ClearUserPicture :exec
+UPDATE users
+SET picture = NULL,
+    picture_etag = NULL
+WHERE id = $1;
+
+-- name: SetUserPicture :exec
+UPDATE users
+SET picture = $2,
+    picture_etag = $3
+WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT id, email, name, provider, role, email_verified, locked_until, created_at FROM users
+WHERE (sqlc.narg('provider')::text IS NULL OR provider = sqlc.narg('provider')::text)
+  AND (sqlc.narg('email_verified')::boolean IS NULL OR email_verified = sqlc.narg('email_verified')::boolean)
+  AND (sqlc.narg('before_created_at')::timestamptz IS NULL
+       OR (created_at, id) < (sqlc.narg('before_created_at')::timestamptz, sqlc.narg('before_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ClearExpiredAuthTokens :execrows
+UPDATE users
+SET email_verification_token_hash = NULL,
+    email_verification_expires_at = NULL
+WHERE email_verification_expires_at < $1;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE id = $1
+RETURNING *;
+
 -- Sessions
 
 -- name: CreateSession :one
-INSERT INTO sessions (user_id, token_hash, expires_at, ip_address, user_agent)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO sessions (user_id, token_hash, expires_at, ip_address, user_agent, session_type, persistent)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: GetSessionByTokenHash :one
 SELECT s.*, u.id AS "user.id", u.email AS "user.email", u.email_verified AS "user.email_verified",
-       u.name AS "user.name", u.picture AS "user.picture", u.provider AS "user.provider"
+       u.name AS "user.name", u.picture AS "user.picture", u.provider AS "user.provider", u.role AS "user.role"
 FROM sessions s
 JOIN users u ON s.user_id = u.id
 WHERE s.token_hash = $1 AND s.expires_at > NOW();
@@ -98,26 +131,40 @@ UPDATE sessions
 SET last_active_at = NOW()
 WHERE id = $1;
 
+-- name: UpdateSessionTokenHash :exec
+UPDATE sessions
+SET token_hash = $2
+WHERE id = $1;
+
 -- name: DeleteSession :exec
 DELETE FROM sessions WHERE id = $1;
 
 -- name: DeleteSessionByTokenHash :exec
 DELETE FROM sessions WHERE token_hash = $1;
 
--- name: DeleteUserSessions :exec
+-- name: DeleteUserSessions :execrows
 DELETE FROM sessions WHERE user_id = $1;
 
 -- name: CountUserSessions :one
-SELECT COUNT(*) FROM sessions WHERE user_id = $1;
+SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND session_type = 'interactive';
 
 -- name: GetOldestUserSession :one
 SELECT * FROM sessions
-WHERE user_id = $1
+WHERE user_id = $1 AND session_type = 'interactive'
 ORDER BY created_at ASC
 LIMIT 1;
 
--- name: DeleteExpiredSessions :exec
-DELETE FROM sessions WHERE expires_at < NOW();
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM sessions
+WHERE id IN (
+    SELECT id FROM sessions
+    WHERE expires_at < NOW()
+       OR (sqlc.narg('idle_cutoff')::timestamptz IS NOT NULL
+           AND session_type <> 'service'
+           AND COALESCE(last_active_at, created_at) < sqlc.narg('idle_cutoff')::timestamptz)
+    LIMIT sqlc.arg('batch_size')
+    FOR UPDATE SKIP LOCKED
+);
 
 -- Audit logs
 
@@ -125,6 +172,21 @@ DELETE FROM sessions WHERE expires_at < NOW();
 INSERT INTO audit_logs (user_id, event_type, ip_address, user_agent, metadata)
 VALUES ($1, $2, $3, $4, $5);
 
+-- name: CreateAuditLogBatch :exec
+-- Inserts one row per array index, in order. Empty IP, user agent and metadata
+-- strings are stored as NULL; created_at is the time each event was logged.
+INSERT INTO audit_logs (user_id, event_type, ip_address, user_agent, metadata, created_at)
+SELECT e.user_id, e.event_type, NULLIF(e.ip_address, '')::inet, NULLIF(e.user_agent, ''), NULLIF(e.metadata, '')::jsonb, e.created_at
+FROM unnest(
+    sqlc.arg('user_ids')::uuid[],
+    sqlc.arg('event_types')::text[],
+    sqlc.arg('ip_addresses')::text[],
+    sqlc.arg('user_agents')::text[],
+    sqlc.arg('metadata')::text[],
+    sqlc.arg('created_ats')::timestamptz[]
+) WITH ORDINALITY AS e(user_id, event_type, ip_address, user_agent, metadata, created_at, n)
+ORDER BY e.n;
+
 -- name: PurgeAuditLogsBefore :one
 WITH deleted AS (
     DELETE FROM audit_logs
@@ -132,3 +194,173 @@ WITH deleted AS (
     RETURNING 1
 )
 SELECT COUNT(*) FROM deleted;
+
+-- name: ListRecentLoginDevices :many
+-- Distinct addresses and user agents the user signed in from between since and
+-- before, taken from login audit events because sessions are deleted on logout.
+SELECT DISTINCT ip_address, user_agent FROM audit_logs
+WHERE user_id = sqlc.arg('user_id')
+  AND event_type IN ('login_success', 'oauth_login', 'register_success')
+  AND created_at >= sqlc.arg('since')
+  AND created_at < sqlc.arg('before')
+LIMIT sqlc.arg('limit');
+
+-- API keys
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (user_id, name, key_prefix, key_hash, expires_at, scopes)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT k.*, u.id AS "user.id", u.email AS "user.email", u.email_verified AS "user.email_verified",
+       u.name AS "user.name", u.picture AS "user.picture", u.provider AS "user.provider", u.role AS "user.role",
+       u.locked_until AS "user.locked_until"
+FROM api_keys k
+JOIN users u ON k.user_id = u.id
+WHERE k.key_hash = $1 AND k.revoked_at IS NULL;
+
+-- name: ListUserAPIKeys :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: CountActiveUserAPIKeys :one
+SELECT COUNT(*) FROM api_keys
+WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: RevokeUserAPIKeys :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- Recipes
+
+-- name: CreateRecipe :one
+INSERT INTO recipes (user_id, request, recipe)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: ListRecipesForUser :many
+SELECT * FROM recipes
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetRecipeByID :one
+SELECT * FROM recipes
+WHERE id = $1 AND user_id = $2;
+
+-- Email verification sends
+
+-- name: GetEmailVerificationSend :one
+SELECT * FROM email_verification_sends
+WHERE user_id = $1;
+
+-- name: RecordEmailVerificationSend :one
+INSERT INTO email_verification_sends (user_id, attempts, last_sent_at)
+VALUES (sqlc.arg('user_id'), 1, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET attempts = CASE
+        WHEN email_verification_sends.last_sent_at < sqlc.arg('reset_before') THEN 1
+        ELSE email_verification_sends.attempts + 1
+    END,
+    last_sent_at = NOW()
+RETURNING *;
+
+-- Password history
+
+-- name: ListPasswordHistory :many
+SELECT password_hash FROM password_history
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+
+-- name: AddPasswordHistory :exec
+INSERT INTO password_history (user_id, password_hash)
+VALUES ($1, $2);
+
+-- name: PrunePasswordHistory :execrows
+DELETE FROM password_history
+WHERE user_id = sqlc.arg('user_id')
+  AND id NOT IN (
+    SELECT id FROM password_history
+    WHERE user_id = sqlc.arg('user_id')
+    ORDER BY created_at DESC, id DESC
+    LIMIT sqlc.arg('keep')
+  );
+
+-- Previous email verification tokens
+
+-- name: SetPreviousVerificationToken :exec
+INSERT INTO email_verification_previous_tokens (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET token_hash = EXCLUDED.token_hash,
+    expires_at = EXCLUDED.expires_at;
+
+-- name: GetPreviousVerificationToken :one
+SELECT * FROM email_verification_previous_tokens
+WHERE token_hash = $1;
+
+-- name: DeletePreviousVerificationToken :exec
+DELETE FROM email_verification_previous_tokens
+WHERE user_id = $1;
+
+-- name: DeleteExpiredPreviousVerificationTokens :execrows
+DELETE FROM email_verification_previous_tokens
+WHERE expires_at < $1;
+
+-- User identities
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (provider, subject, user_id, email, private_email)
+VALUES ($1, $2, $3, $4, $5);
+
+-- Stats
+
+-- name: CountActiveSessionsByDay :many
+-- Sessions in use on each UTC day from since up to until: created before the
+-- day ended and last active after it began. Sessions deleted by logout or
+-- cleanup are no longer counted.
+SELECT (d.day AT TIME ZONE 'UTC')::date AS day, COUNT(s.id) AS count
+FROM generate_series(sqlc.arg('since')::timestamptz, sqlc.arg('until')::timestamptz - interval '24 hours', interval '24 hours') AS d(day)
+LEFT JOIN sessions s
+  ON s.last_active_at >= d.day
+ AND s.created_at < d.day + interval '24 hours'
+GROUP BY d.day
+ORDER BY d.day;
+
+-- name: CountUsersCreatedByDay :many
+-- New accounts per UTC day, for every sign-up method. Days without one are
+-- left out.
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count
+FROM users
+WHERE created_at >= sqlc.arg('since')
+  AND created_at < sqlc.arg('until')
+GROUP BY day
+ORDER BY day;
+
+-- name: CountAuditEventsByDay :many
+-- Audit events of the given types per UTC day. Days without one are left out.
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count
+FROM audit_logs
+WHERE event_type = ANY(sqlc.arg('event_types')::text[])
+  AND created_at >= sqlc.arg('since')
+  AND created_at < sqlc.arg('until')
+GROUP BY day
+ORDER BY day;
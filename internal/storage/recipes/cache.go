@@ -0,0 +1,45 @@
+package recipes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
+	"github.com/redis/go-redis/v9"
+)
+
+// ValkeyCache stores generated recipes as JSON in Valkey.
+type ValkeyCache struct {
+	client *redis.Client
+}
+
+// NewValkeyCache uses client, which the caller owns and closes.
+func NewValkeyCache(client *redis.Client) *ValkeyCache {
+	return &ValkeyCache{client: client}
+}
+
+func (c *ValkeyCache) Get(ctx context.Context, key string) (*apprecipes.Recipe, bool, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var recipe apprecipes.Recipe
+	if err := json.Unmarshal(data, &recipe); err != nil {
+		return nil, false, err
+	}
+	return &recipe, true, nil
+}
+
+func (c *ValkeyCache) Set(ctx context.Context, key string, recipe *apprecipes.Recipe, ttl time.Duration) error {
+	data, err := json.Marshal(recipe)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, key, data, ttl).Err()
+}
@@ -0,0 +1,117 @@
+package recipes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	apprecipes "github.com/mounis-bhat/starter/internal/app/recipes"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+)
+
+// Repository stores recipes in Postgres as JSONB request/result pairs.
+type Repository struct {
+	queries *db.Queries
+}
+
+func NewRepository(queries *db.Queries) *Repository {
+	return &Repository{queries: queries}
+}
+
+func (r *Repository) Save(ctx context.Context, userID string, req apprecipes.RecipeRequest, recipe *apprecipes.Recipe) (*apprecipes.SavedRecipe, error) {
+	owner, err := parseUUID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id: %w", err)
+	}
+
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	result, err := json.Marshal(recipe)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := r.queries.CreateRecipe(ctx, db.CreateRecipeParams{
+		UserID:  owner,
+		Request: request,
+		Recipe:  result,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toSavedRecipe(row)
+}
+
+func (r *Repository) ListForUser(ctx context.Context, userID string, limit, offset int) ([]*apprecipes.SavedRecipe, error) {
+	owner, err := parseUUID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id: %w", err)
+	}
+
+	rows, err := r.queries.ListRecipesForUser(ctx, db.ListRecipesForUserParams{
+		UserID: owner,
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recipes := make([]*apprecipes.SavedRecipe, 0, len(rows))
+	for _, row := range rows {
+		recipe, err := toSavedRecipe(row)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+	return recipes, nil
+}
+
+func (r *Repository) Get(ctx context.Context, userID, id string) (*apprecipes.SavedRecipe, error) {
+	owner, err := parseUUID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id: %w", err)
+	}
+	recipeID, err := parseUUID(id)
+	if err != nil {
+		return nil, apprecipes.ErrRecipeNotFound
+	}
+
+	row, err := r.queries.GetRecipeByID(ctx, db.GetRecipeByIDParams{ID: recipeID, UserID: owner})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apprecipes.ErrRecipeNotFound
+		}
+		return nil, err
+	}
+	return toSavedRecipe(row)
+}
+
+func toSavedRecipe(row db.Recipe) (*apprecipes.SavedRecipe, error) {
+	saved := &apprecipes.SavedRecipe{
+		ID:        uuid.UUID(row.ID.Bytes).String(),
+		CreatedAt: row.CreatedAt.Time,
+	}
+	if err := json.Unmarshal(row.Request, &saved.Request); err != nil {
+		return nil, fmt.Errorf("decode recipe request: %w", err)
+	}
+	if err := json.Unmarshal(row.Recipe, &saved.Recipe); err != nil {
+		return nil, fmt.Errorf("decode recipe: %w", err)
+	}
+	return saved, nil
+}
+
+func parseUUID(value string) (pgtype.UUID, error) {
+	parsed, err := uuid.Parse(value)
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	return pgtype.UUID{Bytes: parsed, Valid: true}, nil
+}
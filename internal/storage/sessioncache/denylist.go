@@ -0,0 +1,83 @@
+package sessioncache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	denyPrefix        = "session:deny:"
+	denyUserPrefix    = "session:deny-user:"
+	refreshUserPrefix = "session:refresh-user:"
+)
+
+// ValkeyDenylist implements domain.SessionDenylist. Denied sessions expire
+// with the session; user marks are kept for ttl, the longest a session lives,
+// and hold the time they were set in Unix milliseconds.
+type ValkeyDenylist struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewValkeyDenylist uses client, which the caller owns and closes.
+func NewValkeyDenylist(client *redis.Client, ttl time.Duration) *ValkeyDenylist {
+	return &ValkeyDenylist{client: client, ttl: ttl}
+}
+
+func (d *ValkeyDenylist) Deny(ctx context.Context, sessionID string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return d.client.Set(ctx, denyPrefix+sessionID, "1", ttl).Err()
+}
+
+func (d *ValkeyDenylist) DenyUser(ctx context.Context, userID string, at time.Time) error {
+	return d.client.Set(ctx, denyUserPrefix+userID, at.UnixMilli(), d.ttl).Err()
+}
+
+func (d *ValkeyDenylist) RefreshUser(ctx context.Context, userID string, at time.Time) error {
+	return d.client.Set(ctx, refreshUserPrefix+userID, at.UnixMilli(), d.ttl).Err()
+}
+
+// Check reads all three entries in one round trip.
+func (d *ValkeyDenylist) Check(ctx context.Context, sessionID, userID string) (domain.SessionDenial, error) {
+	values, err := d.client.MGet(ctx, denyPrefix+sessionID, denyUserPrefix+userID, refreshUserPrefix+userID).Result()
+	if err != nil {
+		return domain.SessionDenial{}, err
+	}
+	deniedAt, err := markTime(values[1])
+	if err != nil {
+		return domain.SessionDenial{}, err
+	}
+	refreshAt, err := markTime(values[2])
+	if err != nil {
+		return domain.SessionDenial{}, err
+	}
+	return domain.SessionDenial{
+		Denied:        values[0] != nil,
+		UserDeniedAt:  deniedAt,
+		UserRefreshAt: refreshAt,
+	}, nil
+}
+
+// markTime decodes a user mark; nil is a missing key.
+func markTime(value any) (time.Time, error) {
+	if value == nil {
+		return time.Time{}, nil
+	}
+	raw, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.New("unexpected denylist value")
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
@@ -0,0 +1,122 @@
+// Package sessioncache keeps session state in Valkey: validated session rows
+// keyed by token hash, so session validation can skip Postgres while an entry
+// is fresh, and the denylist of revoked stateless sessions.
+package sessioncache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mounis-bhat/starter/internal/storage/db"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionPrefix     = "session:"
+	userPrefix        = "session:user:"
+	userRevokedPrefix = "session:user-revoked:"
+	// tombstone replaces a deleted session's entry until it expires, so a
+	// request that read the row just before the delete cannot cache it again.
+	tombstone = "-"
+)
+
+// setScript caches a row unless the session was deleted (its entry is a
+// tombstone) or all of its user's sessions were, and adds it to the user's
+// index. KEYS: entry, user index, user revoked marker. ARGV: row, ttl in
+// milliseconds, token hash, tombstone.
+var setScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 1 or redis.call('GET', KEYS[1]) == ARGV[4] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+return 1
+`)
+
+// deleteUserScript tombstones every indexed session of a user and marks the
+// user, so sessions read before the delete are not cached again. KEYS: user
+// index, user revoked marker. ARGV: session key prefix, ttl in milliseconds,
+// tombstone.
+var deleteUserScript = redis.NewScript(`
+local hashes = redis.call('SMEMBERS', KEYS[1])
+for _, hash in ipairs(hashes) do
+	redis.call('SET', ARGV[1] .. hash, ARGV[3], 'PX', ARGV[2])
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], '1', 'PX', ARGV[2])
+return #hashes
+`)
+
+// ValkeyCache implements domain.SessionCache. Deletes leave tombstones for ttl,
+// the longest any entry lives, which closes the race between a validation that
+// read the row and a revocation that removed it.
+type ValkeyCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewValkeyCache uses client, which the caller owns and closes.
+func NewValkeyCache(client *redis.Client, ttl time.Duration) *ValkeyCache {
+	return &ValkeyCache{client: client, ttl: ttl}
+}
+
+// Get returns the cached row for tokenHash. found is false on a miss and for a
+// deleted session, which the caller then looks up in Postgres.
+func (c *ValkeyCache) Get(ctx context.Context, tokenHash string) (db.GetSessionByTokenHashRow, bool, error) {
+	data, err := c.client.Get(ctx, sessionPrefix+tokenHash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return db.GetSessionByTokenHashRow{}, false, nil
+		}
+		return db.GetSessionByTokenHashRow{}, false, err
+	}
+	if string(data) == tombstone {
+		return db.GetSessionByTokenHashRow{}, false, nil
+	}
+
+	var row db.GetSessionByTokenHashRow
+	if err := json.Unmarshal(data, &row); err != nil {
+		return db.GetSessionByTokenHashRow{}, false, err
+	}
+	return row, true, nil
+}
+
+// Set caches row under tokenHash for the cache TTL.
+func (c *ValkeyCache) Set(ctx context.Context, tokenHash string, row db.GetSessionByTokenHashRow) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	userID := userKey(row.UserID)
+	keys := []string{sessionPrefix + tokenHash, userPrefix + userID, userRevokedPrefix + userID}
+	return setScript.Run(ctx, c.client, keys, data, c.ttl.Milliseconds(), tokenHash, tombstone).Err()
+}
+
+// Delete drops the entries for tokenHashes.
+func (c *ValkeyCache) Delete(ctx context.Context, tokenHashes ...string) error {
+	if len(tokenHashes) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
+	for _, tokenHash := range tokenHashes {
+		pipe.Set(ctx, sessionPrefix+tokenHash, tombstone, c.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// DeleteUser drops the entries for every session of userID.
+func (c *ValkeyCache) DeleteUser(ctx context.Context, userID pgtype.UUID) error {
+	id := userKey(userID)
+	keys := []string{userPrefix + id, userRevokedPrefix + id}
+	return deleteUserScript.Run(ctx, c.client, keys, sessionPrefix, c.ttl.Milliseconds(), tombstone).Err()
+}
+
+func userKey(id pgtype.UUID) string {
+	return uuid.UUID(id.Bytes).String()
+}
@@ -3,11 +3,15 @@ package storage
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/mounis-bhat/starter/internal/logging"
 	"github.com/mounis-bhat/starter/internal/storage/db"
 )
 
@@ -16,18 +20,34 @@ type Store struct {
 	Queries *db.Queries
 }
 
-func New(ctx context.Context, cfg config.DatabaseConfig) (*Store, error) {
-	pool, err := pgxpool.New(ctx, cfg.ConnectionString())
+// Delays between startup connection attempts; each retry doubles the last.
+const (
+	connectRetryInitialDelay = 500 * time.Millisecond
+	connectRetryMaxDelay     = 5 * time.Second
+)
+
+func New(ctx context.Context, cfg config.DatabaseConfig, logger *slog.Logger) (*Store, error) {
+	poolConfig, err := newPoolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
 
-	if err := pool.Ping(ctx); err != nil {
+	if err := pingWithRetry(ctx, pool, cfg, logger); err != nil {
 		pool.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
 	}
 
-	if err := ensureMigrationsApplied(ctx, pool); err != nil {
+	if cfg.AutoMigrate {
+		err = applyMigrations(ctx, pool, logger)
+	} else {
+		err = ensureMigrationsApplied(ctx, pool)
+	}
+	if err != nil {
 		pool.Close()
 		return nil, err
 	}
@@ -38,6 +58,72 @@ func New(ctx context.Context, cfg config.DatabaseConfig) (*Store, error) {
 	}, nil
 }
 
+// newPoolConfig applies pool tuning on top of the connection string. Zero values keep pgxpool defaults.
+func newPoolConfig(cfg config.DatabaseConfig) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.ConnectionString())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	if cfg.MaxConns < 0 || cfg.MinConns < 0 {
+		return nil, fmt.Errorf("database pool connection limits must not be negative")
+	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if poolConfig.MinConns > poolConfig.MaxConns {
+		return nil, fmt.Errorf("database pool min conns (%d) exceeds max conns (%d)", poolConfig.MinConns, poolConfig.MaxConns)
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+
+	return poolConfig, nil
+}
+
+// pingWithRetry waits for the database at startup, so a deploy that starts the
+// app before Postgres is ready does not crash-loop. It pings up to
+// cfg.ConnectAttempts times with growing delays and gives up early once
+// cfg.ConnectTimeout has passed.
+func pingWithRetry(ctx context.Context, pool *pgxpool.Pool, cfg config.DatabaseConfig, logger *slog.Logger) error {
+	attempts := max(cfg.ConnectAttempts, 1)
+	if cfg.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout)
+		defer cancel()
+	}
+
+	delay := connectRetryInitialDelay
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return fmt.Errorf("failed to ping database after %d attempts: %w", attempt, err)
+		}
+
+		logger.Warn("database not ready, retrying",
+			slog.Int("attempt", attempt),
+			slog.Int("max_attempts", attempts),
+			slog.Duration("retry_in", delay),
+			logging.Err(err),
+		)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to ping database after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, connectRetryMaxDelay)
+	}
+}
+
 func ensureMigrationsApplied(ctx context.Context, pool *pgxpool.Pool) error {
 	if skipMigrationCheck() {
 		return nil
@@ -94,3 +180,25 @@ func (s *Store) Close() {
 func (s *Store) Pool() *pgxpool.Pool {
 	return s.pool
 }
+
+// Querier returns the pool-bound queries as an interface, for consumers that
+// accept fakes.
+func (s *Store) Querier() db.Querier {
+	return s.Queries
+}
+
+// WithTx runs fn with queries bound to a transaction, committing if fn returns
+// nil and rolling back otherwise.
+func (s *Store) WithTx(ctx context.Context, fn func(q db.Querier) error) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		return fn(s.Queries.WithTx(tx))
+	})
+}
+
+// Stats reports connection pool usage (acquired, idle, and total connections).
+func (s *Store) Stats() *pgxpool.Stat {
+	if s.pool == nil {
+		return nil
+	}
+	return s.pool.Stat()
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/mounis-bhat/starter/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Timeouts for Valkey connections. Rate limiting, session validation and recipe
+// generation all wait on Valkey, so a stalled server fails the command quickly
+// instead of holding the request; connections are redialed on demand once it
+// is back.
+const (
+	valkeyDialTimeout  = 2 * time.Second
+	valkeyReadTimeout  = 500 * time.Millisecond
+	valkeyWriteTimeout = 500 * time.Millisecond
+)
+
+// NewValkeyClient returns the one client every Valkey-backed component shares:
+// the rate limiters, OAuth state store, session cache, JWT denylist and recipe
+// cache. It connects lazily, so nothing is dialed until the first command, and
+// VALKEY_POOL_SIZE caps the connections of all of them together. The caller
+// closes it after the components are done.
+func NewValkeyClient(cfg config.ValkeyConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr(),
+		Password:     cfg.Password,
+		DialTimeout:  valkeyDialTimeout,
+		ReadTimeout:  valkeyReadTimeout,
+		WriteTimeout: valkeyWriteTimeout,
+		PoolSize:     cfg.PoolSize,
+	})
+}
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sessions
+    ADD COLUMN session_type VARCHAR(20) NOT NULL DEFAULT 'interactive'
+        CHECK (session_type IN ('interactive', 'service'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS session_type;
+-- +goose StatementEnd
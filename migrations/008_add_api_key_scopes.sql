@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE api_keys ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
+
+-- Keys issued before scopes existed could only reach the recipe endpoints.
+UPDATE api_keys SET scopes = '{recipes:generate}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE api_keys DROP COLUMN IF EXISTS scopes;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX idx_sessions_last_active_at ON sessions (last_active_at);
+CREATE INDEX idx_audit_logs_event_type_created_at ON audit_logs (event_type, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_audit_logs_event_type_created_at;
+DROP INDEX IF EXISTS idx_sessions_last_active_at;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+// Package migrations embeds the goose SQL migrations so the server can apply
+// them at startup (AUTO_MIGRATE=true) without the files on disk. goose ignores
+// this file because its name has no version prefix.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -690,7 +690,7 @@ export interface paths {
                         [name: string]: unknown;
                     };
                     content: {
-                        "application/json": components["schemas"]["api.AuthStatusResponse"];
+                        "application/json": components["schemas"]["api.RegisterResponse"];
                     };
                 };
                 /** @description Bad Request */
@@ -752,7 +752,7 @@ export interface paths {
                         [name: string]: unknown;
                     };
                     content: {
-                        "application/json": components["schemas"]["api.AuthStatusResponse"];
+                        "application/json": components["schemas"]["api.VerifyEmailResponse"];
                     };
                 };
                 /** @description Bad Request */
@@ -1086,6 +1086,22 @@ export interface components {
             /** @example verysecurepassword */
             password: string;
         };
+        /** @description Registration response */
+        "api.RegisterResponse": {
+            /** @example false */
+            email_verified?: boolean;
+            /** @example ok */
+            status?: string;
+            /** @example true */
+            verification_email_sent?: boolean;
+        };
+        /** @description Verify email response */
+        "api.VerifyEmailResponse": {
+            /** @example /welcome */
+            redirect?: string;
+            /** @example ok */
+            status?: string;
+        };
     };
     responses: never;
     parameters: never;
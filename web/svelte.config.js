@@ -4,7 +4,10 @@ import adapter from '@sveltejs/adapter-static';
 const config = {
 	kit: {
 		adapter: adapter({
-			fallback: 'index.html'
+			fallback: 'index.html',
+			// Emit .br and .gz copies of each asset; the Go server serves them to
+			// clients that accept the encoding.
+			precompress: true
 		})
 	}
 };